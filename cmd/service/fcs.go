@@ -46,12 +46,25 @@ import (
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler"
+	"github.com/czcorpus/mquery-sru/handler/admin"
+	"github.com/czcorpus/mquery-sru/handler/batch"
+	"github.com/czcorpus/mquery-sru/handler/collocs"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	"github.com/czcorpus/mquery-sru/handler/form"
+	"github.com/czcorpus/mquery-sru/handler/forms"
+	"github.com/czcorpus/mquery-sru/handler/parse"
+	"github.com/czcorpus/mquery-sru/handler/position"
 	"github.com/czcorpus/mquery-sru/monitoring"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/worker"
 )
 
+const (
+	// shutdownTimeout specifies how long the server waits for
+	// in-flight requests to finish once a shutdown is requested
+	shutdownTimeout = 10 * time.Second
+)
+
 var (
 	version   string
 	buildDate string
@@ -85,6 +98,49 @@ func watchdogIdentificationMiddleware(WatchdogReqFilterConf *cnf.WatchdogReqFilt
 	}
 }
 
+// waitForReadiness checks that Redis is available and at least one
+// worker is registered and then marks the server as ready.
+// If Redis is not available within the configured grace period,
+// the server is terminated. Missing workers are only reported
+// as we still expect them to be started eventually.
+func waitForReadiness(
+	ctx context.Context,
+	conf *cnf.Conf,
+	radapter *rdb.Adapter,
+	gate *handler.ReadinessGate,
+) {
+	gracePeriod := time.Duration(conf.StartupGracePeriodSecs) * time.Second
+	t0 := time.Now()
+	if err := radapter.TestConnection(gracePeriod, 10*time.Second); err != nil {
+		log.Fatal().Err(err).Msg("failed to connect to Redis")
+	}
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+	var warned bool
+	for {
+		numWorkers, err := radapter.NumWorkers()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to check registered workers")
+
+		} else if numWorkers > 0 {
+			gate.SetReady()
+			log.Info().
+				Int("numWorkers", numWorkers).
+				Msg("server is ready")
+			return
+		}
+		if !warned && time.Since(t0) > gracePeriod {
+			log.Warn().Msg("no worker registered within the startup grace period, still waiting")
+			warned = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
 func runApiServer(
 	ctx context.Context,
 	conf *cnf.Conf,
@@ -104,14 +160,57 @@ func runApiServer(
 		}
 	}
 	engine.Use(gin.Recovery())
-	engine.Use(logging.GinMiddleware())
+	requestLogger := handler.NewRequestLogger(
+		conf.LogSampling.Rate, conf.LogSampling.SlowRequestThreshold())
+	engine.Use(requestLogger.Middleware())
 	engine.Use(watchdogIdentificationMiddleware(conf.WatchdogReqFilter))
+	requestLimiter := handler.NewRequestLimiter(conf.MaxRequestURLLength, conf.MaxRequestBodySize)
+	engine.Use(requestLimiter.Middleware())
+	inFlight := handler.NewInFlightCounter()
+	engine.Use(inFlight.Middleware())
+	readinessGate := handler.NewReadinessGate()
+	// monitoring and administration must be available also during startup
+	readinessGate.Exempt("/monitoring/", "/admin/")
+	engine.Use(readinessGate.Middleware())
 	engine.NoMethod(uniresp.NoMethodHandler)
 	engine.NoRoute(uniresp.NotFoundHandler)
 
-	FCSActions := handler.NewFCSHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
+	rscSizes := common.NewResourceSizes(ctx, conf.CorporaSetup, radapter)
+	FCSActions := handler.NewFCSHandler(
+		conf.ServerInfo, conf.CorporaSetup, radapter, rscSizes, conf.Logging.Level.IsDebugMode())
+	// explain responses contain the sizes so they must be regenerated
+	rscSizes.OnUpdate(FCSActions.InvalidateResponseCache)
+	// changed sizes mean the corpora have been reindexed
+	rscSizes.OnUpdate(FCSActions.PrefetchCache().Invalidate)
 	engine.GET("/", FCSActions.FCSHandler)
 	engine.HEAD("/", FCSActions.FCSHandler)
+	engine.GET("/search.xml", FCSActions.FCSHandlerWithFormat(general.ResponseFormatXML))
+	engine.GET("/search.json", FCSActions.FCSHandlerWithFormat(general.ResponseFormatJSON))
+	// the endpoint is also available via its database path; other (single
+	// segment) paths are treated as unknown databases
+	engine.GET("/:database", FCSActions.FCSHandler)
+	engine.HEAD("/:database", FCSActions.FCSHandler)
+	requestLimiter.DelegateFCSRoutes("/", "/search.xml", "/search.json", "/:database")
+	if dbPath := conf.ServerInfo.DatabasePath(); strings.Contains(dbPath[1:], "/") {
+		engine.GET(dbPath, FCSActions.FCSHandler)
+		engine.HEAD(dbPath, FCSActions.FCSHandler)
+		requestLimiter.DelegateFCSRoutes(dbPath)
+	}
+
+	batchHandler := batch.NewBatchHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
+	engine.POST("/batch", batchHandler.Handle)
+
+	positionHandler := position.NewPositionHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
+	engine.GET("/position", positionHandler.Handle)
+
+	formsHandler := forms.NewFormsHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
+	engine.GET("/forms", formsHandler.Handle)
+
+	parseHandler := parse.NewParseHandler()
+	engine.GET("/parse", parseHandler.Handle)
+
+	collocsHandler := collocs.NewCollocationsHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
+	engine.GET("/collocations", collocsHandler.Handle)
 
 	viewHandler := handler.NewViewHandler(FCSActions, conf.AssetsURLPath)
 	engine.GET("/ui/view", viewHandler.Handle)
@@ -128,21 +227,60 @@ func runApiServer(
 	logger := monitoring.NewWorkerJobLogger(conf.TimezoneLocation())
 	logger.GoRunTimelineWriter()
 
-	monitoringActions := monitoring.NewActions(logger, conf.TimezoneLocation())
+	monitoringActions := monitoring.NewActions(logger, conf.TimezoneLocation(), radapter)
 	engine.GET("/monitoring/workers-load", monitoringActions.WorkersLoad)
+	engine.GET("/monitoring/in-flight-jobs", monitoringActions.InFlightJobs)
+	engine.GET("/monitoring/workers-suggestion", monitoringActions.WorkersSuggestion)
+
+	if adminToken := conf.GetAdminToken(); adminToken != "" {
+		adminHandler := admin.NewAdminHandler(adminToken)
+		adminHandler.RegisterCache("explain", FCSActions.ResponseCache())
+		adminHandler.RegisterCache("resourceSizes", rscSizes)
+		adminHandler.RegisterCache("prefetch", FCSActions.PrefetchCache())
+		adminGroup := engine.Group("/admin", adminHandler.AuthMiddleware())
+		adminGroup.GET("/caches", adminHandler.ListCaches)
+		adminGroup.POST("/caches/:name/flush", adminHandler.FlushCache)
+		if conf.Logging.Level.IsDebugMode() {
+			adminGroup.GET("/jobs-preview", FCSActions.JobsPreview)
+		}
+
+	} else {
+		log.Info().Msg("no admin token configured, admin endpoints disabled")
+	}
 
+	// with TLS, HTTP/2 is enabled automatically by net/http
+	engine.UseH2C = conf.HTTP2Cleartext
 	srv := &http.Server{
-		Handler:      engine,
+		Handler:      engine.Handler(),
 		Addr:         fmt.Sprintf("%s:%d", conf.ListenAddress, conf.ListenPort),
 		WriteTimeout: time.Duration(conf.ServerWriteTimeoutSecs) * time.Second,
 		ReadTimeout:  time.Duration(conf.ServerReadTimeoutSecs) * time.Second,
+		IdleTimeout:  time.Duration(conf.ServerIdleTimeoutSecs) * time.Second,
 	}
 
 	srvErrChan := make(chan error, 1)
 
 	go func() {
-		log.Info().Msgf("listening at %s:%d", conf.ListenAddress, conf.ListenPort)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		waitForReadiness(ctx, conf, radapter, readinessGate)
+		if readinessGate.IsReady() {
+			// sizes require workers so we can probe them only now
+			rscSizes.Refresh(ctx)
+		}
+	}()
+
+	go func() {
+		log.Info().
+			Bool("tls", conf.UsesTLS()).
+			Bool("h2c", conf.HTTP2Cleartext).
+			Msgf("listening at %s:%d", conf.ListenAddress, conf.ListenPort)
+		var err error
+		if conf.UsesTLS() {
+			err = srv.ListenAndServeTLS(conf.TLSCertFile, conf.TLSKeyFile)
+
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			srvErrChan <- err
 		}
 	}()
@@ -151,20 +289,42 @@ func runApiServer(
 	case err := <-srvErrChan:
 		log.Error().Err(err).Msg("Server error")
 	case <-ctx.Done():
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		numInFlight := inFlight.Active()
+		log.Info().
+			Int64("inFlightRequests", numInFlight).
+			Float64("timeoutSecs", shutdownTimeout.Seconds()).
+			Msg("shutting down the server")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 		defer cancel()
 		err := srv.Shutdown(ctx)
 		if err != nil {
 			log.Info().Err(err).Msg("Shutdown request error")
 		}
+		abandoned := inFlight.Requests()
+		for _, req := range abandoned {
+			log.Warn().
+				Str("uri", req.URI).
+				Float64("runningSecs", time.Since(req.Start).Seconds()).
+				Msg("request not finished before shutdown deadline")
+		}
+		log.Info().
+			Int64("completed", max(numInFlight-int64(len(abandoned)), 0)).
+			Int("abandoned", len(abandoned)).
+			Msg("server shutdown finished")
 	}
 }
 
 func runWorker(ctx context.Context, conf *cnf.Conf, workerID string, radapter *rdb.Adapter) {
-	log.Info().Msg("Starting MQuery-SRU worker")
+	queues, err := getWorkerQueues(conf)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to determine worker queues")
+	}
+	log.Info().Strs("queues", queues).Msg("Starting MQuery-SRU worker")
 	ch := radapter.Subscribe()
 	logger := monitoring.NewWorkerJobLogger(conf.TimezoneLocation())
-	w := worker.NewWorker(ctx, workerID, radapter, ch, logger)
+	w := worker.NewWorker(
+		ctx, workerID, queues, radapter, ch, logger,
+		conf.CorporaSetup.RegistryDir, conf.CorporaSetup.MaxRawLineLength)
 	w.Listen()
 }
 
@@ -176,6 +336,16 @@ func getWorkerID() (workerID string) {
 	return
 }
 
+// getWorkerQueues returns queues the worker takes queries from.
+// The WORKER_QUEUES env. variable (comma-separated names) has
+// precedence over the configured `redis.workerQueues`.
+func getWorkerQueues(conf *cnf.Conf) ([]string, error) {
+	if v := getEnv("WORKER_QUEUES"); v != "" {
+		return rdb.ParseWorkerQueues(v)
+	}
+	return conf.Redis.WorkerQueues, nil
+}
+
 func main() {
 	version := general.VersionInfo{
 		Version:   version,
@@ -185,8 +355,9 @@ func main() {
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "MQuery-SRU - A Manatee-open based SRU endpoint.\n\n")
-		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] server [config.json]\n\t", filepath.Base(os.Args[0]))
-		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] worker [config.json]\n\t", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] server [config.json [override.json...]]\n\t", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] worker [config.json [override.json...]]\n\t", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] selftest [config.json [override.json...]]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s translate [basic/advanced]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "%s [options] version\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
@@ -207,9 +378,14 @@ func main() {
 			fmt.Println("Unknown query type")
 			os.Exit(2)
 		}
+		return
 	}
 
-	conf := cnf.LoadConfig(flag.Arg(1))
+	var confPaths []string
+	if flag.NArg() > 1 {
+		confPaths = flag.Args()[1:]
+	}
+	conf := cnf.LoadConfig(confPaths...)
 
 	if action == "worker" {
 		if conf.Logging.Path != "" {
@@ -228,6 +404,8 @@ func main() {
 	}
 	log.Info().Msg("MQuery-SRU initialization...")
 	cnf.ValidateAndDefaults(conf)
+	general.SetStrictHTTPStatus(conf.SRUStrictHTTPStatus)
+	general.SetStrictParameters(*conf.StrictParameters)
 
 	log.Info().
 		Strs(
@@ -242,21 +420,25 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	radapter := rdb.NewAdapter(ctx, conf.Redis)
+	radapter := rdb.NewAdapter(ctx, conf.Redis, conf.MaxNumConcurrentJobs)
 
 	switch action {
 	case "server":
+		runApiServer(ctx, conf, radapter)
+	case "worker":
 		err := radapter.TestConnection(50*time.Second, 10*time.Second)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to connect to Redis")
 		}
-		runApiServer(ctx, conf, radapter)
-	case "worker":
+		runWorker(ctx, conf, getWorkerID(), radapter)
+	case "selftest":
 		err := radapter.TestConnection(50*time.Second, 10*time.Second)
 		if err != nil {
 			log.Fatal().Err(err).Msg("failed to connect to Redis")
 		}
-		runWorker(ctx, conf, getWorkerID(), radapter)
+		if !runSelfTest(ctx, conf, radapter) {
+			os.Exit(1)
+		}
 	default:
 		log.Fatal().Msgf("Unknown action %s", action)
 	}
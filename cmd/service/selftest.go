@@ -0,0 +1,125 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/parser/basic"
+	"github.com/czcorpus/mquery-sru/rdb"
+)
+
+const (
+	// selfTestDefaultQuery is a Manatee query used in case
+	// a resource does not specify its `selfTestQuery`
+	selfTestDefaultQuery = "[]"
+	selfTestMaxItems     = 1
+)
+
+func selfTestQuery(rsc *corpus.CorpusSetup) (string, error) {
+	if rsc.SelfTestQuery == "" {
+		return selfTestDefaultQuery, nil
+	}
+	ast, err := basic.ParseQuery(rsc.SelfTestQuery, rsc.PosAttrs, rsc.StructureMapping)
+	if err != nil {
+		return "", fmt.Errorf("invalid selfTestQuery: %w", err)
+	}
+	ans := ast.Generate()
+	if len(ast.Errors()) > 0 {
+		return "", fmt.Errorf("invalid selfTestQuery: %w", ast.Errors()[0])
+	}
+	return ans, nil
+}
+
+// selfTestResource runs a sample query against a resource
+// and returns the number of hits
+func selfTestResource(
+	ctx context.Context,
+	conf *cnf.Conf,
+	radapter *rdb.Adapter,
+	rsc *corpus.CorpusSetup,
+) (int, error) {
+	q, err := selfTestQuery(rsc)
+	if err != nil {
+		return 0, err
+	}
+	attrs, err := conf.CorporaSetup.Resources.GetCommonPosAttrNames(rsc.ID)
+	if err != nil {
+		return 0, err
+	}
+	// add text layer as another attr, otherwise we won't be able to parse it due to Manatee output formatting
+	attrs = append(attrs, attrs[0])
+	wait, err := radapter.PublishQuery(ctx, rdb.Query{
+		Func:  "concExample",
+		Queue: rsc.WorkerQueue,
+		Args: rdb.ConcQueryArgs{
+			CorpusPath:        conf.CorporaSetup.GetRegistryPath(rsc.ID),
+			Query:             q,
+			Attrs:             attrs,
+			MaxItems:          selfTestMaxItems,
+			MaxContext:        conf.CorporaSetup.GetDefaultContext(rsc),
+			ViewContextStruct: rsc.ViewContextStruct,
+			Encoding:          rsc.Encoding,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	res := <-wait
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.ConcSize == 0 || len(res.Lines) == 0 {
+		return 0, errors.New("no results")
+	}
+	return res.ConcSize, nil
+}
+
+// runSelfTest runs a sample query against each configured resource
+// and prints results. It returns false if any of the resources failed.
+func runSelfTest(ctx context.Context, conf *cnf.Conf, radapter *rdb.Adapter) bool {
+	numWorkers, err := radapter.NumWorkers()
+	if err != nil {
+		fmt.Printf("FAIL: %s\n", err)
+		return false
+	}
+	if numWorkers == 0 {
+		fmt.Println("FAIL: no worker registered")
+		return false
+	}
+	fmt.Printf("running self-test using %d worker(s)\n", numWorkers)
+	allOK := true
+	for _, rsc := range conf.CorporaSetup.Resources {
+		t0 := time.Now()
+		concSize, err := selfTestResource(ctx, conf, radapter, rsc)
+		if err != nil {
+			fmt.Printf("[FAIL] %s (%s): %s (%.2fs)\n", rsc.ID, rsc.PID, err, time.Since(t0).Seconds())
+			allOK = false
+
+		} else {
+			fmt.Printf("[ OK ] %s (%s): %d hits (%.2fs)\n", rsc.ID, rsc.PID, concSize, time.Since(t0).Seconds())
+		}
+	}
+	return allOK
+}
@@ -22,26 +22,69 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/query/parser/basic"
 	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
 )
 
+const replQuitCmd = ":quit"
+
+// repl reads queries from stdin and prints their translations.
+// It ends on EOF (Ctrl-D), the `:quit` command or Ctrl-C.
 func repl(translate func(string) error) {
-	reader := bufio.NewReader(os.Stdin)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// reading stdin blocks so we must read in a separate goroutine
+	// to be able to react to signals
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			input, err := reader.ReadString('\n')
+			if err != nil {
+				readErr <- err
+				return
+			}
+			lines <- input
+		}
+	}()
+
+	fmt.Printf("Enter a query to translate (%s or Ctrl-C to exit)\n", replQuitCmd)
 	for {
 		fmt.Print("> ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Error: %s, Bye.\n", err)
+		select {
+		case <-signals:
+			fmt.Println("\nBye.")
 			return
-		}
-		input = strings.TrimSpace(input)
-		if err := translate(input); err != nil {
-			fmt.Println(err)
+		case err := <-readErr:
+			if err == io.EOF {
+				fmt.Println("\nBye.")
+
+			} else {
+				fmt.Printf("Error: %v, Bye.\n", err)
+			}
+			return
+		case input := <-lines:
+			input = strings.TrimSpace(input)
+			if input == "" {
+				continue
+			}
+			if input == replQuitCmd {
+				fmt.Println("Bye.")
+				return
+			}
+			if err := translate(input); err != nil {
+				fmt.Println(err)
+			}
 		}
 	}
 }
@@ -119,6 +162,7 @@ func translateFCSQuery(input string) error {
 			TextStruct:      "doc",
 			SessionStruct:   "doc",
 		},
+		[]corpus.QueryRewriteRule{},
 	)
 
 	if err != nil {
@@ -19,25 +19,34 @@
 package cnf
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/i18n"
 	"github.com/czcorpus/mquery-sru/rdb"
 
+	"github.com/czcorpus/cnc-gokit/fs"
 	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/rs/zerolog/log"
 )
 
 const (
 	dfltServerWriteTimeoutSecs = 30
-	dfltLanguage               = "en"
-	dfltMaxNumConcurrentJobs   = 4
+	dfltServerIdleTimeoutSecs  = 120
+	dfltLanguage               = i18n.DefaultLanguage
+	dfltMaxNumConcurrentJobs   = 4 // per resource
 	dfltVertMaxNumErrors       = 100
+	dfltStartupGracePeriodSecs = 60
+	dfltMaxRequestURLLength    = 8192
+	dfltMaxRequestBodySize     = 1024 * 1024
+	dfltStrictParameters       = true
 
 	dfltTimeZone       = "Europe/Prague"
 	dfltSourcesRootDir = "."
@@ -53,9 +62,10 @@ type ServerInfo struct {
 	// ServerPort specifies an external port the service listens on.
 	ServerPort string `json:"serverPort"`
 
-	// Database speicifies a concrete "sub section" of the endpoint.
-	// TODO: not sure about this; In the documentation, it seems
-	// like it is a URL path specifying concrete resources offered.
+	// Database specifies a concrete "sub section" of the endpoint.
+	// Besides the root path (`/`), the endpoint is available also
+	// via the database path (see DatabasePath). Requests to other
+	// databases produce a diagnostic.
 	Database string `json:"database"`
 
 	// DatabaseTitle is a multi-language configuration
@@ -77,46 +87,57 @@ type ServerInfo struct {
 
 	// ExternalURLPath specifies an external path to the API on host
 	ExternalURLPath string `json:"externalUrlPath"`
+
+	// ExposeInternalErrors makes diagnostics caused by internal
+	// errors contain the original error messages. By default,
+	// the messages are only logged and diagnostics contain
+	// a correlation ID of the respective log record instead.
+	ExposeInternalErrors bool `json:"exposeInternalErrors"`
+}
+
+// DatabasePath returns a URL path (with a leading slash)
+// of the endpoint database.
+func (s *ServerInfo) DatabasePath() string {
+	return "/" + strings.Trim(s.Database, "/")
 }
 
 func (s *ServerInfo) Validate() error {
 	if s == nil {
 		return errors.New("missing serverInfo section")
 	}
-
+	errs := make([]error, 0, 3)
 	if s.ServerHost == "" {
-		return errors.New("missing configuration `serverInfo.ServerHost`")
+		errs = append(errs, errors.New("missing configuration `serverInfo.ServerHost`"))
 	}
 	if s.ServerPort == "" {
-		return errors.New("missing configuration `serverInfo.ServerPort`")
+		errs = append(errs, errors.New("missing configuration `serverInfo.ServerPort`"))
 	}
-	if s.Database == "" {
-		return errors.New("missing configuration `serverInfo.Database`")
+	if strings.Trim(s.Database, "/") == "" {
+		errs = append(errs, errors.New("missing configuration `serverInfo.Database`"))
 	}
 
 	if s.DatabaseTitle == nil {
-		return errors.New("missing configuration section `serverInfo.databaseTitle`")
-	}
-	_, ok := s.DatabaseTitle["en"]
-	if !ok {
-		return errors.New("missing required configuration for `serverInfo.databaseTitle.en`")
+		errs = append(errs, errors.New("missing configuration section `serverInfo.databaseTitle`"))
+
+	} else if _, ok := s.DatabaseTitle[i18n.DefaultLanguage]; !ok {
+		errs = append(errs, fmt.Errorf("missing required configuration for `serverInfo.databaseTitle.%s`", i18n.DefaultLanguage))
 	}
 
 	if s.DatabaseDescription != nil {
-		_, ok := s.DatabaseDescription["en"]
+		_, ok := s.DatabaseDescription[i18n.DefaultLanguage]
 		if !ok {
-			return errors.New("missing required configuration for `serverInfo.databaseDescription.en`")
+			errs = append(errs, fmt.Errorf("missing required configuration for `serverInfo.databaseDescription.%s`", i18n.DefaultLanguage))
 		}
 	}
 
 	if s.DatabaseAuthor != nil {
-		_, ok := s.DatabaseAuthor["en"]
+		_, ok := s.DatabaseAuthor[i18n.DefaultLanguage]
 		if !ok {
-			return errors.New("missing required configuration for `serverInfo.databaseAuthor.en`")
+			errs = append(errs, fmt.Errorf("missing required configuration for `serverInfo.databaseAuthor.%s`", i18n.DefaultLanguage))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 type WatchdogReqFilter struct {
@@ -127,6 +148,24 @@ type WatchdogReqFilter struct {
 	HTTPIdHeaderToken string `json:"httpIdHeaderToken"`
 }
 
+// LogSamplingConf configures sampling of per-request log records
+// to prevent log floods under heavy traffic
+type LogSamplingConf struct {
+	// Rate specifies that only 1 of Rate requests is logged.
+	// Zero or 1 means all the requests are logged.
+	Rate int `json:"rate"`
+
+	// SlowRequestSecs specifies a latency threshold above which
+	// a request is always logged (regardless of sampling).
+	// Zero means no threshold.
+	SlowRequestSecs float64 `json:"slowRequestSecs"`
+}
+
+// SlowRequestThreshold returns SlowRequestSecs as time.Duration
+func (conf *LogSamplingConf) SlowRequestThreshold() time.Duration {
+	return time.Duration(conf.SlowRequestSecs * float64(time.Second))
+}
+
 // Conf is a global configuration of the app
 type Conf struct {
 	ListenAddress          string   `json:"listenAddress"`
@@ -136,6 +175,59 @@ type Conf struct {
 	CorsAllowedOrigins     []string `json:"corsAllowedOrigins"`
 	TrustedProxies         []string `json:"trustedProxies"`
 
+	// ServerIdleTimeoutSecs specifies how long an idle keep-alive
+	// connection is kept open for a next request. Clients sending
+	// many requests (e.g. aggregators) then do not have to open
+	// a new connection for each of them.
+	ServerIdleTimeoutSecs int `json:"serverIdleTimeoutSecs"`
+
+	// TLSCertFile and TLSKeyFile enable HTTPS. In such case,
+	// HTTP/2 is negotiated with clients supporting it.
+	TLSCertFile string `json:"tlsCertFile"`
+	TLSKeyFile  string `json:"tlsKeyFile"`
+
+	// HTTP2Cleartext enables HTTP/2 without TLS (h2c) which is
+	// useful e.g. behind a reverse proxy terminating TLS. It cannot
+	// be combined with TLSCertFile and TLSKeyFile.
+	HTTP2Cleartext bool `json:"http2Cleartext"`
+
+	// SRUStrictHTTPStatus enables proper HTTP statuses (400, 422, 500)
+	// for responses with SRU diagnostics. By default, 200 is used
+	// for such responses as SRU carries errors in the response body.
+	SRUStrictHTTPStatus bool `json:"sruStrictHTTPStatus"`
+
+	// StrictParameters specifies whether unknown request parameters
+	// are reported as errors (the SRU specification requires this).
+	// If false, such parameters are ignored which may help with
+	// clients adding their own parameters (e.g. for tracking).
+	// Defaults to true.
+	StrictParameters *bool `json:"strictParameters"`
+
+	// AdminToken enables administration endpoints (`/admin/*`)
+	// which require the `Authorization: Bearer <token>` header.
+	// If empty, the watchdog token (if configured) is used instead.
+	// With no token available, the endpoints are disabled.
+	AdminToken string `json:"adminToken"`
+
+	// StartupGracePeriodSecs specifies how long the server waits
+	// for Redis and workers to become available. Until then,
+	// all requests are answered with 503 (Service Unavailable).
+	StartupGracePeriodSecs int `json:"startupGracePeriodSecs"`
+
+	// MaxNumConcurrentJobs limits number of jobs the server publishes
+	// to workers at the same time. Additional requests wait until
+	// some of the running jobs finish.
+	MaxNumConcurrentJobs int `json:"maxNumConcurrentJobs"`
+
+	// MaxRequestURLLength is a max. length of a request URL
+	// (including the query string). Longer requests are rejected
+	// before they reach query parsers.
+	MaxRequestURLLength int `json:"maxRequestURLLength"`
+
+	// MaxRequestBodySize is a max. size (in bytes) of a request body
+	// (e.g. for batch queries).
+	MaxRequestBodySize int64 `json:"maxRequestBodySize"`
+
 	// SourcesRootDir is mainly used to locate html/xml templates and other
 	// assets so we can refer them in a relative way inside the code
 	SourcesRootDir    string               `json:"sourcesRootDir"`
@@ -145,11 +237,29 @@ type Conf struct {
 	CorporaSetup      *corpus.CorporaSetup `json:"corpora"`
 	Redis             *rdb.Conf            `json:"redis"`
 	Logging           logging.LoggingConf  `json:"logging"`
+	LogSampling       *LogSamplingConf     `json:"logSampling"`
 	TimeZone          string               `json:"timeZone"`
 
 	srcPath string
 }
 
+// UsesTLS tests whether the server should serve HTTPS
+func (conf *Conf) UsesTLS() bool {
+	return conf.TLSCertFile != "" || conf.TLSKeyFile != ""
+}
+
+// GetAdminToken returns a token required by administration endpoints
+// (see AdminToken). Empty string means the endpoints are disabled.
+func (conf *Conf) GetAdminToken() string {
+	if conf.AdminToken != "" {
+		return conf.AdminToken
+	}
+	if conf.WatchdogReqFilter != nil {
+		return conf.WatchdogReqFilter.HTTPIdHeaderToken
+	}
+	return ""
+}
+
 func (conf *Conf) TimezoneLocation() *time.Location {
 	// we can ignore the error here as we always call c.Validate()
 	// first (which also tries to load the location and report possible
@@ -159,7 +269,8 @@ func (conf *Conf) TimezoneLocation() *time.Location {
 }
 
 // GetSourcePath returns an absolute path of a file
-// the config was loaded from.
+// the config was loaded from. In case multiple files
+// were merged, the first (base) one is returned.
 func (conf *Conf) GetSourcePath() string {
 	if filepath.IsAbs(conf.srcPath) {
 		return conf.srcPath
@@ -172,53 +283,154 @@ func (conf *Conf) GetSourcePath() string {
 	return filepath.Join(cwd, conf.srcPath)
 }
 
+// loadResources loads resource configurations from JSON files in `path`.
+// Unlike most of the config functions, it does not stop on the first
+// invalid file so all the problems are reported at once (joined by
+// errors.Join). Valid resources are returned along with the error.
 func loadResources(path string) ([]*corpus.CorpusSetup, error) {
 	ans := make([]*corpus.CorpusSetup, 0, 20)
 	items, err := os.ReadDir(path)
 	if err != nil {
 		return ans, fmt.Errorf("failed to list resource conf directory: %w", err)
 	}
+	errs := make([]error, 0, 5)
 	for _, item := range items {
-		fmt.Println("item: ", item.Name())
-		rawConf, err := os.ReadFile(filepath.Join(path, item.Name()))
+		itemPath := filepath.Join(path, item.Name())
+		if item.IsDir() || filepath.Ext(item.Name()) != ".json" {
+			log.Warn().
+				Str("path", itemPath).
+				Msg("skipping non-JSON item in resource conf directory")
+			continue
+		}
+		rawConf, err := os.ReadFile(itemPath)
 		if err != nil {
-			return ans, fmt.Errorf("failed to list resource conf file %s: %w", item.Name(), err)
+			errs = append(errs, fmt.Errorf("failed to read resource conf file %s: %w", itemPath, err))
+			continue
 		}
 		var cs corpus.CorpusSetup
 		err = json.Unmarshal(rawConf, &cs)
 		if err != nil {
-			return ans, fmt.Errorf("failed to parse resource conf file %s: %w", item.Name(), err)
+			errs = append(errs, fmt.Errorf("failed to parse resource conf file %s: %w", itemPath, err))
+			continue
 		}
+		cs.ConfFile = itemPath
 		ans = append(ans, &cs)
 	}
+	return ans, errors.Join(errs...)
+}
+
+// logConfErrors logs each of (possibly joined) configuration errors
+// separately and returns the number of the errors.
+func logConfErrors(err error, msg string) int {
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+
+	} else {
+		errs = []error{err}
+	}
+	for _, e := range errs {
+		log.Error().Err(e).Msg(msg)
+	}
+	return len(errs)
+}
+
+// decodeConfData decodes a raw JSON configuration object. Numbers
+// are kept as json.Number so they survive re-encoding without losing
+// precision.
+func decodeConfData(rawData []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(rawData))
+	dec.UseNumber()
+	var ans map[string]any
+	if err := dec.Decode(&ans); err != nil {
+		return nil, err
+	}
 	return ans, nil
 }
 
-func LoadConfig(path string) *Conf {
-	if path == "" {
+// findConfKey returns a key of `data` matching `key` case-insensitively
+// (the same way encoding/json matches struct fields). In case there
+// is no such key, `key` itself is returned.
+func findConfKey(data map[string]any, key string) string {
+	if _, ok := data[key]; ok {
+		return key
+	}
+	for k := range data {
+		if strings.EqualFold(k, key) {
+			return k
+		}
+	}
+	return key
+}
+
+// mergeConfData deep-merges `src` into `dst`. Nested objects are merged
+// recursively, all the other values (including arrays) from `src`
+// replace the ones in `dst`. Keys are matched case-insensitively.
+func mergeConfData(dst, src map[string]any) map[string]any {
+	for k, srcVal := range src {
+		dstKey := findConfKey(dst, k)
+		srcMap, srcIsMap := srcVal.(map[string]any)
+		dstMap, dstIsMap := dst[dstKey].(map[string]any)
+		if srcIsMap && dstIsMap {
+			dst[dstKey] = mergeConfData(dstMap, srcMap)
+
+		} else {
+			dst[dstKey] = srcVal
+		}
+	}
+	return dst
+}
+
+// LoadConfig loads configuration from one or more JSON files.
+// In case of multiple files, they are deep-merged with later
+// files overriding values from the earlier ones. This allows
+// e.g. to have a base configuration and environment specific
+// overrides.
+func LoadConfig(paths ...string) *Conf {
+	if len(paths) == 0 || paths[0] == "" {
 		log.Fatal().Msg("Cannot load config - path not specified")
 	}
-	rawData, err := os.ReadFile(path)
+	merged := make(map[string]any)
+	for _, path := range paths {
+		rawData, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", path).Msg("Cannot load config")
+		}
+		confData, err := decodeConfData(rawData)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", path).Msg("Cannot load config")
+		}
+		merged = mergeConfData(merged, confData)
+	}
+	rawData, err := json.Marshal(merged)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Cannot load config")
 	}
 	var conf Conf
-	conf.srcPath = path
+	conf.srcPath = paths[0]
 	err = json.Unmarshal(rawData, &conf)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Cannot load config")
 	}
-	if conf.CorporaSetup.ResourcesConfDir != "" {
+	if conf.CorporaSetup != nil && conf.CorporaSetup.ResourcesConfDir != "" {
 		rsrcs, err := loadResources(conf.CorporaSetup.ResourcesConfDir)
 		if err != nil {
-			log.Fatal().Err(err).Msg("Cannot load individual resource configs")
+			numErrs := logConfErrors(err, "Cannot load individual resource config")
+			log.Fatal().
+				Int("numErrors", numErrs).
+				Msg("Cannot load individual resource configs, see the errors above")
 		}
 		conf.CorporaSetup.Resources = append(conf.CorporaSetup.Resources, rsrcs...)
 	}
 	return &conf
 }
 
+// ValidateAndDefaults validates the configuration and sets default
+// values where needed. Errors of all the sections (server info, corpora
+// including individual resources, redis) are collected and reported
+// together before the process exits.
 func ValidateAndDefaults(conf *Conf) {
+	errs := make([]error, 0, 10)
 	if conf.ServerWriteTimeoutSecs == 0 {
 		conf.ServerWriteTimeoutSecs = dfltServerWriteTimeoutSecs
 		log.Warn().Msgf(
@@ -226,22 +438,112 @@ func ValidateAndDefaults(conf *Conf) {
 			dfltServerWriteTimeoutSecs,
 		)
 	}
+	if conf.ServerIdleTimeoutSecs == 0 {
+		conf.ServerIdleTimeoutSecs = dfltServerIdleTimeoutSecs
+		log.Warn().Msgf(
+			"serverIdleTimeoutSecs not specified, using default: %d",
+			dfltServerIdleTimeoutSecs,
+		)
+
+	} else if conf.ServerIdleTimeoutSecs < 0 {
+		errs = append(errs, errors.New("`serverIdleTimeoutSecs` must be positive"))
+	}
+	if conf.UsesTLS() {
+		if conf.TLSCertFile == "" || conf.TLSKeyFile == "" {
+			errs = append(errs, errors.New("both `tlsCertFile` and `tlsKeyFile` must be specified"))
+
+		} else {
+			for _, path := range []string{conf.TLSCertFile, conf.TLSKeyFile} {
+				if isFile, err := fs.IsFile(path); err != nil || !isFile {
+					errs = append(errs, fmt.Errorf("TLS file %s not found", path))
+				}
+			}
+		}
+		if conf.HTTP2Cleartext {
+			errs = append(
+				errs, errors.New("`http2Cleartext` cannot be combined with `tlsCertFile` and `tlsKeyFile`"))
+		}
+	}
+	if conf.StartupGracePeriodSecs == 0 {
+		conf.StartupGracePeriodSecs = dfltStartupGracePeriodSecs
+		log.Warn().Msgf(
+			"startupGracePeriodSecs not specified, using default: %d",
+			dfltStartupGracePeriodSecs,
+		)
+	}
+	if conf.MaxNumConcurrentJobs == 0 {
+		// a federated search publishes a job for each resource
+		// so the default limit is sized to the number of resources
+		conf.MaxNumConcurrentJobs = dfltMaxNumConcurrentJobs
+		if conf.CorporaSetup != nil && len(conf.CorporaSetup.Resources) > 1 {
+			conf.MaxNumConcurrentJobs *= len(conf.CorporaSetup.Resources)
+		}
+		log.Warn().Msgf(
+			"maxNumConcurrentJobs not specified, using default: %d",
+			conf.MaxNumConcurrentJobs,
+		)
+
+	} else if conf.MaxNumConcurrentJobs < 0 {
+		errs = append(errs, errors.New("`maxNumConcurrentJobs` must be positive"))
+	}
+	if conf.MaxRequestURLLength == 0 {
+		conf.MaxRequestURLLength = dfltMaxRequestURLLength
+		log.Warn().Msgf(
+			"maxRequestURLLength not specified, using default: %d",
+			dfltMaxRequestURLLength,
+		)
+
+	} else if conf.MaxRequestURLLength < 0 {
+		errs = append(errs, errors.New("`maxRequestURLLength` must be positive"))
+	}
+	if conf.MaxRequestBodySize == 0 {
+		conf.MaxRequestBodySize = dfltMaxRequestBodySize
+		log.Warn().Msgf(
+			"maxRequestBodySize not specified, using default: %d",
+			dfltMaxRequestBodySize,
+		)
+
+	} else if conf.MaxRequestBodySize < 0 {
+		errs = append(errs, errors.New("`maxRequestBodySize` must be positive"))
+	}
+	if conf.StrictParameters == nil {
+		strict := dfltStrictParameters
+		conf.StrictParameters = &strict
+		log.Warn().Msgf(
+			"strictParameters not specified, using default: %t",
+			dfltStrictParameters,
+		)
+	}
+	if conf.LogSampling == nil {
+		conf.LogSampling = &LogSamplingConf{Rate: 1}
+
+	} else if conf.LogSampling.Rate < 0 || conf.LogSampling.SlowRequestSecs < 0 {
+		errs = append(errs, errors.New("`logSampling` values must be positive"))
+	}
 	if err := conf.ServerInfo.Validate(); err != nil {
-		log.Fatal().Err(err).Msg("invalid configuration")
-		return
+		errs = append(errs, err)
 	}
+	corporaErr := conf.CorporaSetup.ValidateAndDefaults("corpora")
+	if corporaErr != nil {
+		errs = append(errs, corporaErr)
+	}
+	var redisErr error
+	if conf.Redis == nil {
+		redisErr = errors.New("missing configuration section `redis`")
 
-	if err := conf.CorporaSetup.ValidateAndDefaults("corpora"); err != nil {
-		log.Fatal().Err(err).Msg("invalid configuration")
-		return
+	} else {
+		redisErr = conf.Redis.Validate()
 	}
-	if err := conf.CorporaSetup.ValidateAndDefaults("corporaSetup"); err != nil {
-		log.Fatal().Err(err).Msg("invalid configuration")
-		return
+	if redisErr != nil {
+		errs = append(errs, redisErr)
 	}
-	if err := conf.Redis.Validate(); err != nil {
-		log.Fatal().Err(err).Msg("invalid configuration")
-		return
+	if corporaErr == nil && redisErr == nil {
+		if budget := conf.CorporaSetup.SearchTimeBudget(); budget > 0 &&
+			budget >= time.Duration(conf.Redis.QueryAnswerTimeoutSecs)*time.Second {
+			errs = append(
+				errs,
+				errors.New("`corpora.searchTimeBudgetSecs` must be lower than `redis.queryAnswerTimeoutSecs`"))
+		}
 	}
 	if conf.TimeZone == "" {
 		log.Warn().
@@ -249,8 +551,7 @@ func ValidateAndDefaults(conf *Conf) {
 			Msg("time zone not specified, using default")
 	}
 	if _, err := time.LoadLocation(conf.TimeZone); err != nil {
-		log.Fatal().Err(err).Msg("invalid time zone")
-		return
+		errs = append(errs, fmt.Errorf("invalid `timeZone`: %w", err))
 	}
 	if conf.SourcesRootDir == "" {
 		log.Warn().
@@ -264,4 +565,14 @@ func ValidateAndDefaults(conf *Conf) {
 			Msg("URL path of assets not set, using default (this is needed only for UI features)")
 		conf.AssetsURLPath = dfltAssetsURLPath
 	}
+	if len(errs) > 0 {
+		var numErrs int
+		for _, err := range errs {
+			numErrs += logConfErrors(err, "invalid configuration")
+		}
+		log.Fatal().
+			Str("path", conf.srcPath).
+			Int("numErrors", numErrs).
+			Msg("invalid configuration, see the errors above")
+	}
 }
@@ -0,0 +1,83 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package cnf
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustDecodeConfData(t *testing.T, data string) map[string]any {
+	ans, err := decodeConfData([]byte(data))
+	assert.NoError(t, err)
+	return ans
+}
+
+func TestMergeConfDataNested(t *testing.T) {
+	dst := mustDecodeConfData(t, `{"a": {"b": 1, "c": [1, 2]}, "d": "x"}`)
+	src := mustDecodeConfData(t, `{"a": {"c": [3]}, "e": true}`)
+	ans, err := json.Marshal(mergeConfData(dst, src))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a": {"b": 1, "c": [3]}, "d": "x", "e": true}`, string(ans))
+}
+
+func TestMergeConfDataKeepsNumberPrecision(t *testing.T) {
+	dst := mustDecodeConfData(t, `{"a": 1}`)
+	src := mustDecodeConfData(t, `{"b": 9007199254740993}`)
+	ans, err := json.Marshal(mergeConfData(dst, src))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1,"b":9007199254740993}`, string(ans))
+}
+
+func TestMergeConfDataCaseInsensitiveKeys(t *testing.T) {
+	dst := mustDecodeConfData(t, `{"listenPort": 8080, "logging": {"level": "info"}}`)
+	src := mustDecodeConfData(t, `{"ListenPort": 9090, "Logging": {"path": "/tmp/x.log"}}`)
+	ans, err := json.Marshal(mergeConfData(dst, src))
+	assert.NoError(t, err)
+	assert.JSONEq(
+		t,
+		`{"listenPort": 9090, "logging": {"level": "info", "path": "/tmp/x.log"}}`,
+		string(ans),
+	)
+}
+
+func TestLoadConfigMergesFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.json")
+	override := filepath.Join(dir, "override.json")
+	assert.NoError(t, os.WriteFile(base, []byte(`{"listenAddress": "localhost", "listenPort": 8080}`), 0644))
+	assert.NoError(t, os.WriteFile(override, []byte(`{"ListenPort": 9090}`), 0644))
+	conf := LoadConfig(base, override)
+	assert.Equal(t, "localhost", conf.ListenAddress)
+	assert.Equal(t, 9090, conf.ListenPort)
+}
+
+func TestServerInfoValidateReportsAllErrors(t *testing.T) {
+	info := &ServerInfo{ServerHost: "localhost", DatabaseAuthor: map[string]string{"cs": "autor"}}
+	err := info.Validate()
+	assert.ErrorContains(t, err, "`serverInfo.ServerPort`")
+	assert.ErrorContains(t, err, "`serverInfo.Database`")
+	assert.ErrorContains(t, err, "`serverInfo.databaseTitle`")
+	assert.ErrorContains(t, err, "`serverInfo.databaseAuthor.en`")
+	assert.NotContains(t, err.Error(), "ServerHost")
+}
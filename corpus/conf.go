@@ -21,13 +21,22 @@ package corpus
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/fs"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/i18n"
 	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/transform"
 	"github.com/rs/zerolog/log"
 )
 
@@ -44,8 +53,27 @@ const (
 	dfltMaxRecords = 50
 	dfltMaxContext = 50
 
+	dfltCollocationsWindow = 5
+
+	dfltMaxBatchSize = 10
+
+	dfltMaxFacetItems = 20
+
+	dfltQuerySuggestionsMaxJobs = 10
+
+	dfltMaxScanTerms = mango.MaxStructAttrValuesInternalLimit
+
 	dfltViewContextStruct = "s"
 
+	dfltMultiValueSep = ","
+
+	dfltMaxRawLineLength = 1024 * 1024
+
+	// MaxFuzzyDistance is the max. supported edit distance of
+	// fuzzy (approximate) word matching. Larger values would produce
+	// extremely large queries.
+	MaxFuzzyDistance = 2
+
 	// ExplainOpNumberOfRecords is a value we currently don't understand
 	// well...
 	// TODO what is this value for in the "explain" operation?
@@ -113,6 +141,52 @@ type PosAttr struct {
 	// (e.g. the `word` attribute is typically set as
 	// the default for the `text` layer)
 	IsLayerDefault bool `json:"isLayerDefault"`
+
+	// Exposed defines whether the attribute is visible to clients
+	// (explain, data views). Internal attributes (e.g. `word_lc` used
+	// for case folding) can still be used e.g. by query rewrite rules.
+	// If not specified, the attribute is exposed.
+	Exposed *bool `json:"exposed"`
+
+	// MultiValue defines whether the attribute may contain multiple
+	// values per token (Manatee's MULTIVALUE attributes, e.g. more
+	// lemmas for an ambiguous word form). Such values are returned
+	// by Manatee joined by MultiSep.
+	MultiValue bool `json:"multiValue"`
+
+	// MultiSep is a separator of individual values of a multi-value
+	// attribute (Manatee's MULTISEP, e.g. `|` for `noun|verb`). It must
+	// not contain whitespace. If not specified, Manatee's default `,`
+	// is used.
+	MultiSep string `json:"multiSep"`
+}
+
+// IsExposed tells whether the attribute is visible to clients
+func (pa PosAttr) IsExposed() bool {
+	return pa.Exposed == nil || *pa.Exposed
+}
+
+// SplitValues splits a (possibly multi-value) attribute value
+// into individual values. For single-value attributes, the value
+// is returned as is.
+func (pa PosAttr) SplitValues(v string) []string {
+	if !pa.MultiValue {
+		return []string{v}
+	}
+	sep := pa.MultiSep
+	if sep == "" {
+		sep = dfltMultiValueSep
+	}
+	ans := make([]string, 0, 2)
+	for _, item := range strings.Split(v, sep) {
+		if item != "" {
+			ans = append(ans, item)
+		}
+	}
+	if len(ans) == 0 {
+		return []string{v}
+	}
+	return ans
 }
 
 // StructureMapping provides mapping between custom
@@ -127,6 +201,138 @@ type StructureMapping struct {
 	SessionStruct   string `json:"sessionStruct"`
 }
 
+// GetStructure returns a corpus structure for a FCS-QL generic
+// structure name (e.g. `s`, `sentence`, `p`). In case the structure
+// is unknown or not mapped, an empty string is returned.
+func (sm StructureMapping) GetStructure(name string) string {
+	switch name {
+	case "sentence", "s":
+		return sm.SentenceStruct
+	case "utterance", "u":
+		return sm.UtteranceStruct
+	case "paragraph", "p":
+		return sm.ParagraphStruct
+	case "turn", "t":
+		return sm.TurnStruct
+	case "text":
+		return sm.TextStruct
+	case "session":
+		return sm.SessionStruct
+	}
+	return ""
+}
+
+// MissingStructures returns mapped structures (in form `role: structure`,
+// e.g. `sentenceStruct: s`) which are not present in `structs`
+// (typically structures defined in a corpus registry file).
+func (sm StructureMapping) MissingStructures(structs []string) []string {
+	ans := make([]string, 0, 6)
+	for _, item := range [][2]string{
+		{"sentenceStruct", sm.SentenceStruct},
+		{"utteranceStruct", sm.UtteranceStruct},
+		{"paragraphStruct", sm.ParagraphStruct},
+		{"turnStruct", sm.TurnStruct},
+		{"textStruct", sm.TextStruct},
+		{"sessionStruct", sm.SessionStruct},
+	} {
+		if item[1] != "" && !collections.SliceContains(structs, item[1]) {
+			ans = append(ans, item[0]+": "+item[1])
+		}
+	}
+	return ans
+}
+
+// Facet defines a structural attribute used to calculate
+// distribution of matches (e.g. by genre). The structure
+// is specified using FCS-QL generic names (`text`, `s`,...)
+// which are mapped via StructureMapping.
+type Facet struct {
+
+	// Name is an identifier used by clients to request the facet
+	Name string `json:"name"`
+
+	// Struct is a FCS-QL generic structure (e.g. `text`)
+	Struct string `json:"struct"`
+
+	// Attr is an attribute of the structure (e.g. `genre`)
+	Attr string `json:"attr"`
+}
+
+func (f Facet) Validate(confContext string, smapping StructureMapping) error {
+	if f.Name == "" {
+		return fmt.Errorf("missing `%s.name`", confContext)
+	}
+	if smapping.GetStructure(f.Struct) == "" {
+		return fmt.Errorf("`%s.struct` is not mapped to any corpus structure", confContext)
+	}
+	if f.Attr == "" {
+		return fmt.Errorf("missing `%s.attr`", confContext)
+	}
+	return nil
+}
+
+// QueryRewriteRule maps a canonical attribute/value pair of a FCS-QL
+// query (e.g. `pos="NOUN"`) to a resource specific one (e.g. `tag="N.*"`).
+// This allows a single query to work across corpora with different tagsets.
+type QueryRewriteRule struct {
+
+	// Attr is a FCS-QL attribute (i.e. a layer with an optional
+	// qualifier - e.g. `pos` or `ud:pos`)
+	Attr string `json:"attr"`
+
+	// Value is a canonical value (compared literally)
+	Value string `json:"value"`
+
+	// TargetAttr is a positional attribute of the corpus
+	TargetAttr string `json:"targetAttr"`
+
+	// TargetValue is a regular expression used for the TargetAttr.
+	// It is inserted into the generated CQL as is (i.e. as a quoted
+	// string) so it must not contain double quotes.
+	TargetValue string `json:"targetValue"`
+}
+
+// Matches tests whether the rule can be applied to an attribute
+// specified by `qualifier` and `layer` with `value`.
+func (rule QueryRewriteRule) Matches(qualifier, layer, value string) bool {
+	attr := layer
+	if qualifier != "" {
+		attr = qualifier + ":" + layer
+	}
+	return rule.Attr == attr && rule.Value == value
+}
+
+func (rule QueryRewriteRule) Validate(confContext string, posAttrs []PosAttr) error {
+	if rule.Attr == "" {
+		return fmt.Errorf("missing `%s.attr`", confContext)
+	}
+	layer := rule.Attr
+	if _, tmp, ok := strings.Cut(rule.Attr, ":"); ok {
+		layer = tmp
+	}
+	if layer != "word" {
+		if err := LayerType(layer).Validate(); err != nil {
+			return fmt.Errorf("invalid `%s.attr`: %w", confContext, err)
+		}
+	}
+	if rule.Value == "" {
+		return fmt.Errorf("missing `%s.value`", confContext)
+	}
+	if collections.SliceFindIndex(posAttrs, func(v PosAttr) bool { return v.Name == rule.TargetAttr }) == -1 {
+		return fmt.Errorf("`%s.targetAttr` must be one of the configured posAttrs", confContext)
+	}
+	if rule.TargetValue == "" {
+		return fmt.Errorf("missing `%s.targetValue`", confContext)
+	}
+	if strings.Contains(rule.TargetValue, "\"") {
+		return fmt.Errorf("invalid `%s.targetValue`: double quotes are not allowed", confContext)
+	}
+	if _, err := regexp.Compile(rule.TargetValue); err != nil {
+		return fmt.Errorf("invalid `%s.targetValue`: %w", confContext, err)
+	}
+	return nil
+}
+
 // CorpusSetup is a complete corpus configuration
 // (it is part of MQuery-SRU configuration)
 type CorpusSetup struct {
@@ -149,7 +355,144 @@ type CorpusSetup struct {
 	// a structure representing a sentence or a speach.
 	ViewContextStruct string `json:"viewContextStruct"`
 
+	// GlueStruct is a self-closing structure (typically `g`) marking
+	// tokens not separated by a space in the original text (e.g.
+	// punctuation). If set, the spacing is reconstructed in records
+	// and character offsets of tokens. Otherwise, a single space
+	// between tokens is assumed.
+	GlueStruct string `json:"glueStruct"`
+
 	KontextBacklinkRootURL string `json:"kontextBacklinkRootURL"`
+
+	// Encoding is a character encoding of the corpus data as defined
+	// in its registry file (e.g. `iso8859-2`). Empty value means UTF-8.
+	Encoding string `json:"encoding"`
+
+	// QueryRewriteRules contains rules applied to FCS-QL queries
+	// before they are translated to Manatee CQL.
+	QueryRewriteRules []QueryRewriteRule `json:"queryRewriteRules"`
+
+	// QueryMacros maps macro names to query fragments (e.g. `NOUN` to
+	// `[pos="N.*"]`). Users refer to macros via `$NAME` in both basic
+	// and advanced queries and macros are expanded before parsing.
+	QueryMacros map[string]string `json:"queryMacros"`
+
+	// FoldedStructAttrs maps structural attributes (e.g. `doc.author`)
+	// to their lowercase variants (e.g. `doc.author_lc`) which are used
+	// by the scan operation for case insensitive listing of values.
+	FoldedStructAttrs map[string]string `json:"foldedStructAttrs"`
+
+	// LayerOrder specifies the order of layers in the advanced
+	// data view (e.g. `["text", "pos", "lemma"]`) for consumers
+	// expecting fixed columns. Layers not listed follow in their
+	// default order. By default, layers are ordered by the first
+	// occurrence of their attributes in PosAttrs.
+	LayerOrder []LayerType `json:"layerOrder"`
+
+	// Facets defines structural attributes which can be used
+	// to obtain distribution of matches (e.g. by genre or decade)
+	Facets []Facet `json:"facets"`
+
+	// WorkerQueue is a name of a worker queue queries for the resource
+	// are sent to. This allows for isolating large (slow) resources
+	// by dedicated workers. If empty, the default queue is used.
+	WorkerQueue string `json:"workerQueue"`
+
+	// DefaultContext overrides `corpora.defaultContext` for the resource.
+	// Zero value means no override.
+	DefaultContext int `json:"defaultContext"`
+
+	// SupportsBasic specifies whether the resource can be searched
+	// using basic (CQL) queries. If not specified, basic search is supported.
+	SupportsBasic *bool `json:"supportsBasic"`
+
+	// SupportsAdvanced specifies whether the resource can be searched
+	// using advanced (FCS-QL) queries. If not specified, advanced search
+	// is supported.
+	SupportsAdvanced *bool `json:"supportsAdvanced"`
+
+	// DefaultQueryType is a query type (`cql` or `fcs`) assumed in case
+	// clients search the resource without specifying `queryType`.
+	// It must be one of the query types supported by the resource.
+	// If empty, the global default (`cql`) is used.
+	DefaultQueryType string `json:"defaultQueryType"`
+
+	// FuzzyMaxDistance enables approximate matching of words in basic
+	// queries (e.g. for historical corpora with spelling variation)
+	// and specifies max. edit distance clients can request.
+	// Zero value means the resource does not support fuzzy matching.
+	FuzzyMaxDistance int `json:"fuzzyMaxDistance"`
+
+	// MinFormFreq enables a post-filter dropping result lines whose
+	// match form occurs less than MinFormFreq times (e.g. to reduce
+	// noise caused by OCR errors). Please note that this also affects
+	// the reported number of records. Zero value disables the filter.
+	MinFormFreq int `json:"minFormFreq"`
+
+	// Transformers is a list of named transformers applied (in the
+	// specified order) to result lines before they are returned to
+	// clients (e.g. `strip-markup`, `merge-hyphenation`).
+	Transformers []string `json:"transformers"`
+
+	// NormalizationAttr is a positional attribute containing
+	// normalized (e.g. modern spelling) forms of tokens. If set,
+	// the attribute is returned as the `norm` layer in the advanced
+	// data view along with the original forms (this is mostly useful
+	// for historical corpora).
+	NormalizationAttr string `json:"normalizationAttr"`
+
+	// LastUpdated is a date (YYYY-MM-DD) of the last update
+	// of the corpus data. It is shown in the explain response.
+	LastUpdated string `json:"lastUpdated"`
+
+	// SelfTestQuery is a basic (CQL) query used by the `selftest`
+	// action to verify the resource returns results. If empty,
+	// a query matching any token is used.
+	SelfTestQuery string `json:"selfTestQuery"`
+
+	// ConfFile is a path of the file the resource configuration
+	// has been loaded from (see CorporaSetup.ResourcesConfDir).
+	// It is used to provide context for validation errors.
+	ConfFile string `json:"-"`
+}
+
+// withConfFile adds the source file of the resource configuration
+// (if known) to a validation error
+func (cs *CorpusSetup) withConfFile(err error) error {
+	if cs.ConfFile == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", cs.ConfFile, err)
+}
+
+// IsBasicSearchSupported tells whether the resource can be searched
+// using basic (CQL) queries
+func (cs *CorpusSetup) IsBasicSearchSupported() bool {
+	return cs.SupportsBasic == nil || *cs.SupportsBasic
+}
+
+// IsAdvancedSearchSupported tells whether the resource can be searched
+// using advanced (FCS-QL) queries
+func (cs *CorpusSetup) IsAdvancedSearchSupported() bool {
+	return cs.SupportsAdvanced == nil || *cs.SupportsAdvanced
+}
+
+// isStructAttrName tests whether `name` has the form `struct.attr`
+func isStructAttrName(name string) bool {
+	structName, attrName, ok := strings.Cut(name, ".")
+	return ok && structName != "" && attrName != "" && !strings.Contains(attrName, ".")
+}
+
+// GetFacetAttr returns a structural attribute (e.g. `doc.genre`)
+// of a facet with the provided name. In case there is no such
+// facet, an empty string is returned.
+func (cs *CorpusSetup) GetFacetAttr(name string) string {
+	for _, facet := range cs.Facets {
+		if facet.Name == name {
+			return cs.StructureMapping.GetStructure(facet.Struct) + "." + facet.Attr
+		}
+	}
+	return ""
 }
 
 // GetBasicSearchAttrs provides all the basic search attrs
@@ -163,33 +506,137 @@ func (cs *CorpusSetup) GetBasicSearchAttrs() []string {
 	return searchAttrs
 }
 
+// ExpandQueryMacros replaces the resource's query macros (`$NAME`)
+// in a basic or an advanced (`isAdvanced`) query by their definitions
+func (cs *CorpusSetup) ExpandQueryMacros(q string, isAdvanced bool) (string, error) {
+	return query.ExpandMacros(q, cs.QueryMacros, isAdvanced)
+}
+
+// WithNormalizationAttr returns a copy of `attrs` extended
+// by the NormalizationAttr (if configured and not already present)
+func (cs *CorpusSetup) WithNormalizationAttr(attrs []string) []string {
+	ans := make([]string, len(attrs), len(attrs)+1)
+	copy(ans, attrs)
+	if cs.NormalizationAttr != "" && !collections.SliceContains(ans, cs.NormalizationAttr) {
+		ans = append(ans, cs.NormalizationAttr)
+	}
+	return ans
+}
+
 // GetLayerDefault provides default positional
 // attribute for a specified layer.
 func (cs *CorpusSetup) GetLayerDefault(ln LayerType) PosAttr {
 	for _, item := range cs.PosAttrs {
-		if item.IsLayerDefault {
+		if item.Layer == ln && item.IsLayerDefault {
 			return item
 		}
 	}
 	return PosAttr{}
 }
 
+// GetPosAttr returns a positional attribute with the provided
+// name. If not found, an empty PosAttr is returned.
+func (cs *CorpusSetup) GetPosAttr(name string) PosAttr {
+	for _, item := range cs.PosAttrs {
+		if item.Name == name {
+			return item
+		}
+	}
+	return PosAttr{}
+}
+
+// GetLayerAttrNames returns names of the resource's attributes
+// representing the provided (canonical) layers. This allows for
+// resources using different attribute names for the same layer
+// (e.g. `lemma` vs. `l`). The text layer attribute is always
+// the first one.
+func (cs *CorpusSetup) GetLayerAttrNames(layers []LayerType) []string {
+	ans := make([]string, 0, len(layers)+1)
+	ans = append(ans, cs.GetLayerDefault(LayerTypeText).Name)
+	for _, layer := range layers {
+		if layer == LayerTypeText {
+			continue
+		}
+		if attr := cs.GetLayerDefault(layer); attr.Name != "" {
+			ans = append(ans, attr.Name)
+		}
+	}
+	return ans
+}
+
+// HasExposedAttr tells whether the resource provides an exposed
+// positional attribute (or the normalization attribute) `name`.
+func (cs *CorpusSetup) HasExposedAttr(name string) bool {
+	if name == cs.NormalizationAttr {
+		return name != ""
+	}
+	attr := cs.GetPosAttr(name)
+	return attr.Name != "" && attr.IsExposed()
+}
+
+// RestrictLayersByAttrs returns only the `layers` with their
+// attributes contained in `attrs`. The text layer is always kept
+// as it is needed to render hits. Empty `attrs` means no restriction.
+// The original slice is not modified.
+func (cs *CorpusSetup) RestrictLayersByAttrs(layers []LayerType, attrs []string) []LayerType {
+	if len(attrs) == 0 {
+		return layers
+	}
+	ans := make([]LayerType, 0, len(layers))
+	for _, layer := range layers {
+		attr := cs.GetLayerDefault(layer).Name
+		if layer == LayerTypeNorm {
+			attr = cs.NormalizationAttr
+		}
+		if layer == LayerTypeText || collections.SliceContains(attrs, attr) {
+			ans = append(ans, layer)
+		}
+	}
+	return ans
+}
+
+// OrderLayers sorts `layers` according to LayerOrder. Layers
+// not listed there are ordered by the first occurrence of their
+// attributes in PosAttrs (and the remaining ones keep their order).
+// The original slice is not modified.
+func (cs *CorpusSetup) OrderLayers(layers []LayerType) []LayerType {
+	rank := func(layer LayerType) int {
+		if i := collections.SliceFindIndex(cs.LayerOrder, func(v LayerType) bool { return v == layer }); i > -1 {
+			return i
+		}
+		if i := collections.SliceFindIndex(cs.PosAttrs, func(v PosAttr) bool { return v.Layer == layer }); i > -1 {
+			return len(cs.LayerOrder) + i
+		}
+		return len(cs.LayerOrder) + len(cs.PosAttrs)
+	}
+	ans := make([]LayerType, len(layers))
+	copy(ans, layers)
+	sort.SliceStable(ans, func(i, j int) bool { return rank(ans[i]) < rank(ans[j]) })
+	return ans
+}
+
 // GetDefinedLayers returns all the layers defined for the corpus
+// (only exposed attributes are considered)
 func (cs *CorpusSetup) GetDefinedLayers() *collections.Set[LayerType] {
 	ans := collections.NewSet[LayerType]()
 	for _, item := range cs.PosAttrs {
-		ans.Add(item.Layer)
+		if item.IsExposed() {
+			ans.Add(item.Layer)
+		}
 	}
 	return ans
 }
 
 // GetDefinedLayersAsRefString provides all the layers
 // defined for the corpus formatted as a single string
-// (this is required in SRU XML)
+// (this is required in SRU XML). Internal attributes
+// are not included.
 func (cs *CorpusSetup) GetDefinedLayersAsRefString() string {
 	ans := make([]string, 0, len(cs.PosAttrs))
 	for _, item := range cs.PosAttrs {
-		ans = append(ans, item.ID)
+		if item.IsExposed() {
+			ans = append(ans, item.ID)
+		}
 	}
 	return strings.Join(ans, " ")
 }
@@ -200,17 +647,17 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 	if ls.FullName == nil {
 		return fmt.Errorf("missing configuration section `%s.fullName`", confContext)
 	}
-	_, ok := ls.FullName["en"]
+	_, ok := ls.FullName[i18n.DefaultLanguage]
 	if !ok {
-		return fmt.Errorf("missing required configuration for `%s.fullName.en`", confContext)
+		return fmt.Errorf("missing required configuration for `%s.fullName.%s`", confContext, i18n.DefaultLanguage)
 	}
 
 	if ls.Description == nil {
 		return fmt.Errorf("missing configuration section `%s.description`", confContext)
 	}
-	_, ok = ls.Description["en"]
+	_, ok = ls.Description[i18n.DefaultLanguage]
 	if !ok {
-		return fmt.Errorf("missing required configuration for `%s.description.en`", confContext)
+		return fmt.Errorf("missing required configuration for `%s.description.%s`", confContext, i18n.DefaultLanguage)
 	}
 
 	if ls.Languages == nil {
@@ -222,9 +669,46 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 	}
 	layerDefaults := make(map[LayerType]int)
 	var basicSrchAttrs int
-	for _, attr := range ls.PosAttrs {
+	for i, attr := range ls.PosAttrs {
 		if err := attr.Layer.Validate(); err != nil {
-			return err
+			return fmt.Errorf("`%s.posAttrs` - %w", confContext, err)
+		}
+		if attr.IsBasicSearchAttr {
+			basicSrchAttrs++
+		}
+		if attr.MultiValue && attr.Layer == LayerTypeText {
+			// the text layer is used to render KWIC lines and segments
+			return fmt.Errorf(
+				"`%s.posAttrs` - attribute %s of the text layer cannot be multiValue", confContext, attr.Name)
+		}
+		if attr.MultiSep != "" && !attr.MultiValue {
+			log.Warn().
+				Str("attr", attr.Name).
+				Str("corpus", ls.ID).
+				Msg("multiSep set for a single-value attribute, ignoring")
+
+		} else if attr.MultiValue && attr.MultiSep == "" {
+			ls.PosAttrs[i].MultiSep = dfltMultiValueSep
+			log.Warn().
+				Str("attr", attr.Name).
+				Str("corpus", ls.ID).
+				Str("value", dfltMultiValueSep).
+				Msg("multiSep not set for a multi-value attribute, using default")
+
+		} else if attr.MultiValue && strings.IndexFunc(attr.MultiSep, unicode.IsSpace) > -1 {
+			// tokens (including their attributes) are separated by spaces
+			// in concordance lines so such a separator cannot be used
+			return fmt.Errorf(
+				"`%s.posAttrs` - multiSep of attribute %s cannot contain whitespace",
+				confContext, attr.Name)
+		}
+		if !attr.IsExposed() {
+			if attr.IsLayerDefault {
+				return fmt.Errorf(
+					"`%s.posAttrs` - internal (not exposed) attribute %s cannot be isLayerDefault",
+					confContext, attr.Name)
+			}
+			continue
 		}
 		_, ok := layerDefaults[attr.Layer]
 		if !ok { // we must make sure items with 0 are also set, so we can validate all the attrs
@@ -233,21 +717,146 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 		if attr.IsLayerDefault {
 			layerDefaults[attr.Layer]++
 		}
-		if attr.IsBasicSearchAttr {
-			basicSrchAttrs++
-		}
 	}
 	for layer, num := range layerDefaults {
 		if num != 1 {
 			return fmt.Errorf(
-				"invalid number of isLayerDefault items for layer %s: %d (must be 1)",
+				"`%s.posAttrs` - invalid number of isLayerDefault items for layer %s: %d (must be 1)",
+				confContext,
 				layer,
 				num,
 			)
 		}
 	}
-	if basicSrchAttrs == 0 {
-		return fmt.Errorf("no positional attributes are set to be used in basic search query")
+	// the text layer is required by FCS (and used to render KWIC lines)
+	if _, ok := layerDefaults[LayerTypeText]; !ok {
+		return fmt.Errorf("`%s.posAttrs` must define an attribute for the text layer", confContext)
+	}
+	if !ls.IsBasicSearchSupported() && !ls.IsAdvancedSearchSupported() {
+		return fmt.Errorf(
+			"`%s` must support at least one of basic and advanced search", confContext)
+	}
+	switch ls.DefaultQueryType {
+	case "":
+	case "cql":
+		if !ls.IsBasicSearchSupported() {
+			return fmt.Errorf(
+				"`%s.defaultQueryType` - the resource does not support basic search", confContext)
+		}
+	case "fcs":
+		if !ls.IsAdvancedSearchSupported() {
+			return fmt.Errorf(
+				"`%s.defaultQueryType` - the resource does not support advanced search", confContext)
+		}
+	default:
+		return fmt.Errorf(
+			"`%s.defaultQueryType` - unknown query type %s", confContext, ls.DefaultQueryType)
+	}
+	if basicSrchAttrs == 0 && ls.IsBasicSearchSupported() {
+		return fmt.Errorf(
+			"`%s.posAttrs` - no positional attributes are set to be used in basic search query", confContext)
+	}
+
+	for i, rule := range ls.QueryRewriteRules {
+		ruleCtx := fmt.Sprintf("%s.queryRewriteRules[%d]", confContext, i)
+		if err := rule.Validate(ruleCtx, ls.PosAttrs); err != nil {
+			return err
+		}
+		for _, prev := range ls.QueryRewriteRules[:i] {
+			if prev.Attr == rule.Attr && prev.Value == rule.Value {
+				return fmt.Errorf("`%s` duplicates a previous rule", ruleCtx)
+			}
+		}
+	}
+
+	for name, def := range ls.QueryMacros {
+		if !query.IsValidMacroName(name) {
+			return fmt.Errorf("`%s.queryMacros` - invalid macro name %s", confContext, name)
+		}
+		if strings.TrimSpace(def) == "" {
+			return fmt.Errorf("`%s.queryMacros.%s` - empty macro definition", confContext, name)
+		}
+		if _, err := query.ExpandMacros("$"+name, ls.QueryMacros, true); err != nil {
+			return fmt.Errorf("`%s.queryMacros.%s` - %w", confContext, name, err)
+		}
+	}
+
+	for attr, folded := range ls.FoldedStructAttrs {
+		if !isStructAttrName(attr) || !isStructAttrName(folded) {
+			return fmt.Errorf(
+				"`%s.foldedStructAttrs` must map structural attributes (e.g. `doc.author`), found %s: %s",
+				confContext, attr, folded)
+		}
+	}
+
+	for i, layer := range ls.LayerOrder {
+		if err := layer.Validate(); err != nil {
+			return fmt.Errorf("invalid `%s.layerOrder`: %w", confContext, err)
+		}
+		if !ls.GetDefinedLayers().Contains(layer) &&
+			!(layer == LayerTypeNorm && ls.NormalizationAttr != "") {
+			return fmt.Errorf(
+				"`%s.layerOrder` refers to layer %s not defined by the resource", confContext, layer)
+		}
+		if collections.SliceContains(ls.LayerOrder[:i], layer) {
+			return fmt.Errorf("`%s.layerOrder` contains duplicate layer %s", confContext, layer)
+		}
+	}
+
+	for i, facet := range ls.Facets {
+		facetCtx := fmt.Sprintf("%s.facets[%d]", confContext, i)
+		if err := facet.Validate(facetCtx, ls.StructureMapping); err != nil {
+			return err
+		}
+		for _, prev := range ls.Facets[:i] {
+			if prev.Name == facet.Name {
+				return fmt.Errorf("`%s` duplicates a previous facet name", facetCtx)
+			}
+		}
+	}
+
+	if _, err := general.GetEncoding(ls.Encoding); err != nil {
+		return fmt.Errorf("invalid `%s.encoding`: %w", confContext, err)
+	}
+
+	if ls.NormalizationAttr != "" {
+		if collections.SliceFindIndex(
+			ls.PosAttrs,
+			func(v PosAttr) bool { return v.Name == ls.NormalizationAttr },
+		) == -1 {
+			return fmt.Errorf(
+				"`%s.normalizationAttr` must be one of the configured posAttrs", confContext)
+		}
+		for _, attr := range ls.PosAttrs {
+			if attr.IsExposed() && attr.Layer == LayerTypeNorm && attr.Name != ls.NormalizationAttr {
+				return fmt.Errorf(
+					"`%s.normalizationAttr` conflicts with attribute %s of the norm layer",
+					confContext, attr.Name)
+			}
+		}
+	}
+
+	if ls.LastUpdated != "" {
+		if _, err := time.Parse(time.DateOnly, ls.LastUpdated); err != nil {
+			return fmt.Errorf("invalid `%s.lastUpdated` (use YYYY-MM-DD): %w", confContext, err)
+		}
+	}
+
+	if ls.FuzzyMaxDistance < 0 || ls.FuzzyMaxDistance > MaxFuzzyDistance {
+		return fmt.Errorf(
+			"`%s.fuzzyMaxDistance` must be between 0 and %d", confContext, MaxFuzzyDistance)
+	}
+
+	if ls.MinFormFreq < 0 {
+		return fmt.Errorf("`%s.minFormFreq` invalid value; has to be positive", confContext)
+	}
+
+	for i, name := range ls.Transformers {
+		if !transform.Exists(name) {
+			return fmt.Errorf(
+				"`%s.transformers[%d]` - unknown transformer %s (available: %s)",
+				confContext, i, name, strings.Join(transform.Names(), ", "))
+		}
 	}
 
 	if ls.ViewContextStruct == "" {
@@ -280,6 +889,34 @@ func (sr SrchResources) GetCommonLayers() []LayerType {
 	return ans.ToOrderedSlice()
 }
 
+// GetLastUpdated returns the latest LastUpdated date
+// of the resources. Empty string means no resource
+// provides the date.
+func (sr SrchResources) GetLastUpdated() string {
+	var ans string
+	for _, rsc := range sr {
+		// YYYY-MM-DD values can be compared as strings
+		if rsc.LastUpdated > ans {
+			ans = rsc.LastUpdated
+		}
+	}
+	return ans
+}
+
+// SupportsBasicSearch tells whether at least one of the resources
+// supports basic search
+func (sr SrchResources) SupportsBasicSearch() bool {
+	return collections.SliceFindIndex(
+		sr, func(v *CorpusSetup) bool { return v.IsBasicSearchSupported() }) > -1
+}
+
+// SupportsAdvancedSearch tells whether at least one of the resources
+// supports advanced search
+func (sr SrchResources) SupportsAdvancedSearch() bool {
+	return collections.SliceFindIndex(
+		sr, func(v *CorpusSetup) bool { return v.IsAdvancedSearchSupported() }) > -1
+}
+
 func (sr SrchResources) GetCorpora() []string {
 	return collections.SliceMap(sr, func(v *CorpusSetup, i int) string { return v.ID })
 }
@@ -292,7 +929,7 @@ func (sr SrchResources) GetResource(ID string) (*CorpusSetup, error) {
 	return sr[resIndex], nil
 }
 
-// GetCommonPosAttrs returns positional attributes common
+// GetCommonPosAttrs returns exposed positional attributes common
 // to provided corpora. The attribute of the text layer which
 // is set as default will be listed always first, the rest
 // is sorted alphabetically.
@@ -305,6 +942,9 @@ func (sr SrchResources) GetCommonPosAttrs(corpusNames ...string) ([]PosAttr, err
 			return nil, err
 		}
 		for _, pa := range res.PosAttrs {
+			if !pa.IsExposed() {
+				continue
+			}
 			count[pa.Name]++
 			collect[pa.Name] = pa
 		}
@@ -332,6 +972,36 @@ func (sr SrchResources) GetCommonPosAttrs(corpusNames ...string) ([]PosAttr, err
 	return ans, nil
 }
 
+// GetSupportedPosAttrs returns all the exposed positional attributes
+// of all the resources (unique by their ID). As resources may use different
+// names for the same layer, this (unlike GetCommonPosAttrs2) makes sure
+// each layer reference of a resource points to an existing item.
+func (sr SrchResources) GetSupportedPosAttrs() []PosAttr {
+	ans := make([]PosAttr, 0, 10)
+	seen := make(map[string]bool)
+	for _, res := range sr {
+		for _, pa := range res.PosAttrs {
+			if !pa.IsExposed() || seen[pa.ID] {
+				continue
+			}
+			seen[pa.ID] = true
+			ans = append(ans, pa)
+		}
+	}
+	sort.SliceStable(ans, func(i, j int) bool {
+		if ans[i].Layer != ans[j].Layer {
+			if ans[i].Layer == DefaultLayerType {
+				return true
+			}
+			if ans[j].Layer == DefaultLayerType {
+				return false
+			}
+		}
+		return strings.Compare(ans[i].ID, ans[j].ID) < 0
+	})
+	return ans
+}
+
 // GetCommonPosAttrs2 returns positional attributes common
 // to defined corpora, it can not return error like GetCommonPosAttrs
 func (sr SrchResources) GetCommonPosAttrs2() []PosAttr {
@@ -339,6 +1009,9 @@ func (sr SrchResources) GetCommonPosAttrs2() []PosAttr {
 	collect := make(map[string]PosAttr)
 	for _, res := range sr {
 		for _, pa := range res.PosAttrs {
+			if !pa.IsExposed() {
+				continue
+			}
 			count[pa.Name]++
 			collect[pa.Name] = pa
 		}
@@ -380,15 +1053,42 @@ func (sr SrchResources) GetCommonPosAttrNames(corpusName ...string) ([]string, e
 	return ans, nil
 }
 
+// GetUnknownPosAttrs returns those of `attrs` not provided
+// by any of the specified corpora (see CorpusSetup.HasExposedAttr).
+func (sr SrchResources) GetUnknownPosAttrs(attrs []string, corpusNames ...string) ([]string, error) {
+	ans := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		var found bool
+		for _, corp := range corpusNames {
+			res, err := sr.GetResource(corp)
+			if err != nil {
+				return nil, err
+			}
+			if res.HasExposedAttr(attr) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ans = append(ans, attr)
+		}
+	}
+	return ans, nil
+}
+
 // Validate validates all the corpora configurations.
+// Unlike the other validation methods, it does not stop
+// on the first invalid resource but reports errors of all
+// the resources (joined by errors.Join).
 // This should be run during server startup.
 func (sr SrchResources) Validate(confContext string) error {
+	errs := make([]error, 0, len(sr))
 	for _, corp := range sr {
 		if err := corp.Validate(fmt.Sprintf("%s[%s]", confContext, corp.ID)); err != nil {
-			return err
+			errs = append(errs, corp.withConfFile(err))
 		}
 	}
-	return nil
+	return errors.Join(errs...)
 }
 
 // GetResourceByPID
@@ -404,6 +1104,67 @@ func (sr SrchResources) GetResourceByPID(PID string) (*CorpusSetup, error) {
 
 // ---
 
+// AggregatorLimits identifies requests of a federated search
+// aggregator (by its user agent or by an identification header)
+// and defines a maximum number of records returned to it.
+type AggregatorLimits struct {
+
+	// UserAgents lists (case-insensitive) substrings of the User-Agent
+	// header identifying the aggregator.
+	UserAgents []string `json:"userAgents"`
+
+	// HTTPIdHeaderName is an optional identification header name
+	HTTPIdHeaderName string `json:"httpIdHeaderName"`
+
+	// HTTPIdHeaderToken is an identification header value
+	HTTPIdHeaderToken string `json:"httpIdHeaderToken"`
+
+	// MaximumRecords specifies max. number of records returned
+	// to the aggregator (regardless of its `maximumRecords`).
+	MaximumRecords int `json:"maximumRecords"`
+}
+
+// Matches tells whether the request comes from the aggregator
+func (al *AggregatorLimits) Matches(req *http.Request) bool {
+	if al.HTTPIdHeaderName != "" && req.Header.Get(al.HTTPIdHeaderName) == al.HTTPIdHeaderToken {
+		return true
+	}
+	userAgent := strings.ToLower(req.UserAgent())
+	for _, ua := range al.UserAgents {
+		if ua != "" && strings.Contains(userAgent, strings.ToLower(ua)) {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveMaxRecords returns a number of records to be returned
+// for a request with the requested `maximumRecords`. The second
+// return value tells whether the number has been reduced.
+// It is safe to call the method on nil value (no limits).
+func (al *AggregatorLimits) EffectiveMaxRecords(req *http.Request, maxRecords int) (int, bool) {
+	if al == nil || maxRecords <= al.MaximumRecords || !al.Matches(req) {
+		return maxRecords, false
+	}
+	return al.MaximumRecords, true
+}
+
+func (al *AggregatorLimits) Validate(confContext string) error {
+	if al.MaximumRecords <= 0 {
+		return fmt.Errorf("`%s.maximumRecords` must be a positive number", confContext)
+	}
+	if len(al.UserAgents) == 0 && al.HTTPIdHeaderName == "" {
+		return fmt.Errorf(
+			"`%s` must define at least one of userAgents and httpIdHeaderName", confContext)
+	}
+	if al.HTTPIdHeaderName != "" && al.HTTPIdHeaderToken == "" {
+		return fmt.Errorf("`%s.httpIdHeaderToken` must be set along with httpIdHeaderName", confContext)
+	}
+	return nil
+}
+
+// ---
+
 // CorporaSetup defines mquery application configuration related
 // to a corpus
 type CorporaSetup struct {
@@ -418,9 +1179,136 @@ type CorporaSetup struct {
 	// also limited by its internals to `MaxRecordsInternalLimit`
 	MaximumRecords int `json:"maximumRecords"`
 
+	// PrefetchRecords specifies number of additional records fetched
+	// (for each resource) along with the first page of a search
+	// so the following pages can be served faster. Zero value
+	// disables prefetching. The sum with `MaximumRecords` is limited
+	// to `MaxRecordsInternalLimit`.
+	PrefetchRecords int `json:"prefetchRecords"`
+
+	// RecordSchemas lists record schemas clients may request
+	// via `recordSchema` (FCS 2.0 only). The FCS resource schema
+	// must be always present. If not set, only the FCS resource
+	// schema is allowed.
+	RecordSchemas []string `json:"recordSchemas"`
+
 	// MaximumContext specifies max. number of tokens left/right from hit
 	MaximumContext int `json:"maximumContext"`
 
+	// DefaultContext specifies number of tokens of KWIC context used
+	// in case clients do not specify it (see `x-fcs-context-size`).
+	// It cannot exceed `MaximumContext`.
+	DefaultContext int `json:"defaultContext"`
+
+	// QueryNormalization enables normalization of basic queries
+	// (typographic quotes, Unicode spaces, leading/trailing whitespace)
+	// before they are parsed. This helps with queries copy-pasted
+	// from text editors.
+	QueryNormalization bool `json:"queryNormalization"`
+
+	// QuerySuggestions enables suggestions of alternative basic
+	// queries (a different letter case, a lemma) in case a search
+	// returns no results. Each suggestion is tested by an additional
+	// count-only search so only those with some hits are returned.
+	QuerySuggestions bool `json:"querySuggestions"`
+
+	// QuerySuggestionsMaxJobs limits number of the additional
+	// count-only searches (i.e. worker jobs) run to test query
+	// suggestions of a single search. The jobs are divided evenly
+	// among the suggestions.
+	QuerySuggestionsMaxJobs int `json:"querySuggestionsMaxJobs"`
+
+	// AllowUnboundedQueries disables rejection of advanced queries
+	// heuristically detected to match (almost) any token via
+	// a trivial regular expression (e.g. `[word=".*"]`)
+	AllowUnboundedQueries bool `json:"allowUnboundedQueries"`
+
+	// DeduplicateRecords enables skipping of records with the same
+	// content coming from different resources (e.g. overlapping
+	// corpora). It is applied within a single result page only
+	// so it does not affect the reported number of records.
+	DeduplicateRecords bool `json:"deduplicateRecords"`
+
+	// ClampStartRecord makes searches with `startRecord` beyond
+	// the available records return the last page (along with
+	// a diagnostic) instead of the "first record position out
+	// of range" error required by the SRU specification.
+	ClampStartRecord bool `json:"clampStartRecord"`
+
+	// MaxRawLineLength is a max. length (in bytes) of a raw concordance
+	// line a worker is willing to parse. Longer lines (e.g. pathological
+	// matches with huge structures) are replaced by an error placeholder.
+	MaxRawLineLength int `json:"maxRawLineLength"`
+
+	// StreamingMinRecords enables writing searchRetrieve records
+	// to clients one by one (instead of buffering the whole response)
+	// for requests with `maximumRecords` equal or greater than the value.
+	// Zero value disables streaming. Only XML responses can be streamed.
+	// Streaming reduces memory usage only, the response latency does not
+	// improve as the records are written once all the results are available.
+	StreamingMinRecords int `json:"streamingMinRecords"`
+
+	// AggregatorLimits applies a stricter limit of returned records
+	// to requests identified as coming from a (federated search)
+	// aggregator so the federated latency remains low.
+	AggregatorLimits *AggregatorLimits `json:"aggregatorLimits"`
+
+	// SearchTimeBudgetSecs specifies total time a federated search
+	// waits for results of individual resources. Once the budget is nearly
+	// exhausted, results collected so far are returned and each resource
+	// not answering in time is reported via a diagnostic. Unlike the Redis
+	// `queryAnswerTimeoutSecs`, slow resources do not fail the whole
+	// request. Zero value disables the budget.
+	SearchTimeBudgetSecs float64 `json:"searchTimeBudgetSecs"`
+
+	// SearchCacheMaxAgeSecs specifies `max-age` of the `Cache-Control`
+	// header attached to successful searchRetrieve responses. Zero value
+	// means clients must revalidate cached responses (`no-cache`) using
+	// the provided ETag.
+	SearchCacheMaxAgeSecs int `json:"searchCacheMaxAgeSecs"`
+
+	// MaximumBatchSize specifies max. number of queries
+	// in a single batch request
+	MaximumBatchSize int `json:"maximumBatchSize"`
+
+	// CollocationsTopN specifies how many collocates are returned
+	// in the (opt-in) collocations data view. Zero value disables
+	// the data view. The value is limited by `MaxCollocItemsInternalLimit`.
+	CollocationsTopN int `json:"collocationsTopN"`
+
+	// CollocationsWindow specifies number of tokens left/right from hit
+	// where collocates are searched for.
+	CollocationsWindow int `json:"collocationsWindow"`
+
+	// MaximumFacetItems specifies max. number of values returned
+	// for each requested facet. The value is limited by
+	// `MaxFreqItemsInternalLimit`.
+	MaximumFacetItems int `json:"maximumFacetItems"`
+
+	// MaximumScanTerms specifies max. number of terms returned
+	// by the scan operation (i.e. max. `maximumTerms`). The value
+	// is limited by `MaxStructAttrValuesInternalLimit`.
+	MaximumScanTerms int `json:"maximumScanTerms"`
+
+	// DefaultScanTerms specifies number of terms returned by the scan
+	// operation in case clients do not specify `maximumTerms`.
+	// It must not be greater than MaximumScanTerms.
+	DefaultScanTerms int `json:"defaultScanTerms"`
+
+	// MaximumEndpointResources limits number of resources listed in
+	// the endpoint description (explain) so large installations do not
+	// produce huge responses. Clients obtain the other resources using
+	// an offset (see `x-mquery-resources-offset`). Zero value means
+	// all the resources are listed.
+	MaximumEndpointResources int `json:"maximumEndpointResources"`
+
+	// FallbackLayers lists preferred layers (in order of preference)
+	// retrieved for each resource independently in case the resources
+	// have no common layer besides `text` (heterogeneous corpora). Each
+	// resource then provides all of the listed layers it defines.
+	// If empty, only the common layers are retrieved.
+	FallbackLayers []LayerType `json:"fallbackLayers"`
+
 	// Resources is a description of configured corpora/resources
 	Resources SrchResources `json:"resources"`
 
@@ -430,25 +1318,88 @@ type CorporaSetup struct {
 	// to stick with one of the two (inline solution for one or two corpora
 	// and this one for more)
 	ResourcesConfDir string `json:"resourcesConfDir"`
+
+	// AllowNoResources allows the server to start with no configured
+	// resources (e.g. when resources are deployed later). In such case,
+	// only a warning is logged. Otherwise, missing resources are treated
+	// as a configuration error.
+	AllowNoResources bool `json:"allowNoResources"`
 }
 
+// GetRegistryPath returns a path of the corpus registry file. The path
+// is not validated here - resource IDs are validated once the configuration
+// is loaded and workers reject paths outside of their registry directory
+// at query time (see ValidateRegistryPath).
 func (cs *CorporaSetup) GetRegistryPath(corpusID string) string {
 	return filepath.Join(cs.RegistryDir, corpusID)
 }
 
+// ValidateRegistryPath tests whether a corpus registry `path`
+// is located within the `registryDir` (e.g. to prevent resource IDs
+// like `../../etc/passwd` from escaping the directory). The test is
+// lexical only, i.e. symbolic links within the directory are allowed.
+func ValidateRegistryPath(registryDir, path string) error {
+	rel, err := filepath.Rel(filepath.Clean(registryDir), filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("registry path %s is outside of the registry directory", path)
+	}
+	return nil
+}
+
+// ResourceLayers returns layers to be retrieved for a resource in a search
+// involving resources with `commonLayers`. In case there is no common layer
+// besides `text`, the resource's own layers listed in FallbackLayers are used
+// so each resource provides its richest available annotation.
+func (cs *CorporaSetup) ResourceLayers(rsc *CorpusSetup, commonLayers []LayerType) []LayerType {
+	if len(cs.FallbackLayers) == 0 || collections.SliceFindIndex(
+		commonLayers, func(v LayerType) bool { return v != LayerTypeText }) > -1 {
+		return commonLayers
+	}
+	defined := rsc.GetDefinedLayers()
+	ans := []LayerType{LayerTypeText}
+	for _, layer := range cs.FallbackLayers {
+		if layer != LayerTypeText && defined.Contains(layer) && !collections.SliceContains(ans, layer) {
+			ans = append(ans, layer)
+		}
+	}
+	return ans
+}
+
+// ValidateAndDefaults validates the section and all the resources
+// and sets default values where needed. Errors of the general settings
+// and errors of individual resources are reported together (joined
+// by errors.Join) so all the problems can be fixed at once.
 func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 	if cs == nil {
 		return fmt.Errorf("missing configuration section `%s`", confContext)
 	}
-	if cs.RegistryDir == "" {
-		return fmt.Errorf("missing `%s.registryDir`", confContext)
+	errs := make([]error, 0, len(cs.Resources)+1)
+	if err := cs.validateGeneral(confContext); err != nil {
+		errs = append(errs, err)
 	}
-	isDir, err := fs.IsDir(cs.RegistryDir)
-	if err != nil {
-		return fmt.Errorf("failed to test `%s.registryDir`: %w", confContext, err)
+	for _, rsc := range cs.Resources {
+		rscContext := fmt.Sprintf("%s.resources[%s]", confContext, rsc.ID)
+		if err := cs.validateResource(rscContext, rsc); err != nil {
+			errs = append(errs, rsc.withConfFile(err))
+		}
 	}
-	if !isDir {
-		return fmt.Errorf("`%s.registryDir` is not a directory", confContext)
+	return errors.Join(errs...)
+}
+
+// validateGeneral validates settings of the section (i.e. not
+// of individual resources). All the errors found are returned
+// (joined by errors.Join).
+func (cs *CorporaSetup) validateGeneral(confContext string) error {
+	errs := make([]error, 0, 5)
+	if cs.RegistryDir == "" {
+		errs = append(errs, fmt.Errorf("missing `%s.registryDir`", confContext))
+
+	} else if isDir, err := fs.IsDir(cs.RegistryDir); err != nil {
+		errs = append(errs, fmt.Errorf("failed to test `%s.registryDir`: %w", confContext, err))
+
+	} else if !isDir {
+		errs = append(errs, fmt.Errorf("`%s.registryDir` is not a directory", confContext))
 	}
 	if cs.MaximumRecords == 0 {
 		cs.MaximumRecords = dfltMaxRecords
@@ -457,12 +1408,57 @@ func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 			Msgf("%s.maximumRecords not set, using default", confContext)
 
 	} else if cs.MaximumRecords > mango.MaxRecordsInternalLimit {
-		return fmt.Errorf(
-			"`%s.maximumRecords must be at most %d", confContext, mango.MaxRecordsInternalLimit)
+		errs = append(errs, fmt.Errorf(
+			"`%s.maximumRecords must be at most %d", confContext, mango.MaxRecordsInternalLimit))
+	}
+
+	if len(cs.RecordSchemas) == 0 {
+		cs.RecordSchemas = []string{general.RecordSchema}
+		log.Warn().
+			Strs("value", cs.RecordSchemas).
+			Msgf("%s.recordSchemas not set, using default", confContext)
+	}
+	for _, rs := range cs.RecordSchemas {
+		if !general.IsKnownRecordSchema(rs) {
+			errs = append(errs, fmt.Errorf("`%s.recordSchemas` contains unknown schema %s", confContext, rs))
+		}
+	}
+	if !collections.SliceContains(cs.RecordSchemas, general.RecordSchema) {
+		errs = append(errs, fmt.Errorf(
+			"`%s.recordSchemas` must contain %s", confContext, general.RecordSchema))
+	}
+
+	if cs.PrefetchRecords < 0 {
+		errs = append(errs, fmt.Errorf("`%s.prefetchRecords` invalid value; has to be positive", confContext))
+
+	} else if cs.MaximumRecords+cs.PrefetchRecords > mango.MaxRecordsInternalLimit {
+		errs = append(errs, fmt.Errorf(
+			"`%s.prefetchRecords` must be at most %d (including maximumRecords)",
+			confContext, mango.MaxRecordsInternalLimit))
+	}
+
+	if cs.MaxRawLineLength == 0 {
+		cs.MaxRawLineLength = dfltMaxRawLineLength
+		log.Warn().
+			Int("value", dfltMaxRawLineLength).
+			Msgf("%s.maxRawLineLength not set, using default", confContext)
+
+	} else if cs.MaxRawLineLength < 0 {
+		errs = append(errs, fmt.Errorf("`%s.maxRawLineLength` invalid value; has to be positive", confContext))
+	}
+
+	if cs.StreamingMinRecords < 0 {
+		errs = append(errs, fmt.Errorf("`%s.streamingMinRecords` invalid value; has to be positive", confContext))
+	}
+
+	if cs.AggregatorLimits != nil {
+		if err := cs.AggregatorLimits.Validate(confContext + ".aggregatorLimits"); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
 	if cs.MaximumContext < 0 {
-		return fmt.Errorf("`%s.maximumContext` invalid value; has to be positive", confContext)
+		errs = append(errs, fmt.Errorf("`%s.maximumContext` invalid value; has to be positive", confContext))
 
 	} else if cs.MaximumContext == 0 {
 		cs.MaximumContext = dfltMaxContext
@@ -471,5 +1467,215 @@ func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 			Msgf("%s.maximumContext not set, using default", confContext)
 	}
 
-	return cs.Resources.Validate("resources")
+	if cs.DefaultContext < 0 {
+		errs = append(errs, fmt.Errorf("`%s.defaultContext` invalid value; has to be positive", confContext))
+
+	} else if cs.DefaultContext == 0 {
+		cs.DefaultContext = cs.MaximumContext
+		log.Warn().
+			Int("value", cs.DefaultContext).
+			Msgf("%s.defaultContext not set, using maximumContext", confContext)
+
+	} else if cs.DefaultContext > cs.MaximumContext {
+		errs = append(errs, fmt.Errorf(
+			"`%s.defaultContext` must be at most %d (maximumContext)", confContext, cs.MaximumContext))
+	}
+
+	if cs.MaximumBatchSize < 0 {
+		errs = append(errs, fmt.Errorf("`%s.maximumBatchSize` invalid value; has to be positive", confContext))
+
+	} else if cs.MaximumBatchSize == 0 {
+		cs.MaximumBatchSize = dfltMaxBatchSize
+		log.Warn().
+			Int("value", dfltMaxBatchSize).
+			Msgf("%s.maximumBatchSize not set, using default", confContext)
+	}
+
+	if cs.CollocationsTopN < 0 {
+		errs = append(errs, fmt.Errorf("`%s.collocationsTopN` invalid value; has to be positive", confContext))
+
+	} else if cs.CollocationsTopN > mango.MaxCollocItemsInternalLimit {
+		errs = append(errs, fmt.Errorf(
+			"`%s.collocationsTopN must be at most %d", confContext, mango.MaxCollocItemsInternalLimit))
+	}
+	if cs.CollocationsWindow < 0 {
+		errs = append(errs, fmt.Errorf("`%s.collocationsWindow` invalid value; has to be positive", confContext))
+
+	} else if cs.CollocationsWindow == 0 && cs.CollocationsTopN > 0 {
+		cs.CollocationsWindow = dfltCollocationsWindow
+		log.Warn().
+			Int("value", dfltCollocationsWindow).
+			Msgf("%s.collocationsWindow not set, using default", confContext)
+	}
+
+	if cs.MaximumFacetItems < 0 {
+		errs = append(errs, fmt.Errorf("`%s.maximumFacetItems` invalid value; has to be positive", confContext))
+
+	} else if cs.MaximumFacetItems == 0 {
+		cs.MaximumFacetItems = dfltMaxFacetItems
+		log.Warn().
+			Int("value", dfltMaxFacetItems).
+			Msgf("%s.maximumFacetItems not set, using default", confContext)
+
+	} else if cs.MaximumFacetItems > mango.MaxFreqItemsInternalLimit {
+		errs = append(errs, fmt.Errorf(
+			"`%s.maximumFacetItems must be at most %d", confContext, mango.MaxFreqItemsInternalLimit))
+	}
+
+	if cs.MaximumScanTerms < 0 {
+		errs = append(errs, fmt.Errorf("`%s.maximumScanTerms` invalid value; has to be positive", confContext))
+
+	} else if cs.MaximumScanTerms == 0 {
+		cs.MaximumScanTerms = dfltMaxScanTerms
+		log.Warn().
+			Int("value", dfltMaxScanTerms).
+			Msgf("%s.maximumScanTerms not set, using default", confContext)
+
+	} else if cs.MaximumScanTerms > mango.MaxStructAttrValuesInternalLimit {
+		errs = append(errs, fmt.Errorf(
+			"`%s.maximumScanTerms must be at most %d", confContext, mango.MaxStructAttrValuesInternalLimit))
+	}
+
+	if cs.DefaultScanTerms < 0 {
+		errs = append(errs, fmt.Errorf("`%s.defaultScanTerms` invalid value; has to be positive", confContext))
+
+	} else if cs.DefaultScanTerms == 0 {
+		cs.DefaultScanTerms = cs.MaximumScanTerms
+		log.Warn().
+			Int("value", cs.DefaultScanTerms).
+			Msgf("%s.defaultScanTerms not set, using maximumScanTerms", confContext)
+
+	} else if cs.DefaultScanTerms > cs.MaximumScanTerms {
+		errs = append(errs, fmt.Errorf(
+			"`%s.defaultScanTerms` must be at most %d (maximumScanTerms)", confContext, cs.MaximumScanTerms))
+	}
+
+	if cs.MaximumEndpointResources < 0 {
+		errs = append(errs, fmt.Errorf("`%s.maximumEndpointResources` invalid value; has to be positive", confContext))
+	}
+
+	if cs.QuerySuggestionsMaxJobs < 0 {
+		errs = append(errs, fmt.Errorf("`%s.querySuggestionsMaxJobs` invalid value; has to be positive", confContext))
+
+	} else if cs.QuerySuggestionsMaxJobs == 0 && cs.QuerySuggestions {
+		cs.QuerySuggestionsMaxJobs = dfltQuerySuggestionsMaxJobs
+		log.Warn().
+			Int("value", dfltQuerySuggestionsMaxJobs).
+			Msgf("%s.querySuggestionsMaxJobs not set, using default", confContext)
+	}
+
+	if cs.SearchTimeBudgetSecs < 0 {
+		errs = append(errs, fmt.Errorf("`%s.searchTimeBudgetSecs` invalid value; has to be positive", confContext))
+	}
+
+	if cs.SearchCacheMaxAgeSecs < 0 {
+		errs = append(errs, fmt.Errorf("`%s.searchCacheMaxAgeSecs` invalid value; has to be positive", confContext))
+	}
+
+	for _, layer := range cs.FallbackLayers {
+		if err := layer.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid `%s.fallbackLayers`: %w", confContext, err))
+		}
+	}
+
+	if len(cs.Resources) == 0 {
+		if !cs.AllowNoResources {
+			errs = append(errs, fmt.Errorf(
+				"no resources configured (check `%s.resources` and `%s.resourcesConfDir`)",
+				confContext, confContext))
+
+		} else {
+			log.Warn().
+				Str("resourcesConfDir", cs.ResourcesConfDir).
+				Msgf("no resources configured in `%s`, the server provides no data", confContext)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateResource validates a resource with respect to the section
+// settings (which is why validateGeneral should be run first).
+func (cs *CorporaSetup) validateResource(confContext string, rsc *CorpusSetup) error {
+	errs := make([]error, 0, 3)
+	if cs.RegistryDir != "" {
+		if err := ValidateRegistryPath(cs.RegistryDir, cs.GetRegistryPath(rsc.ID)); err != nil {
+			errs = append(errs, fmt.Errorf("`%s.id` is invalid: %w", confContext, err))
+
+		} else if err := cs.validateStructureMapping(confContext, rsc); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if rsc.DefaultContext < 0 || cs.MaximumContext > 0 && rsc.DefaultContext > cs.MaximumContext {
+		errs = append(errs, fmt.Errorf(
+			"`%s.defaultContext` must be between 0 and %d (maximumContext)",
+			confContext, cs.MaximumContext,
+		))
+	}
+	if err := rsc.Validate(confContext); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validateStructureMapping tests whether structures mapped by the resource's
+// structureMapping are defined in its registry file. As the registry may
+// not be available to the server (it is required by workers only),
+// a missing registry file just skips the test.
+func (cs *CorporaSetup) validateStructureMapping(confContext string, rsc *CorpusSetup) error {
+	regPath := cs.GetRegistryPath(rsc.ID)
+	structs, err := RegistryStructures(regPath)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Warn().
+			Str("resource", rsc.ID).
+			Str("registryPath", regPath).
+			Msgf("registry file not found, cannot verify `%s.structureMapping`", confContext)
+		return nil
+
+	} else if err != nil {
+		return fmt.Errorf("failed to verify `%s.structureMapping`: %w", confContext, err)
+	}
+	if missing := rsc.StructureMapping.MissingStructures(structs); len(missing) > 0 {
+		return fmt.Errorf(
+			"`%s.structureMapping` refers to structures not defined in the registry file %s (%s)",
+			confContext, regPath, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// EndpointResources returns resources listed in the endpoint
+// description starting with the resource at `offset`. In case
+// the number of listed resources is limited (see MaximumEndpointResources),
+// the offset of the following page is returned too (or -1 if there is none).
+func (cs *CorporaSetup) EndpointResources(offset int) (SrchResources, int) {
+	if offset < 0 || offset > 0 && offset >= len(cs.Resources) {
+		return SrchResources{}, -1
+	}
+	if cs.MaximumEndpointResources == 0 || offset+cs.MaximumEndpointResources >= len(cs.Resources) {
+		return cs.Resources[offset:], -1
+	}
+	next := offset + cs.MaximumEndpointResources
+	return cs.Resources[offset:next], next
+}
+
+// SearchCacheControl returns a value of the `Cache-Control` header
+// for successful searchRetrieve responses.
+func (cs *CorporaSetup) SearchCacheControl() string {
+	if cs.SearchCacheMaxAgeSecs == 0 {
+		return "no-cache"
+	}
+	return fmt.Sprintf("max-age=%d", cs.SearchCacheMaxAgeSecs)
+}
+
+// SearchTimeBudget returns SearchTimeBudgetSecs as time.Duration
+func (cs *CorporaSetup) SearchTimeBudget() time.Duration {
+	return time.Duration(cs.SearchTimeBudgetSecs * float64(time.Second))
+}
+
+// GetDefaultContext returns number of tokens of KWIC context used
+// for a resource in case clients do not specify it
+func (cs *CorporaSetup) GetDefaultContext(rsc *CorpusSetup) int {
+	if rsc.DefaultContext > 0 {
+		return rsc.DefaultContext
+	}
+	return cs.DefaultContext
 }
@@ -0,0 +1,569 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestingCorpusSetup(rules ...QueryRewriteRule) *CorpusSetup {
+	return &CorpusSetup{
+		ID:          "test",
+		FullName:    map[string]string{"en": "Test corpus"},
+		Description: map[string]string{"en": "Test corpus"},
+		Languages:   []string{"eng"},
+		PosAttrs: []PosAttr{
+			{ID: "id1", Name: "word", Layer: LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+			{ID: "id2", Name: "tag", Layer: LayerTypePOS, IsLayerDefault: true},
+		},
+		ViewContextStruct: "s",
+		QueryRewriteRules: rules,
+	}
+}
+
+func TestValidRewriteRules(t *testing.T) {
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*"},
+		QueryRewriteRule{Attr: "ud:pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*"},
+	)
+	assert.NoError(t, cs.Validate("test"))
+}
+
+func TestRewriteRuleWithInvalidLayer(t *testing.T) {
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "foo", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*"},
+	)
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestRewriteRuleWithUnknownTargetAttr(t *testing.T) {
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "k", TargetValue: "1"},
+	)
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestRewriteRuleWithInvalidRegexp(t *testing.T) {
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*("},
+	)
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestRewriteRuleWithQuoteInTargetValue(t *testing.T) {
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: `N.*"] | [word=".*`},
+	)
+	assert.ErrorContains(t, cs.Validate("test"), "double quotes")
+	cs = createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: `N\"`},
+	)
+	assert.Error(t, cs.Validate("test"))
+	cs = createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: `N[]].*`},
+	)
+	assert.NoError(t, cs.Validate("test"))
+}
+
+func TestDuplicateRewriteRules(t *testing.T) {
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*"},
+		QueryRewriteRule{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "NN.*"},
+	)
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestRewriteRuleMatches(t *testing.T) {
+	rule := QueryRewriteRule{Attr: "ud:pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*"}
+	assert.True(t, rule.Matches("ud", "pos", "NOUN"))
+	assert.False(t, rule.Matches("", "pos", "NOUN"))
+	assert.False(t, rule.Matches("ud", "pos", "VERB"))
+}
+
+func TestInternalAttrsAreHidden(t *testing.T) {
+	exposed := false
+	cs := createTestingCorpusSetup(
+		QueryRewriteRule{Attr: "word", Value: "dog", TargetAttr: "word_lc", TargetValue: "dog"},
+	)
+	cs.PosAttrs = append(
+		cs.PosAttrs,
+		PosAttr{ID: "id3", Name: "word_lc", Layer: LayerTypeText, Exposed: &exposed},
+	)
+	assert.NoError(t, cs.Validate("test"))
+	assert.Equal(t, "id1 id2", cs.GetDefinedLayersAsRefString())
+
+	sr := SrchResources{cs}
+	names, err := sr.GetCommonPosAttrNames("test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"word", "tag"}, names)
+	assert.Len(t, sr.GetCommonPosAttrs2(), 2)
+}
+
+func TestInternalAttrCannotBeLayerDefault(t *testing.T) {
+	exposed := false
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs[1].Exposed = &exposed
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestFuzzyMaxDistanceOutOfRange(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.FuzzyMaxDistance = MaxFuzzyDistance
+	assert.NoError(t, cs.Validate("test"))
+	cs.FuzzyMaxDistance = MaxFuzzyDistance + 1
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestDefaultQueryTypeValidation(t *testing.T) {
+	supported := false
+	cs := createTestingCorpusSetup()
+	cs.DefaultQueryType = "fcs"
+	assert.NoError(t, cs.Validate("test"))
+	cs.DefaultQueryType = "lex"
+	assert.Error(t, cs.Validate("test"))
+	cs.DefaultQueryType = "fcs"
+	cs.SupportsAdvanced = &supported
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestSearchCapabilities(t *testing.T) {
+	supported := false
+	cs := createTestingCorpusSetup()
+	assert.True(t, cs.IsBasicSearchSupported())
+	assert.True(t, cs.IsAdvancedSearchSupported())
+	cs.SupportsAdvanced = &supported
+	assert.NoError(t, cs.Validate("test"))
+	assert.False(t, cs.IsAdvancedSearchSupported())
+	assert.True(t, SrchResources{cs}.SupportsBasicSearch())
+	assert.False(t, SrchResources{cs}.SupportsAdvancedSearch())
+	cs.SupportsBasic = &supported
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestNormalizationAttr(t *testing.T) {
+	exposed := false
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs = append(
+		cs.PosAttrs,
+		PosAttr{ID: "id3", Name: "word_mod", Layer: LayerTypeText, Exposed: &exposed},
+	)
+	assert.Equal(t, []string{"word", "tag"}, cs.WithNormalizationAttr([]string{"word", "tag"}))
+	cs.NormalizationAttr = "word_mod"
+	assert.NoError(t, cs.Validate("test"))
+	attrs := []string{"word", "tag"}
+	assert.Equal(t, []string{"word", "tag", "word_mod"}, cs.WithNormalizationAttr(attrs))
+	assert.Equal(t, []string{"word", "tag"}, attrs)
+	assert.Equal(
+		t, []string{"word", "word_mod"}, cs.WithNormalizationAttr([]string{"word", "word_mod"}))
+	cs.NormalizationAttr = "lemma"
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestNormalizationAttrConflictsWithNormLayer(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs = append(
+		cs.PosAttrs,
+		PosAttr{ID: "id3", Name: "word_mod", Layer: LayerTypeText},
+		PosAttr{ID: "id4", Name: "word_norm", Layer: LayerTypeNorm, IsLayerDefault: true},
+	)
+	cs.NormalizationAttr = "word_norm"
+	assert.NoError(t, cs.Validate("test"))
+	cs.NormalizationAttr = "word_mod"
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestInvalidMinFormFreq(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.MinFormFreq = 3
+	assert.NoError(t, cs.Validate("test"))
+	cs.MinFormFreq = -1
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestUnknownTransformer(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.Transformers = []string{"strip-markup", "merge-hyphenation"}
+	assert.NoError(t, cs.Validate("test"))
+	cs.Transformers = []string{"strip-markup", "join-clitics"}
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestQueryMacrosValidation(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.QueryMacros = map[string]string{"NOUN": `[tag="N.*"]`, "NP": `$ADJ $NOUN`, "ADJ": `[tag="A.*"]`}
+	assert.NoError(t, cs.Validate("test"))
+	cs.QueryMacros["NP"] = `$ADJ $NP`
+	assert.Error(t, cs.Validate("test"))
+	cs.QueryMacros["NP"] = `$ADV` // not a macro reference, kept as is
+	assert.NoError(t, cs.Validate("test"))
+	cs.QueryMacros = map[string]string{"NO-UN": `[tag="N.*"]`}
+	assert.Error(t, cs.Validate("test"))
+	cs.QueryMacros = map[string]string{"NOUN": ` `}
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestGetLayerDefault(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	assert.Equal(t, "word", cs.GetLayerDefault(LayerTypeText).Name)
+	assert.Equal(t, "tag", cs.GetLayerDefault(LayerTypePOS).Name)
+	assert.Equal(t, "", cs.GetLayerDefault(LayerTypeLemma).Name)
+}
+
+func TestMissingTextLayer(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs = []PosAttr{{ID: "id2", Name: "tag", Layer: LayerTypePOS, IsLayerDefault: true}}
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestSplitMultiValues(t *testing.T) {
+	single := PosAttr{Name: "lemma"}
+	assert.Equal(t, []string{"a,b"}, single.SplitValues("a,b"))
+	multi := PosAttr{Name: "lemma", MultiValue: true}
+	assert.Equal(t, []string{"a", "b"}, multi.SplitValues("a,b"))
+	assert.Equal(t, []string{"a"}, multi.SplitValues("a,"))
+	assert.Equal(t, []string{""}, multi.SplitValues(""))
+	multi.MultiSep = "|"
+	assert.Equal(t, []string{"a,b", "c"}, multi.SplitValues("a,b|c"))
+}
+
+func TestSplitPackedValues(t *testing.T) {
+	multi := PosAttr{Name: "pos", MultiValue: true, MultiSep: "|"}
+	assert.Equal(t, []string{"noun", "verb"}, multi.SplitValues("noun|verb"))
+	assert.Equal(t, []string{"noun"}, multi.SplitValues("noun"))
+	multi.MultiSep = "||"
+	assert.Equal(t, []string{"noun", "verb|adj"}, multi.SplitValues("noun||verb|adj"))
+}
+
+func TestMultiSepValidation(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs[1].MultiValue = true
+	assert.NoError(t, cs.Validate("test"))
+	assert.Equal(t, ",", cs.PosAttrs[1].MultiSep)
+	cs.PosAttrs[1].MultiSep = "|"
+	assert.NoError(t, cs.Validate("test"))
+	assert.Equal(t, []string{"noun", "verb"}, cs.PosAttrs[1].SplitValues("noun|verb"))
+	cs.PosAttrs[1].MultiSep = " "
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestMultiValueTextLayer(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs[1].MultiValue = true
+	assert.NoError(t, cs.Validate("test"))
+	cs.PosAttrs[0].MultiValue = true
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestGetLayerAttrNamesWithAliases(t *testing.T) {
+	cs1 := createTestingCorpusSetup()
+	cs1.PosAttrs = append(cs1.PosAttrs, PosAttr{ID: "id3", Name: "lemma", Layer: LayerTypeLemma, IsLayerDefault: true})
+	cs2 := createTestingCorpusSetup()
+	cs2.ID = "test2"
+	cs2.PosAttrs = []PosAttr{
+		{ID: "id4", Name: "l", Layer: LayerTypeLemma, IsLayerDefault: true},
+		{ID: "id5", Name: "w", Layer: LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+	}
+	assert.NoError(t, cs2.Validate("test2"))
+	layers := []LayerType{LayerTypeLemma, LayerTypeText}
+	assert.Equal(t, []string{"word", "lemma"}, cs1.GetLayerAttrNames(layers))
+	assert.Equal(t, []string{"w", "l"}, cs2.GetLayerAttrNames(layers))
+
+	sr := SrchResources{cs1, cs2}
+	assert.Equal(t, []LayerType{LayerTypeLemma, LayerTypeText}, sr.GetCommonLayers())
+	ids := collections.SliceMap(sr.GetSupportedPosAttrs(), func(pa PosAttr, i int) string { return pa.ID })
+	assert.Equal(t, []string{"id1", "id5", "id2", "id3", "id4"}, ids)
+}
+
+func TestAggregatorLimitsEffectiveMaxRecords(t *testing.T) {
+	limits := &AggregatorLimits{
+		UserAgents:        []string{"FCS-Aggregator"},
+		HTTPIdHeaderName:  "X-Fcs-Client",
+		HTTPIdHeaderToken: "aggr",
+		MaximumRecords:    20,
+	}
+	req := httptest.NewRequest("GET", "/?maximumRecords=100", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	v, reduced := limits.EffectiveMaxRecords(req, 100)
+	assert.Equal(t, 100, v)
+	assert.False(t, reduced)
+
+	req.Header.Set("User-Agent", "CLARIN fcs-aggregator/2.0")
+	v, reduced = limits.EffectiveMaxRecords(req, 100)
+	assert.Equal(t, 20, v)
+	assert.True(t, reduced)
+	v, reduced = limits.EffectiveMaxRecords(req, 10)
+	assert.Equal(t, 10, v)
+	assert.False(t, reduced)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Fcs-Client", "aggr")
+	v, reduced = limits.EffectiveMaxRecords(req, 100)
+	assert.Equal(t, 20, v)
+	assert.True(t, reduced)
+
+	var noLimits *AggregatorLimits
+	v, reduced = noLimits.EffectiveMaxRecords(req, 100)
+	assert.Equal(t, 100, v)
+	assert.False(t, reduced)
+}
+
+func TestAggregatorLimitsValidate(t *testing.T) {
+	assert.Error(t, (&AggregatorLimits{UserAgents: []string{"aggr"}}).Validate("test"))
+	assert.Error(t, (&AggregatorLimits{MaximumRecords: 10}).Validate("test"))
+	assert.Error(t, (&AggregatorLimits{HTTPIdHeaderName: "X-Id", MaximumRecords: 10}).Validate("test"))
+	assert.NoError(t, (&AggregatorLimits{UserAgents: []string{"aggr"}, MaximumRecords: 10}).Validate("test"))
+}
+
+func TestNoResources(t *testing.T) {
+	cs := &CorporaSetup{RegistryDir: t.TempDir()}
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+	cs.AllowNoResources = true
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+	cs.AllowNoResources = false
+	cs.Resources = SrchResources{createTestingCorpusSetup()}
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestValidationReportsAllResources(t *testing.T) {
+	rsc1 := createTestingCorpusSetup()
+	rsc1.ID = "corp1"
+	rsc1.FullName = nil
+	rsc1.ConfFile = "/etc/mquery-sru/resources/corp1.json"
+	rsc2 := createTestingCorpusSetup()
+	rsc2.ID = "corp2"
+	rsc3 := createTestingCorpusSetup()
+	rsc3.ID = "corp3"
+	rsc3.DefaultContext = -1
+	cs := &CorporaSetup{RegistryDir: t.TempDir(), Resources: SrchResources{rsc1, rsc2, rsc3}}
+	err := cs.ValidateAndDefaults("corpora")
+	assert.ErrorContains(t, err, "/etc/mquery-sru/resources/corp1.json: ")
+	assert.ErrorContains(t, err, "`corpora.resources[corp1].fullName`")
+	assert.ErrorContains(t, err, "`corpora.resources[corp3].defaultContext`")
+	assert.NotContains(t, err.Error(), "corp2")
+}
+
+func TestGeneralValidationReportsAllErrors(t *testing.T) {
+	cs := &CorporaSetup{
+		RegistryDir:      filepath.Join(t.TempDir(), "missing"),
+		PrefetchRecords:  -1,
+		MaxRawLineLength: -1,
+		RecordSchemas:    []string{"foo"},
+	}
+	err := cs.ValidateAndDefaults("corpora")
+	assert.ErrorContains(t, err, "`corpora.registryDir`")
+	assert.ErrorContains(t, err, "`corpora.recordSchemas` contains unknown schema foo")
+	assert.ErrorContains(t, err, "`corpora.prefetchRecords`")
+	assert.ErrorContains(t, err, "`corpora.maxRawLineLength`")
+	assert.ErrorContains(t, err, "no resources configured")
+}
+
+func TestMaximumScanTermsValidation(t *testing.T) {
+	cs := &CorporaSetup{RegistryDir: t.TempDir(), AllowNoResources: true}
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+	assert.Equal(t, dfltMaxScanTerms, cs.MaximumScanTerms)
+	assert.Equal(t, cs.MaximumScanTerms, cs.DefaultScanTerms)
+	cs.MaximumScanTerms = 100000
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+	cs.MaximumScanTerms = 100
+	cs.DefaultScanTerms = 200
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+	cs.DefaultScanTerms = 50
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestQuerySuggestionsMaxJobsValidation(t *testing.T) {
+	cs := &CorporaSetup{RegistryDir: t.TempDir(), AllowNoResources: true, QuerySuggestions: true}
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+	assert.Equal(t, dfltQuerySuggestionsMaxJobs, cs.QuerySuggestionsMaxJobs)
+	cs.QuerySuggestionsMaxJobs = -1
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestSearchCacheControl(t *testing.T) {
+	cs := &CorporaSetup{RegistryDir: t.TempDir(), AllowNoResources: true}
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+	assert.Equal(t, "no-cache", cs.SearchCacheControl())
+	cs.SearchCacheMaxAgeSecs = 300
+	assert.Equal(t, "max-age=300", cs.SearchCacheControl())
+	cs.SearchCacheMaxAgeSecs = -1
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestEndpointResources(t *testing.T) {
+	cs := &CorporaSetup{
+		Resources: SrchResources{
+			&CorpusSetup{ID: "a"}, &CorpusSetup{ID: "b"}, &CorpusSetup{ID: "c"},
+		},
+	}
+	rscs, next := cs.EndpointResources(0)
+	assert.Equal(t, []string{"a", "b", "c"}, rscs.GetCorpora())
+	assert.Equal(t, -1, next)
+
+	cs.MaximumEndpointResources = 2
+	rscs, next = cs.EndpointResources(0)
+	assert.Equal(t, []string{"a", "b"}, rscs.GetCorpora())
+	assert.Equal(t, 2, next)
+	rscs, next = cs.EndpointResources(next)
+	assert.Equal(t, []string{"c"}, rscs.GetCorpora())
+	assert.Equal(t, -1, next)
+
+	rscs, _ = cs.EndpointResources(3)
+	assert.Empty(t, rscs)
+	rscs, _ = cs.EndpointResources(-1)
+	assert.Empty(t, rscs)
+}
+
+func TestFoldedStructAttrsValidation(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.FoldedStructAttrs = map[string]string{"doc.author": "doc.author_lc"}
+	assert.NoError(t, cs.Validate("test"))
+	cs.FoldedStructAttrs = map[string]string{"doc.author": "author_lc"}
+	assert.Error(t, cs.Validate("test"))
+	cs.FoldedStructAttrs = map[string]string{"doc": "doc.author_lc"}
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestValidateRegistryPath(t *testing.T) {
+	assert.NoError(t, ValidateRegistryPath("/var/registry", "/var/registry/syn2020"))
+	assert.NoError(t, ValidateRegistryPath("/var/registry/", "/var/registry/sub/syn2020"))
+	assert.Error(t, ValidateRegistryPath("/var/registry", "/var/registry"))
+	assert.Error(t, ValidateRegistryPath("/var/registry", "/var/registry/../passwd"))
+	assert.Error(t, ValidateRegistryPath("/var/registry", "/etc/passwd"))
+	assert.Error(t, ValidateRegistryPath("/var/registry", "/var/registry2/syn2020"))
+	assert.Error(t, ValidateRegistryPath("/var/registry", "syn2020"))
+}
+
+func TestStructureMappingValidation(t *testing.T) {
+	regDir := t.TempDir()
+	regFile := "PATH /var/corpora/test\nATTRIBUTE word\nSTRUCTURE doc {\n\tATTRIBUTE id\n}\nSTRUCTURE s\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "test"), []byte(regFile), 0644))
+	structs, err := RegistryStructures(filepath.Join(regDir, "test"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"doc", "s"}, structs)
+
+	rsc := createTestingCorpusSetup()
+	rsc.StructureMapping = StructureMapping{SentenceStruct: "s", TextStruct: "doc"}
+	cs := &CorporaSetup{RegistryDir: regDir, Resources: SrchResources{rsc}}
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+
+	rsc.StructureMapping.ParagraphStruct = "p"
+	err = cs.ValidateAndDefaults("corpora")
+	assert.ErrorContains(t, err, "`corpora.resources[test].structureMapping`")
+	assert.ErrorContains(t, err, "paragraphStruct: p")
+
+	// missing registry file cannot be verified
+	rsc.ID = "test2"
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestResourceIDOutsideRegistryDir(t *testing.T) {
+	rsc := createTestingCorpusSetup()
+	rsc.ID = "../../etc/passwd"
+	cs := &CorporaSetup{RegistryDir: t.TempDir(), Resources: SrchResources{rsc}}
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestResourceLayers(t *testing.T) {
+	rsc := createTestingCorpusSetup()
+	cs := &CorporaSetup{}
+	common := []LayerType{LayerTypeText}
+	assert.Equal(t, common, cs.ResourceLayers(rsc, common))
+
+	cs.FallbackLayers = []LayerType{LayerTypeLemma, LayerTypePOS}
+	assert.Equal(t, []LayerType{LayerTypeText, LayerTypePOS}, cs.ResourceLayers(rsc, common))
+
+	// with common layers, no fallback is applied
+	common = []LayerType{LayerTypeText, LayerTypeLemma}
+	assert.Equal(t, common, cs.ResourceLayers(rsc, common))
+}
+
+func TestFallbackLayersValidation(t *testing.T) {
+	cs := &CorporaSetup{
+		RegistryDir:    t.TempDir(),
+		Resources:      SrchResources{createTestingCorpusSetup()},
+		FallbackLayers: []LayerType{LayerTypeLemma, "foo"},
+	}
+	assert.Error(t, cs.ValidateAndDefaults("corpora"))
+	cs.FallbackLayers = []LayerType{LayerTypeLemma, LayerTypePOS}
+	assert.NoError(t, cs.ValidateAndDefaults("corpora"))
+}
+
+func TestOrderLayers(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.PosAttrs = append(cs.PosAttrs, PosAttr{ID: "id3", Name: "lemma", Layer: LayerTypeLemma, IsLayerDefault: true})
+	layers := []LayerType{LayerTypeLemma, LayerTypePOS, LayerTypeText, LayerTypeNorm}
+	assert.Equal(
+		t,
+		[]LayerType{LayerTypeText, LayerTypePOS, LayerTypeLemma, LayerTypeNorm},
+		cs.OrderLayers(layers),
+	)
+	assert.Equal(t, LayerTypeLemma, layers[0])
+
+	cs.LayerOrder = []LayerType{LayerTypeText, LayerTypeLemma}
+	assert.Equal(
+		t,
+		[]LayerType{LayerTypeText, LayerTypeLemma, LayerTypePOS, LayerTypeNorm},
+		cs.OrderLayers(layers),
+	)
+}
+
+func TestLayerOrderValidation(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.LayerOrder = []LayerType{LayerTypePOS, LayerTypeText}
+	assert.NoError(t, cs.Validate("test"))
+	cs.LayerOrder = []LayerType{LayerTypeLemma}
+	assert.Error(t, cs.Validate("test"))
+	cs.LayerOrder = []LayerType{LayerTypePOS, LayerTypePOS}
+	assert.Error(t, cs.Validate("test"))
+	cs.LayerOrder = []LayerType{"foo"}
+	assert.Error(t, cs.Validate("test"))
+}
+
+func TestRestrictLayersByAttrs(t *testing.T) {
+	cs := createTestingCorpusSetup()
+	cs.NormalizationAttr = "norm"
+	layers := []LayerType{LayerTypeText, LayerTypePOS, LayerTypeNorm}
+	assert.Equal(t, layers, cs.RestrictLayersByAttrs(layers, nil))
+	assert.Equal(t, []LayerType{LayerTypeText}, cs.RestrictLayersByAttrs(layers, []string{"word"}))
+	assert.Equal(
+		t,
+		[]LayerType{LayerTypeText, LayerTypeNorm},
+		cs.RestrictLayersByAttrs(layers, []string{"norm", "lemma"}),
+	)
+}
+
+func TestGetUnknownPosAttrs(t *testing.T) {
+	cs1 := createTestingCorpusSetup()
+	cs2 := createTestingCorpusSetup()
+	cs2.ID = "test2"
+	cs2.PosAttrs = append(cs2.PosAttrs, PosAttr{ID: "id3", Name: "lemma", Layer: LayerTypeLemma, IsLayerDefault: true})
+	sr := SrchResources{cs1, cs2}
+	unknown, err := sr.GetUnknownPosAttrs([]string{"word", "lemma", "foo"}, "test", "test2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, unknown)
+	unknown, err = sr.GetUnknownPosAttrs([]string{"word", "lemma"}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lemma"}, unknown)
+}
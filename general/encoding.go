@@ -0,0 +1,56 @@
+// Copyright 2023 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// IsUTF8Encoding tests whether the name represents UTF-8
+// (an empty name is considered UTF-8 too)
+func IsUTF8Encoding(name string) bool {
+	switch strings.ToLower(strings.ReplaceAll(name, "-", "")) {
+	case "", "utf8":
+		return true
+	}
+	return false
+}
+
+// GetEncoding returns an encoding based on its name. Both
+// common labels (e.g. `iso-8859-2`, `latin2`, `windows-1250`) and
+// Manatee style names (e.g. `iso8859-2`) are accepted. For UTF-8,
+// nil is returned as no transcoding is needed.
+func GetEncoding(name string) (encoding.Encoding, error) {
+	if IsUTF8Encoding(name) {
+		return nil, nil
+	}
+	normName := strings.ToLower(name)
+	if strings.HasPrefix(normName, "iso8859") {
+		normName = "iso-8859" + strings.TrimPrefix(normName, "iso8859")
+	}
+	enc, err := htmlindex.Get(normName)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported encoding %s", name)
+	}
+	return enc, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEncodingUTF8(t *testing.T) {
+	for _, name := range []string{"", "utf-8", "UTF8"} {
+		enc, err := GetEncoding(name)
+		assert.NoError(t, err)
+		assert.Nil(t, enc)
+	}
+}
+
+func TestGetEncodingManateeStyleName(t *testing.T) {
+	enc, err := GetEncoding("iso8859-2")
+	assert.NoError(t, err)
+	ans, err := enc.NewDecoder().String("\xb9\xe8")
+	assert.NoError(t, err)
+	assert.Equal(t, "šč", ans)
+}
+
+func TestGetEncodingUnsupported(t *testing.T) {
+	_, err := GetEncoding("foo-123")
+	assert.Error(t, err)
+}
@@ -20,52 +20,23 @@ package general
 
 import (
 	"fmt"
+
+	"github.com/czcorpus/mquery-sru/i18n"
 )
 
 type DiagnosticType int
 
 type DiagnosticCode int
 
-func (dc DiagnosticCode) AsMessage() string {
-	switch dc {
-	case DCGeneralSystemError:
-		return "General system error"
-	case DCSystemTemporarilyUnavailable:
-		return "System temporarily unavailable"
-	case DCAuthenticationError:
-		return "Authentication error"
-	case DCUnsupportedOperation:
-		return "Unsupported operation"
-	case DCUnsupportedVersion:
-		return "Unsupported version"
-	case DCUnsupportedParameterValue:
-		return "Unsupported parameter value"
-	case DCMandatoryParameterNotSupplied:
-		return "Mandatory parameter not supplied"
-	case DCUnsupportedParameter:
-		return "Unsupported Parameter"
-	case DCUnsupportedContextSet:
-		return "Unsupported context set"
-	case DCUnsupportedIndex:
-		return "Unsupported index"
-	case DCDatabaseDoesNotExist:
-		return "Database does not exist"
-	case DCQuerySyntaxError:
-		return "Query syntax error"
-	case DCQueryCannotProcess:
-		return "Cannot process query; reason unknown"
-	case DCQueryFeatureUnsupported:
-		return "Query feature unsupported"
-	case DCTooManyMatchingRecords:
-		return "Result set not created: too many matching records"
-	case DCFirstRecordPosOutOfRange:
-		return "First record position out of range"
-	case DCUnknownSchemaForRetrieval:
-		return "Unknown schema for retrieval"
-	case DCUnsupportedRecordPacking:
-		return "Unsupported record packing"
+// AsMessage returns a default human readable message for the code
+// in the required language. In case there is no translation available,
+// the English version is returned.
+func (dc DiagnosticCode) AsMessage(lang string) string {
+	msg, _ := i18n.Resolve(diagnosticMessages[dc], []string{lang}, i18n.DefaultLanguage)
+	if msg == "" {
+		return "??"
 	}
-	return "??"
+	return msg
 }
 
 // from appendix A FCS 2.0 documentation
@@ -103,10 +74,93 @@ const (
 	DCTooManyMatchingRecords    DiagnosticCode = 60
 	DCFirstRecordPosOutOfRange  DiagnosticCode = 61
 	DCUnknownSchemaForRetrieval DiagnosticCode = 66
+	// Sorting related diagnostics
+	DCSortNotSupported DiagnosticCode = 80
 	// Records related diagnostics
 	DCUnsupportedRecordPacking DiagnosticCode = 71
 )
 
+// diagnosticMessages is a catalog of default diagnostic messages.
+// Each code must provide at least the English (i18n.DefaultLanguage) version.
+var diagnosticMessages = map[DiagnosticCode]map[string]string{
+	DCGeneralSystemError: {
+		"en": "General system error",
+		"cs": "Obecná systémová chyba",
+	},
+	DCSystemTemporarilyUnavailable: {
+		"en": "System temporarily unavailable",
+		"cs": "Systém je dočasně nedostupný",
+	},
+	DCAuthenticationError: {
+		"en": "Authentication error",
+		"cs": "Chyba autentizace",
+	},
+	DCUnsupportedOperation: {
+		"en": "Unsupported operation",
+		"cs": "Nepodporovaná operace",
+	},
+	DCUnsupportedVersion: {
+		"en": "Unsupported version",
+		"cs": "Nepodporovaná verze",
+	},
+	DCUnsupportedParameterValue: {
+		"en": "Unsupported parameter value",
+		"cs": "Nepodporovaná hodnota parametru",
+	},
+	DCMandatoryParameterNotSupplied: {
+		"en": "Mandatory parameter not supplied",
+		"cs": "Chybí povinný parametr",
+	},
+	DCUnsupportedParameter: {
+		"en": "Unsupported Parameter",
+		"cs": "Nepodporovaný parametr",
+	},
+	DCUnsupportedContextSet: {
+		"en": "Unsupported context set",
+		"cs": "Nepodporovaná sada kontextů",
+	},
+	DCUnsupportedIndex: {
+		"en": "Unsupported index",
+		"cs": "Nepodporovaný index",
+	},
+	DCDatabaseDoesNotExist: {
+		"en": "Database does not exist",
+		"cs": "Databáze neexistuje",
+	},
+	DCQuerySyntaxError: {
+		"en": "Query syntax error",
+		"cs": "Chyba syntaxe dotazu",
+	},
+	DCQueryCannotProcess: {
+		"en": "Cannot process query; reason unknown",
+		"cs": "Dotaz nelze zpracovat; neznámý důvod",
+	},
+	DCQueryFeatureUnsupported: {
+		"en": "Query feature unsupported",
+		"cs": "Nepodporovaná vlastnost dotazu",
+	},
+	DCTooManyMatchingRecords: {
+		"en": "Result set not created: too many matching records",
+		"cs": "Výsledek nebyl vytvořen: příliš mnoho odpovídajících záznamů",
+	},
+	DCFirstRecordPosOutOfRange: {
+		"en": "First record position out of range",
+		"cs": "Pozice prvního záznamu je mimo rozsah",
+	},
+	DCUnknownSchemaForRetrieval: {
+		"en": "Unknown schema for retrieval",
+		"cs": "Neznámé schéma pro získání záznamů",
+	},
+	DCSortNotSupported: {
+		"en": "Sort not supported",
+		"cs": "Řazení není podporováno",
+	},
+	DCUnsupportedRecordPacking: {
+		"en": "Unsupported record packing",
+		"cs": "Nepodporovaný formát záznamů",
+	},
+}
+
 type FCSError struct {
 	Type    DiagnosticType
 	Code    DiagnosticCode
@@ -0,0 +1,33 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import "github.com/czcorpus/mquery-sru/i18n"
+
+// NegotiateLanguage finds the most preferred language from
+// the `Accept-Language` header we have diagnostic messages for.
+// If nothing matches, i18n.DefaultLanguage is returned.
+func NegotiateLanguage(acceptLanguage string) string {
+	for _, lang := range i18n.ParseAcceptLanguage(acceptLanguage) {
+		if _, ok := diagnosticMessages[DCGeneralSystemError][lang]; ok {
+			return lang
+		}
+	}
+	return i18n.DefaultLanguage
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachedResponse is a serialized response along with
+// information needed for conditional requests
+type CachedResponse struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+}
+
+// NotModified tests whether a client already has the response
+// based on the `If-None-Match` and `If-Modified-Since` request headers.
+// In case both headers are present, `If-None-Match` takes precedence
+// (see RFC 9110, section 13.2.2).
+func (cr CachedResponse) NotModified(req *http.Request) bool {
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		return MatchesETag(inm, cr.ETag)
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		return !cr.LastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// MatchesETag tests whether an `If-None-Match` header value
+// matches the provided ETag. The weak comparison is used
+// (see RFC 9110, section 8.8.3.2).
+func MatchesETag(ifNoneMatch, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheStats provides basic information about a cache usage
+type CacheStats struct {
+	Size   int    `json:"size"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// HitRate returns ratio of cache hits to all the cache lookups
+func (cs CacheStats) HitRate() float64 {
+	if cs.Hits+cs.Misses == 0 {
+		return 0
+	}
+	return float64(cs.Hits) / float64(cs.Hits+cs.Misses)
+}
+
+// DfltResponseCacheMaxItems is a default maximum number of responses
+// stored in a ResponseCache
+const DfltResponseCacheMaxItems = 500
+
+type cacheItem struct {
+	key  string
+	resp CachedResponse
+}
+
+// ResponseCache stores serialized responses which do not change
+// between configuration (re)loads - typically the explain operation
+// which is frequently polled by FCS aggregators.
+// The number of stored responses is limited - once the limit is reached,
+// the least recently used response is removed.
+type ResponseCache struct {
+	items        map[string]*list.Element
+	order        *list.List
+	maxItems     int
+	lastModified time.Time
+	mu           sync.RWMutex
+	hits         atomic.Uint64
+	misses       atomic.Uint64
+}
+
+func (rc *ResponseCache) Get(key string) (CachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	elm, ok := rc.items[key]
+	if !ok {
+		rc.misses.Add(1)
+		return CachedResponse{}, false
+	}
+	rc.hits.Add(1)
+	rc.order.MoveToFront(elm)
+	return elm.Value.(*cacheItem).resp, true
+}
+
+// Stats returns current size of the cache and numbers
+// of hits and misses since the cache has been created.
+func (rc *ResponseCache) Stats() CacheStats {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return CacheStats{
+		Size:   len(rc.items),
+		Hits:   rc.hits.Load(),
+		Misses: rc.misses.Load(),
+	}
+}
+
+// Set stores a serialized response and returns its
+// cache record (including calculated ETag).
+func (rc *ResponseCache) Set(key string, body []byte) CachedResponse {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	ans := CachedResponse{
+		Body:         body,
+		ETag:         fmt.Sprintf("\"%x\"", sha1.Sum(body)),
+		LastModified: rc.lastModified,
+	}
+	if elm, ok := rc.items[key]; ok {
+		elm.Value.(*cacheItem).resp = ans
+		rc.order.MoveToFront(elm)
+		return ans
+	}
+	rc.items[key] = rc.order.PushFront(&cacheItem{key: key, resp: ans})
+	for rc.order.Len() > rc.maxItems {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.items, oldest.Value.(*cacheItem).key)
+	}
+	return ans
+}
+
+// DerivedETag returns a weak ETag derived from the provided key
+// and the current cache generation (i.e. the ETag changes each time
+// the cache is invalidated). This is useful for responses which are
+// not stored in the cache but which depend on the same configuration
+// and data (e.g. search results).
+// Please note that the generation is a time of the last invalidation
+// of the cache in the current process. With multiple server instances
+// (e.g. behind a load balancer), each instance produces different ETags
+// for the same response so clients switching between instances do not
+// obtain `304 Not Modified`.
+func (rc *ResponseCache) DerivedETag(key string) string {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return fmt.Sprintf(
+		"W/\"%x\"", sha1.Sum([]byte(key+"|"+rc.lastModified.Format(time.RFC3339Nano))))
+}
+
+// Invalidate removes all the cached responses. It should be called
+// each time the configuration affecting the cached responses changes.
+func (rc *ResponseCache) Invalidate() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.items = make(map[string]*list.Element)
+	rc.order.Init()
+	rc.lastModified = time.Now().UTC()
+}
+
+// NewResponseCache creates a new cache storing at most `maxItems`
+// responses. For non-positive values, DfltResponseCacheMaxItems is used.
+func NewResponseCache(maxItems int) *ResponseCache {
+	if maxItems <= 0 {
+		maxItems = DfltResponseCacheMaxItems
+	}
+	return &ResponseCache{
+		items:        make(map[string]*list.Element),
+		order:        list.New(),
+		maxItems:     maxItems,
+		lastModified: time.Now().UTC(),
+	}
+}
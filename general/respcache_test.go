@@ -0,0 +1,124 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseCacheSetGet(t *testing.T) {
+	rc := NewResponseCache(0)
+	_, ok := rc.Get("foo")
+	assert.False(t, ok)
+	stored := rc.Set("foo", []byte("<xml />"))
+	cached, ok := rc.Get("foo")
+	assert.True(t, ok)
+	assert.Equal(t, stored, cached)
+	assert.Equal(t, []byte("<xml />"), cached.Body)
+	assert.NotEmpty(t, cached.ETag)
+}
+
+func TestResponseCacheInvalidate(t *testing.T) {
+	rc := NewResponseCache(0)
+	stored := rc.Set("foo", []byte("<xml />"))
+	rc.Invalidate()
+	_, ok := rc.Get("foo")
+	assert.False(t, ok)
+	stored2 := rc.Set("foo", []byte("<xml />"))
+	assert.Equal(t, stored.ETag, stored2.ETag)
+	assert.False(t, stored2.LastModified.Before(stored.LastModified))
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	rc := NewResponseCache(2)
+	rc.Set("foo", []byte("<foo />"))
+	rc.Set("bar", []byte("<bar />"))
+	_, ok := rc.Get("foo")
+	assert.True(t, ok)
+	rc.Set("baz", []byte("<baz />"))
+	_, ok = rc.Get("bar")
+	assert.False(t, ok)
+	_, ok = rc.Get("foo")
+	assert.True(t, ok)
+	_, ok = rc.Get("baz")
+	assert.True(t, ok)
+	assert.Equal(t, 2, rc.Stats().Size)
+}
+
+func TestCachedResponseNotModifiedETag(t *testing.T) {
+	cr := CachedResponse{ETag: "\"abc\"", LastModified: time.Now()}
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	assert.False(t, cr.NotModified(req))
+	req.Header.Set("If-None-Match", "\"xyz\", \"abc\"")
+	assert.True(t, cr.NotModified(req))
+	req.Header.Set("If-None-Match", "\"xyz\"")
+	assert.False(t, cr.NotModified(req))
+	req.Header.Set("If-None-Match", "W/\"abc\"")
+	assert.True(t, cr.NotModified(req))
+}
+
+func TestCachedResponseNotModifiedSince(t *testing.T) {
+	lastMod := time.Date(2024, 3, 1, 10, 0, 0, 500, time.UTC)
+	cr := CachedResponse{ETag: "\"abc\"", LastModified: lastMod}
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-Modified-Since", lastMod.Format(http.TimeFormat))
+	assert.True(t, cr.NotModified(req))
+	req.Header.Set("If-Modified-Since", lastMod.Add(-time.Hour).Format(http.TimeFormat))
+	assert.False(t, cr.NotModified(req))
+	// If-None-Match takes precedence
+	req.Header.Set("If-Modified-Since", lastMod.Format(http.TimeFormat))
+	req.Header.Set("If-None-Match", "\"xyz\"")
+	assert.False(t, cr.NotModified(req))
+}
+
+func TestResponseCacheStats(t *testing.T) {
+	rc := NewResponseCache(0)
+	rc.Get("foo")
+	rc.Set("foo", []byte("<xml />"))
+	rc.Get("foo")
+	rc.Get("foo")
+	stats := rc.Stats()
+	assert.Equal(t, 1, stats.Size)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.InDelta(t, 0.667, stats.HitRate(), 0.001)
+	rc.Invalidate()
+	assert.Equal(t, 0, rc.Stats().Size)
+}
+
+func TestMatchesETag(t *testing.T) {
+	assert.True(t, MatchesETag("\"abc\"", "W/\"abc\""))
+	assert.True(t, MatchesETag("W/\"abc\"", "W/\"abc\""))
+	assert.True(t, MatchesETag("*", "\"abc\""))
+	assert.False(t, MatchesETag("\"xyz\"", "W/\"abc\""))
+}
+
+func TestResponseCacheDerivedETag(t *testing.T) {
+	rc := NewResponseCache(0)
+	etag := rc.DerivedETag("foo")
+	assert.Equal(t, etag, rc.DerivedETag("foo"))
+	assert.NotEqual(t, etag, rc.DerivedETag("bar"))
+	assert.Contains(t, etag, "W/\"")
+	rc.Invalidate()
+	assert.NotEqual(t, etag, rc.DerivedETag("foo"))
+}
@@ -18,37 +18,102 @@
 
 package general
 
+import "net/http"
+
 const (
+	RecordSchema = "http://clarin.eu/fcs/resource"
 
-	// ConformantStatusBadRequest
-	// Note: we want to keep awareness about proper
-	// states but to keep in line with the SRU specification,
-	// 200 is expected
-	ConformantStatusBadRequest = 200
+	// RecordSchemaDC is a Dublin Core record schema providing
+	// a simplified (plain text) view of search results
+	RecordSchemaDC = "info:srw/schema/1/dc-v1.1"
+)
 
-	// ConformantUnprocessableEntity
-	// Note: we want to keep awareness about proper
-	// states but to keep in line with the SRU specification,
-	// 200 is expected
-	ConformantUnprocessableEntity = 200
+// IsKnownRecordSchema tests whether the server is able
+// to produce records in the schema
+func IsKnownRecordSchema(schema string) bool {
+	return schema == RecordSchema || schema == RecordSchemaDC
+}
 
-	// ConformandGeneralServerError
-	// Note: we want to keep awareness about proper
-	// states but to keep in line with the SRU specification,
-	// 200 is expected
-	ConformandGeneralServerError = 200
+// Conformant statuses are used for responses containing SRU diagnostics.
+// Note: we want to keep awareness about proper states but to keep
+// in line with the SRU specification, 200 is expected by default.
+// Deployments requiring proper HTTP statuses can enable them
+// via SetStrictHTTPStatus.
+var (
+	ConformantStatusBadRequest    = http.StatusOK
+	ConformantUnprocessableEntity = http.StatusOK
+	ConformandGeneralServerError  = http.StatusOK
+)
 
-	RecordSchema = "http://clarin.eu/fcs/resource"
+// SetStrictHTTPStatus switches between SRU conformant HTTP statuses
+// (i.e. 200 for all the responses with diagnostics) and proper
+// HTTP statuses (400, 422, 500). It is expected to be called
+// once during the service initialization.
+func SetStrictHTTPStatus(strict bool) {
+	if strict {
+		ConformantStatusBadRequest = http.StatusBadRequest
+		ConformantUnprocessableEntity = http.StatusUnprocessableEntity
+		ConformandGeneralServerError = http.StatusInternalServerError
+
+	} else {
+		ConformantStatusBadRequest = http.StatusOK
+		ConformantUnprocessableEntity = http.StatusOK
+		ConformandGeneralServerError = http.StatusOK
+	}
+}
+
+// StrictParameters specifies whether unknown request parameters
+// are reported via the "Unsupported parameter" diagnostic (as required
+// by the SRU specification). If false, such parameters (e.g. `utm_source`
+// appended by some clients) are ignored. Use SetStrictParameters
+// to change the value.
+var StrictParameters = true
+
+// SetStrictParameters enables/disables reporting of unknown request
+// parameters. It is expected to be called once during the service
+// initialization.
+func SetStrictParameters(strict bool) {
+	StrictParameters = strict
+}
+
+// ResponseFormat specifies a serialization of SRU responses
+type ResponseFormat string
+
+const (
+	ResponseFormatXML  ResponseFormat = "xml"
+	ResponseFormatJSON ResponseFormat = "json"
 )
 
+// ContentType returns a MIME type of the format
+func (rf ResponseFormat) ContentType() string {
+	if rf == ResponseFormatJSON {
+		return "application/json"
+	}
+	return "application/xml"
+}
+
 type FCSGeneralRequest struct {
 	Version string
 	Errors  []FCSError
 	Fatal   bool
 
+	// Lang is a language negotiated with the client
+	// (via the `Accept-Language` header). It is used
+	// for diagnostic messages.
+	Lang string
+
+	// AcceptLanguages contains languages requested by the client
+	// (via the `Accept-Language` header) sorted by preference.
+	// It is used to resolve translations of titles, descriptions etc.
+	AcceptLanguages []string
+
 	// XSLT is an optional path of a XSL template
 	// for outputting formatted (typically HTML) result
 	XSLT string
+
+	// Format is a serialization of the response. Empty value
+	// means XML. For JSON, the XSLT is ignored.
+	Format ResponseFormat
 }
 
 func (r *FCSGeneralRequest) AddError(fcsError FCSError) {
@@ -0,0 +1,116 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/general"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Cache is a cache which can be inspected and flushed
+// by the administration endpoints
+type Cache interface {
+	Stats() general.CacheStats
+	Invalidate()
+}
+
+type CacheInfo struct {
+	Name    string  `json:"name"`
+	Size    int     `json:"size"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hitRate"`
+}
+
+type CachesResponse struct {
+	Caches []CacheInfo `json:"caches"`
+}
+
+// AdminHandler provides endpoints for inspecting and flushing
+// internal caches (e.g. after a corpus has been reindexed).
+type AdminHandler struct {
+	token  string
+	caches map[string]Cache
+}
+
+// RegisterCache makes a cache available via the administration endpoints
+func (a *AdminHandler) RegisterCache(name string, cache Cache) {
+	a.caches[name] = cache
+}
+
+// AuthMiddleware accepts only requests with the `Authorization: Bearer <token>`
+// header containing the configured token.
+func (a *AdminHandler) AuthMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			uniresp.RespondWithErrorJSON(
+				ctx, errors.New("unauthorized"), http.StatusUnauthorized)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func (a *AdminHandler) ListCaches(ctx *gin.Context) {
+	ans := CachesResponse{Caches: make([]CacheInfo, 0, len(a.caches))}
+	for name, cache := range a.caches {
+		stats := cache.Stats()
+		ans.Caches = append(ans.Caches, CacheInfo{
+			Name:    name,
+			Size:    stats.Size,
+			Hits:    stats.Hits,
+			Misses:  stats.Misses,
+			HitRate: stats.HitRate(),
+		})
+	}
+	sort.Slice(ans.Caches, func(i, j int) bool { return ans.Caches[i].Name < ans.Caches[j].Name })
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+func (a *AdminHandler) FlushCache(ctx *gin.Context) {
+	name := ctx.Param("name")
+	cache, ok := a.caches[name]
+	if !ok {
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("unknown cache %s", name), http.StatusNotFound)
+		return
+	}
+	cache.Invalidate()
+	log.Info().Str("cache", name).Msg("cache flushed via admin endpoint")
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]any{"ok": true, "cache": name})
+}
+
+func NewAdminHandler(token string) *AdminHandler {
+	return &AdminHandler{
+		token:  token,
+		caches: make(map[string]Cache),
+	}
+}
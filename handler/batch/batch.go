@@ -0,0 +1,334 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/handler/common"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/czcorpus/mquery-sru/transform"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// BatchQuery is a single query of a batch request
+type BatchQuery struct {
+	Query string `json:"query"`
+
+	// QueryType is either "cql" (default) or "fcs"
+	QueryType string `json:"queryType"`
+
+	// Resources is a list of resource PIDs to search in.
+	// If empty, all the configured resources are used.
+	Resources []string `json:"resources"`
+
+	// MaximumRecords specifies max. number of returned records.
+	// If zero, the configured `maximumRecords` is used.
+	MaximumRecords int `json:"maximumRecords"`
+
+	// WithPositions enables absolute corpus positions of hits
+	// in records (see Record.Position)
+	WithPositions bool `json:"withPositions"`
+
+	// WithPOS enables part-of-speech tags of tokens (see Token.POS)
+	WithPOS bool `json:"withPos"`
+}
+
+type BatchRequest struct {
+	Queries []BatchQuery `json:"queries"`
+}
+
+type Token struct {
+	Word string `json:"word"`
+	Hit  bool   `json:"hit,omitempty"`
+
+	// POS is a part-of-speech tag of the token. It is provided only
+	// if requested via BatchQuery.WithPOS and only for resources
+	// with the `pos` layer.
+	POS string `json:"pos,omitempty"`
+}
+
+type Record struct {
+	PID    string  `json:"pid"`
+	Tokens []Token `json:"tokens"`
+
+	// Position is an absolute corpus position of the first token
+	// of the hit (provided only if requested via BatchQuery.WithPositions).
+	// It can be used with the `/position` endpoint.
+	Position *int `json:"position,omitempty"`
+}
+
+type QueryResult struct {
+	Query           string   `json:"query"`
+	NumberOfRecords int      `json:"numberOfRecords"`
+	Records         []Record `json:"records"`
+	Error           string   `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []QueryResult `json:"results"`
+}
+
+// ---
+
+// pendingQuery represents a batch query already published
+// to workers
+type pendingQuery struct {
+	maxRecords    int
+	withPositions bool
+	withPOS       bool
+	corpora       []string
+	waits         []<-chan result.ConcResult
+	err           error
+}
+
+// BatchHandler allows for sending multiple queries within a single
+// request. All the queries are published to workers at once so
+// they are processed concurrently.
+type BatchHandler struct {
+	serverInfo *cnf.ServerInfo
+	conf       *corpus.CorporaSetup
+	radapter   *rdb.Adapter
+}
+
+// internalError hides details of an internal error from clients
+// unless configured otherwise (see common.InternalErrorIdent)
+func (a *BatchHandler) internalError(err error) error {
+	return errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
+}
+
+func (a *BatchHandler) publishQuery(ctx *gin.Context, bq BatchQuery) pendingQuery {
+	ans := pendingQuery{
+		maxRecords:    bq.MaximumRecords,
+		withPositions: bq.WithPositions,
+		withPOS:       bq.WithPOS,
+	}
+	if ans.maxRecords == 0 {
+		ans.maxRecords = a.conf.MaximumRecords
+
+	} else if ans.maxRecords < 0 || ans.maxRecords > mango.MaxRecordsInternalLimit {
+		ans.err = fmt.Errorf("maximumRecords must be between 1 and %d", mango.MaxRecordsInternalLimit)
+		return ans
+	}
+	if len(bq.Resources) > 0 {
+		for _, pid := range bq.Resources {
+			res, err := a.conf.Resources.GetResourceByPID(pid)
+			if err != nil {
+				ans.err = fmt.Errorf("unknown resource %s", pid)
+				return ans
+			}
+			ans.corpora = append(ans.corpora, res.ID)
+		}
+
+	} else {
+		ans.corpora = a.conf.Resources.GetCorpora()
+	}
+	if len(ans.corpora) == 0 {
+		ans.err = errors.New("no resources to search in")
+		return ans
+	}
+	retrieveAttrs, err := a.conf.Resources.GetCommonPosAttrNames(ans.corpora...)
+	if err != nil {
+		ans.err = a.internalError(err)
+		return ans
+	}
+
+	ans.waits = make([]<-chan result.ConcResult, len(ans.corpora))
+	for i, corpusID := range ans.corpora {
+		rscConf, err := a.conf.Resources.GetResource(corpusID)
+		if err != nil {
+			ans.err = a.internalError(err)
+			return ans
+		}
+		q, err := common.TranslateQuery(a.conf, rscConf, bq.Query, bq.QueryType)
+		if err != nil {
+			ans.err = err
+			return ans
+		}
+		rscAttrs := retrieveAttrs[:len(retrieveAttrs):len(retrieveAttrs)]
+		if posAttr := rscConf.GetLayerDefault(corpus.LayerTypePOS).Name; bq.WithPOS &&
+			posAttr != "" && !collections.SliceContains(rscAttrs, posAttr) {
+			rscAttrs = append(rscAttrs, posAttr)
+		}
+		// add text layer as another attr, otherwise we won't be able to parse it due to Manatee output formatting
+		rscAttrs = append(rscAttrs, rscAttrs[0])
+		wait, err := a.radapter.PublishQuery(ctx.Request.Context(), rdb.Query{
+			Func:  "concExample",
+			Queue: rscConf.WorkerQueue,
+			Args: rdb.ConcQueryArgs{
+				CorpusPath:        a.conf.GetRegistryPath(corpusID),
+				Query:             q,
+				Attrs:             rscAttrs,
+				StartLine:         0,
+				MaxItems:          ans.maxRecords,
+				MaxContext:        a.conf.GetDefaultContext(rscConf),
+				ViewContextStruct: rscConf.ViewContextStruct,
+				Encoding:          rscConf.Encoding,
+			},
+		})
+		if err != nil {
+			ans.err = a.internalError(err)
+			return ans
+		}
+		ans.waits[i] = wait
+	}
+	return ans
+}
+
+func (a *BatchHandler) collectResult(pq pendingQuery) QueryResult {
+	var ans QueryResult
+	results := make(map[string]result.ConcResult)
+	concSizes := make(map[string]int)
+	for i, wait := range pq.waits {
+		if wait == nil { // publishing failed
+			continue
+		}
+		res := <-wait
+		if res.Error != nil && !res.HasOutOfRangeError() && ans.Error == "" {
+			ans.Error = common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error)
+		}
+		results[pq.corpora[i]] = res
+		concSizes[pq.corpora[i]] = res.ConcSize
+	}
+	if pq.err != nil {
+		ans.Error = pq.err.Error()
+	}
+	if ans.Error != "" {
+		return ans
+	}
+	ranges := query.CalculateExactRanges(pq.corpora, concSizes, 0, pq.maxRecords)
+	fromResource := result.NewRoundRobinLineSel(pq.maxRecords, ranges.PIDList()...)
+	if a.conf.DeduplicateRecords {
+		fromResource.EnableDeduplication()
+	}
+	for i, rng := range ranges {
+		res := results[rng.Rsc]
+		if res.Error != nil {
+			fromResource.RscSetErrorAt(i, res.Error)
+		}
+		fromResource.SetRscLines(rng.Rsc, res)
+		ans.NumberOfRecords += res.ConcSize
+	}
+	ans.Records = make([]Record, 0, pq.maxRecords)
+	for len(ans.Records) < pq.maxRecords && fromResource.Next() {
+		rscConf, err := a.conf.Resources.GetResource(fromResource.CurrRscName())
+		if err != nil {
+			ans.Error = common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err)
+			return ans
+		}
+		line := transform.Apply(rscConf.Transformers, fromResource.CurrLine())
+		var posAttr string
+		if pq.withPOS {
+			posAttr = rscConf.GetLayerDefault(corpus.LayerTypePOS).Name
+		}
+		record := Record{
+			PID: rscConf.PID,
+			Tokens: collections.SliceMap(
+				line.Text.Tokens(),
+				func(token *concordance.Token, i int) Token {
+					tok := Token{Word: token.Word, Hit: token.Strong}
+					if posAttr != "" {
+						tok.POS = token.Attrs[posAttr]
+					}
+					return tok
+				},
+			),
+		}
+		if pq.withPositions {
+			if pos, err := common.ParseRefPosition(line.Ref); err == nil {
+				record.Position = &pos
+
+			} else {
+				log.Error().Err(err).Str("resource", rscConf.ID).Msg("failed to get hit position")
+			}
+		}
+		ans.Records = append(ans.Records, record)
+	}
+	return ans
+}
+
+func (a *BatchHandler) Handle(ctx *gin.Context) {
+	var req BatchRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		var mbErr *http.MaxBytesError
+		if errors.As(err, &mbErr) {
+			uniresp.RespondWithErrorJSON(
+				ctx, fmt.Errorf("batch request too large: %w", err), http.StatusRequestEntityTooLarge)
+			return
+		}
+		uniresp.RespondWithErrorJSON(
+			ctx, fmt.Errorf("invalid batch request: %w", err), http.StatusBadRequest)
+		return
+	}
+	if len(req.Queries) == 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("no queries in batch request"), http.StatusBadRequest)
+		return
+	}
+	if len(req.Queries) > a.conf.MaximumBatchSize {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("too many queries in batch request (max. %d)", a.conf.MaximumBatchSize),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	// first we publish all the queries so workers can process them
+	// concurrently and only then we collect the results
+	pending := make([]pendingQuery, len(req.Queries))
+	for i, bq := range req.Queries {
+		pending[i] = a.publishQuery(ctx, bq)
+	}
+	ans := BatchResponse{Results: make([]QueryResult, len(req.Queries))}
+	for i, pq := range pending {
+		ans.Results[i] = a.collectResult(pq)
+		ans.Results[i].Query = req.Queries[i].Query
+		if ans.Results[i].Error != "" {
+			log.Warn().
+				Str("query", req.Queries[i].Query).
+				Str("error", ans.Results[i].Error).
+				Msg("batch query failed")
+		}
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+func NewBatchHandler(
+	serverInfo *cnf.ServerInfo,
+	conf *corpus.CorporaSetup,
+	radapter *rdb.Adapter,
+) *BatchHandler {
+	return &BatchHandler{
+		serverInfo: serverInfo,
+		conf:       conf,
+		radapter:   radapter,
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package batch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestConf() *corpus.CorporaSetup {
+	return &corpus.CorporaSetup{
+		MaximumRecords:   10,
+		MaximumBatchSize: 2,
+		Resources: corpus.SrchResources{
+			&corpus.CorpusSetup{
+				ID:  "corp1",
+				PID: "pid1",
+				PosAttrs: []corpus.PosAttr{
+					{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+					{Name: "tag", Layer: corpus.LayerTypePOS, IsLayerDefault: true},
+				},
+			},
+		},
+	}
+}
+
+func handleBatch(t *testing.T, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewBatchHandler(&cnf.ServerInfo{}, createTestConf(), nil)
+	engine := gin.New()
+	engine.POST("/batch", h.Handle)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(
+		rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+	return rec
+}
+
+func resultChan(res result.ConcResult) <-chan result.ConcResult {
+	ans := make(chan result.ConcResult, 1)
+	ans <- res
+	close(ans)
+	return ans
+}
+
+func TestHandleRejectsInvalidRequest(t *testing.T) {
+	rec := handleBatch(t, `{"queries": [`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid batch request")
+}
+
+func TestHandleRejectsEmptyBatch(t *testing.T) {
+	rec := handleBatch(t, `{"queries": []}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no queries")
+}
+
+func TestHandleRejectsTooManyQueries(t *testing.T) {
+	rec := handleBatch(t, `{"queries": [{"query": "a"}, {"query": "b"}, {"query": "c"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "too many queries")
+}
+
+func TestPublishQueryValidatesArgs(t *testing.T) {
+	h := NewBatchHandler(&cnf.ServerInfo{}, createTestConf(), nil)
+	pq := h.publishQuery(nil, BatchQuery{Query: "a", MaximumRecords: -1})
+	assert.ErrorContains(t, pq.err, "maximumRecords")
+	pq = h.publishQuery(nil, BatchQuery{Query: "a", Resources: []string{"unknown"}})
+	assert.ErrorContains(t, pq.err, "unknown resource unknown")
+}
+
+func TestCollectResultWithPositionsAndPOS(t *testing.T) {
+	h := NewBatchHandler(&cnf.ServerInfo{}, createTestConf(), nil)
+	pq := pendingQuery{
+		maxRecords:    10,
+		withPositions: true,
+		withPOS:       true,
+		corpora:       []string{"corp1"},
+		waits: []<-chan result.ConcResult{
+			resultChan(result.ConcResult{
+				ConcSize: 1,
+				Lines: []concordance.Line{
+					{
+						Ref: "#42",
+						Text: concordance.TokenSlice{
+							&concordance.Token{Word: "a", Attrs: map[string]string{"tag": "D"}},
+							&concordance.Token{Word: "cat", Strong: true, Attrs: map[string]string{"tag": "N"}},
+						},
+					},
+				},
+			}),
+		},
+	}
+	ans := h.collectResult(pq)
+	assert.Empty(t, ans.Error)
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	assert.Equal(t, 1, len(ans.Records))
+	assert.Equal(t, "pid1", ans.Records[0].PID)
+	assert.Equal(t, 42, *ans.Records[0].Position)
+	assert.Equal(
+		t,
+		[]Token{{Word: "a", POS: "D"}, {Word: "cat", Hit: true, POS: "N"}},
+		ans.Records[0].Tokens,
+	)
+}
+
+func TestCollectResultReportsError(t *testing.T) {
+	h := NewBatchHandler(&cnf.ServerInfo{}, createTestConf(), nil)
+	pq := pendingQuery{
+		maxRecords: 10,
+		corpora:    []string{"corp1"},
+		waits: []<-chan result.ConcResult{
+			resultChan(result.ConcResult{Error: errors.New("failed to run query")}),
+		},
+	}
+	ans := h.collectResult(pq)
+	assert.Contains(t, ans.Error, "internal error ref.")
+	assert.NotContains(t, ans.Error, "failed to run query")
+	assert.Empty(t, ans.Records)
+
+	h = NewBatchHandler(&cnf.ServerInfo{ExposeInternalErrors: true}, createTestConf(), nil)
+	pq.waits = []<-chan result.ConcResult{
+		resultChan(result.ConcResult{Error: errors.New("failed to run query")}),
+	}
+	ans = h.collectResult(pq)
+	assert.Equal(t, "failed to run query", ans.Error)
+}
@@ -0,0 +1,262 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package collocs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/handler/common"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dfltWindow   = 5
+	dfltMinFreq  = 3
+	dfltMaxItems = 20
+	maxWindow    = 20
+)
+
+type Collocate struct {
+	Word  string  `json:"word"`
+	Score float64 `json:"score"`
+	Freq  int64   `json:"freq"`
+}
+
+// MergedCollocate is a collocate found in one or more resources.
+// The Freq is a sum of frequencies in the resources and the Score
+// is a frequency-weighted average of the resources' scores (as scores
+// of different corpora cannot be recalculated from the collocates).
+type MergedCollocate struct {
+	Collocate
+	NumResources int `json:"numResources"`
+}
+
+type ResourceCollocations struct {
+	PID        string      `json:"pid"`
+	Collocates []Collocate `json:"collocates"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type CollocationsResponse struct {
+	Query     string                 `json:"query"`
+	Measure   string                 `json:"measure"`
+	Window    int                    `json:"window"`
+	MinFreq   int                    `json:"minFreq"`
+	Merged    []MergedCollocate      `json:"merged"`
+	Resources []ResourceCollocations `json:"resources"`
+}
+
+// CollocationsHandler provides collocation profiles of query
+// matches within one or more resources along with a merged
+// profile.
+type CollocationsHandler struct {
+	serverInfo *cnf.ServerInfo
+	conf       *corpus.CorporaSetup
+	radapter   *rdb.Adapter
+}
+
+// intArg obtains an integer URL argument within [minVal, maxVal]
+// (or dflt if not specified)
+func intArg(ctx *gin.Context, name string, dflt, minVal, maxVal int) (int, error) {
+	v := ctx.Query(name)
+	if v == "" {
+		return dflt, nil
+	}
+	ans, err := strconv.Atoi(v)
+	if err != nil || ans < minVal || ans > maxVal {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, minVal, maxVal)
+	}
+	return ans, nil
+}
+
+// mergeCollocates merges collocates of multiple resources and returns
+// at most `maxItems` items with the highest scores
+func mergeCollocates(rscColls []ResourceCollocations, maxItems int) []MergedCollocate {
+	merged := make(map[string]*MergedCollocate)
+	order := make([]string, 0, maxItems)
+	for _, rsc := range rscColls {
+		for _, coll := range rsc.Collocates {
+			item, ok := merged[coll.Word]
+			if !ok {
+				item = &MergedCollocate{Collocate: Collocate{Word: coll.Word}}
+				merged[coll.Word] = item
+				order = append(order, coll.Word)
+			}
+			// we keep a weighted sum here and divide it below
+			item.Score += coll.Score * float64(coll.Freq)
+			item.Freq += coll.Freq
+			item.NumResources++
+		}
+	}
+	ans := make([]MergedCollocate, 0, len(order))
+	for _, word := range order {
+		item := merged[word]
+		if item.Freq > 0 {
+			item.Score /= float64(item.Freq)
+		}
+		ans = append(ans, *item)
+	}
+	sort.SliceStable(ans, func(i, j int) bool {
+		return ans[i].Score > ans[j].Score
+	})
+	return ans[:min(maxItems, len(ans))]
+}
+
+func (a *CollocationsHandler) Handle(ctx *gin.Context) {
+	q := ctx.Query("query")
+	if q == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("missing query"), http.StatusBadRequest)
+		return
+	}
+	measureName := ctx.DefaultQuery("measure", "logDice")
+	if _, err := mango.ParseCollMeasure(measureName); err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	window := dfltWindow
+	if a.conf.CollocationsWindow > 0 {
+		window = min(a.conf.CollocationsWindow, maxWindow)
+	}
+	window, err := intArg(ctx, "window", window, 1, maxWindow)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	minFreq, err := intArg(ctx, "minFreq", dfltMinFreq, 1, 1000000)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	maxItems, err := intArg(ctx, "maxItems", dfltMaxItems, 1, mango.MaxCollocItemsInternalLimit)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+		return
+	}
+	corpora := a.conf.Resources.GetCorpora()
+	if pids := ctx.QueryArray("resource"); len(pids) > 0 {
+		corpora = make([]string, 0, len(pids))
+		for _, pid := range pids {
+			rscConf, err := a.conf.Resources.GetResourceByPID(pid)
+			if err != nil {
+				uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+				return
+			}
+			corpora = append(corpora, rscConf.ID)
+		}
+	}
+
+	// all the queries are published first so workers can process them concurrently
+	rscs := make([]*corpus.CorpusSetup, len(corpora))
+	waits := make([]<-chan result.ConcResult, len(corpora))
+	for i, corpusID := range corpora {
+		rscConf, err := a.conf.Resources.GetResource(corpusID)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err)),
+				http.StatusInternalServerError,
+			)
+			return
+		}
+		rscs[i] = rscConf
+		cql, err := common.TranslateQuery(a.conf, rscConf, q, ctx.Query("queryType"))
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+			return
+		}
+		waits[i], err = a.radapter.PublishQuery(ctx.Request.Context(), rdb.Query{
+			Func:  "collocations",
+			Queue: rscConf.WorkerQueue,
+			Args: rdb.ConcQueryArgs{
+				CorpusPath:     a.conf.GetRegistryPath(corpusID),
+				Query:          cql,
+				Encoding:       rscConf.Encoding,
+				CollocAttr:     rscConf.GetLayerDefault(corpus.LayerTypeText).Name,
+				CollocWindow:   window,
+				CollocMaxItems: maxItems,
+				CollocMeasure:  measureName,
+				CollocMinFreq:  minFreq,
+			},
+		})
+		if err != nil {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err)),
+				http.StatusInternalServerError,
+			)
+			return
+		}
+	}
+	ans := CollocationsResponse{
+		Query:     q,
+		Measure:   measureName,
+		Window:    window,
+		MinFreq:   minFreq,
+		Resources: make([]ResourceCollocations, len(corpora)),
+	}
+	var numErrors int
+	for i, wait := range waits {
+		res := <-wait
+		ans.Resources[i] = ResourceCollocations{
+			PID: rscs[i].PID,
+			Collocates: collections.SliceMap(
+				res.Collocs,
+				func(item result.CollocItem, i int) Collocate {
+					return Collocate{Word: item.Word, Score: item.Score, Freq: item.Freq}
+				},
+			),
+		}
+		if res.Error != nil {
+			ans.Resources[i].Error = common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error)
+			numErrors++
+		}
+	}
+	if numErrors > 0 && numErrors == len(ans.Resources) {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New(ans.Resources[0].Error), http.StatusInternalServerError)
+		return
+	}
+	ans.Merged = mergeCollocates(ans.Resources, maxItems)
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+func NewCollocationsHandler(
+	serverInfo *cnf.ServerInfo,
+	conf *corpus.CorporaSetup,
+	radapter *rdb.Adapter,
+) *CollocationsHandler {
+	return &CollocationsHandler{
+		serverInfo: serverInfo,
+		conf:       conf,
+		radapter:   radapter,
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package collocs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeCollocates(t *testing.T) {
+	rscs := []ResourceCollocations{
+		{
+			PID: "corp1",
+			Collocates: []Collocate{
+				{Word: "foo", Score: 10, Freq: 30},
+				{Word: "bar", Score: 8, Freq: 10},
+			},
+		},
+		{
+			PID: "corp2",
+			Collocates: []Collocate{
+				{Word: "bar", Score: 12, Freq: 30},
+				{Word: "baz", Score: 5, Freq: 100},
+			},
+		},
+		{PID: "corp3", Error: "failed"},
+	}
+	ans := mergeCollocates(rscs, 10)
+	assert.Equal(t, 3, len(ans))
+	assert.Equal(t, "bar", ans[0].Word)
+	assert.Equal(t, 11.0, ans[0].Score)
+	assert.Equal(t, int64(40), ans[0].Freq)
+	assert.Equal(t, 2, ans[0].NumResources)
+	assert.Equal(t, "foo", ans[1].Word)
+	assert.Equal(t, "baz", ans[2].Word)
+	assert.Equal(t, 1, ans[2].NumResources)
+}
+
+func TestMergeCollocatesLimit(t *testing.T) {
+	rscs := []ResourceCollocations{
+		{
+			PID: "corp1",
+			Collocates: []Collocate{
+				{Word: "foo", Score: 10, Freq: 30},
+				{Word: "bar", Score: 8, Freq: 10},
+			},
+		},
+	}
+	ans := mergeCollocates(rscs, 1)
+	assert.Equal(t, []MergedCollocate{{Collocate: Collocate{Word: "foo", Score: 10, Freq: 30}, NumResources: 1}}, ans)
+	assert.Equal(t, 0, len(mergeCollocates([]ResourceCollocations{}, 5)))
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+)
+
+// searchBudgetReserve is a part of the search time budget
+// reserved for processing of collected results (i.e. we stop
+// waiting for workers once the budget is nearly exhausted)
+const searchBudgetReserve = 0.1
+
+// ErrSearchBudgetExhausted is a cause of contexts created
+// by WithSearchBudget once their deadline is reached.
+var ErrSearchBudgetExhausted = errors.New("search time budget exhausted")
+
+// WithSearchBudget returns a context limiting how long a federated
+// search waits for results of individual resources. The deadline
+// leaves a small reserve of the `budget` for the response processing.
+func WithSearchBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	wait := budget - time.Duration(float64(budget)*searchBudgetReserve)
+	return context.WithTimeoutCause(ctx, wait, ErrSearchBudgetExhausted)
+}
+
+// SearchBudgetExhausted tests whether `ctx` (or its parent created
+// by WithSearchBudget) has been canceled due to an exhausted budget.
+func SearchBudgetExhausted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrSearchBudgetExhausted)
+}
+
+// AwaitResult waits for a worker result. If `ctx` is done sooner,
+// a result with the respective error is returned so the caller
+// can continue with results of other resources. A nil `wait`
+// (i.e. a query which could not be published in time) always
+// ends with the error. The same applies for a channel closed without
+// providing a result.
+func AwaitResult(ctx context.Context, wait <-chan result.ConcResult) result.ConcResult {
+	select {
+	case res, ok := <-wait:
+		if !ok {
+			return result.ConcResult{
+				Error: errors.New("worker job ended without a result"),
+			}
+		}
+		return res
+	case <-ctx.Done():
+		return result.ConcResult{
+			Error: fmt.Errorf("waiting for worker response canceled: %w", ctx.Err()),
+		}
+	}
+}
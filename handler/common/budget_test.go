@@ -0,0 +1,97 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowWorker mocks a worker answering after `delay`
+func slowWorker(delay time.Duration, res result.ConcResult) <-chan result.ConcResult {
+	ans := make(chan result.ConcResult, 1)
+	go func() {
+		time.Sleep(delay)
+		ans <- res
+		close(ans)
+	}()
+	return ans
+}
+
+func TestAwaitResultWithinBudget(t *testing.T) {
+	ctx, cancel := WithSearchBudget(context.Background(), time.Second)
+	defer cancel()
+	res := AwaitResult(ctx, slowWorker(10*time.Millisecond, result.ConcResult{ConcSize: 7}))
+	assert.NoError(t, res.Error)
+	assert.Equal(t, 7, res.ConcSize)
+}
+
+func TestAwaitResultBudgetExhausted(t *testing.T) {
+	ctx, cancel := WithSearchBudget(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	fast := slowWorker(10*time.Millisecond, result.ConcResult{ConcSize: 7})
+	slow := slowWorker(5*time.Second, result.ConcResult{ConcSize: 11})
+
+	t0 := time.Now()
+	res := AwaitResult(ctx, fast)
+	assert.NoError(t, res.Error)
+	res = AwaitResult(ctx, slow)
+	assert.Less(t, time.Since(t0), time.Second)
+	assert.ErrorIs(t, res.Error, context.DeadlineExceeded)
+	assert.True(t, SearchBudgetExhausted(ctx))
+}
+
+func TestWithSearchBudgetKeepsReserve(t *testing.T) {
+	ctx, cancel := WithSearchBudget(context.Background(), 10*time.Second)
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.Less(t, time.Until(deadline), 9*time.Second+100*time.Millisecond)
+	assert.Greater(t, time.Until(deadline), 8*time.Second)
+}
+
+func TestIsSearchBudgetExhaustedOtherDeadline(t *testing.T) {
+	budgetCtx, cancel := WithSearchBudget(context.Background(), 10*time.Second)
+	defer cancel()
+	ctx, cancel2 := context.WithTimeout(budgetCtx, 10*time.Millisecond)
+	defer cancel2()
+	res := AwaitResult(ctx, slowWorker(5*time.Second, result.ConcResult{}))
+	assert.ErrorIs(t, res.Error, context.DeadlineExceeded)
+	assert.False(t, SearchBudgetExhausted(ctx))
+}
+
+func TestAwaitResultNilWait(t *testing.T) {
+	ctx, cancel := WithSearchBudget(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	res := AwaitResult(ctx, nil)
+	assert.ErrorIs(t, res.Error, context.DeadlineExceeded)
+	assert.True(t, SearchBudgetExhausted(ctx))
+}
+
+func TestAwaitResultClosedChannel(t *testing.T) {
+	wait := make(chan result.ConcResult)
+	close(wait)
+	res := AwaitResult(context.Background(), wait)
+	assert.Error(t, res.Error)
+	assert.Equal(t, 0, res.ConcSize)
+}
@@ -0,0 +1,302 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+)
+
+// HitMarker specifies how hits are marked in the basic (hits) data
+// view of JSON responses. XML responses always use the HITS data view
+// encoding.
+type HitMarker string
+
+const (
+	// HitMarkerHits encodes hits as the HITS data view (`<hits:Hit>` elements)
+	HitMarkerHits HitMarker = "hits"
+
+	// HitMarkerBold wraps hits in `<b>` elements
+	HitMarkerBold HitMarker = "bold"
+
+	// HitMarkerBrackets wraps hits in square brackets
+	HitMarkerBrackets HitMarker = "brackets"
+
+	// HitMarkerColumns provides the left context, the hit and the right
+	// context separately (see SplitHitColumns)
+	HitMarkerColumns HitMarker = "columns"
+
+	DefaultHitMarker = HitMarkerHits
+)
+
+func (hm HitMarker) Validate() error {
+	if hm == HitMarkerHits || hm == HitMarkerBold || hm == HitMarkerBrackets ||
+		hm == HitMarkerColumns {
+		return nil
+	}
+	return fmt.Errorf("unsupported hit marker: %s", hm)
+}
+
+func (hm HitMarker) String() string {
+	return string(hm)
+}
+
+// HitColumns contains a concordance line split into
+// the left context, the hit and the right context
+type HitColumns struct {
+	Left  string
+	Hit   string
+	Right string
+}
+
+// HitSpanIndices returns for each token of the `text` an index
+// of a continuous span of matched tokens (a hit) the token belongs to.
+// For tokens outside of any hit, -1 is used. Adjacent hits are recognized
+// by the mango.HitBoundaryStruct structure placed between them.
+func HitSpanIndices(text concordance.TokenSlice) []int {
+	ans := make([]int, 0, len(text))
+	curr := -1
+	inHit := false
+	for _, elm := range text {
+		switch v := elm.(type) {
+		case *concordance.Token:
+			if v.Strong {
+				if !inHit {
+					curr++
+					inHit = true
+				}
+				ans = append(ans, curr)
+
+			} else {
+				inHit = false
+				ans = append(ans, -1)
+			}
+		case *concordance.Struct:
+			if v.IsSelfClose && v.Name == mango.HitBoundaryStruct {
+				inHit = false
+			}
+		}
+	}
+	return ans
+}
+
+// GluedTokens returns for each token of the `text` whether it is glued
+// to the preceding token (i.e. there is no space between them in the original
+// text). The glue is marked by self-closing structures `glueStruct` (e.g.
+// `<g/>`) placed between tokens. With an empty `glueStruct`, nil is returned
+// which means a single space between all the tokens.
+func GluedTokens(text concordance.TokenSlice, glueStruct string) []bool {
+	if glueStruct == "" {
+		return nil
+	}
+	ans := make([]bool, 0, len(text))
+	var glue bool
+	for _, elm := range text {
+		switch v := elm.(type) {
+		case *concordance.Token:
+			ans = append(ans, glue && len(ans) > 0)
+			glue = false
+		case *concordance.Struct:
+			if v.IsSelfClose && v.Name == glueStruct {
+				glue = true
+			}
+		}
+	}
+	return ans
+}
+
+// tokenSeparator returns a string preceding the i-th token
+// (see GluedTokens for the `glued` argument)
+func tokenSeparator(glued []bool, i int) string {
+	if i == 0 || i < len(glued) && glued[i] {
+		return ""
+	}
+	return " "
+}
+
+// FormatHits renders tokens as a content of the HITS data view.
+// Each continuous span of matched tokens is wrapped in a single
+// `<hits:Hit>` element. Tokens are separated by spaces unless they are
+// glued (see GluedTokens). Character offsets of the hits can be
+// obtained via HitOffsets.
+func FormatHits(text concordance.TokenSlice, glued []bool) string {
+	tokens := text.Tokens()
+	spans := HitSpanIndices(text)
+	var ans strings.Builder
+	for i, token := range tokens {
+		startsHit := spans[i] > -1 && (i == 0 || spans[i-1] != spans[i])
+		endsHit := i > 0 && spans[i-1] > -1 && spans[i-1] != spans[i]
+		if endsHit {
+			ans.WriteString("</hits:Hit>")
+		}
+		ans.WriteString(tokenSeparator(glued, i))
+		if startsHit {
+			ans.WriteString("<hits:Hit>")
+		}
+		ans.WriteString(token.Word)
+	}
+	if len(spans) > 0 && spans[len(spans)-1] > -1 {
+		ans.WriteString("</hits:Hit>")
+	}
+	return ans.String()
+}
+
+// HitOffsets returns character offsets (1-based, inclusive) of each
+// continuous span of matched tokens (i.e. of each `<hits:Hit>` element
+// rendered by FormatHits) within the plain text of the tokens.
+func HitOffsets(text concordance.TokenSlice, glued []bool) [][2]int {
+	spans := HitSpanIndices(text)
+	offsets := TokenOffsets(text.Tokens(), glued)
+	ans := make([][2]int, 0, 1)
+	for i, span := range spans {
+		if span == -1 {
+			continue
+		}
+		if i == 0 || spans[i-1] != span {
+			ans = append(ans, offsets[i])
+
+		} else {
+			ans[len(ans)-1][1] = offsets[i][1]
+		}
+	}
+	return ans
+}
+
+// MatchKey returns a normalized key of a match (i.e. of the tokens
+// marked as strong) folded using `fold`. Words of a multi-token match
+// are separated by a single space. Clients may use the key to sort and
+// group records.
+func MatchKey(tokens []*concordance.Token, fold ScanFold) string {
+	words := make([]string, 0, 3)
+	for _, token := range tokens {
+		if token.Strong {
+			words = append(words, fold.Apply(token.Word))
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// TokenOffsets returns character offsets (1-based, inclusive) of tokens
+// within their plain text (see FormatPlainText).
+func TokenOffsets(tokens []*concordance.Token, glued []bool) [][2]int {
+	ans := make([][2]int, len(tokens))
+	pos := 1
+	for i, token := range tokens {
+		pos += len(tokenSeparator(glued, i))
+		wordLen := utf8.RuneCountInString(token.Word)
+		ans[i] = [2]int{pos, pos + wordLen - 1}
+		pos += wordLen
+	}
+	return ans
+}
+
+// FormatPlainText renders tokens as a plain text (words separated
+// by spaces unless glued, see GluedTokens) with no information
+// about the matching tokens.
+func FormatPlainText(tokens []*concordance.Token, glued []bool) string {
+	var ans strings.Builder
+	for i, token := range tokens {
+		ans.WriteString(tokenSeparator(glued, i))
+		ans.WriteString(token.Word)
+	}
+	return ans.String()
+}
+
+// FormatMarkedHits renders tokens as a plain text (see FormatPlainText)
+// with each continuous span of matched tokens wrapped in markers
+// specified by `marker` (HitMarkerBold or HitMarkerBrackets). For other
+// markers, the text is returned with no hits marked.
+func FormatMarkedHits(text concordance.TokenSlice, glued []bool, marker HitMarker) string {
+	var open, closing string
+	switch marker {
+	case HitMarkerBold:
+		open, closing = "<b>", "</b>"
+	case HitMarkerBrackets:
+		open, closing = "[", "]"
+	}
+	tokens := text.Tokens()
+	spans := HitSpanIndices(text)
+	var ans strings.Builder
+	for i, token := range tokens {
+		startsHit := spans[i] > -1 && (i == 0 || spans[i-1] != spans[i])
+		endsHit := i > 0 && spans[i-1] > -1 && spans[i-1] != spans[i]
+		if endsHit {
+			ans.WriteString(closing)
+		}
+		ans.WriteString(tokenSeparator(glued, i))
+		if startsHit {
+			ans.WriteString(open)
+		}
+		ans.WriteString(token.Word)
+	}
+	if len(spans) > 0 && spans[len(spans)-1] > -1 {
+		ans.WriteString(closing)
+	}
+	return ans.String()
+}
+
+// SplitHitColumns splits tokens into the left context, the hit and
+// the right context. In case there are more hits, the hit column
+// spans from the first to the last of them.
+func SplitHitColumns(tokens []*concordance.Token, glued []bool) HitColumns {
+	first, last := len(tokens), -1
+	for i, token := range tokens {
+		if token.Strong {
+			first = min(first, i)
+			last = i
+		}
+	}
+	if last == -1 {
+		return HitColumns{Left: FormatPlainText(tokens, glued)}
+	}
+	join := func(from, to int) string {
+		var ans strings.Builder
+		for i := from; i < to; i++ {
+			if i > from {
+				ans.WriteString(tokenSeparator(glued, i))
+			}
+			ans.WriteString(tokens[i].Word)
+		}
+		return ans.String()
+	}
+	return HitColumns{
+		Left:  join(0, first),
+		Hit:   join(first, last+1),
+		Right: join(last+1, len(tokens)),
+	}
+}
+
+// ParseRefPosition extracts an absolute corpus position (of the first
+// token of a hit) from a concordance line reference (e.g. `#4213`)
+// as provided by Manatee for the `#` ref.
+func ParseRefPosition(ref string) (int, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return -1, fmt.Errorf("invalid position reference: %s", ref)
+	}
+	ans, err := strconv.Atoi(ref[1:])
+	if err != nil || ans < 0 {
+		return -1, fmt.Errorf("invalid position reference: %s", ref)
+	}
+	return ans, nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTokens(words ...string) []*concordance.Token {
+	ans := make([]*concordance.Token, len(words))
+	for i, w := range words {
+		if len(w) > 1 && w[0] == '*' {
+			ans[i] = &concordance.Token{Word: w[1:], Strong: true}
+
+		} else {
+			ans[i] = &concordance.Token{Word: w}
+		}
+	}
+	return ans
+}
+
+// createText works like createTokens; in addition, "|" inserts
+// a boundary between two adjacent hits
+func createText(words ...string) concordance.TokenSlice {
+	ans := make(concordance.TokenSlice, 0, len(words))
+	for _, w := range words {
+		if w == "|" {
+			ans = append(ans, &concordance.Struct{Name: mango.HitBoundaryStruct, IsSelfClose: true})
+
+		} else {
+			ans = append(ans, createTokens(w)[0])
+		}
+	}
+	return ans
+}
+
+func TestHitSpanIndices(t *testing.T) {
+	tokens := createText("a", "*grumpy", "*cat", "and", "*dog", "b")
+	assert.Equal(t, []int{-1, 0, 0, -1, 1, -1}, HitSpanIndices(tokens))
+}
+
+func TestFormatHitsMergesAdjacentTokens(t *testing.T) {
+	tokens := createText("a", "*grumpy", "*cat", "sleeps")
+	assert.Equal(
+		t,
+		`a <hits:Hit>grumpy cat</hits:Hit> sleeps`,
+		FormatHits(tokens, nil),
+	)
+	assert.Equal(t, [][2]int{{3, 12}}, HitOffsets(tokens, nil))
+}
+
+func TestHitSpanIndicesAdjacentHits(t *testing.T) {
+	text := createText("a", "*grumpy", "|", "*cat", "b")
+	assert.Equal(t, []int{-1, 0, 1, -1}, HitSpanIndices(text))
+	assert.Equal(t, `a <hits:Hit>grumpy</hits:Hit> <hits:Hit>cat</hits:Hit> b`, FormatHits(text, nil))
+	assert.Equal(t, [][2]int{{3, 8}, {10, 12}}, HitOffsets(text, nil))
+}
+
+func TestFormatHitsDiscontinuous(t *testing.T) {
+	tokens := createText("*cat", "and", "*dog")
+	assert.Equal(
+		t,
+		`<hits:Hit>cat</hits:Hit> and <hits:Hit>dog</hits:Hit>`,
+		FormatHits(tokens, nil),
+	)
+	assert.Equal(t, [][2]int{{1, 3}, {9, 11}}, HitOffsets(tokens, nil))
+}
+
+func TestFormatHitsNoHit(t *testing.T) {
+	assert.Equal(t, "a b", FormatHits(createText("a", "b"), nil))
+	assert.Empty(t, HitOffsets(createText("a", "b"), nil))
+}
+
+func TestMatchKey(t *testing.T) {
+	tokens := createTokens("the", "*Žlutý", "*Kůň", "runs")
+	assert.Equal(t, "Žlutý Kůň", MatchKey(tokens, ScanFoldNone))
+	assert.Equal(t, "žlutý kůň", MatchKey(tokens, ScanFoldCase))
+	assert.Equal(t, "zluty kun", MatchKey(tokens, ScanFoldAll))
+	assert.Equal(t, "", MatchKey(createTokens("no", "hit"), ScanFoldAll))
+}
+
+func TestFormatPlainText(t *testing.T) {
+	assert.Equal(t, "a grumpy cat", FormatPlainText(createTokens("a", "*grumpy", "*cat"), nil))
+	assert.Equal(t, "", FormatPlainText(createTokens(), nil))
+}
+
+func createGluedText(tokens []*concordance.Token, glued ...int) concordance.TokenSlice {
+	ans := make(concordance.TokenSlice, 0, len(tokens)+len(glued))
+	for i, token := range tokens {
+		for _, g := range glued {
+			if g == i {
+				ans = append(ans, &concordance.Struct{Name: "g", IsSelfClose: true})
+			}
+		}
+		ans = append(ans, token)
+	}
+	return ans
+}
+
+func TestGluedTokens(t *testing.T) {
+	tokens := createTokens("Hello", ",", "world", "!")
+	text := createGluedText(tokens, 1, 3)
+	text = append(concordance.TokenSlice{&concordance.Struct{Name: "s"}}, text...)
+	assert.Equal(t, []bool{false, true, false, true}, GluedTokens(text, "g"))
+	assert.Nil(t, GluedTokens(text, ""))
+}
+
+func TestGluedTokensIgnoresLeadingGlue(t *testing.T) {
+	tokens := createTokens(",", "world")
+	assert.Equal(t, []bool{false, false}, GluedTokens(createGluedText(tokens, 0), "g"))
+}
+
+func TestFormatHitsGlued(t *testing.T) {
+	text := createGluedText(createTokens("Hello", ",", "*grumpy", "*cat", "!"), 1, 4)
+	glued := GluedTokens(text, "g")
+	assert.Equal(
+		t,
+		`Hello, <hits:Hit>grumpy cat</hits:Hit>!`,
+		FormatHits(text, glued),
+	)
+	assert.Equal(t, [][2]int{{8, 17}}, HitOffsets(text, glued))
+	assert.Equal(t, "Hello, grumpy cat!", FormatPlainText(text.Tokens(), glued))
+}
+
+func TestTokenOffsets(t *testing.T) {
+	tokens := createTokens("Hello", ",", "world", "!")
+	assert.Equal(
+		t,
+		[][2]int{{1, 5}, {7, 7}, {9, 13}, {15, 15}},
+		TokenOffsets(tokens, nil),
+	)
+	glued := GluedTokens(createGluedText(tokens, 1, 3), "g")
+	assert.Equal(
+		t,
+		[][2]int{{1, 5}, {6, 6}, {8, 12}, {13, 13}},
+		TokenOffsets(tokens, glued),
+	)
+}
+
+func TestFormatMarkedHits(t *testing.T) {
+	tokens := createText("a", "*grumpy", "*cat", "and", "*dog")
+	assert.Equal(t, "a <b>grumpy cat</b> and <b>dog</b>", FormatMarkedHits(tokens, nil, HitMarkerBold))
+	assert.Equal(t, "a [grumpy cat] and [dog]", FormatMarkedHits(tokens, nil, HitMarkerBrackets))
+}
+
+func TestFormatMarkedHitsGlued(t *testing.T) {
+	tokens := createText("*cat", ",", "dog")
+	assert.Equal(t, "[cat], dog", FormatMarkedHits(tokens, []bool{false, true, false}, HitMarkerBrackets))
+}
+
+func TestSplitHitColumns(t *testing.T) {
+	tokens := createTokens("a", "*grumpy", "cat", "*sleeps", "here", "now")
+	assert.Equal(
+		t,
+		HitColumns{Left: "a", Hit: "grumpy cat sleeps", Right: "here now"},
+		SplitHitColumns(tokens, nil),
+	)
+}
+
+func TestSplitHitColumnsNoHit(t *testing.T) {
+	tokens := createTokens("a", "cat")
+	assert.Equal(t, HitColumns{Left: "a cat"}, SplitHitColumns(tokens, nil))
+}
+
+func TestHitMarkerValidate(t *testing.T) {
+	assert.NoError(t, DefaultHitMarker.Validate())
+	assert.NoError(t, HitMarkerColumns.Validate())
+	assert.Error(t, HitMarker("italic").Validate())
+}
+
+func TestParseRefPosition(t *testing.T) {
+	pos, err := ParseRefPosition("#4213")
+	assert.NoError(t, err)
+	assert.Equal(t, 4213, pos)
+	for _, ref := range []string{"", "4213", "#", "#-1", "#foo"} {
+		_, err := ParseRefPosition(ref)
+		assert.Error(t, err, ref)
+	}
+}
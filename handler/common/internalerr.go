@@ -0,0 +1,40 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// InternalErrorIdent returns a client-facing description of an internal
+// error (typically used as an identifier of the "general system error"
+// diagnostic). In case internal errors are not exposed, the error is logged
+// along with a correlation ID and only the ID is returned as internal error
+// messages may disclose e.g. file paths.
+func InternalErrorIdent(expose bool, err error) string {
+	if expose {
+		return err.Error()
+	}
+	ref := uuid.New().String()
+	log.Error().Err(err).Str("errorRef", ref).Msg("internal error reported to client")
+	return fmt.Sprintf("internal error ref. %s", ref)
+}
@@ -0,0 +1,212 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+)
+
+const (
+	prefetchCacheTTL        = 10 * time.Minute
+	prefetchCacheMaxEntries = 1000
+)
+
+type prefetchedLines struct {
+	concSize int
+	query    string
+	lines    []concordance.Line
+	created  time.Time
+
+	// wideLines are aligned with lines (if wide context is requested)
+	wideLines []concordance.Line
+}
+
+// covers tests whether the prefetched lines contain all the lines
+// (within the concordance) of the [fromLine, fromLine+maxItems) range.
+func (pl prefetchedLines) covers(fromLine, maxItems int) bool {
+	if fromLine >= pl.concSize {
+		return false
+	}
+	return min(fromLine+maxItems, pl.concSize) <= len(pl.lines)
+}
+
+// PrefetchCache stores concordance lines fetched in advance along with
+// the first page of a search so the following pages can be served
+// without involving workers. Lines are prefetched only for the first
+// page so users fetching just a single page cause only a limited
+// overhead (see `prefetchRecords` in the configuration).
+type PrefetchCache struct {
+	numPrefetch int
+	radapter    *rdb.Adapter
+	items       map[string]prefetchedLines
+	mu          sync.Mutex
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+}
+
+// prefetchKey identifies concordance lines regardless of the requested range
+func prefetchKey(args rdb.ConcQueryArgs) string {
+	return fmt.Sprintf(
+		"%s\x00%s\x00%s\x00%d\x00%s\x00%s\x00%d\x00%s\x00%s\x00%d",
+		args.CorpusPath, args.Query, strings.Join(args.Attrs, ","),
+		args.MaxContext, args.ViewContextStruct, args.Encoding, args.MinFormFreq,
+		args.GlueStruct, args.WideContextStruct, args.WideMaxContext,
+	)
+}
+
+func (pc *PrefetchCache) get(key string, fromLine, maxItems int) (result.ConcResult, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	v, ok := pc.items[key]
+	if !ok || time.Since(v.created) > prefetchCacheTTL || !v.covers(fromLine, maxItems) {
+		pc.misses.Add(1)
+		return result.ConcResult{}, false
+	}
+	pc.hits.Add(1)
+	toLine := min(fromLine+maxItems, v.concSize)
+	ans := result.ConcResult{
+		ConcSize: v.concSize,
+		Query:    v.query,
+		Lines:    v.lines[fromLine:toLine],
+	}
+	if v.wideLines != nil {
+		ans.WideLines = v.wideLines[fromLine:min(toLine, len(v.wideLines))]
+	}
+	return ans, true
+}
+
+func (pc *PrefetchCache) set(key string, res result.ConcResult) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if len(pc.items) >= prefetchCacheMaxEntries {
+		var oldestKey string
+		var oldest time.Time
+		for k, v := range pc.items {
+			if time.Since(v.created) > prefetchCacheTTL {
+				delete(pc.items, k)
+
+			} else if oldestKey == "" || v.created.Before(oldest) {
+				oldestKey = k
+				oldest = v.created
+			}
+		}
+		if len(pc.items) >= prefetchCacheMaxEntries {
+			delete(pc.items, oldestKey)
+		}
+	}
+	pc.items[key] = prefetchedLines{
+		concSize:  res.ConcSize,
+		query:     res.Query,
+		lines:     res.Lines,
+		created:   time.Now(),
+		wideLines: res.WideLines,
+	}
+}
+
+// publish sends the query to workers. Identical queries
+// being processed at the same time (e.g. repeated requests)
+// are processed just once.
+func (pc *PrefetchCache) publish(ctx context.Context, query rdb.Query) (<-chan result.ConcResult, error) {
+	query.IdempotencyKey = query.ArgsKey()
+	return pc.radapter.PublishQuery(ctx, query)
+}
+
+// PublishConcQuery works like rdb.Adapter.PublishQuery for concordance
+// queries but it uses prefetched lines if possible. For the first page,
+// additional lines are requested and stored for the following pages.
+// Queries requiring collocations or facets are always passed to workers.
+func (pc *PrefetchCache) PublishConcQuery(ctx context.Context, query rdb.Query) (<-chan result.ConcResult, error) {
+	args := query.Args
+	if pc.numPrefetch == 0 || args.CollocMaxItems > 0 || len(args.FacetAttrs) > 0 || args.MaxItems == 0 {
+		return pc.publish(ctx, query)
+	}
+	key := prefetchKey(args)
+	if res, ok := pc.get(key, args.StartLine, args.MaxItems); ok {
+		ans := make(chan result.ConcResult, 1)
+		ans <- res
+		close(ans)
+		return ans, nil
+	}
+	if args.StartLine > 0 {
+		return pc.publish(ctx, query)
+	}
+	maxItems := args.MaxItems
+	query.Args.MaxItems = min(maxItems+pc.numPrefetch, mango.MaxRecordsInternalLimit)
+	wait, err := pc.publish(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	ans := make(chan result.ConcResult, 1)
+	go func() {
+		defer close(ans)
+		res, ok := <-wait
+		if !ok {
+			return
+		}
+		if res.Error == nil {
+			pc.set(key, res)
+			res.Lines = res.Lines[:min(maxItems, len(res.Lines))]
+			if res.WideLines != nil {
+				res.WideLines = res.WideLines[:min(maxItems, len(res.WideLines))]
+			}
+		}
+		ans <- res
+	}()
+	return ans, nil
+}
+
+// Stats returns current size of the cache and numbers
+// of hits and misses since the cache has been created.
+func (pc *PrefetchCache) Stats() general.CacheStats {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return general.CacheStats{
+		Size:   len(pc.items),
+		Hits:   pc.hits.Load(),
+		Misses: pc.misses.Load(),
+	}
+}
+
+// Invalidate removes all the prefetched lines. It should be called
+// each time corpora data change.
+func (pc *PrefetchCache) Invalidate() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.items = make(map[string]prefetchedLines)
+}
+
+func NewPrefetchCache(conf *corpus.CorporaSetup, radapter *rdb.Adapter) *PrefetchCache {
+	return &PrefetchCache{
+		numPrefetch: conf.PrefetchRecords,
+		radapter:    radapter,
+		items:       make(map[string]prefetchedLines),
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func createLines(n int) []concordance.Line {
+	ans := make([]concordance.Line, n)
+	for i := range ans {
+		ans[i] = concordance.Line{
+			Text: concordance.TokenSlice{&concordance.Token{Word: fmt.Sprintf("w%d", i)}},
+		}
+	}
+	return ans
+}
+
+func TestPrefetchedLinesCovers(t *testing.T) {
+	pl := prefetchedLines{concSize: 100, lines: createLines(30)}
+	assert.True(t, pl.covers(0, 30))
+	assert.True(t, pl.covers(10, 20))
+	assert.False(t, pl.covers(10, 21))
+	assert.False(t, pl.covers(100, 10))
+}
+
+func TestPrefetchedLinesCoversConcEnd(t *testing.T) {
+	pl := prefetchedLines{concSize: 25, lines: createLines(25)}
+	assert.True(t, pl.covers(20, 10))
+	assert.False(t, pl.covers(25, 10))
+}
+
+func TestPrefetchCacheGet(t *testing.T) {
+	pc := NewPrefetchCache(&corpus.CorporaSetup{PrefetchRecords: 20}, nil)
+	pc.set("k1", result.ConcResult{ConcSize: 100, Query: "[word=\"x\"]", Lines: createLines(30)})
+	res, ok := pc.get("k1", 10, 10)
+	assert.True(t, ok)
+	assert.Equal(t, 100, res.ConcSize)
+	assert.Equal(t, "[word=\"x\"]", res.Query)
+	assert.Len(t, res.Lines, 10)
+	assert.Equal(t, "w10", res.Lines[0].Text.Tokens()[0].Word)
+
+	_, ok = pc.get("k1", 25, 10)
+	assert.False(t, ok)
+	_, ok = pc.get("k2", 0, 10)
+	assert.False(t, ok)
+	stats := pc.Stats()
+	assert.Equal(t, 1, stats.Size)
+	assert.Equal(t, uint64(1), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+}
+
+func TestPrefetchCachePublishUsesCachedLines(t *testing.T) {
+	pc := NewPrefetchCache(&corpus.CorporaSetup{PrefetchRecords: 20}, nil)
+	args := rdb.ConcQueryArgs{CorpusPath: "/corpora/c1", Query: "[word=\"x\"]", MaxItems: 10}
+	pc.set(prefetchKey(args), result.ConcResult{ConcSize: 30, Lines: createLines(30)})
+	args.StartLine = 10
+	wait, err := pc.PublishConcQuery(context.Background(), rdb.Query{Func: "concExample", Args: args})
+	assert.NoError(t, err)
+	res := <-wait
+	assert.Len(t, res.Lines, 10)
+	assert.Equal(t, "w10", res.Lines[0].Text.Tokens()[0].Word)
+}
+
+func TestPrefetchCacheInvalidate(t *testing.T) {
+	pc := NewPrefetchCache(&corpus.CorporaSetup{PrefetchRecords: 20}, nil)
+	pc.set("k1", result.ConcResult{ConcSize: 10, Lines: createLines(10)})
+	pc.Invalidate()
+	_, ok := pc.get("k1", 0, 10)
+	assert.False(t, ok)
+}
+
+func TestPrefetchCacheGetWideLines(t *testing.T) {
+	pc := NewPrefetchCache(&corpus.CorporaSetup{PrefetchRecords: 20}, nil)
+	pc.set("k1", result.ConcResult{ConcSize: 30, Lines: createLines(30), WideLines: createLines(30)})
+	res, ok := pc.get("k1", 10, 10)
+	assert.True(t, ok)
+	assert.Len(t, res.WideLines, 10)
+	assert.Equal(t, "w10", res.WideLines[0].Text.Tokens()[0].Word)
+
+	pc.set("k2", result.ConcResult{ConcSize: 30, Lines: createLines(30)})
+	res, ok = pc.get("k2", 10, 10)
+	assert.True(t, ok)
+	assert.Nil(t, res.WideLines)
+}
+
+func TestPrefetchKeyDistinguishesWideContext(t *testing.T) {
+	args := rdb.ConcQueryArgs{CorpusPath: "/corpora/c1", Query: "[word=\"x\"]"}
+	wideArgs := args
+	wideArgs.WideContextStruct = "s"
+	assert.NotEqual(t, prefetchKey(args), prefetchKey(wideArgs))
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// recordIDVersion is a version of the record ID encoding.
+	// It must be changed each time the encoding changes.
+	recordIDVersion = "1"
+
+	recordIDSeparator = "\x00"
+)
+
+var ErrInvalidRecordID = errors.New("invalid record ID")
+
+// EncodeRecordID creates an opaque (and stable) identifier of a record
+// (hit) from a resource PID and a corpus position of the first token
+// of the hit. The ID is URL safe and it starts with a version of the
+// encoding (e.g. `1.`) so it can be changed in the future.
+func EncodeRecordID(pid string, position int) string {
+	data := pid + recordIDSeparator + strconv.Itoa(position)
+	return recordIDVersion + "." + base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+// DecodeRecordID obtains a resource PID and a corpus position from
+// a record ID created by EncodeRecordID. In case the ID is malformed
+// or of an unsupported version, ErrInvalidRecordID is returned.
+func DecodeRecordID(recordID string) (pid string, position int, err error) {
+	version, encoded, ok := strings.Cut(recordID, ".")
+	if !ok || version != recordIDVersion {
+		return "", -1, ErrInvalidRecordID
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", -1, ErrInvalidRecordID
+	}
+	pid, rawPos, ok := strings.Cut(string(data), recordIDSeparator)
+	if !ok || pid == "" {
+		return "", -1, ErrInvalidRecordID
+	}
+	position, err = strconv.Atoi(rawPos)
+	if err != nil || position < 0 {
+		return "", -1, ErrInvalidRecordID
+	}
+	return pid, position, nil
+}
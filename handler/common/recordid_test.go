@@ -0,0 +1,48 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordIDRoundTrip(t *testing.T) {
+	recordID := EncodeRecordID("http://hdl.handle.net/11234/1-5000", 4213)
+	assert.Regexp(t, `^1\.[A-Za-z0-9_-]+$`, recordID)
+	pid, position, err := DecodeRecordID(recordID)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://hdl.handle.net/11234/1-5000", pid)
+	assert.Equal(t, 4213, position)
+}
+
+func TestDecodeRecordIDInvalid(t *testing.T) {
+	for _, recordID := range []string{
+		"",
+		"foo",
+		"2." + EncodeRecordID("corp1", 10)[2:], // unsupported version
+		"1.!!!",
+		EncodeRecordID("", 10),
+		EncodeRecordID("corp1", -1),
+	} {
+		_, _, err := DecodeRecordID(recordID)
+		assert.ErrorIs(t, err, ErrInvalidRecordID, recordID)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestKey identifies a response based on all the request
+// properties affecting it.
+func RequestKey(ctx *gin.Context, req *general.FCSGeneralRequest) string {
+	return fmt.Sprintf(
+		"%s|%s|%s|%s|%s|%s",
+		req.Version,
+		req.Format,
+		ctx.Request.URL.Query().Encode(),
+		req.Lang,
+		strings.Join(req.AcceptLanguages, ","),
+		req.XSLT,
+	)
+}
+
+// ExplainResponseKey identifies an explain response. Unlike RequestKey,
+// only the arguments affecting the explain response are taken into account
+// so clients cannot fill the response cache by varying unrelated
+// URL parameters.
+func ExplainResponseKey(
+	req *general.FCSGeneralRequest,
+	endpointDescription bool,
+	rscOffset string,
+) string {
+	var descKey string
+	if endpointDescription {
+		offset, err := strconv.Atoi(rscOffset)
+		if err != nil {
+			descKey = "desc|invalid"
+
+		} else {
+			descKey = fmt.Sprintf("desc|%d", offset)
+		}
+	}
+	return fmt.Sprintf(
+		"%s|%s|%s|%s|%s|%s",
+		req.Version,
+		req.Format,
+		descKey,
+		req.Lang,
+		strings.Join(req.AcceptLanguages, ","),
+		req.XSLT,
+	)
+}
+
+// ProduceCachedResponse writes a response stored in the `cache` under
+// the `key`. In case there is no such response, the `produce` function
+// is called to create it. Only responses marked by `produce` as cacheable
+// are stored, the other ones are written with the returned status code.
+// As cached responses change only with configuration, ETag and Last-Modified
+// headers are provided so clients can use conditional requests.
+func ProduceCachedResponse(
+	ctx *gin.Context,
+	cache *general.ResponseCache,
+	key string,
+	format general.ResponseFormat,
+	produce func() (body []byte, code int, cacheable bool, err error),
+) {
+	cached, ok := cache.Get(key)
+	if !ok {
+		body, code, cacheable, err := produce()
+		if err != nil {
+			log.Err(err).Msg("failed to encode a result")
+			http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !cacheable {
+			ctx.Writer.Header().Set("Content-Type", format.ContentType())
+			ctx.Writer.WriteHeader(code)
+			if _, err := ctx.Writer.Write(body); err != nil {
+				log.Err(err).Msg("failed to write response")
+			}
+			return
+		}
+		cached = cache.Set(key, body)
+	}
+	ctx.Writer.Header().Set("ETag", cached.ETag)
+	ctx.Writer.Header().Set("Last-Modified", cached.LastModified.Format(http.TimeFormat))
+	// the response (and so the ETag) depends on the preferred languages
+	ctx.Writer.Header().Add("Vary", "Accept-Language")
+	if cached.NotModified(ctx.Request) {
+		ctx.Writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ctx.Writer.Header().Set("Content-Type", format.ContentType())
+	ctx.Writer.WriteHeader(http.StatusOK)
+	if _, err := ctx.Writer.Write(cached.Body); err != nil {
+		log.Err(err).Msg("failed to write response")
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainResponseKeyNormalizesOffset(t *testing.T) {
+	req := &general.FCSGeneralRequest{Version: "2.0", Lang: "en"}
+	assert.Equal(t, ExplainResponseKey(req, true, "0"), ExplainResponseKey(req, true, "00"))
+	assert.NotEqual(t, ExplainResponseKey(req, true, "0"), ExplainResponseKey(req, true, "10"))
+	assert.Equal(t, ExplainResponseKey(req, true, "foo"), ExplainResponseKey(req, true, "bar"))
+}
+
+func TestExplainResponseKeyIgnoresOffsetWithoutDescription(t *testing.T) {
+	req := &general.FCSGeneralRequest{Version: "2.0", Lang: "en"}
+	assert.Equal(t, ExplainResponseKey(req, false, "0"), ExplainResponseKey(req, false, "10"))
+	assert.NotEqual(t, ExplainResponseKey(req, false, "0"), ExplainResponseKey(req, true, "0"))
+}
+
+func TestProduceCachedResponseVariesByLanguage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	ProduceCachedResponse(
+		ctx, general.NewResponseCache(0), "foo", general.ResponseFormatXML,
+		func() ([]byte, int, bool, error) {
+			return []byte("<foo />"), http.StatusOK, true, nil
+		},
+	)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+	assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"sync"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/rs/zerolog/log"
+)
+
+// ResourceSizes caches sizes (numbers of tokens) of the configured
+// resources. Obtaining a size requires a worker to open the corpus
+// so the sizes are probed once (on startup) and then only refreshed
+// on demand (see Invalidate).
+type ResourceSizes struct {
+	ctx      context.Context
+	conf     *corpus.CorporaSetup
+	radapter *rdb.Adapter
+	mutex    sync.RWMutex
+	sizes    map[string]int64
+	onUpdate []func()
+}
+
+// Get returns a size of a resource. In case the size
+// is not known (yet), false is returned.
+func (rs *ResourceSizes) Get(rscID string) (int64, bool) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	v, ok := rs.sizes[rscID]
+	return v, ok
+}
+
+// Total returns a total size of all the resources. In case
+// a size of any of the resources is not known, false is returned.
+func (rs *ResourceSizes) Total() (int64, bool) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	var ans int64
+	for _, rsc := range rs.conf.Resources {
+		v, ok := rs.sizes[rsc.ID]
+		if !ok {
+			return 0, false
+		}
+		ans += v
+	}
+	return ans, true
+}
+
+// OnUpdate registers a function called each time the sizes
+// are refreshed (e.g. to invalidate cached responses)
+func (rs *ResourceSizes) OnUpdate(fn func()) {
+	rs.onUpdate = append(rs.onUpdate, fn)
+}
+
+// Refresh obtains sizes of all the resources from workers.
+// Resources with failed probes are logged and left without size.
+func (rs *ResourceSizes) Refresh(ctx context.Context) {
+	sizes := make(map[string]int64)
+	for _, rsc := range rs.conf.Resources {
+		wait, err := rs.radapter.PublishQuery(ctx, rdb.Query{
+			Func:  "corpusSize",
+			Queue: rsc.WorkerQueue,
+			Args: rdb.ConcQueryArgs{
+				CorpusPath: rs.conf.GetRegistryPath(rsc.ID),
+			},
+		})
+		if err != nil {
+			log.Error().Err(err).Str("resource", rsc.ID).Msg("failed to probe resource size")
+			continue
+		}
+		res := <-wait
+		if res.Error != nil {
+			log.Error().Err(res.Error).Str("resource", rsc.ID).Msg("failed to probe resource size")
+			continue
+		}
+		sizes[rsc.ID] = res.CorpusSize
+	}
+	rs.mutex.Lock()
+	rs.sizes = sizes
+	rs.mutex.Unlock()
+	log.Info().
+		Int("numResources", len(sizes)).
+		Msg("resource sizes refreshed")
+	for _, fn := range rs.onUpdate {
+		fn()
+	}
+}
+
+// Stats provides information about cached sizes
+func (rs *ResourceSizes) Stats() general.CacheStats {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	return general.CacheStats{Size: len(rs.sizes)}
+}
+
+// Invalidate triggers refreshing of the sizes in the background
+// (e.g. once a corpus has been reindexed). The current sizes
+// are available until the refresh finishes.
+func (rs *ResourceSizes) Invalidate() {
+	go rs.Refresh(rs.ctx)
+}
+
+func NewResourceSizes(
+	ctx context.Context,
+	conf *corpus.CorporaSetup,
+	radapter *rdb.Adapter,
+) *ResourceSizes {
+	return &ResourceSizes{
+		ctx:      ctx,
+		conf:     conf,
+		radapter: radapter,
+		sizes:    make(map[string]int64),
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ScanFold specifies how values of a scanned index are folded
+// (i.e. which values are grouped into a single term)
+type ScanFold string
+
+const (
+	ScanFoldNone       ScanFold = ""
+	ScanFoldCase       ScanFold = "case"
+	ScanFoldDiacritics ScanFold = "diacritics"
+	ScanFoldAll        ScanFold = "all"
+)
+
+func (sf ScanFold) Validate() error {
+	if sf == ScanFoldNone || sf == ScanFoldCase || sf == ScanFoldDiacritics || sf == ScanFoldAll {
+		return nil
+	}
+	return fmt.Errorf("unknown scan fold: %s", sf)
+}
+
+// Apply returns a folded form of `value`
+func (sf ScanFold) Apply(value string) string {
+	if sf == ScanFoldDiacritics || sf == ScanFoldAll {
+		rmDiacritics := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+		if v, _, err := transform.String(rmDiacritics, value); err == nil {
+			value = v
+		}
+	}
+	if sf == ScanFoldCase || sf == ScanFoldAll {
+		value = strings.ToLower(value)
+	}
+	return value
+}
+
+var (
+	ErrInvalidScanClause    = errors.New("invalid scan clause")
+	ErrUnsupportedScanIndex = errors.New("unsupported scan index")
+)
+
+// ParseScanClause splits a CQL scan clause (e.g. `text.genre = "fiction"`
+// or just `text.genre`) into an index and a start term. Only the `=`
+// relation is supported.
+func ParseScanClause(clause string) (index, term string, err error) {
+	clause = strings.TrimSpace(clause)
+	idx := strings.IndexAny(clause, " \t=")
+	if idx < 0 {
+		return clause, "", nil
+	}
+	index = clause[:idx]
+	rest := strings.TrimSpace(clause[idx:])
+	if index == "" || rest == "" {
+		return "", "", ErrInvalidScanClause
+	}
+	rest, ok := strings.CutPrefix(rest, "=")
+	if !ok {
+		return "", "", ErrInvalidScanClause
+	}
+	term = strings.TrimSpace(rest)
+	if len(term) >= 2 && strings.HasPrefix(term, `"`) && strings.HasSuffix(term, `"`) {
+		term = strings.ReplaceAll(term[1:len(term)-1], `\"`, `"`)
+
+	} else if term == "" || strings.ContainsAny(term, " \t\"") {
+		return "", "", ErrInvalidScanClause
+	}
+	return index, term, nil
+}
+
+// mergeScanTerms merges alphabetically sorted lists of terms
+// obtained from different resources. Numbers of records of the same
+// values are summed and at most `maxTerms` terms are returned.
+// With folding, values with the same folded form are merged into
+// a single term represented by the most frequent of the values and
+// only the values with the folded form equal or greater than the folded
+// `term` are used (as resources may provide values regardless of the folding).
+func mergeScanTerms(lists [][]result.FacetItem, term string, fold ScanFold, maxTerms int) []result.FacetItem {
+	type group struct {
+		freq    int64
+		reprVal string
+		reprFrq int64
+	}
+	foldedTerm := fold.Apply(term)
+	forms := make(map[string]int64)
+	for _, list := range lists {
+		for _, item := range list {
+			forms[item.Value] += item.Freq
+		}
+	}
+	groups := make(map[string]*group)
+	for value, freq := range forms {
+		key := fold.Apply(value)
+		if fold != ScanFoldNone && key < foldedTerm {
+			continue
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{}
+			groups[key] = g
+		}
+		g.freq += freq
+		if freq > g.reprFrq || freq == g.reprFrq && value < g.reprVal {
+			g.reprVal = value
+			g.reprFrq = freq
+		}
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	// each resource provides its first `maxTerms` values so the first
+	// `maxTerms` merged values are complete (unlike the following ones)
+	keys = keys[:min(maxTerms, len(keys))]
+	ans := make([]result.FacetItem, len(keys))
+	for i, k := range keys {
+		ans[i] = result.FacetItem{Value: groups[k].reprVal, Freq: groups[k].freq}
+	}
+	return ans
+}
+
+// ScanResult contains terms obtained by ScanStructAttr along with
+// resources which could not contribute (or contributed just partially)
+type ScanResult struct {
+	Terms []result.FacetItem
+
+	// TimedOutRscs contains IDs of resources not answering in time
+	TimedOutRscs []string
+
+	// TruncatedRscs contains IDs of resources with too many values
+	// to be folded completely (see ScanStructAttr)
+	TruncatedRscs []string
+}
+
+// ScanStructAttr lists values of a structural attribute referenced by
+// `index` (a FCS-QL generic structure and an attribute, e.g. `text.genre`)
+// along with numbers of the structures (e.g. documents) having the values.
+// All the resources with the structure mapped (see corpus.StructureMapping)
+// are searched and their numbers are summed. In case the index does not
+// refer to an existing attribute, ErrUnsupportedScanIndex is returned.
+// For case folding, a lowercase variant of the attribute is used if
+// configured (see corpus.CorpusSetup.FoldedStructAttrs). Otherwise,
+// values are folded here which is limited to the first
+// mango.MaxStructAttrValuesInternalLimit values of each resource
+// (resources with more values are reported in ScanResult.TruncatedRscs).
+// Resources not answering before `ctx` is done are skipped and reported
+// along with the (partial) terms of the other resources.
+func ScanStructAttr(
+	ctx context.Context,
+	radapter *rdb.Adapter,
+	conf *corpus.CorporaSetup,
+	index, term string,
+	fold ScanFold,
+	maxTerms int,
+) (ScanResult, error) {
+	genStruct, attr, ok := strings.Cut(index, ".")
+	if !ok || attr == "" {
+		return ScanResult{}, ErrUnsupportedScanIndex
+	}
+	var ans ScanResult
+	rscIDs := make([]string, 0, len(conf.Resources))
+	waits := make([]<-chan result.ConcResult, 0, len(conf.Resources))
+	// foldedHere tells (for each of the waits) whether all the values
+	// have been requested to be folded here
+	foldedHere := make([]bool, 0, len(conf.Resources))
+	for _, rsc := range conf.Resources {
+		structName := rsc.StructureMapping.GetStructure(genStruct)
+		if structName == "" {
+			continue
+		}
+		args := rdb.ConcQueryArgs{
+			CorpusPath: conf.GetRegistryPath(rsc.ID),
+			Encoding:   rsc.Encoding,
+			ScanAttr:   structName + "." + attr,
+			ScanFrom:   term,
+			MaxItems:   maxTerms,
+		}
+		var isFoldedHere bool
+		if folded, ok := rsc.FoldedStructAttrs[args.ScanAttr]; ok && fold == ScanFoldCase {
+			args.ScanAttr = folded
+			args.ScanFrom = fold.Apply(term)
+
+		} else if fold != ScanFoldNone {
+			// folded forms may be sorted differently, we must
+			// obtain as many values as possible
+			args.ScanFrom = ""
+			args.MaxItems = mango.MaxStructAttrValuesInternalLimit
+			isFoldedHere = true
+		}
+		wait, err := radapter.PublishQuery(ctx, rdb.Query{
+			Func:  "structAttrValues",
+			Queue: rsc.WorkerQueue,
+			Args:  args,
+		})
+		if errors.Is(err, context.DeadlineExceeded) {
+			ans.TimedOutRscs = append(ans.TimedOutRscs, rsc.ID)
+			continue
+
+		} else if err != nil {
+			return ScanResult{}, err
+		}
+		rscIDs = append(rscIDs, rsc.ID)
+		waits = append(waits, wait)
+		foldedHere = append(foldedHere, isFoldedHere)
+	}
+	lists := make([][]result.FacetItem, 0, len(waits))
+	for i, wait := range waits {
+		res := AwaitResult(ctx, wait)
+		if errors.Is(res.Error, context.DeadlineExceeded) {
+			ans.TimedOutRscs = append(ans.TimedOutRscs, rscIDs[i])
+			continue
+
+		} else if res.HasStructAttrNotFoundError() {
+			// resources may differ in available metadata
+			continue
+
+		} else if res.Error != nil {
+			return ScanResult{}, fmt.Errorf("failed to scan resource %s: %w", rscIDs[i], res.Error)
+		}
+		for _, values := range res.Facets {
+			lists = append(lists, values)
+			if foldedHere[i] && len(values) >= mango.MaxStructAttrValuesInternalLimit {
+				ans.TruncatedRscs = append(ans.TruncatedRscs, rscIDs[i])
+			}
+		}
+	}
+	if len(lists) == 0 && len(ans.TimedOutRscs) == 0 {
+		return ScanResult{}, ErrUnsupportedScanIndex
+	}
+	ans.Terms = mergeScanTerms(lists, term, fold, maxTerms)
+	return ans, nil
+}
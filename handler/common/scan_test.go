@@ -0,0 +1,133 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScanClauseIndexOnly(t *testing.T) {
+	index, term, err := ParseScanClause(" text.genre ")
+	assert.NoError(t, err)
+	assert.Equal(t, "text.genre", index)
+	assert.Equal(t, "", term)
+}
+
+func TestParseScanClauseWithTerm(t *testing.T) {
+	index, term, err := ParseScanClause("text.genre = fiction")
+	assert.NoError(t, err)
+	assert.Equal(t, "text.genre", index)
+	assert.Equal(t, "fiction", term)
+
+	index, term, err = ParseScanClause(`text.title="The \"Best\" Novel"`)
+	assert.NoError(t, err)
+	assert.Equal(t, "text.title", index)
+	assert.Equal(t, `The "Best" Novel`, term)
+}
+
+func TestParseScanClauseInvalid(t *testing.T) {
+	for _, clause := range []string{
+		"= fiction",
+		"text.genre fiction",
+		"text.genre > fiction",
+		"text.genre = two words",
+		"text.genre =",
+	} {
+		_, _, err := ParseScanClause(clause)
+		assert.ErrorIs(t, err, ErrInvalidScanClause, clause)
+	}
+}
+
+func TestMergeScanTerms(t *testing.T) {
+	terms := mergeScanTerms(
+		[][]result.FacetItem{
+			{{Value: "fiction", Freq: 10}, {Value: "poetry", Freq: 2}},
+			{{Value: "essay", Freq: 3}, {Value: "fiction", Freq: 5}},
+		},
+		"",
+		ScanFoldNone,
+		3,
+	)
+	assert.Equal(
+		t,
+		[]result.FacetItem{
+			{Value: "essay", Freq: 3},
+			{Value: "fiction", Freq: 15},
+			{Value: "poetry", Freq: 2},
+		},
+		terms,
+	)
+}
+
+func TestMergeScanTermsLimit(t *testing.T) {
+	terms := mergeScanTerms(
+		[][]result.FacetItem{
+			{{Value: "b", Freq: 1}, {Value: "c", Freq: 1}},
+			{{Value: "a", Freq: 1}, {Value: "d", Freq: 1}},
+		},
+		"",
+		ScanFoldNone,
+		2,
+	)
+	assert.Equal(t, []result.FacetItem{{Value: "a", Freq: 1}, {Value: "b", Freq: 1}}, terms)
+}
+
+func TestScanFoldApply(t *testing.T) {
+	assert.Equal(t, "Čáp", ScanFoldNone.Apply("Čáp"))
+	assert.Equal(t, "čáp", ScanFoldCase.Apply("Čáp"))
+	assert.Equal(t, "Cap", ScanFoldDiacritics.Apply("Čáp"))
+	assert.Equal(t, "cap", ScanFoldAll.Apply("Čáp"))
+	assert.Error(t, ScanFold("foo").Validate())
+}
+
+func TestMergeScanTermsFolded(t *testing.T) {
+	terms := mergeScanTerms(
+		[][]result.FacetItem{
+			{{Value: "Dog", Freq: 2}, {Value: "cat", Freq: 4}, {Value: "dog", Freq: 5}},
+			{{Value: "Cat", Freq: 1}, {Value: "DOG", Freq: 1}},
+		},
+		"",
+		ScanFoldCase,
+		10,
+	)
+	assert.Equal(
+		t,
+		[]result.FacetItem{{Value: "cat", Freq: 5}, {Value: "dog", Freq: 8}},
+		terms,
+	)
+}
+
+func TestMergeScanTermsFoldedFromTerm(t *testing.T) {
+	terms := mergeScanTerms(
+		[][]result.FacetItem{
+			{{Value: "Apple", Freq: 1}, {Value: "Dog", Freq: 2}, {Value: "čáp", Freq: 3}},
+		},
+		"Ca",
+		ScanFoldAll,
+		10,
+	)
+	assert.Equal(
+		t,
+		[]result.FacetItem{{Value: "čáp", Freq: 3}, {Value: "Dog", Freq: 2}},
+		terms,
+	)
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SuggestionCandidates returns alternative basic (CQL) queries tested
+// in case a search returns no results. Only queries consisting of a single
+// word are supported (for other queries, nil is returned). The candidates
+// are the word with a different letter case and the word searched
+// as a lemma (using the `lemma:` layer shorthand).
+func SuggestionCandidates(query string) []string {
+	word := strings.TrimSpace(query)
+	if word == "" || strings.ContainsAny(word, " \t\n\"():") {
+		return nil
+	}
+	switch strings.ToUpper(word) {
+	case "AND", "OR", "NOT":
+		return nil
+	}
+	ans := make([]string, 0, 2)
+	lower := strings.ToLower(word)
+	if lower != word {
+		ans = append(ans, lower)
+
+	} else if first, size := utf8.DecodeRuneInString(word); unicode.IsLower(first) {
+		ans = append(ans, string(unicode.ToUpper(first))+word[size:])
+	}
+	return append(ans, "lemma:"+lower)
+}
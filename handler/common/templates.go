@@ -23,6 +23,7 @@ import (
 	"text/template"
 
 	"github.com/czcorpus/cnc-gokit/strutil"
+	"github.com/czcorpus/mquery-sru/i18n"
 )
 
 func GetTemplateFunctions() template.FuncMap {
@@ -38,8 +39,8 @@ func GetTemplateFunctions() template.FuncMap {
 			return strutil.SmartTruncate(s, 200)
 		},
 		"enMsgFrom": func(msg map[string]string) string {
-			v, ok := msg["en"]
-			if !ok {
+			v, _ := i18n.Resolve(msg, nil, i18n.DefaultLanguage)
+			if v == "" {
 				return "??"
 			}
 			return v
@@ -0,0 +1,98 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import "time"
+
+// RscWait is a time spent waiting for a result of a resource
+type RscWait struct {
+	Rsc  string
+	Wait time.Duration
+}
+
+// SearchTimings collects durations of individual phases of a search
+// (for debugging purposes). Durations of phases repeated for multiple
+// resources (translation, publishing) are summed. Waits for resources
+// are measured from the start of the respective waiting phase as
+// results are collected sequentially while workers run in parallel.
+type SearchTimings struct {
+	Translate time.Duration
+	Publish   time.Duration
+	RscWaits  []RscWait
+	Merge     time.Duration
+	Total     time.Duration
+
+	start      time.Time
+	waitStart  time.Time
+	mergeStart time.Time
+}
+
+// AddTranslate adds time elapsed since `since` to the translation phase
+func (st *SearchTimings) AddTranslate(since time.Time) {
+	st.Translate += time.Since(since)
+}
+
+// AddPublish adds time elapsed since `since` to the publishing phase
+func (st *SearchTimings) AddPublish(since time.Time) {
+	st.Publish += time.Since(since)
+}
+
+// StartWaiting marks the start of a phase of collecting worker results
+func (st *SearchTimings) StartWaiting() {
+	st.waitStart = time.Now()
+}
+
+// AddRscWait records that a result of the resource `rsc` has been
+// obtained. In case the resource has been waited for already (e.g.
+// when its lines are re-fetched), the wait is added to the previous one.
+func (st *SearchTimings) AddRscWait(rsc string) {
+	wait := time.Since(st.waitStart)
+	for i, v := range st.RscWaits {
+		if v.Rsc == rsc {
+			st.RscWaits[i].Wait += wait
+			return
+		}
+	}
+	st.RscWaits = append(st.RscWaits, RscWait{Rsc: rsc, Wait: wait})
+}
+
+// StartMerge marks the start of merging of the results
+func (st *SearchTimings) StartMerge() {
+	st.mergeStart = time.Now()
+}
+
+// Finish calculates the merge phase (if started) and the total time
+func (st *SearchTimings) Finish() {
+	if !st.mergeStart.IsZero() {
+		st.Merge = time.Since(st.mergeStart)
+	}
+	st.Total = time.Since(st.start)
+}
+
+// DurationMillis converts a duration into (fractional) milliseconds
+func DurationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func NewSearchTimings() *SearchTimings {
+	return &SearchTimings{
+		start:    time.Now(),
+		RscWaits: make([]RscWait, 0, 5),
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTimingsRscWaits(t *testing.T) {
+	st := NewSearchTimings()
+	st.StartWaiting()
+	st.AddRscWait("corp1")
+	st.AddRscWait("corp2")
+	first := st.RscWaits[0].Wait
+	st.StartWaiting()
+	time.Sleep(time.Millisecond)
+	st.AddRscWait("corp1")
+	assert.Len(t, st.RscWaits, 2)
+	assert.Equal(t, "corp1", st.RscWaits[0].Rsc)
+	assert.Equal(t, "corp2", st.RscWaits[1].Rsc)
+	assert.GreaterOrEqual(t, st.RscWaits[0].Wait, first+time.Millisecond)
+}
+
+func TestSearchTimingsFinish(t *testing.T) {
+	st := NewSearchTimings()
+	st.Finish()
+	assert.Zero(t, st.Merge)
+	st.StartMerge()
+	time.Sleep(time.Millisecond)
+	st.Finish()
+	assert.GreaterOrEqual(t, st.Merge, time.Millisecond)
+	assert.GreaterOrEqual(t, st.Total, st.Merge)
+}
+
+func TestDurationMillis(t *testing.T) {
+	assert.Equal(t, 1.5, DurationMillis(1500*time.Microsecond))
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+	"github.com/czcorpus/mquery-sru/query/parser/basic"
+	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
+)
+
+const (
+	QueryTypeCQL = "cql"
+	QueryTypeFCS = "fcs"
+)
+
+// TranslateQuery translates a basic (`cql`, the default) or an advanced
+// (`fcs`) query into a Manatee CQL query for a resource. This is intended
+// for non-SRU endpoints which do not need detailed diagnostics. Queries
+// of a type the resource does not support are rejected (the same way
+// the searchRetrieve operation does).
+func TranslateQuery(
+	conf *corpus.CorporaSetup,
+	rsc *corpus.CorpusSetup,
+	q, queryType string,
+) (string, error) {
+	if queryType == "" {
+		queryType = QueryTypeCQL
+	}
+	if queryType == QueryTypeCQL && !rsc.IsBasicSearchSupported() ||
+		queryType == QueryTypeFCS && !rsc.IsAdvancedSearchSupported() {
+		return "", fmt.Errorf("resource %s does not support the query type %s", rsc.PID, queryType)
+	}
+	q, err := rsc.ExpandQueryMacros(q, queryType == QueryTypeFCS)
+	if err != nil {
+		return "", fmt.Errorf("invalid query: %w", err)
+	}
+	var ast compiler.AST
+	switch queryType {
+	case QueryTypeCQL:
+		if conf.QueryNormalization {
+			q = query.NormalizeQuery(q)
+		}
+		ast, err = basic.ParseQuery(q, rsc.PosAttrs, rsc.StructureMapping)
+	case QueryTypeFCS:
+		var fAST *fcsql.Query
+		fAST, err = fcsql.ParseQuery(q, rsc.PosAttrs, rsc.StructureMapping, rsc.QueryRewriteRules)
+		if err == nil && !conf.AllowUnboundedQueries && fAST.IsUnbounded() {
+			err = fcsql.ErrUnboundedQuery
+		}
+		ast = fAST
+	default:
+		return "", fmt.Errorf("unsupported query type: %s", queryType)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid query syntax: %w", err)
+	}
+	ans := ast.Generate()
+	if len(ast.Errors()) > 0 {
+		return "", ast.Errors()[0]
+	}
+	return ans, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/stretchr/testify/assert"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func createTranslateTestRsc() *corpus.CorpusSetup {
+	return &corpus.CorpusSetup{
+		ID:  "corp1",
+		PID: "pid1",
+		PosAttrs: []corpus.PosAttr{
+			{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+		},
+	}
+}
+
+func TestTranslateQuery(t *testing.T) {
+	rsc := createTranslateTestRsc()
+	q, err := TranslateQuery(&corpus.CorporaSetup{}, rsc, "dog", "")
+	assert.NoError(t, err)
+	assert.Equal(t, `[word="dog"]`, q)
+	q, err = TranslateQuery(&corpus.CorporaSetup{}, rsc, `[word="dog"]`, QueryTypeFCS)
+	assert.NoError(t, err)
+	assert.Equal(t, `[word="dog"]`, q)
+	_, err = TranslateQuery(&corpus.CorporaSetup{}, rsc, "dog", "lex")
+	assert.Error(t, err)
+}
+
+func TestTranslateQueryUnsupportedType(t *testing.T) {
+	rsc := createTranslateTestRsc()
+	rsc.SupportsBasic = boolPtr(false)
+	_, err := TranslateQuery(&corpus.CorporaSetup{}, rsc, "dog", "")
+	assert.ErrorContains(t, err, "resource pid1 does not support the query type cql")
+	_, err = TranslateQuery(&corpus.CorporaSetup{}, rsc, `[word="dog"]`, QueryTypeFCS)
+	assert.NoError(t, err)
+
+	rsc = createTranslateTestRsc()
+	rsc.SupportsAdvanced = boolPtr(false)
+	_, err = TranslateQuery(&corpus.CorporaSetup{}, rsc, `[word="dog"]`, QueryTypeFCS)
+	assert.ErrorContains(t, err, "resource pid1 does not support the query type fcs")
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"github.com/czcorpus/mquery-sru/general"
+)
+
+// ValidationErrors collects errors of invalid request arguments
+// so clients can fix all of them in a single round trip.
+type ValidationErrors struct {
+	Errors []general.FCSError
+	Status int
+	lang   string
+}
+
+// Add adds an error with a default message. In case of multiple
+// errors, "bad request" status takes precedence over other ones.
+func (ve *ValidationErrors) Add(status int, code general.DiagnosticCode, ident string) {
+	ve.AddWithMsg(status, code, ident, code.AsMessage(ve.lang))
+}
+
+// AddWithMsg adds an error with a custom message
+func (ve *ValidationErrors) AddWithMsg(status int, code general.DiagnosticCode, ident, message string) {
+	ve.Errors = append(ve.Errors, general.FCSError{Code: code, Ident: ident, Message: message})
+	if ve.Status == 0 || status == general.ConformantStatusBadRequest {
+		ve.Status = status
+	}
+}
+
+func (ve *ValidationErrors) HasErrors() bool {
+	return len(ve.Errors) > 0
+}
+
+func NewValidationErrors(lang string) *ValidationErrors {
+	return &ValidationErrors{lang: lang}
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationErrorsBadRequestTakesPrecedence(t *testing.T) {
+	general.SetStrictHTTPStatus(true)
+	defer general.SetStrictHTTPStatus(false)
+	ve := NewValidationErrors("en")
+	assert.False(t, ve.HasErrors())
+	ve.Add(general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue, "startRecord")
+	ve.Add(general.ConformantStatusBadRequest, general.DCMandatoryParameterNotSupplied, "fcs_query")
+	ve.AddWithMsg(general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue, "maximumRecords", "foo")
+	assert.True(t, ve.HasErrors())
+	assert.Len(t, ve.Errors, 3)
+	assert.Equal(t, general.DCUnsupportedParameterValue.AsMessage("en"), ve.Errors[0].Message)
+	assert.Equal(t, "foo", ve.Errors[2].Message)
+	assert.Equal(t, http.StatusBadRequest, ve.Status)
+}
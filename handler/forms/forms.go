@@ -0,0 +1,159 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package forms
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/handler/common"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	dfltMaxItems = 20
+)
+
+type Form struct {
+	Value string `json:"value"`
+	Freq  int64  `json:"freq"`
+}
+
+type FormsResponse struct {
+	PID   string `json:"pid"`
+	Lemma string `json:"lemma"`
+	Forms []Form `json:"forms"`
+}
+
+// lemmaQuery creates a CQL query matching the `lemma` literally
+// (i.e. with all the regexp special characters and quotes escaped)
+func lemmaQuery(lemmaAttr, lemma string) string {
+	return fmt.Sprintf(
+		"[%s=\"%s\"]",
+		lemmaAttr,
+		strings.ReplaceAll(regexp.QuoteMeta(lemma), "\"", "\\\""),
+	)
+}
+
+// FormsHandler provides word forms (along with their frequencies)
+// a lemma expands to. This helps users understand and refine
+// lemma based queries before running full searches.
+type FormsHandler struct {
+	serverInfo *cnf.ServerInfo
+	conf       *corpus.CorporaSetup
+	radapter   *rdb.Adapter
+}
+
+func (a *FormsHandler) Handle(ctx *gin.Context) {
+	rscConf, err := a.conf.Resources.GetResourceByPID(ctx.Query("resource"))
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+	}
+	lemma := ctx.Query("lemma")
+	if lemma == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("missing lemma"), http.StatusBadRequest)
+		return
+	}
+	maxItems := dfltMaxItems
+	if v := ctx.Query("maxItems"); v != "" {
+		maxItems, err = strconv.Atoi(v)
+		if err != nil || maxItems < 1 || maxItems > mango.MaxFreqItemsInternalLimit {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("maxItems must be between 1 and %d", mango.MaxFreqItemsInternalLimit),
+				http.StatusBadRequest,
+			)
+			return
+		}
+	}
+	lemmaAttr := rscConf.GetLayerDefault(corpus.LayerTypeLemma)
+	if lemmaAttr.Name == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("resource %s does not provide lemmas", rscConf.PID),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	wait, err := a.radapter.PublishQuery(ctx.Request.Context(), rdb.Query{
+		Func:  "lemmaForms",
+		Queue: rscConf.WorkerQueue,
+		Args: rdb.ConcQueryArgs{
+			CorpusPath: a.conf.GetRegistryPath(rscConf.ID),
+			Query:      lemmaQuery(lemmaAttr.Name, lemma),
+			FormsAttr:  rscConf.GetLayerDefault(corpus.LayerTypeText).Name,
+			MaxItems:   maxItems,
+			Encoding:   rscConf.Encoding,
+		},
+	})
+	if err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err)),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	res := <-wait
+	if res.Error != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error)),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	ans := FormsResponse{
+		PID:   rscConf.PID,
+		Lemma: lemma,
+		Forms: collections.SliceMap(
+			res.Forms,
+			func(item result.FacetItem, i int) Form {
+				return Form{Value: item.Value, Freq: item.Freq}
+			},
+		),
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+func NewFormsHandler(
+	serverInfo *cnf.ServerInfo,
+	conf *corpus.CorporaSetup,
+	radapter *rdb.Adapter,
+) *FormsHandler {
+	return &FormsHandler{
+		serverInfo: serverInfo,
+		conf:       conf,
+		radapter:   radapter,
+	}
+}
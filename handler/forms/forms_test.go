@@ -0,0 +1,93 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package forms
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func handleForms(t *testing.T, url string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewFormsHandler(
+		&cnf.ServerInfo{},
+		&corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				&corpus.CorpusSetup{
+					ID:  "corp1",
+					PID: "pid1",
+					PosAttrs: []corpus.PosAttr{
+						{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+						{Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+					},
+				},
+				&corpus.CorpusSetup{
+					ID:  "corp2",
+					PID: "pid2",
+					PosAttrs: []corpus.PosAttr{
+						{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+					},
+				},
+			},
+		},
+		nil,
+	)
+	engine := gin.New()
+	engine.GET("/forms", h.Handle)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	return rec
+}
+
+func TestHandleUnknownResource(t *testing.T) {
+	rec := handleForms(t, "/forms?resource=unknown&lemma=dog")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleMissingLemma(t *testing.T) {
+	rec := handleForms(t, "/forms?resource=pid1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing lemma")
+}
+
+func TestHandleInvalidMaxItems(t *testing.T) {
+	for _, v := range []string{"foo", "0", "1000000"} {
+		rec := handleForms(t, "/forms?resource=pid1&lemma=dog&maxItems="+v)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "maxItems")
+	}
+}
+
+func TestHandleResourceWithoutLemmas(t *testing.T) {
+	rec := handleForms(t, "/forms?resource=pid2&lemma=dog")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "does not provide lemmas")
+}
+
+func TestLemmaQuery(t *testing.T) {
+	assert.Equal(t, `[lemma="dog"]`, lemmaQuery("lemma", "dog"))
+	assert.Equal(t, `[lemma="a\.b\*"]`, lemmaQuery("lemma", "a.b*"))
+	assert.Equal(t, `[lemma="\"x\""]`, lemmaQuery("lemma", `"x"`))
+}
@@ -19,12 +19,18 @@
 package handler
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	v12 "github.com/czcorpus/mquery-sru/handler/v12"
 	v20 "github.com/czcorpus/mquery-sru/handler/v20"
+	"github.com/czcorpus/mquery-sru/i18n"
 	"github.com/czcorpus/mquery-sru/rdb"
 
 	"github.com/gin-gonic/gin"
@@ -47,8 +53,12 @@ type FCSSubHandler interface {
 }
 
 type FCSHandler struct {
-	conf     *corpus.CorporaSetup
-	radapter *rdb.Adapter
+	serverInfo *cnf.ServerInfo
+	conf       *corpus.CorporaSetup
+	radapter   *rdb.Adapter
+	respCache  *general.ResponseCache
+	prefetch   *common.PrefetchCache
+	debugMode  bool
 
 	versions map[string]FCSSubHandler
 }
@@ -56,15 +66,66 @@ type FCSHandler struct {
 func (a *FCSHandler) FCSHandler(ctx *gin.Context) {
 	a.handleWithXSLT(
 		ctx,
+		general.ResponseFormatXML,
 		map[string]string{},
 	)
 }
 
-func (a *FCSHandler) handleWithXSLT(ctx *gin.Context, xslt map[string]string) {
+// FCSHandlerWithFormat returns a handler producing responses in
+// the specified format. This is for clients which cannot easily
+// negotiate the format (e.g. `/search.json`).
+func (a *FCSHandler) FCSHandlerWithFormat(format general.ResponseFormat) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		a.handleWithXSLT(ctx, format, map[string]string{})
+	}
+}
+
+// JobsPreview handles a FCS 2.0 searchRetrieve request without executing
+// the search. Instead, worker jobs (one per searched resource) the search
+// would publish are returned in the debug data of a JSON response.
+// This is intended for debugging of query translation and it works only
+// in the debug mode (otherwise, 404 is returned even if the route is registered).
+func (a *FCSHandler) JobsPreview(ctx *gin.Context) {
+	if !a.debugMode {
+		uniresp.NotFoundHandler(ctx)
+		return
+	}
+	if ctx.DefaultQuery("version", DefaultVersion) != Version20 ||
+		ctx.Query("operation") != "searchRetrieve" {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New("only searchRetrieve operation of version 2.0 can be previewed"),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	ctx.Set(common.JobsPreviewKey, true)
+	a.handleWithXSLT(ctx, general.ResponseFormatJSON, map[string]string{})
+}
+
+func (a *FCSHandler) handleWithXSLT(
+	ctx *gin.Context,
+	format general.ResponseFormat,
+	xslt map[string]string,
+) {
 	req := general.FCSGeneralRequest{
+		Format:  format,
 		Version: ctx.DefaultQuery("version", DefaultVersion),
 		Fatal:   false,
 		Errors:  make([]general.FCSError, 0, 10),
+		Lang:    general.NegotiateLanguage(ctx.GetHeader("Accept-Language")),
+
+		AcceptLanguages: i18n.ParseAcceptLanguage(ctx.GetHeader("Accept-Language")),
+	}
+	if db := ctx.Param("database"); db != "" && "/"+db != a.serverInfo.DatabasePath() {
+		req.AddError(general.FCSError{
+			Code:    general.DCDatabaseDoesNotExist,
+			Ident:   db,
+			Message: "Database does not exist: " + db,
+		})
+	}
+	if limitErr, ok := ctx.Get(requestLimitErrorKey); ok {
+		req.AddError(limitErr.(general.FCSError))
 	}
 	handler, ok := a.versions[req.Version]
 	if !ok {
@@ -77,22 +138,47 @@ func (a *FCSHandler) handleWithXSLT(ctx *gin.Context, xslt map[string]string) {
 		})
 	}
 	logging.AddLogEvent(ctx, "version", req.Version)
+	logging.AddLogEvent(ctx, "format", req.Format)
 	handler.Handle(ctx, req, xslt)
 }
 
+// ResponseCache returns the cache of serialized (explain) responses
+func (a *FCSHandler) ResponseCache() *general.ResponseCache {
+	return a.respCache
+}
+
+// PrefetchCache returns the cache of prefetched concordance lines
+func (a *FCSHandler) PrefetchCache() *common.PrefetchCache {
+	return a.prefetch
+}
+
+// InvalidateResponseCache removes all the cached responses.
+// It must be called once the configuration is (re)loaded.
+func (a *FCSHandler) InvalidateResponseCache() {
+	a.respCache.Invalidate()
+}
+
 func NewFCSHandler(
 	serverInfo *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
 	radapter *rdb.Adapter,
+	rscSizes *common.ResourceSizes,
+	debugMode bool,
 ) *FCSHandler {
+	respCache := general.NewResponseCache(general.DfltResponseCacheMaxItems)
+	prefetch := common.NewPrefetchCache(corporaConf, radapter)
 	return &FCSHandler{
-		conf:     corporaConf,
-		radapter: radapter,
+		serverInfo: serverInfo,
+		conf:       corporaConf,
+		radapter:   radapter,
+		respCache:  respCache,
+		prefetch:   prefetch,
+		debugMode:  debugMode,
 		versions: map[string]FCSSubHandler{
 			Version12: v12.NewFCSSubHandlerV12(
-				serverInfo, corporaConf, radapter),
+				serverInfo, corporaConf, radapter, debugMode, respCache, rscSizes, prefetch),
 			Version20: v20.NewFCSSubHandlerV20(
-				serverInfo, corporaConf, radapter),
+				serverInfo, corporaConf, radapter, debugMode, respCache, rscSizes, prefetch),
 		},
 	}
 }
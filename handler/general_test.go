@@ -0,0 +1,135 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSubHandler struct {
+	req general.FCSGeneralRequest
+}
+
+func (h *recordingSubHandler) Handle(
+	ctx *gin.Context,
+	fcsGeneralRequest general.FCSGeneralRequest,
+	xslt map[string]string,
+) {
+	h.req = fcsGeneralRequest
+}
+
+func handleDatabasePath(t *testing.T, path string) general.FCSGeneralRequest {
+	gin.SetMode(gin.TestMode)
+	sub := &recordingSubHandler{}
+	h := &FCSHandler{
+		serverInfo: &cnf.ServerInfo{Database: "/fcs-corpora/"},
+		versions:   map[string]FCSSubHandler{Version20: sub},
+	}
+	engine := gin.New()
+	engine.GET("/", h.FCSHandler)
+	engine.GET("/:database", h.FCSHandler)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return sub.req
+}
+
+func TestDatabasePathRouting(t *testing.T) {
+	req := handleDatabasePath(t, "/")
+	assert.False(t, req.HasFatalError())
+	req = handleDatabasePath(t, "/fcs-corpora")
+	assert.False(t, req.HasFatalError())
+	req = handleDatabasePath(t, "/other?operation=explain")
+	assert.True(t, req.HasFatalError())
+	assert.Equal(t, general.DCDatabaseDoesNotExist, req.Errors[0].Code)
+}
+
+func createTestingPreviewEngine(debugMode bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	corporaConf := &corpus.CorporaSetup{
+		RegistryDir:    "/var/lib/manatee/registry",
+		MaximumRecords: 50,
+		MaximumContext: 20,
+		RecordSchemas:  []string{general.RecordSchema},
+		Resources: corpus.SrchResources{
+			{
+				ID:  "corp1",
+				PID: "corp1-pid",
+				PosAttrs: []corpus.PosAttr{
+					{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+				},
+			},
+		},
+	}
+	// with no Redis adapter, any attempt to publish a job would panic
+	h := NewFCSHandler(&cnf.ServerInfo{}, corporaConf, nil, nil, debugMode)
+	engine := gin.New()
+	engine.GET("/admin/jobs-preview", h.JobsPreview)
+	return engine
+}
+
+func TestJobsPreviewPublishesNoJob(t *testing.T) {
+	engine := createTestingPreviewEngine(true)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(
+		rec,
+		httptest.NewRequest(
+			http.MethodGet,
+			"/admin/jobs-preview?operation=searchRetrieve&query=dog",
+			nil,
+		),
+	)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var ans struct {
+		ExtraResponseData struct {
+			Jobs []struct {
+				PID  string `json:"pid"`
+				Func string `json:"func"`
+			} `json:"jobs"`
+		} `json:"extraResponseData"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &ans))
+	if assert.Len(t, ans.ExtraResponseData.Jobs, 1) {
+		assert.Equal(t, "corp1-pid", ans.ExtraResponseData.Jobs[0].PID)
+		assert.Equal(t, "concExample", ans.ExtraResponseData.Jobs[0].Func)
+	}
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
+
+func TestJobsPreviewUnavailableOutsideDebugMode(t *testing.T) {
+	engine := createTestingPreviewEngine(false)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(
+		rec,
+		httptest.NewRequest(
+			http.MethodGet,
+			"/admin/jobs-preview?operation=searchRetrieve&query=dog",
+			nil,
+		),
+	)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,73 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InFlightRequest describes a request currently being processed
+type InFlightRequest struct {
+	URI   string
+	Start time.Time
+}
+
+// InFlightCounter keeps track of requests currently being processed.
+// This is mostly useful for reporting requests which did not finish
+// before the server shutdown deadline.
+type InFlightCounter struct {
+	nextID   atomic.Uint64
+	active   atomic.Int64
+	requests sync.Map
+}
+
+func (c *InFlightCounter) Active() int64 {
+	return c.active.Load()
+}
+
+// Requests returns a list of requests currently being processed
+func (c *InFlightCounter) Requests() []InFlightRequest {
+	ans := make([]InFlightRequest, 0, c.Active())
+	c.requests.Range(func(k, v any) bool {
+		ans = append(ans, v.(InFlightRequest))
+		return true
+	})
+	return ans
+}
+
+func (c *InFlightCounter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id := c.nextID.Add(1)
+		c.requests.Store(id, InFlightRequest{URI: ctx.Request.RequestURI, Start: time.Now()})
+		c.active.Add(1)
+		defer func() {
+			c.active.Add(-1)
+			c.requests.Delete(id)
+		}()
+		ctx.Next()
+	}
+}
+
+func NewInFlightCounter() *InFlightCounter {
+	return &InFlightCounter{}
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+)
+
+// requestLimitErrorKey is a key of a gin context value containing
+// a general.FCSError describing why RequestLimiter rejected the request
+// (see RequestLimiter.DelegateFCSRoutes)
+const requestLimitErrorKey = "requestLimitError"
+
+// RequestLimiter rejects requests with too long URLs (414) and
+// too large bodies (413) before they reach any handler (and
+// query parsers). This protects the service against degenerate
+// inputs exhausting memory.
+type RequestLimiter struct {
+	maxURLLength int
+	maxBodySize  int64
+
+	// fcsRoutes contains routes with rejections reported by FCSHandler
+	fcsRoutes map[string]bool
+}
+
+// DelegateFCSRoutes makes the limiter leave rejections of requests
+// to the provided routes (as registered in gin) on FCSHandler so clients
+// obtain SRU diagnostics in the negotiated version and format.
+func (rl *RequestLimiter) DelegateFCSRoutes(routes ...string) {
+	for _, route := range routes {
+		rl.fcsRoutes[route] = true
+	}
+}
+
+func (rl *RequestLimiter) reject(ctx *gin.Context, err error, status int) {
+	if rl.fcsRoutes[ctx.FullPath()] {
+		ctx.Set(requestLimitErrorKey, general.FCSError{
+			Code:    general.DCGeneralSystemError,
+			Message: err.Error(),
+		})
+		ctx.Next()
+		return
+	}
+	uniresp.RespondWithErrorJSON(ctx, err, status)
+	ctx.Abort()
+}
+
+func (rl *RequestLimiter) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if len(ctx.Request.RequestURI) > rl.maxURLLength {
+			rl.reject(
+				ctx,
+				fmt.Errorf("request URL exceeds max. length of %d characters", rl.maxURLLength),
+				http.StatusRequestURITooLong,
+			)
+			return
+		}
+		if ctx.Request.ContentLength > rl.maxBodySize {
+			rl.reject(
+				ctx,
+				fmt.Errorf("request body exceeds max. size of %d bytes", rl.maxBodySize),
+				http.StatusRequestEntityTooLarge,
+			)
+			return
+		}
+		// the Content-Length may be missing (chunked encoding) or wrong
+		// so the reader itself must be limited too
+		if ctx.Request.Body != nil {
+			ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, rl.maxBodySize)
+		}
+		ctx.Next()
+	}
+}
+
+func NewRequestLimiter(maxURLLength int, maxBodySize int64) *RequestLimiter {
+	return &RequestLimiter{
+		maxURLLength: maxURLLength,
+		maxBodySize:  maxBodySize,
+		fcsRoutes:    make(map[string]bool),
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createLimitedEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(NewRequestLimiter(40, 10).Middleware())
+	engine.Any("/", func(ctx *gin.Context) {
+		if _, err := io.ReadAll(ctx.Request.Body); err != nil {
+			ctx.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		ctx.Status(http.StatusOK)
+	})
+	return engine
+}
+
+func TestRequestLimiterURLLength(t *testing.T) {
+	engine := createLimitedEngine()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?query=dog", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(
+		w, httptest.NewRequest(http.MethodGet, "/?query="+strings.Repeat("a", 40), nil))
+	assert.Equal(t, http.StatusRequestURITooLong, w.Code)
+}
+
+func TestRequestLimiterBodySize(t *testing.T) {
+	engine := createLimitedEngine()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789")))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789a")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	// missing Content-Length must not bypass the limit
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("0123456789a"))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestRequestLimiterDelegatedFCSRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sub := &recordingSubHandler{}
+	h := &FCSHandler{
+		serverInfo: &cnf.ServerInfo{Database: "/fcs-corpora/"},
+		versions:   map[string]FCSSubHandler{Version20: sub},
+	}
+	limiter := NewRequestLimiter(40, 10)
+	limiter.DelegateFCSRoutes("/")
+	engine := gin.New()
+	engine.Use(limiter.Middleware())
+	engine.GET("/", h.FCSHandler)
+	engine.ServeHTTP(
+		httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodGet, "/?query="+strings.Repeat("a", 40), nil))
+	assert.True(t, sub.req.HasFatalError())
+	assert.Equal(t, general.DCGeneralSystemError, sub.req.Errors[0].Code)
+}
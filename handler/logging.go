@@ -0,0 +1,112 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// logEventPrefix must match the prefix used by cnc-gokit's
+	// logging.AddLogEvent and logging.AddCustomEntry
+	logEventPrefix = "logEvent_"
+)
+
+// RequestLogger writes a structured log record for each request.
+// Unlike logging.GinMiddleware, it can log just a sample of requests
+// to prevent log floods under heavy traffic. Failed requests (5xx
+// and requests with internal errors) and slow requests are always logged.
+type RequestLogger struct {
+	sampleRate    int
+	slowThreshold time.Duration
+	counter       atomic.Uint64
+}
+
+// shouldLog decides whether a finished request should be logged
+func (rl *RequestLogger) shouldLog(ctx *gin.Context, latency time.Duration) bool {
+	if ctx.Writer.Status() >= 500 || len(ctx.Errors) > 0 {
+		return true
+	}
+	if rl.slowThreshold > 0 && latency >= rl.slowThreshold {
+		return true
+	}
+	if rl.sampleRate <= 1 {
+		return true
+	}
+	return (rl.counter.Add(1)-1)%uint64(rl.sampleRate) == 0
+}
+
+func (rl *RequestLogger) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		path := ctx.Request.URL.Path
+		if ctx.Request.URL.RawQuery != "" {
+			path = path + "?" + ctx.Request.URL.RawQuery
+		}
+
+		ctx.Next()
+
+		latency := time.Since(start)
+		if !rl.shouldLog(ctx, latency) {
+			return
+		}
+		var logEvent *zerolog.Event
+		if ctx.Writer.Status() >= 500 {
+			logEvent = log.Error()
+
+		} else {
+			logEvent = log.Info()
+		}
+		errs := ctx.Errors.ByType(gin.ErrorTypePrivate)
+		if len(errs) > 0 {
+			logEvent = logEvent.Str("errorMessage", errs.String())
+		}
+		logEvent = logEvent.
+			Float64("latency", latency.Seconds()).
+			Str("clientIP", ctx.ClientIP()).
+			Str("method", ctx.Request.Method).
+			Int("status", ctx.Writer.Status()).
+			Int("bodySize", ctx.Writer.Size()).
+			Str("userAgent", ctx.Request.UserAgent()).
+			Str("path", path)
+		if rl.sampleRate > 1 {
+			// allows for estimating actual numbers of requests
+			logEvent = logEvent.Int("sampleRate", rl.sampleRate)
+		}
+		for k, v := range ctx.Keys {
+			if strings.HasPrefix(k, logEventPrefix) {
+				logEvent = logEvent.Any(k[len(logEventPrefix):], v)
+			}
+		}
+		logEvent.Send()
+	}
+}
+
+func NewRequestLogger(sampleRate int, slowThreshold time.Duration) *RequestLogger {
+	return &RequestLogger{
+		sampleRate:    sampleRate,
+		slowThreshold: slowThreshold,
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestingLogCtx(status int) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Status(status)
+	ctx.Writer.WriteHeaderNow()
+	return ctx
+}
+
+func TestRequestLoggerSampling(t *testing.T) {
+	rl := NewRequestLogger(3, 0)
+	var numLogged int
+	for i := 0; i < 9; i++ {
+		if rl.shouldLog(createTestingLogCtx(http.StatusOK), time.Millisecond) {
+			numLogged++
+		}
+	}
+	assert.Equal(t, 3, numLogged)
+}
+
+func TestRequestLoggerAlwaysLogsErrorsAndSlowRequests(t *testing.T) {
+	rl := NewRequestLogger(1000, time.Second)
+	// consume the first (sampled) request
+	rl.shouldLog(createTestingLogCtx(http.StatusOK), time.Millisecond)
+	assert.False(t, rl.shouldLog(createTestingLogCtx(http.StatusOK), time.Millisecond))
+	assert.True(t, rl.shouldLog(createTestingLogCtx(http.StatusInternalServerError), time.Millisecond))
+	assert.True(t, rl.shouldLog(createTestingLogCtx(http.StatusOK), 2*time.Second))
+}
+
+func TestRequestLoggerWithoutSampling(t *testing.T) {
+	rl := NewRequestLogger(1, 0)
+	for i := 0; i < 5; i++ {
+		assert.True(t, rl.shouldLog(createTestingLogCtx(http.StatusOK), time.Millisecond))
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+	"github.com/czcorpus/mquery-sru/query/parser/basic"
+	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	queryTypeCQL = "cql"
+	queryTypeFCS = "fcs"
+)
+
+type ParseResponse struct {
+	QueryType string         `json:"queryType"`
+	Query     string         `json:"query"`
+	Tree      *compiler.Node `json:"tree"`
+}
+
+// ParseHandler provides structure (a parse tree) of basic (`cql`)
+// and advanced (`fcs`) queries along with positions of their parts.
+// This allows query builders to render and validate queries without
+// running searches.
+type ParseHandler struct {
+}
+
+func (a *ParseHandler) Handle(ctx *gin.Context) {
+	query := ctx.Query("query")
+	if query == "" {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("missing query"), http.StatusBadRequest)
+		return
+	}
+	queryType := ctx.DefaultQuery("queryType", queryTypeCQL)
+	var tree compiler.TreeProvider
+	var err error
+	switch queryType {
+	case queryTypeCQL:
+		tree, err = basic.ParseQuery(query, []corpus.PosAttr{}, corpus.StructureMapping{})
+	case queryTypeFCS:
+		tree, err = fcsql.ParseQuery(
+			query, []corpus.PosAttr{}, corpus.StructureMapping{}, []corpus.QueryRewriteRule{})
+	default:
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			fmt.Errorf("unsupported queryType %s (use %s or %s)", queryType, queryTypeCQL, queryTypeFCS),
+			http.StatusBadRequest,
+		)
+		return
+	}
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+		return
+	}
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		ParseResponse{
+			QueryType: queryType,
+			Query:     query,
+			Tree:      tree.Tree(),
+		},
+	)
+}
+
+func NewParseHandler() *ParseHandler {
+	return &ParseHandler{}
+}
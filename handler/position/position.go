@@ -0,0 +1,203 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package position
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/handler/common"
+	"github.com/czcorpus/mquery-sru/rdb"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Token struct {
+	Word string `json:"word"`
+	Hit  bool   `json:"hit,omitempty"`
+
+	// POS is a part-of-speech tag (provided only if requested
+	// via `withPos=true` and only for resources with the `pos` layer)
+	POS string `json:"pos,omitempty"`
+}
+
+type PositionResponse struct {
+	PID      string  `json:"pid"`
+	Position int     `json:"position"`
+	Unit     string  `json:"unit,omitempty"`
+	Ref      string  `json:"ref"`
+	Tokens   []Token `json:"tokens"`
+}
+
+// newPositionResponse creates a response from the concordance `line`
+// of the requested position. The `posAttr` is empty in case
+// part-of-speech tags are not requested.
+func newPositionResponse(
+	pid string,
+	position int,
+	unit, posAttr string,
+	line concordance.Line,
+) PositionResponse {
+	return PositionResponse{
+		PID:      pid,
+		Position: position,
+		Unit:     unit,
+		Ref:      line.Ref,
+		Tokens: collections.SliceMap(
+			line.Text.Tokens(),
+			func(token *concordance.Token, i int) Token {
+				tok := Token{Word: token.Word, Hit: token.Strong}
+				if posAttr != "" {
+					tok.POS = token.Attrs[posAttr]
+				}
+				return tok
+			},
+		),
+	}
+}
+
+// PositionHandler provides a context of a known corpus position
+// or a structure (e.g. "sentence 4213"). This is mostly useful
+// for resolving references of previously returned results.
+type PositionHandler struct {
+	serverInfo *cnf.ServerInfo
+	conf       *corpus.CorporaSetup
+	radapter   *rdb.Adapter
+}
+
+func (a *PositionHandler) Handle(ctx *gin.Context) {
+	pid := ctx.Query("resource")
+	var position int
+	if recordID := ctx.Query("recordId"); recordID != "" {
+		var err error
+		pid, position, err = common.DecodeRecordID(recordID)
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusBadRequest)
+			return
+		}
+		if unit := ctx.Query("unit"); unit != "" && unit != "word" {
+			uniresp.RespondWithErrorJSON(
+				ctx, errors.New("unit cannot be combined with recordId"), http.StatusBadRequest)
+			return
+		}
+
+	} else {
+		var err error
+		position, err = strconv.Atoi(ctx.Query("position"))
+		if err != nil {
+			uniresp.RespondWithErrorJSON(
+				ctx, fmt.Errorf("invalid position: %w", err), http.StatusBadRequest)
+			return
+		}
+		if position < 0 {
+			uniresp.RespondWithErrorJSON(
+				ctx, errors.New("position must be a non-negative number"), http.StatusBadRequest)
+			return
+		}
+	}
+	rscConf, err := a.conf.Resources.GetResourceByPID(pid)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusNotFound)
+		return
+	}
+	unit := ctx.Query("unit")
+	var structName string
+	if unit != "" && unit != "word" {
+		structName = rscConf.StructureMapping.GetStructure(unit)
+		if structName == "" {
+			uniresp.RespondWithErrorJSON(
+				ctx, fmt.Errorf("unsupported unit: %s", unit), http.StatusBadRequest)
+			return
+		}
+	}
+	retrieveAttrs, err := a.conf.Resources.GetCommonPosAttrNames(rscConf.ID)
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	var posAttr string
+	if ctx.Query("withPos") == "true" {
+		posAttr = rscConf.GetLayerDefault(corpus.LayerTypePOS).Name
+		if posAttr != "" && !collections.SliceContains(retrieveAttrs, posAttr) {
+			retrieveAttrs = append(retrieveAttrs, posAttr)
+		}
+	}
+	// add text layer as another attr, otherwise we won't be able to parse it due to Manatee output formatting
+	retrieveAttrs = append(retrieveAttrs, retrieveAttrs[0])
+
+	wait, err := a.radapter.PublishQuery(ctx.Request.Context(), rdb.Query{
+		Func:  "positionContext",
+		Queue: rscConf.WorkerQueue,
+		Args: rdb.ConcQueryArgs{
+			CorpusPath:     a.conf.GetRegistryPath(rscConf.ID),
+			Attrs:          retrieveAttrs,
+			MaxContext:     a.conf.GetDefaultContext(rscConf),
+			Position:       position,
+			PositionStruct: structName,
+			Encoding:       rscConf.Encoding,
+		},
+	})
+	if err != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err)),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	res := <-wait
+	if res.HasPositionOutOfRangeError() {
+		uniresp.RespondWithErrorJSON(ctx, res.Error, http.StatusBadRequest)
+		return
+
+	} else if res.Error != nil {
+		uniresp.RespondWithErrorJSON(
+			ctx,
+			errors.New(common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error)),
+			http.StatusInternalServerError,
+		)
+		return
+	}
+	if len(res.Lines) == 0 {
+		uniresp.RespondWithErrorJSON(
+			ctx, errors.New("no data found for the position"), http.StatusNotFound)
+		return
+	}
+	ans := newPositionResponse(rscConf.PID, position, unit, posAttr, res.Lines[0])
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+func NewPositionHandler(
+	serverInfo *cnf.ServerInfo,
+	conf *corpus.CorporaSetup,
+	radapter *rdb.Adapter,
+) *PositionHandler {
+	return &PositionHandler{
+		serverInfo: serverInfo,
+		conf:       conf,
+		radapter:   radapter,
+	}
+}
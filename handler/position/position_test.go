@@ -0,0 +1,107 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package position
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/handler/common"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func handlePosition(t *testing.T, url string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	h := NewPositionHandler(
+		&cnf.ServerInfo{},
+		&corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				&corpus.CorpusSetup{
+					ID:               "corp1",
+					PID:              "pid1",
+					StructureMapping: corpus.StructureMapping{SentenceStruct: "s"},
+				},
+			},
+		},
+		nil,
+	)
+	engine := gin.New()
+	engine.GET("/position", h.Handle)
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	return rec
+}
+
+func TestHandleRejectsInvalidPosition(t *testing.T) {
+	rec := handlePosition(t, "/position?resource=pid1&position=foo")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid position")
+
+	rec = handlePosition(t, "/position?resource=pid1&position=-1")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "non-negative")
+}
+
+func TestHandleUnknownResource(t *testing.T) {
+	rec := handlePosition(t, "/position?resource=unknown&position=10")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandleUnsupportedUnit(t *testing.T) {
+	rec := handlePosition(t, "/position?resource=pid1&position=10&unit=paragraph")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unsupported unit")
+}
+
+func TestHandleRecordID(t *testing.T) {
+	rec := handlePosition(t, "/position?recordId=invalid")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	recordID := common.EncodeRecordID("pid1", 10)
+	rec = handlePosition(t, "/position?unit=sentence&recordId="+recordID)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "cannot be combined")
+
+	rec = handlePosition(t, "/position?recordId="+common.EncodeRecordID("unknown", 10))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNewPositionResponse(t *testing.T) {
+	line := concordance.Line{
+		Ref: "#10",
+		Text: concordance.TokenSlice{
+			&concordance.Token{Word: "a", Attrs: map[string]string{"tag": "D"}},
+			&concordance.Token{Word: "cat", Strong: true, Attrs: map[string]string{"tag": "N"}},
+		},
+	}
+	ans := newPositionResponse("pid1", 10, "", "tag", line)
+	assert.Equal(t, "pid1", ans.PID)
+	assert.Equal(t, 10, ans.Position)
+	assert.Equal(t, "#10", ans.Ref)
+	assert.Equal(t, []Token{{Word: "a", POS: "D"}, {Word: "cat", Hit: true, POS: "N"}}, ans.Tokens)
+
+	ans = newPositionResponse("pid1", 10, "sentence", "", line)
+	assert.Equal(t, "sentence", ans.Unit)
+	assert.Equal(t, []Token{{Word: "a"}, {Word: "cat", Hit: true}}, ans.Tokens)
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ReadinessRetryAfterSecs is a value of the `Retry-After` header
+	// sent to clients while the service is not ready yet
+	ReadinessRetryAfterSecs = 5
+)
+
+// ReadinessGate rejects requests (503 Service Unavailable) until
+// the service is marked as ready (i.e. Redis is available and
+// at least one worker is registered).
+type ReadinessGate struct {
+	ready atomic.Bool
+
+	// exemptPrefixes contains path prefixes of requests passed
+	// through regardless of the readiness (e.g. monitoring)
+	exemptPrefixes []string
+}
+
+// Exempt makes the gate pass requests with paths starting with
+// any of the provided prefixes even if the service is not ready yet.
+// It must be called before the server starts.
+func (g *ReadinessGate) Exempt(prefixes ...string) {
+	g.exemptPrefixes = append(g.exemptPrefixes, prefixes...)
+}
+
+func (g *ReadinessGate) isExempt(path string) bool {
+	for _, prefix := range g.exemptPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *ReadinessGate) SetReady() {
+	g.ready.Store(true)
+}
+
+func (g *ReadinessGate) IsReady() bool {
+	return g.ready.Load()
+}
+
+func (g *ReadinessGate) Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !g.IsReady() && !g.isExempt(ctx.Request.URL.Path) {
+			ctx.Header("Retry-After", strconv.Itoa(ReadinessRetryAfterSecs))
+			ctx.String(
+				http.StatusServiceUnavailable,
+				"service is starting, please try again later",
+			)
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func NewReadinessGate() *ReadinessGate {
+	return &ReadinessGate{}
+}
@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/gin-gonic/gin"
 )
 
@@ -41,6 +42,8 @@ const (
 	SearchRetrArgQuery         SearchRetrArg = "query"
 	SearchRetrArgFCSContext    SearchRetrArg = "x-fcs-context"
 	SearchRetrArgFCSDataViews  SearchRetrArg = "x-fcs-dataviews"
+	SearchRetrArgFCSAttrs      SearchRetrArg = "x-fcs-attrs"
+	SearchRetrArgFCSGroupByRsc SearchRetrArg = "x-fcs-group-by-resource"
 	SearchRetrArgRecordSchema  SearchRetrArg = "recordSchema"
 
 	ScanArgVersion          ScanArg = "version"
@@ -49,11 +52,13 @@ const (
 	ScanArgScanClause       ScanArg = "scanClause"
 	ScanArgMaximumTerms     ScanArg = "maximumTerms"
 	ScanArgResponsePosition ScanArg = "responsePosition"
+	ScanArgScanFold         ScanArg = "x-mquery-scan-fold"
 
 	ExplainArgVersion                ExplainArg = "version"
 	ExplainArgRecordPacking          ExplainArg = "recordPacking"
 	ExplainArgOperation              ExplainArg = "operation"
 	ExplainArgFCSEndpointDescription ExplainArg = "x-fcs-endpoint-description"
+	ExplainArgResourcesOffset        ExplainArg = "x-mquery-resources-offset"
 )
 
 type Operation string
@@ -94,7 +99,9 @@ func (sra SearchRetrArg) Validate() error {
 		sra == SearchRetrArgQuery ||
 		sra == SearchRetrArgFCSContext ||
 		sra == SearchRetrArgRecordSchema ||
-		sra == SearchRetrArgFCSDataViews {
+		sra == SearchRetrArgFCSDataViews ||
+		sra == SearchRetrArgFCSAttrs ||
+		sra == SearchRetrArgFCSGroupByRsc {
 		return nil
 	}
 	return fmt.Errorf("unknown searchRetrieve argument: %s", sra)
@@ -118,7 +125,8 @@ func (sa ScanArg) Validate() error {
 		sa == ScanArgRecordPacking ||
 		sa == ScanArgScanClause ||
 		sa == ScanArgMaximumTerms ||
-		sa == ScanArgResponsePosition {
+		sa == ScanArgResponsePosition ||
+		sa == ScanArgScanFold {
 		return nil
 	}
 	return fmt.Errorf("unknown scan argument: %s", sa)
@@ -132,7 +140,8 @@ func (arg ExplainArg) Validate() error {
 	if arg == ExplainArgVersion ||
 		arg == ExplainArgRecordPacking ||
 		arg == ExplainArgOperation ||
-		arg == ExplainArgFCSEndpointDescription {
+		arg == ExplainArgFCSEndpointDescription ||
+		arg == ExplainArgResourcesOffset {
 		return nil
 	}
 	return fmt.Errorf("unknown explain argument: %s", arg)
@@ -158,3 +167,15 @@ func fetchContext(ctx *gin.Context) []string {
 	}
 	return tmp
 }
+
+// fetchAttrs obtains unique positional attribute names
+// requested via the comma-separated `x-fcs-attrs` argument
+func fetchAttrs(ctx *gin.Context) []string {
+	ans := make([]string, 0, 5)
+	for _, v := range strings.Split(ctx.Query(SearchRetrArgFCSAttrs.String()), ",") {
+		if v != "" && !collections.SliceContains(ans, v) {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
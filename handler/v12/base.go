@@ -20,6 +20,7 @@
 package v12
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"net/http"
@@ -28,6 +29,7 @@ import (
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	"github.com/czcorpus/mquery-sru/handler/v12/schema"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/rs/zerolog/log"
@@ -39,48 +41,106 @@ type FCSSubHandlerV12 struct {
 	serverInfo  *cnf.ServerInfo
 	corporaConf *corpus.CorporaSetup
 	radapter    *rdb.Adapter
+
+	// debugMode enables additional (debugging) information
+	// in responses (e.g. generated Manatee queries)
+	debugMode bool
+
+	// respCache stores serialized explain responses
+	respCache *general.ResponseCache
+
+	// rscSizes provides (cached) sizes of resources
+	rscSizes *common.ResourceSizes
+
+	// prefetch serves concordance lines fetched in advance
+	prefetch *common.PrefetchCache
 }
 
-func (a *FCSSubHandlerV12) produceXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
+func (a *FCSSubHandlerV12) encodeResponse(
+	format general.ResponseFormat, xslt string, data any) ([]byte, error) {
+	if format == general.ResponseFormatJSON {
+		return json.MarshalIndent(data, "", "  ")
+	}
 	xmlAns, err := xml.MarshalIndent(data, "", "  ")
 	if err != nil {
-		log.Err(err).Msg("failed to encode a result to XML")
+		return []byte{}, err
+	}
+	return []byte(xml.Header + general.GetXSLTHeader(xslt) + string(xmlAns)), nil
+}
+
+func (a *FCSSubHandlerV12) produceResponse(
+	ctx *gin.Context, code int, format general.ResponseFormat, xslt string, data any) {
+	ans, err := a.encodeResponse(format, xslt, data)
+	if err != nil {
+		log.Err(err).Str("format", string(format)).Msg("failed to encode a result")
 		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	ctx.Writer.Header().Set("Content-Type", format.ContentType())
 	ctx.Writer.WriteHeader(code)
-	_, err = ctx.Writer.Write([]byte(xml.Header + general.GetXSLTHeader(xslt) + string(xmlAns)))
+	_, err = ctx.Writer.Write(ans)
 	if err != nil {
-		log.Err(err).Msg("failed to write XML to response")
+		log.Err(err).Msg("failed to write response")
 		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
 	}
-	ctx.Writer.Header().Set("Content-Type", "application/xml")
+}
+
+// produceCachedExplainResponse writes an explain response, possibly
+// from the response cache.
+func (a *FCSSubHandlerV12) produceCachedExplainResponse(ctx *gin.Context, fcsResponse *FCSRequest) {
+	cacheKey := common.ExplainResponseKey(
+		fcsResponse.General,
+		ctx.Query(ExplainArgFCSEndpointDescription.String()) == "true",
+		ctx.DefaultQuery(ExplainArgResourcesOffset.String(), "0"),
+	)
+	common.ProduceCachedResponse(
+		ctx,
+		a.respCache,
+		cacheKey,
+		fcsResponse.General.Format,
+		func() ([]byte, int, bool, error) {
+			response, code := a.explain(ctx, fcsResponse)
+			body, err := a.encodeResponse(
+				fcsResponse.General.Format, fcsResponse.General.XSLT, response)
+			return body, code, code == http.StatusOK && response.Diagnostics == nil, err
+		},
+	)
+}
+
+// setSearchCacheHeaders provides headers allowing clients to cache
+// searchRetrieve responses and to revalidate them using conditional
+// requests. The ETag changes with the configuration and resource data.
+func (a *FCSSubHandlerV12) setSearchCacheHeaders(ctx *gin.Context, etag string) {
+	ctx.Writer.Header().Set("ETag", etag)
+	ctx.Writer.Header().Set("Cache-Control", a.corporaConf.SearchCacheControl())
+	// the response (and so the ETag) depends on the preferred languages
+	ctx.Writer.Header().Add("Vary", "Accept-Language")
 }
 
 func (a *FCSSubHandlerV12) produceExplainErrorResponse(
-	ctx *gin.Context, code int, xslt string, fcsErrors []general.FCSError) {
+	ctx *gin.Context, code int, format general.ResponseFormat, xslt, lang string, fcsErrors []general.FCSError) {
 	ans := schema.XMLExplainResponse{
 		XMLNSSRU:    "http://www.loc.gov/zing/srw/",
 		Version:     "1.2",
-		Diagnostics: schema.NewXMLDiagnostics(),
+		Diagnostics: schema.NewXMLDiagnostics(lang),
 	}
 	for _, fcsErr := range fcsErrors {
 		ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
 	}
-	a.produceXMLResponse(ctx, code, xslt, ans)
+	a.produceResponse(ctx, code, format, xslt, ans)
 }
 
 func (a *FCSSubHandlerV12) produceSRErrorResponse(
-	ctx *gin.Context, code int, xslt string, fcsErrors []general.FCSError) {
+	ctx *gin.Context, code int, format general.ResponseFormat, xslt, lang string, fcsErrors []general.FCSError) {
 	ans := schema.XMLSRResponse{
 		XMLNSSRUResponse: "http://www.loc.gov/zing/srw/",
 		Version:          "1.2",
-		Diagnostics:      schema.NewXMLDiagnostics(),
+		Diagnostics:      schema.NewXMLDiagnostics(lang),
 	}
 	for _, fcsErr := range fcsErrors {
 		ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
 	}
-	a.produceXMLResponse(ctx, code, xslt, ans)
+	a.produceResponse(ctx, code, format, xslt, ans)
 }
 
 func (a *FCSSubHandlerV12) Handle(
@@ -95,7 +155,7 @@ func (a *FCSSubHandlerV12) Handle(
 	}
 	if fcsResponse.General.HasFatalError() {
 		a.produceExplainErrorResponse(
-			ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+			ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.Format, fcsGeneralRequest.XSLT, fcsGeneralRequest.Lang, fcsGeneralRequest.Errors)
 		return
 	}
 
@@ -116,7 +176,7 @@ func (a *FCSSubHandlerV12) Handle(
 			Message: fmt.Sprintf("Unsupported operation: %s", operation),
 		})
 		a.produceExplainErrorResponse(
-			ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+			ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.Format, fcsGeneralRequest.XSLT, fcsGeneralRequest.Lang, fcsGeneralRequest.Errors)
 		return
 	}
 	fcsResponse.Operation = operation
@@ -132,11 +192,11 @@ func (a *FCSSubHandlerV12) Handle(
 		})
 		if operation == OperationSearchRetrive {
 			a.produceSRErrorResponse(
-				ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+				ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.Format, fcsGeneralRequest.XSLT, fcsGeneralRequest.Lang, fcsGeneralRequest.Errors)
 
 		} else {
 			a.produceExplainErrorResponse(
-				ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+				ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.Format, fcsGeneralRequest.XSLT, fcsGeneralRequest.Lang, fcsGeneralRequest.Errors)
 		}
 		return
 	}
@@ -147,23 +207,42 @@ func (a *FCSSubHandlerV12) Handle(
 	var code int
 	switch fcsResponse.Operation {
 	case OperationExplain:
-		response, code = a.explain(ctx, fcsResponse)
+		a.produceCachedExplainResponse(ctx, fcsResponse)
+		return
 	case OperationSearchRetrive:
-		response, code = a.searchRetrieve(ctx, fcsResponse)
+		etag := a.respCache.DerivedETag(common.RequestKey(ctx, fcsResponse.General))
+		if general.MatchesETag(ctx.GetHeader("If-None-Match"), etag) {
+			a.setSearchCacheHeaders(ctx, etag)
+			ctx.Writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		srResponse, srCode := a.searchRetrieve(ctx, fcsResponse)
+		if srCode == http.StatusOK && srResponse.Diagnostics == nil {
+			a.setSearchCacheHeaders(ctx, etag)
+		}
+		response, code = srResponse, srCode
 	case OperationScan:
 		response, code = a.scan(ctx, fcsResponse)
 	}
-	a.produceXMLResponse(ctx, code, fcsGeneralRequest.XSLT, response)
+	a.produceResponse(ctx, code, fcsGeneralRequest.Format, fcsGeneralRequest.XSLT, response)
 }
 
 func NewFCSSubHandlerV12(
 	generalConf *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
 	radapter *rdb.Adapter,
+	debugMode bool,
+	respCache *general.ResponseCache,
+	rscSizes *common.ResourceSizes,
+	prefetch *common.PrefetchCache,
 ) *FCSSubHandlerV12 {
 	return &FCSSubHandlerV12{
 		serverInfo:  generalConf,
 		corporaConf: corporaConf,
 		radapter:    radapter,
+		debugMode:   debugMode,
+		respCache:   respCache,
+		rscSizes:    rscSizes,
+		prefetch:    prefetch,
 	}
 }
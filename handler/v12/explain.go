@@ -21,12 +21,15 @@ package v12
 
 import (
 	"encoding/xml"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler/v12/schema"
+	"github.com/czcorpus/mquery-sru/i18n"
 
 	"github.com/gin-gonic/gin"
 )
@@ -49,22 +52,28 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 					Database:  a.serverInfo.Database,
 				},
 				DatabaseInfo: schema.XMLExplainDatabaseInfo{
-					Titles: general.MapItems(
+					Titles: i18n.Map(
 						a.serverInfo.DatabaseTitle,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+						fcsResponse.General.AcceptLanguages,
+						a.serverInfo.PrimaryLanguage,
+						func(k string, v string, resolved bool) schema.XMLMultilingual {
+							return schema.XMLMultilingual{Language: k, Primary: resolved, Value: v}
 						},
 					),
-					Descriptions: general.MapItems(
+					Descriptions: i18n.Map(
 						a.serverInfo.DatabaseDescription,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+						fcsResponse.General.AcceptLanguages,
+						a.serverInfo.PrimaryLanguage,
+						func(k string, v string, resolved bool) schema.XMLMultilingual {
+							return schema.XMLMultilingual{Language: k, Primary: resolved, Value: v}
 						},
 					),
-					Authors: general.MapItems(
+					Authors: i18n.Map(
 						a.serverInfo.DatabaseAuthor,
-						func(k string, v string) schema.XMLMultilingual {
-							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
+						fcsResponse.General.AcceptLanguages,
+						a.serverInfo.PrimaryLanguage,
+						func(k string, v string, resolved bool) schema.XMLMultilingual {
+							return schema.XMLMultilingual{Language: k, Primary: resolved, Value: v}
 						},
 					),
 				},
@@ -96,10 +105,15 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 		},
 	}
 
+	if size, ok := a.rscSizes.Total(); ok {
+		ans.ExplainRecord.Data.DatabaseInfo.Extent = fmt.Sprintf("%d tokens", size)
+	}
+	ans.ExplainRecord.Data.DatabaseInfo.LastUpdate = a.corporaConf.Resources.GetLastUpdated()
+
 	// check if all parameters are supported
 	for key := range ctx.Request.URL.Query() {
-		if err := ExplainArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+		if err := ExplainArg(key).Validate(); err != nil && general.StrictParameters {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
 			return ans, general.ConformantStatusBadRequest
 		}
@@ -107,6 +121,18 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 
 	// extra data
 	if ctx.Query(ExplainArgFCSEndpointDescription.String()) == "true" {
+		rscOffset, err := strconv.Atoi(ctx.DefaultQuery(ExplainArgResourcesOffset.String(), "0"))
+		if err != nil || rscOffset < 0 || rscOffset > 0 && rscOffset >= len(a.corporaConf.Resources) {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, ExplainArgResourcesOffset.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+		resources, nextOffset := a.corporaConf.EndpointResources(rscOffset)
+		if a.corporaConf.MaximumEndpointResources > 0 {
+			ans.ResourcesPage = schema.NewXMLExplainResourcesPage(
+				len(a.corporaConf.Resources), rscOffset, nextOffset)
+		}
 		ans.EndpointDescription = &schema.XMLExplainEndpointDescription{
 			XMLNSED: "http://clarin.eu/fcs/endpoint-description",
 			Version: "2",
@@ -120,7 +146,7 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 				{ID: "adv", DeliveryPolicy: "send-by-default", Value: "application/x-clarin-fcs-adv+xml"},
 			},
 			SupportedLayers: collections.SliceMap(
-				a.corporaConf.Resources.GetCommonPosAttrs2(),
+				a.corporaConf.Resources.GetSupportedPosAttrs(),
 				func(posAttr corpus.PosAttr, i int) schema.XMLExplainSupportedLayer {
 					return schema.XMLExplainSupportedLayer{
 						ID:        posAttr.ID,
@@ -131,21 +157,30 @@ func (a *FCSSubHandlerV12) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 				},
 			),
 			Resources: collections.SliceMap(
-				a.corporaConf.Resources,
+				resources,
 				func(corpusConf *corpus.CorpusSetup, i int) schema.XMLExplainResource {
+					size, sizeOK := a.rscSizes.Get(corpusConf.ID)
 					return schema.XMLExplainResource{
 						PID:                corpusConf.PID,
 						LandingPage:        corpusConf.URI,
 						Languages:          corpusConf.Languages,
 						AvailableLayers:    schema.XMLExplainAvailableValues{Values: corpusConf.GetDefinedLayersAsRefString()},
+						Size:               general.ReturnIf(sizeOK, size, 0),
+						LastUpdated:        corpusConf.LastUpdated,
 						AvailableDataViews: schema.XMLExplainAvailableValues{Values: "hits adv"},
-						Titles: general.MapItems(
-							corpusConf.FullName, func(lang, title string) schema.XMLMultilingual2 {
+						Titles: i18n.Map(
+							corpusConf.FullName,
+							fcsResponse.General.AcceptLanguages,
+							a.serverInfo.PrimaryLanguage,
+							func(lang, title string, resolved bool) schema.XMLMultilingual2 {
 								return schema.XMLMultilingual2{Language: lang, Value: title}
 							},
 						),
-						Descriptions: general.MapItems(
-							corpusConf.Description, func(lang, title string) schema.XMLMultilingual2 {
+						Descriptions: i18n.Map(
+							corpusConf.Description,
+							fcsResponse.General.AcceptLanguages,
+							a.serverInfo.PrimaryLanguage,
+							func(lang, title string, resolved bool) schema.XMLMultilingual2 {
 								return schema.XMLMultilingual2{Language: lang, Value: title}
 							},
 						),
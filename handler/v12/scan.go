@@ -19,36 +19,45 @@
 package v12
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"strconv"
 
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	"github.com/czcorpus/mquery-sru/handler/v12/schema"
+	"github.com/czcorpus/mquery-sru/mango"
 	"github.com/gin-gonic/gin"
 )
 
 func (a *FCSSubHandlerV12) scan(ctx *gin.Context, fcsResponse *FCSRequest) (schema.XMLScanResponse, int) {
 	ans := schema.NewXMLScanResponse()
 	for key, _ := range ctx.Request.URL.Query() {
-		if err := ScanArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+		if err := ScanArg(key).Validate(); err != nil && general.StrictParameters {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
 			return ans, general.ConformantStatusBadRequest
 		}
 	}
 
-	xMaxTerms := ctx.DefaultQuery(ScanArgMaximumTerms.String(), "1000")
-	_, err := strconv.Atoi(xMaxTerms)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+	xMaxTerms := ctx.DefaultQuery(
+		ScanArgMaximumTerms.String(), strconv.Itoa(a.corporaConf.DefaultScanTerms))
+	maxTerms, err := strconv.Atoi(xMaxTerms)
+	if err != nil || maxTerms < 1 || maxTerms > a.corporaConf.MaximumScanTerms {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCUnsupportedParameterValue, 0, ScanArgMaximumTerms.String())
 		return ans, general.ConformantUnprocessableEntity
 	}
 
+	// only the default position is supported (i.e. the list
+	// starts with the requested term or the following one)
 	xResponsePos := ctx.DefaultQuery(ScanArgResponsePosition.String(), "1")
-	_, err = strconv.Atoi(xResponsePos)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+	responsePos, err := strconv.Atoi(xResponsePos)
+	if err != nil || responsePos != 1 {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCUnsupportedParameterValue, 0, ScanArgResponsePosition.String())
 		return ans, general.ConformantUnprocessableEntity
@@ -56,14 +65,73 @@ func (a *FCSSubHandlerV12) scan(ctx *gin.Context, fcsResponse *FCSRequest) (sche
 
 	scanClause := ctx.Query(ScanArgScanClause.String())
 	if scanClause == "" {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCMandatoryParameterNotSupplied, 0, ScanArgScanClause.String())
 		return ans, general.ConformantUnprocessableEntity
 	}
 
-	ans.Diagnostics = schema.NewXMLDiagnostics()
-	ans.Diagnostics.AddDfltMsgDiagnostic(
-		general.DCUnsupportedIndex, 0, ScanArgScanClause.String())
-	return ans, general.ConformantUnprocessableEntity
+	fold := common.ScanFold(ctx.Query(ScanArgScanFold.String()))
+	if err := fold.Validate(); err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		ans.Diagnostics.AddDiagnostic(
+			general.DCUnsupportedParameterValue, 0, ScanArgScanFold.String(), err.Error())
+		return ans, general.ConformantUnprocessableEntity
+	}
+
+	index, term, err := common.ParseScanClause(scanClause)
+	if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		ans.Diagnostics.AddDiagnostic(
+			general.DCQuerySyntaxError, 0, ScanArgScanClause.String(), err.Error())
+		return ans, general.ConformantUnprocessableEntity
+	}
+	// the server may limit how long the scan waits for individual
+	// resources (the same way as for searches)
+	scanCtx := ctx.Request.Context()
+	if budget := a.corporaConf.SearchTimeBudget(); budget > 0 {
+		var cancel context.CancelFunc
+		scanCtx, cancel = common.WithSearchBudget(scanCtx, budget)
+		defer cancel()
+	}
+	scanned, err := common.ScanStructAttr(
+		scanCtx, a.radapter, a.corporaConf, index, term, fold, maxTerms)
+	if errors.Is(err, common.ErrUnsupportedScanIndex) {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCUnsupportedIndex, 0, index)
+		return ans, general.ConformantUnprocessableEntity
+
+	} else if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
+		return ans, general.ConformandGeneralServerError
+	}
+	if len(scanned.TimedOutRscs) > 0 {
+		// partial result - other resources still provide their terms
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		for _, rsc := range scanned.TimedOutRscs {
+			ans.Diagnostics.AddDiagnostic(
+				0, general.DTGeneralProcessingHint, rsc,
+				fmt.Sprintf(
+					"timed-out-partial: scan of resource %s did not finish within the search time budget",
+					rsc))
+		}
+	}
+	for _, rsc := range scanned.TruncatedRscs {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, rsc,
+			fmt.Sprintf(
+				"Resource %s provides too many values to be folded, only its first %d values have been used",
+				rsc, mango.MaxStructAttrValuesInternalLimit))
+	}
+	ans.Terms = make([]schema.XMLScanTerm, len(scanned.Terms))
+	for i, t := range scanned.Terms {
+		ans.Terms[i] = schema.XMLScanTerm{Value: t.Value, NumberOfRecords: t.Freq}
+	}
+	return ans, http.StatusOK
 }
@@ -19,12 +19,12 @@
 package schema
 
 type XMLMultilingual struct {
-	Language string `xml:"lang,attr,omitempty"`
-	Primary  bool   `xml:"primary,attr,omitempty"`
-	Value    string `xml:",chardata"`
+	Language string `xml:"lang,attr,omitempty" json:"language,omitempty"`
+	Primary  bool   `xml:"primary,attr,omitempty" json:"primary,omitempty"`
+	Value    string `xml:",chardata" json:"value"`
 }
 
 type XMLMultilingual2 struct {
-	Language string `xml:"xml:lang,attr,omitempty"`
-	Value    string `xml:",chardata"`
+	Language string `xml:"xml:lang,attr,omitempty" json:"language,omitempty"`
+	Value    string `xml:",chardata" json:"value"`
 }
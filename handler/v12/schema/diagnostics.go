@@ -26,14 +26,17 @@ import (
 )
 
 type XMLDiagnostic struct {
-	URI     []string `xml:"diag:uri,omitempty"`
-	Details string   `xml:"diag:details"`
-	Message string   `xml:"diag:message"`
+	URI     []string `xml:"diag:uri,omitempty" json:"uri,omitempty"`
+	Details string   `xml:"diag:details" json:"details"`
+	Message string   `xml:"diag:message" json:"message"`
 }
 
 type XMLDiagnostics struct {
-	XMLNSDiag   string          `xml:"xmlns:diag,attr"`
-	Diagnostics []XMLDiagnostic `xml:"diag:diagnostic"`
+	XMLNSDiag   string          `xml:"xmlns:diag,attr" json:"-"`
+	Diagnostics []XMLDiagnostic `xml:"diag:diagnostic" json:"diagnostics"`
+
+	// lang specifies a language of default messages
+	lang string
 }
 
 // AddDfltMsgDiagnostics adds a diagnostics code along with
@@ -44,7 +47,7 @@ func (d *XMLDiagnostics) AddDfltMsgDiagnostic(
 	typ general.DiagnosticType,
 	ident string,
 ) {
-	d.AddDiagnostic(code, typ, ident, code.AsMessage())
+	d.AddDiagnostic(code, typ, ident, code.AsMessage(d.lang))
 }
 
 func (d *XMLDiagnostics) AddDiagnostic(
@@ -67,8 +70,9 @@ func (d *XMLDiagnostics) AddDiagnostic(
 	})
 }
 
-func NewXMLDiagnostics() *XMLDiagnostics {
+func NewXMLDiagnostics(lang string) *XMLDiagnostics {
 	return &XMLDiagnostics{
 		XMLNSDiag: "http://www.loc.gov/zing/srw/diagnostic/",
+		lang:      lang,
 	}
 }
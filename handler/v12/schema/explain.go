@@ -21,62 +21,67 @@ package schema
 import "encoding/xml"
 
 type XMLExplainResponse struct {
-	XMLName  xml.Name `xml:"sru:explainResponse"`
-	XMLNSSRU string   `xml:"xmlns:sru,attr"`
-	Version  string   `xml:"sru:version"`
+	XMLName  xml.Name `xml:"sru:explainResponse" json:"-"`
+	XMLNSSRU string   `xml:"xmlns:sru,attr" json:"-"`
+	Version  string   `xml:"sru:version" json:"version"`
 
-	ExplainRecord       *XMLExplainRecord              `xml:"sru:record,omitempty"`
-	EchoedRequest       *XMLExplainEchoedRequest       `xml:"sru:echoedExplainRequest,omitempty"`
-	EndpointDescription *XMLExplainEndpointDescription `xml:"sru:extraResponseData>ed:EndpointDescription,omitempty"`
-	Diagnostics         *XMLDiagnostics                `xml:"sru:diagnostics,omitempty"`
+	ExplainRecord       *XMLExplainRecord              `xml:"sru:record,omitempty" json:"explainRecord,omitempty"`
+	EchoedRequest       *XMLExplainEchoedRequest       `xml:"sru:echoedExplainRequest,omitempty" json:"echoedRequest,omitempty"`
+	EndpointDescription *XMLExplainEndpointDescription `xml:"sru:extraResponseData>ed:EndpointDescription,omitempty" json:"endpointDescription,omitempty"`
+	ResourcesPage       *XMLExplainResourcesPage       `xml:"sru:extraResponseData>rp:resourcesPage,omitempty" json:"resourcesPage,omitempty"`
+	Diagnostics         *XMLDiagnostics                `xml:"sru:diagnostics,omitempty" json:"diagnostics,omitempty"`
 }
 
 // --------------------- Explain Record ---------------------
 
 type XMLExplainRecord struct {
-	Schema        string         `xml:"sru:recordSchema"`
-	RecordPacking string         `xml:"sru:recordPacking"`
-	Data          XMLExplainData `xml:"sru:recordData>zr:explain"`
+	Schema        string         `xml:"sru:recordSchema" json:"schema"`
+	RecordPacking string         `xml:"sru:recordPacking" json:"recordPacking"`
+	Data          XMLExplainData `xml:"sru:recordData>zr:explain" json:"data"`
 }
 
 type XMLExplainData struct {
-	XMLNSZR string `xml:"xmlns:zr,attr"`
+	XMLNSZR string `xml:"xmlns:zr,attr" json:"-"`
 
-	ServerInfo   XMLExplainServerInfo   `xml:"zr:serverInfo"`
-	DatabaseInfo XMLExplainDatabaseInfo `xml:"zr:databaseInfo"`
-	SchemaInfo   XMLExplainSchemaInfo   `xml:"zr:schemaInfo"`
-	ConfigInfo   XMLExplainConfigInfo   `xml:"zr:configInfo"`
+	ServerInfo   XMLExplainServerInfo   `xml:"zr:serverInfo" json:"serverInfo"`
+	DatabaseInfo XMLExplainDatabaseInfo `xml:"zr:databaseInfo" json:"databaseInfo"`
+	SchemaInfo   XMLExplainSchemaInfo   `xml:"zr:schemaInfo" json:"schemaInfo"`
+	ConfigInfo   XMLExplainConfigInfo   `xml:"zr:configInfo" json:"configInfo"`
 }
 
 type XMLExplainServerInfo struct {
-	Protocol  string `xml:"protocol,attr"`
-	Version   string `xml:"version,attr"`
-	Transport string `xml:"transport,attr"`
+	Protocol  string `xml:"protocol,attr" json:"protocol"`
+	Version   string `xml:"version,attr" json:"version"`
+	Transport string `xml:"transport,attr" json:"transport"`
 
-	Host     string `xml:"zr:host"`
-	Port     string `xml:"zr:port"`
-	Database string `xml:"zr:database"`
+	Host     string `xml:"zr:host" json:"host"`
+	Port     string `xml:"zr:port" json:"port"`
+	Database string `xml:"zr:database" json:"database"`
 }
 
 type XMLExplainDatabaseInfo struct {
-	Titles       []XMLMultilingual `xml:"zr:title"`
-	Descriptions []XMLMultilingual `xml:"zr:description"`
-	Authors      []XMLMultilingual `xml:"zr:author"`
+	Titles       []XMLMultilingual `xml:"zr:title" json:"titles"`
+	Descriptions []XMLMultilingual `xml:"zr:description" json:"descriptions"`
+	Authors      []XMLMultilingual `xml:"zr:author" json:"authors"`
+
+	// Extent describes the size of the data (number of tokens)
+	Extent     string `xml:"zr:extent,omitempty" json:"extent,omitempty"`
+	LastUpdate string `xml:"zr:lastUpdate,omitempty" json:"lastUpdate,omitempty"`
 }
 
 type XMLExplainDefinition struct {
-	Identifier string `xml:"identifier,attr"`
-	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr" json:"identifier"`
+	Name       string `xml:"name,attr" json:"name"`
 
-	Titles []XMLMultilingual `xml:"zr:title"`
+	Titles []XMLMultilingual `xml:"zr:title" json:"titles"`
 }
 
 type XMLExplainSchemaInfo struct {
-	Schema XMLExplainDefinition `xml:"zr:schema"`
+	Schema XMLExplainDefinition `xml:"zr:schema" json:"schema"`
 }
 
 type XMLExplainConfigInfo struct {
-	Values []XMLExplainConfig
+	Values []XMLExplainConfig `json:"values"`
 }
 
 func (c *XMLExplainConfigInfo) AddDefault(key string, value any) {
@@ -96,54 +101,81 @@ func (c *XMLExplainConfigInfo) AddSetting(typ string, value any) {
 }
 
 type XMLExplainConfig struct {
-	XMLName xml.Name
-	Type    string `xml:"type,attr"`
-	Value   any    `xml:",chardata"`
+	XMLName xml.Name `json:"-"`
+	Type    string   `xml:"type,attr" json:"type"`
+	Value   any      `xml:",chardata" json:"value"`
 }
 
 // --------------------- Echoed Explain Request ---------------------
 
 type XMLExplainEchoedRequest struct {
-	Version string `xml:"sru:version"`
+	Version string `xml:"sru:version" json:"version"`
 }
 
 // -------------------- XMLExplainSupportedLayer ---------------------
 
 type XMLExplainSupportedLayer struct {
-	ID        string `xml:"id,attr"`
-	Qualifier string `xml:"qualifier,attr"`
-	ResultID  string `xml:"result-id,attr"`
-	Value     string `xml:",chardata"`
+	ID        string `xml:"id,attr" json:"id"`
+	Qualifier string `xml:"qualifier,attr" json:"qualifier"`
+	ResultID  string `xml:"result-id,attr" json:"resultId"`
+	Value     string `xml:",chardata" json:"value"`
 }
 
 // --------------------- Extra Response Data ---------------------
 
 type XMLExplainEndpointDescription struct {
-	XMLNSED string `xml:"xmlns:ed,attr"`
-	Version string `xml:"version,attr"`
+	XMLNSED string `xml:"xmlns:ed,attr" json:"-"`
+	Version string `xml:"version,attr" json:"version"`
 
-	Capabilities       []string                      `xml:"ed:Capabilities>ed:Capability"`
-	SupportedDataViews []XMLExplainSupportedDataView `xml:"ed:SupportedDataViews>ed:SupportedDataView"`
-	SupportedLayers    []XMLExplainSupportedLayer    `xml:"ed:SupportedLayers>ed:SupportedLayer"`
-	Resources          []XMLExplainResource          `xml:"ed:Resources>ed:Resource"`
+	Capabilities       []string                      `xml:"ed:Capabilities>ed:Capability" json:"capabilities"`
+	SupportedDataViews []XMLExplainSupportedDataView `xml:"ed:SupportedDataViews>ed:SupportedDataView" json:"supportedDataViews"`
+	SupportedLayers    []XMLExplainSupportedLayer    `xml:"ed:SupportedLayers>ed:SupportedLayer" json:"supportedLayers"`
+	Resources          []XMLExplainResource          `xml:"ed:Resources>ed:Resource" json:"resources"`
 }
 
 type XMLExplainSupportedDataView struct {
-	ID             string `xml:"id,attr"`
-	DeliveryPolicy string `xml:"delivery-policy,attr"`
-	Value          string `xml:",chardata"`
+	ID             string `xml:"id,attr" json:"id"`
+	DeliveryPolicy string `xml:"delivery-policy,attr" json:"deliveryPolicy"`
+	Value          string `xml:",chardata" json:"value"`
 }
 
 type XMLExplainResource struct {
-	PID                string                    `xml:"pid,attr"`
-	Titles             []XMLMultilingual2        `xml:"ed:Title"`
-	Descriptions       []XMLMultilingual2        `xml:"ed:Description"`
-	LandingPage        string                    `xml:"ed:LandingPageURI,omitempty"`
-	Languages          []string                  `xml:"ed:Languages>ed:Language"`
-	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews"`
-	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers"`
+	PID                string                    `xml:"pid,attr" json:"pid"`
+	Titles             []XMLMultilingual2        `xml:"ed:Title" json:"titles"`
+	Descriptions       []XMLMultilingual2        `xml:"ed:Description" json:"descriptions"`
+	LandingPage        string                    `xml:"ed:LandingPageURI,omitempty" json:"landingPage,omitempty"`
+	Languages          []string                  `xml:"ed:Languages>ed:Language" json:"languages"`
+	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews" json:"availableDataViews"`
+	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers" json:"availableLayers"`
+
+	// Size and LastUpdated are not part of the FCS endpoint description
+	// so they are available only in the JSON output
+	Size        int64  `xml:"-" json:"size,omitempty"`
+	LastUpdated string `xml:"-" json:"lastUpdated,omitempty"`
+}
+
+// XMLExplainResourcesPage describes which part of the resources
+// is listed in the endpoint description. It is attached only in case
+// the number of listed resources is limited by the configuration.
+type XMLExplainResourcesPage struct {
+	XMLNSRP    string `xml:"xmlns:rp,attr" json:"-"`
+	Total      int    `xml:"total,attr" json:"total"`
+	Offset     int    `xml:"offset,attr" json:"offset"`
+	NextOffset int    `xml:"nextOffset,attr,omitempty" json:"nextOffset,omitempty"`
+}
+
+func NewXMLExplainResourcesPage(total, offset, nextOffset int) *XMLExplainResourcesPage {
+	ans := &XMLExplainResourcesPage{
+		XMLNSRP: "http://www.korpus.cz/mquery/resources-page",
+		Total:   total,
+		Offset:  offset,
+	}
+	if nextOffset > 0 {
+		ans.NextOffset = nextOffset
+	}
+	return ans
 }
 
 type XMLExplainAvailableValues struct {
-	Values string `xml:"ref,attr"`
+	Values string `xml:"ref,attr" json:"values"`
 }
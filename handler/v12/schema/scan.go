@@ -21,10 +21,18 @@ package schema
 import "encoding/xml"
 
 type XMLScanResponse struct {
-	XMLName           xml.Name        `xml:"sru:scanResponse"`
-	XMLNSScanResponse string          `xml:"xmlns:scan,attr"`
-	Version           string          `xml:"sru:version"`
-	Diagnostics       *XMLDiagnostics `xml:"sru:diagnostics,omitempty"`
+	XMLName           xml.Name        `xml:"sru:scanResponse" json:"-"`
+	XMLNSScanResponse string          `xml:"xmlns:scan,attr" json:"-"`
+	Version           string          `xml:"sru:version" json:"version"`
+	Terms             []XMLScanTerm   `xml:"sru:terms>sru:term,omitempty" json:"terms,omitempty"`
+	Diagnostics       *XMLDiagnostics `xml:"sru:diagnostics,omitempty" json:"diagnostics,omitempty"`
+}
+
+// XMLScanTerm is a value of a scanned index along with
+// a number of records (e.g. documents) with the value
+type XMLScanTerm struct {
+	Value           string `xml:"sru:value" json:"value"`
+	NumberOfRecords int64  `xml:"sru:numberOfRecords" json:"numberOfRecords"`
 }
 
 func NewXMLScanResponse() XMLScanResponse {
@@ -21,18 +21,19 @@ package schema
 import "encoding/xml"
 
 type XMLSRResponse struct {
-	XMLName          xml.Name `xml:"sru:searchRetrieveResponse"`
-	XMLNSSRUResponse string   `xml:"xmlns:sru,attr"`
-	Version          string   `xml:"sru:version"`
+	XMLName          xml.Name `xml:"sru:searchRetrieveResponse" json:"-"`
+	XMLNSSRUResponse string   `xml:"xmlns:sru,attr" json:"-"`
+	Version          string   `xml:"sru:version" json:"version"`
 
-	NumberOfRecords int `xml:"sru:numberOfRecords"`
+	NumberOfRecords int `xml:"sru:numberOfRecords" json:"numberOfRecords"`
 
 	// Records
 	// note: we need a pointer here to allow the marshaler skip the 'records' parent
 	// in case there are no 'record' children
-	Records       *[]XMLSRRecord     `xml:"sru:records>sru:record,omitempty"`
-	EchoedRequest XMLSREchoedRequest `xml:"sru:echoedSearchRetrieveRequest"`
-	Diagnostics   *XMLDiagnostics    `xml:"sru:diagnostics,omitempty"`
+	Records           *[]XMLSRRecord     `xml:"sru:records>sru:record,omitempty" json:"records,omitempty"`
+	EchoedRequest     XMLSREchoedRequest `xml:"sru:echoedSearchRetrieveRequest" json:"echoedRequest"`
+	Diagnostics       *XMLDiagnostics    `xml:"sru:diagnostics,omitempty" json:"diagnostics,omitempty"`
+	ExtraResponseData *XMLSRDebugData    `xml:"sru:extraResponseData>mq:debug,omitempty" json:"extraResponseData,omitempty"`
 }
 
 func NewXMLSRResponse() XMLSRResponse {
@@ -46,37 +47,85 @@ func NewXMLSRResponse() XMLSRResponse {
 // --------------------- Search Retrieve Record ---------------------
 
 type XMLSRRecord struct {
-	Schema         string        `xml:"sru:recordSchema"`
-	RecordPacking  string        `xml:"sru:recordPacking"`
-	Data           XMLSRResource `xml:"sru:recordData>fcs:Resource"`
-	RecordPosition int           `xml:"sru:recordPosition"`
+	Schema         string        `xml:"sru:recordSchema" json:"schema"`
+	RecordPacking  string        `xml:"sru:recordPacking" json:"recordPacking"`
+	Data           XMLSRResource `xml:"sru:recordData>fcs:Resource" json:"data"`
+	RecordPosition int           `xml:"sru:recordPosition" json:"recordPosition"`
 }
 
 type XMLSRResource struct {
-	XMLNSFCS         string                `xml:"xmlns:fcs,attr"`
-	PID              string                `xml:"pid,attr"`
-	ResourceFragment XMLSRResourceFragment `xml:"fcs:ResourceFragment"`
+	XMLNSFCS         string                `xml:"xmlns:fcs,attr" json:"-"`
+	PID              string                `xml:"pid,attr" json:"pid"`
+	ResourceFragment XMLSRResourceFragment `xml:"fcs:ResourceFragment" json:"resourceFragment"`
 }
 
 type XMLSRResourceFragment struct {
-	Ref       string        `xml:"ref,attr,omitempty"`
-	DataViews XMLSRDataView `xml:"fcs:DataView"`
+	Ref       string        `xml:"ref,attr,omitempty" json:"ref,omitempty"`
+	DataViews XMLSRDataView `xml:"fcs:DataView" json:"dataViews"`
 }
 
 type XMLSRDataView struct {
-	Type   string                   `xml:"type,attr"`
-	Result XMLSRBasicDataViewResult `xml:"hits:Result"`
+	Type   string                   `xml:"type,attr" json:"type"`
+	Result XMLSRBasicDataViewResult `xml:"hits:Result" json:"result"`
 }
 
 type XMLSRBasicDataViewResult struct {
-	XMLNSHits string `xml:"xmlns:hits,attr"`
-	Data      string `xml:",innerxml"`
+	XMLNSHits string `xml:"xmlns:hits,attr" json:"-"`
+	Data      string `xml:",innerxml" json:"data"`
+}
+
+// --------------------- Debugging data ---------------------
+
+// XMLSRDebugData contains information for debugging queries.
+// It is attached to responses only in the debug mode.
+type XMLSRDebugData struct {
+	XMLNSMQ        string              `xml:"xmlns:mq,attr" json:"-"`
+	BackendQueries []XMLSRBackendQuery `xml:"mq:backendQuery" json:"backendQueries"`
+	Timings        *XMLSRTimings       `xml:"mq:timings,omitempty" json:"timings,omitempty"`
+}
+
+func (dd *XMLSRDebugData) AddBackendQuery(pid, query string) {
+	dd.BackendQueries = append(dd.BackendQueries, XMLSRBackendQuery{PID: pid, Value: query})
+}
+
+func NewXMLSRDebugData() *XMLSRDebugData {
+	return &XMLSRDebugData{
+		XMLNSMQ:        "http://www.korpus.cz/mquery/debug",
+		BackendQueries: make([]XMLSRBackendQuery, 0, 5),
+	}
+}
+
+// XMLSRBackendQuery is a Manatee CQL query generated
+// from the client's query for a resource specified by PID
+type XMLSRBackendQuery struct {
+	PID   string `xml:"pid,attr" json:"pid"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// XMLSRTimings provides durations (in milliseconds) of individual
+// phases of a search. Translation and publishing times are summed
+// over all the resources. Waits for worker results are measured
+// for each resource separately. The time needed to serialize
+// the response is not included.
+type XMLSRTimings struct {
+	Total     float64          `xml:"total,attr" json:"total"`
+	Translate float64          `xml:"translate,attr" json:"translate"`
+	Publish   float64          `xml:"publish,attr" json:"publish"`
+	Merge     float64          `xml:"merge,attr" json:"merge"`
+	Resources []XMLSRRscTiming `xml:"mq:resource" json:"resources"`
+}
+
+// XMLSRRscTiming is a time spent waiting for results
+// of a resource specified by PID
+type XMLSRRscTiming struct {
+	PID  string  `xml:"pid,attr" json:"pid"`
+	Wait float64 `xml:"wait,attr" json:"wait"`
 }
 
 // --------------------- Echoed Search Retrieve Request ---------------------
 
 type XMLSREchoedRequest struct {
-	Version     string `xml:"sru:version"`
-	Query       string `xml:"sru:query"`
-	StartRecord int    `xml:"sru:startRecord"`
+	Version     string `xml:"sru:version" json:"version"`
+	Query       string `xml:"sru:query" json:"query"`
+	StartRecord int    `xml:"sru:startRecord" json:"startRecord"`
 }
@@ -20,17 +20,20 @@
 package v12
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
-	"github.com/czcorpus/mquery-common/concordance"
 	"github.com/czcorpus/mquery-sru/backlink"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	"github.com/czcorpus/mquery-sru/handler/v12/schema"
 	"github.com/czcorpus/mquery-sru/mango"
 	"github.com/czcorpus/mquery-sru/query"
@@ -38,24 +41,40 @@ import (
 	"github.com/czcorpus/mquery-sru/query/parser/basic"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/result"
+	"github.com/czcorpus/mquery-sru/transform"
 	"github.com/rs/zerolog/log"
 
 	"github.com/gin-gonic/gin"
 )
 
 func (a *FCSSubHandlerV12) translateQuery(
-	corpusName, query string,
+	corpusName, query, lang string,
 ) (compiler.AST, *general.FCSError) {
 	var fcsErr *general.FCSError
 	res, err := a.corporaConf.Resources.GetResource(corpusName)
 	if err != nil {
 		fcsErr = &general.FCSError{
 			Code:    general.DCGeneralSystemError,
-			Ident:   err.Error(),
-			Message: general.DCGeneralSystemError.AsMessage(),
+			Ident:   common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err),
+			Message: general.DCGeneralSystemError.AsMessage(lang),
 		}
 		return nil, fcsErr
 	}
+	if !res.IsBasicSearchSupported() {
+		return nil, &general.FCSError{
+			Code:    general.DCUnsupportedParameterValue,
+			Ident:   SearchRetrArgQuery.String(),
+			Message: fmt.Sprintf("Resource %s does not support basic search", res.PID),
+		}
+	}
+	query, err = res.ExpandQueryMacros(query, false)
+	if err != nil {
+		return nil, &general.FCSError{
+			Code:    general.DCQuerySyntaxError,
+			Ident:   SearchRetrArgQuery.String(),
+			Message: fmt.Sprintf("Invalid query: %s", err),
+		}
+	}
 	ast, err := basic.ParseQuery(
 		query,
 		res.PosAttrs,
@@ -71,45 +90,84 @@ func (a *FCSSubHandlerV12) translateQuery(
 	return ast, fcsErr
 }
 
+// attachTimings adds timings of the search to the debugging data
+// (which are available only in the debug mode)
+func (a *FCSSubHandlerV12) attachTimings(ans *schema.XMLSRResponse, timings *common.SearchTimings) {
+	if ans.ExtraResponseData == nil {
+		return
+	}
+	timings.Finish()
+	ans.ExtraResponseData.Timings = &schema.XMLSRTimings{
+		Total:     common.DurationMillis(timings.Total),
+		Translate: common.DurationMillis(timings.Translate),
+		Publish:   common.DurationMillis(timings.Publish),
+		Merge:     common.DurationMillis(timings.Merge),
+		Resources: collections.SliceMap(
+			timings.RscWaits,
+			func(item common.RscWait, i int) schema.XMLSRRscTiming {
+				pid := item.Rsc
+				if rscConf, err := a.corporaConf.Resources.GetResource(item.Rsc); err == nil {
+					pid = rscConf.PID
+				}
+				return schema.XMLSRRscTiming{PID: pid, Wait: common.DurationMillis(item.Wait)}
+			},
+		),
+	}
+}
+
+// restrictAttrs returns only the `attrs` contained in `requested`.
+// The first attribute (the text layer) is always kept as it is needed
+// to render hits. Empty `requested` means no restriction.
+func restrictAttrs(attrs []string, requested []string) []string {
+	if len(requested) == 0 || len(attrs) == 0 {
+		return attrs
+	}
+	ans := make([]string, 0, len(attrs)+1)
+	ans = append(ans, attrs[0])
+	for _, attr := range attrs[1:] {
+		if collections.SliceContains(requested, attr) {
+			ans = append(ans, attr)
+		}
+	}
+	return ans
+}
+
 func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequest) (schema.XMLSRResponse, int) {
+	timings := common.NewSearchTimings()
 	logArgs := make(map[string]interface{})
 	logging.AddLogEvent(ctx, "args", logArgs)
 	ans := schema.NewXMLSRResponse()
 
+	// validation errors are collected and reported all at once
+	validErrs := common.NewValidationErrors(fcsResponse.General.Lang)
+
 	// check if all parameters are supported
 	for key, _ := range ctx.Request.URL.Query() {
-		if err := SearchRetrArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
-			return ans, general.ConformantStatusBadRequest
+		if err := SearchRetrArg(key).Validate(); err != nil && general.StrictParameters {
+			validErrs.AddWithMsg(
+				general.ConformantStatusBadRequest, general.DCUnsupportedParameter, key, err.Error())
 		}
 	}
 
 	// handle query parameter
 	fcsQuery := ctx.Query(SearchRetrArgQuery.String())
 	if len(fcsQuery) == 0 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCMandatoryParameterNotSupplied, 0, "fcs_query")
-		return ans, general.ConformantStatusBadRequest
+		validErrs.Add(
+			general.ConformantStatusBadRequest, general.DCMandatoryParameterNotSupplied, "fcs_query")
 	}
 	ans.EchoedRequest.Query = fcsQuery
 	logArgs[SearchRetrArgQuery.String()] = fcsQuery
+	if a.corporaConf.QueryNormalization {
+		fcsQuery = query.NormalizeQuery(fcsQuery)
+	}
 
 	// handle start record parameter
 	xStartRecord := ctx.DefaultQuery(SearchRetrStartRecord.String(), "1")
 	startRecord, err := strconv.Atoi(xStartRecord)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchRetrStartRecord.String())
-		return ans, general.ConformantUnprocessableEntity
-	}
-	if startRecord < 1 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchRetrStartRecord.String())
-		return ans, general.ConformantUnprocessableEntity
+	if err != nil || startRecord < 1 {
+		validErrs.Add(
+			general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+			SearchRetrStartRecord.String())
 	}
 	ans.EchoedRequest.StartRecord = startRecord
 	logArgs[SearchRetrStartRecord.String()] = startRecord
@@ -117,72 +175,109 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	// handle record schema parameter
 	recordSchema := ctx.DefaultQuery(SearchRetrArgRecordSchema.String(), general.RecordSchema)
 	if recordSchema != general.RecordSchema {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnknownSchemaForRetrieval, 0, SearchMaximumRecords.String())
-		return ans, general.ConformantUnprocessableEntity
+		validErrs.Add(
+			general.ConformantUnprocessableEntity, general.DCUnknownSchemaForRetrieval, recordSchema)
 	}
 
 	// handle max records parameter
 	maximumRecords := a.corporaConf.MaximumRecords
 	if xMaximumRecords := ctx.Query(SearchMaximumRecords.String()); len(xMaximumRecords) > 0 {
 		maximumRecords, err = strconv.Atoi(xMaximumRecords)
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCUnsupportedParameterValue, 0, SearchMaximumRecords.String())
-			return ans, general.ConformantUnprocessableEntity
-		}
-	}
-	if maximumRecords < 1 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchMaximumRecords.String())
-		return ans, general.ConformantUnprocessableEntity
+		if err != nil || maximumRecords < 0 {
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchMaximumRecords.String())
 
+		} else if maximumRecords > mango.MaxRecordsInternalLimit {
+			// TODO the error type is not probably very accurate
+			// as the actual result can be very small. But we still
+			// have to limit max. number of records...
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCTooManyMatchingRecords,
+				fmt.Sprintf("%d", mango.MaxRecordsInternalLimit))
+		}
 	}
-	if maximumRecords > mango.MaxRecordsInternalLimit {
-		// TODO the error type is not probably very accurate
-		// as the actual result can be very small. But we still
-		// have to limit max. number of records...
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCTooManyMatchingRecords, 0, fmt.Sprintf("%d", mango.MaxRecordsInternalLimit))
-		return ans, general.ConformantUnprocessableEntity
-	}
+	// aggregators may get less records than requested (see AggregatorLimits)
+	maximumRecords, recordsReduced := a.corporaConf.AggregatorLimits.EffectiveMaxRecords(
+		ctx.Request, maximumRecords)
 	logArgs[SearchMaximumRecords.String()] = maximumRecords
+	// maximumRecords=0 is a way how clients obtain just the total
+	// number of records (with no records returned)
+	countOnly := maximumRecords == 0
 
 	// handle requested sources
 	corporaPids := fetchContext(ctx)
 	corpora := make([]string, 0, len(corporaPids))
+	var unknownResource bool
 	if len(corporaPids) > 0 {
 		for _, pid := range corporaPids {
 			res, err := a.corporaConf.Resources.GetResourceByPID(pid)
 			if err == corpus.ErrResourceNotFound {
-				ans.Records = nil
-				return ans, http.StatusOK
+				unknownResource = true
+				break
 			}
 			corpora = append(corpora, res.ID)
 		}
 
 	} else {
-		corpora = a.corporaConf.Resources.GetCorpora()
+		// FCS 1.2 supports only basic search so resources not supporting
+		// it are skipped (explicitly requested ones are reported as errors)
+		for _, rsc := range a.corporaConf.Resources {
+			if rsc.IsBasicSearchSupported() {
+				corpora = append(corpora, rsc.ID)
+			}
+		}
 	}
 
-	// get searchable corpora and attrs
-	if len(corpora) == 0 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedContextSet, 0, SearchRetrArgFCSContext.String())
-		return ans, general.ConformantStatusBadRequest
+	// get searchable corpora
+	if len(corpora) == 0 && !unknownResource {
+		validErrs.Add(
+			general.ConformantStatusBadRequest, general.DCUnsupportedContextSet,
+			SearchRetrArgFCSContext.String())
+	}
+
+	reqAttrs := fetchAttrs(ctx)
+	if len(reqAttrs) > 0 {
+		logArgs[SearchRetrArgFCSAttrs.String()] = reqAttrs
+		unknownAttrs, err := a.corporaConf.Resources.GetUnknownPosAttrs(reqAttrs, corpora...)
+		if err != nil {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSAttrs.String(), err.Error())
+
+		} else if len(unknownAttrs) > 0 {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSAttrs.String(),
+				fmt.Sprintf("Unknown attributes: %s", strings.Join(unknownAttrs, ", ")))
+		}
+	}
+
+	groupByResource := ctx.Query(SearchRetrArgFCSGroupByRsc.String()) == "true"
+	if groupByResource {
+		logArgs[SearchRetrArgFCSGroupByRsc.String()] = groupByResource
+	}
+
+	if validErrs.HasErrors() {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		for _, fcsErr := range validErrs.Errors {
+			ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
+		}
+		return ans, validErrs.Status
+	}
+	if unknownResource {
+		ans.Records = nil
+		return ans, http.StatusOK
 	}
+
 	retrieveAttrs, err := a.corporaConf.Resources.GetCommonPosAttrNames(corpora...)
 	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCGeneralSystemError, 0, err.Error())
+			general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
 		return ans, http.StatusInternalServerError
 	}
+	retrieveAttrs = restrictAttrs(retrieveAttrs, reqAttrs)
 	// add text layer as another attr,
 	// otherwise we won't be able to parse it due to Manatee output formatting
 	retrieveAttrs = append(retrieveAttrs, retrieveAttrs[0])
@@ -193,100 +288,287 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	log.Warn().Msg("Data views are not implemented yet!")
 	logArgs[SearchRetrArgFCSDataViews.String()] = ctx.Query(SearchRetrArgFCSDataViews.String())
 
-	ranges := query.CalculatePartialRanges(corpora, startRecord-1, maximumRecords)
+	// resources not answering within the search time budget
+	// are skipped (with a diagnostic)
+	searchCtx := ctx.Request.Context()
+	if budget := a.corporaConf.SearchTimeBudget(); budget > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = common.WithSearchBudget(searchCtx, budget)
+		defer cancel()
+	}
+	timedOutRscs := make([]string, 0, len(corpora))
+
+	ranges := query.CalculatePartialRanges(
+		corpora, general.ReturnIf(countOnly, 0, startRecord-1), maximumRecords)
 
 	// make searches
 	waits := make([]<-chan result.ConcResult, len(ranges))
+	if a.debugMode {
+		ans.ExtraResponseData = schema.NewXMLSRDebugData()
+	}
+	concArgs := make([]rdb.ConcQueryArgs, len(ranges))
+	workerQueues := make([]string, len(ranges))
 	for i, rng := range ranges {
 
-		ast, fcsErr := a.translateQuery(rng.Rsc, fcsQuery)
+		translStart := time.Now()
+		ast, fcsErr := a.translateQuery(rng.Rsc, fcsQuery, fcsResponse.General.Lang)
 		if fcsErr != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
 			return ans, general.ConformantUnprocessableEntity
 		}
 
 		query := ast.Generate()
+		timings.AddTranslate(translStart)
 		if len(ast.Errors()) > 0 {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDiagnostic(
 				general.DCQueryCannotProcess, 0, SearchRetrArgQuery.String(), ast.Errors()[0].Error())
 			return ans, general.ConformantUnprocessableEntity
 		}
 		rscConf, err := a.corporaConf.Resources.GetResource(rng.Rsc)
 		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
 			return ans, general.ConformandGeneralServerError
 		}
-		wait, err := a.radapter.PublishQuery(rdb.Query{
-			Func: "concExample",
-			Args: rdb.ConcQueryArgs{
-				CorpusPath:        a.corporaConf.GetRegistryPath(rng.Rsc),
-				Query:             query,
-				Attrs:             retrieveAttrs,
-				StartLine:         rng.From,
-				MaxItems:          maximumRecords,
-				MaxContext:        a.corporaConf.MaximumContext,
-				ViewContextStruct: rscConf.ViewContextStruct,
-			},
+		concArgs[i] = rdb.ConcQueryArgs{
+			CorpusPath:        a.corporaConf.GetRegistryPath(rng.Rsc),
+			Query:             query,
+			Attrs:             retrieveAttrs,
+			StartLine:         rng.From,
+			MaxItems:          maximumRecords,
+			MaxContext:        a.corporaConf.GetDefaultContext(rscConf),
+			ViewContextStruct: rscConf.ViewContextStruct,
+			GlueStruct:        rscConf.GlueStruct,
+			Encoding:          rscConf.Encoding,
+			MinFormFreq:       rscConf.MinFormFreq,
+		}
+		if countOnly {
+			concArgs[i].Output = rdb.ConcOutputCount
+		}
+		if a.debugMode {
+			ans.ExtraResponseData.AddBackendQuery(rscConf.PID, query)
+		}
+		workerQueues[i] = rscConf.WorkerQueue
+		publishStart := time.Now()
+		wait, err := a.prefetch.PublishConcQuery(searchCtx, rdb.Query{
+			Func:  "concExample",
+			Queue: workerQueues[i],
+			Args:  concArgs[i],
 		})
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+		timings.AddPublish(publishStart)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// there was no free slot for the job in time,
+			// the resource will be reported as timed out
+			continue
+
+		} else if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
 			return ans, http.StatusInternalServerError
 		}
 		waits[i] = wait
 	}
+	results := make(map[string]result.ConcResult)
+	concSizes := make(map[string]int)
+	timings.StartWaiting()
+	for i, wait := range waits {
+		res := common.AwaitResult(searchCtx, wait)
+		timings.AddRscWait(ranges[i].Rsc)
+		if res.HasMalformedResultError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
+
+		} else if errors.Is(res.Error, context.DeadlineExceeded) {
+			timedOutRscs = append(timedOutRscs, ranges[i].Rsc)
+
+		} else if res.Error != nil && !res.HasOutOfRangeError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCQueryCannotProcess, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
+		}
+		results[ranges[i].Rsc] = res
+		concSizes[ranges[i].Rsc] = res.ConcSize
+	}
+
+	// lenient clients may prefer the last page to an out of range error
+	var clampedStartRecord int
+	if a.corporaConf.ClampStartRecord && !countOnly {
+		var total int
+		for _, size := range concSizes {
+			total += size
+		}
+		if total > 0 && startRecord-1 >= total {
+			clampedStartRecord = startRecord
+			startRecord = query.LastPageOffset(total, maximumRecords) + 1
+		}
+	}
+
+	// The ranges above have been calculated with the assumption that all
+	// the resources have enough lines. Now we know actual concordance sizes
+	// so we can make sure records are ordered the same way on all the pages
+	// (and re-fetch lines of resources with incorrectly estimated ranges).
+	var exactRanges query.LineRangeList
+	if groupByResource {
+		exactRanges = query.CalculateGroupedRanges(
+			corpora, concSizes, general.ReturnIf(countOnly, 0, startRecord-1), maximumRecords)
+
+	} else {
+		exactRanges = query.CalculateExactRanges(
+			corpora, concSizes, general.ReturnIf(countOnly, 0, startRecord-1), maximumRecords)
+	}
+	refetchWaits := make(map[string]<-chan result.ConcResult)
+	for _, rng := range exactRanges {
+		i := collections.SliceFindIndex(ranges, func(v query.LineRange) bool { return v.Rsc == rng.Rsc })
+		if ranges[i].From == rng.From {
+			continue
+		}
+		if rng.IsEmpty() {
+			// the resource is not reached by the page (grouped results)
+			res := results[rng.Rsc]
+			res.Lines = nil
+			res.WideLines = nil
+			results[rng.Rsc] = res
+			continue
+		}
+		if rng.From >= concSizes[rng.Rsc] {
+			results[rng.Rsc] = result.ConcResult{
+				ConcSize: concSizes[rng.Rsc],
+				Query:    results[rng.Rsc].Query,
+				Error:    mango.ErrRowsRangeOutOfConc,
+			}
+			continue
+		}
+		args := concArgs[i]
+		args.StartLine = rng.From
+		publishStart := time.Now()
+		wait, err := a.prefetch.PublishConcQuery(searchCtx, rdb.Query{
+			Func:  "concExample",
+			Queue: workerQueues[i],
+			Args:  args,
+		})
+		timings.AddPublish(publishStart)
+		if errors.Is(err, context.DeadlineExceeded) {
+			refetchWaits[rng.Rsc] = nil
+			continue
+
+		} else if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
+			return ans, http.StatusInternalServerError
+		}
+		refetchWaits[rng.Rsc] = wait
+	}
+	timings.StartWaiting()
+	for rsc, wait := range refetchWaits {
+		res := common.AwaitResult(searchCtx, wait)
+		timings.AddRscWait(rsc)
+		if res.HasMalformedResultError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
+
+		} else if errors.Is(res.Error, context.DeadlineExceeded) {
+			timedOutRscs = append(timedOutRscs, rsc)
+			res.ConcSize = concSizes[rsc]
+
+		} else if res.Error != nil && !res.HasOutOfRangeError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCQueryCannotProcess, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
+		}
+		results[rsc] = res
+	}
+
+	timings.StartMerge()
 	// using fromResource, we will cycle through available resources' results and their lines
-	fromResource := result.NewRoundRobinLineSel(maximumRecords, ranges.PIDList()...)
+	fromResource := result.NewRoundRobinLineSel(maximumRecords, exactRanges.PIDList()...)
+	if a.corporaConf.DeduplicateRecords {
+		fromResource.EnableDeduplication()
+	}
+	if groupByResource {
+		fromResource.EnableGrouping()
+	}
 	usedQueries := make(map[string]string) // maps resource ID to Manatee CQL query
 	var totalConcSize int
-	for i, wait := range waits {
-		result := <-wait
-		if result.Error != nil {
-			if result.Error == mango.ErrRowsRangeOutOfConc {
-				fromResource.RscSetErrorAt(i, err)
-
-			} else {
-				ans.Diagnostics = schema.NewXMLDiagnostics()
-				ans.Diagnostics.AddDfltMsgDiagnostic(
-					general.DCQueryCannotProcess, 0, err.Error())
-				return ans, http.StatusInternalServerError
-			}
+	for i, rng := range exactRanges {
+		res := results[rng.Rsc]
+		if res.Error != nil {
+			fromResource.RscSetErrorAt(i, res.Error)
 		}
-		fromResource.SetRscLines(ranges[i].Rsc, result)
-		usedQueries[ranges[i].Rsc] = result.Query
-		totalConcSize += result.ConcSize
+		fromResource.SetRscLines(rng.Rsc, res)
+		usedQueries[rng.Rsc] = res.Query
+		totalConcSize += res.ConcSize
 	}
 
 	ans.NumberOfRecords = totalConcSize
 	if fromResource.AllHasOutOfRangeError() {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCFirstRecordPosOutOfRange, 0, fromResource.GetFirstError().Error())
 		return ans, general.ConformantUnprocessableEntity
 
-	} else if fromResource.HasFatalError() {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+	} else if fromResource.HasFatalError() && len(timedOutRscs) == 0 {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCQueryCannotProcess, 0, fromResource.GetFirstError().Error())
+			general.DCQueryCannotProcess, 0,
+			common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, fromResource.GetFirstError()))
 		return ans, general.ConformandGeneralServerError
 	}
+	if len(timedOutRscs) > 0 {
+		// partial result - other resources still provide their lines
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		for _, rsc := range timedOutRscs {
+			ans.Diagnostics.AddDiagnostic(
+				0, general.DTGeneralProcessingHint, rsc,
+				fmt.Sprintf(
+					"timed-out-partial: search in resource %s did not finish within the search time budget",
+					rsc))
+		}
+	}
+	if recordsReduced {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, SearchMaximumRecords.String(),
+			fmt.Sprintf("Number of returned records has been limited to %d", maximumRecords))
+	}
+	if clampedStartRecord > 0 {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, SearchRetrStartRecord.String(),
+			fmt.Sprintf(
+				"Record position %d is out of range, returning the last page starting at %d",
+				clampedStartRecord, startRecord))
+	}
+	if countOnly {
+		a.attachTimings(&ans, timings)
+		return ans, http.StatusOK
+	}
 
 	// transform results
 	records := make([]schema.XMLSRRecord, 0, maximumRecords)
 	for len(records) < maximumRecords && fromResource.Next() {
 		res, err := a.corporaConf.Resources.GetResource(fromResource.CurrRscName())
 		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
 			return ans, http.StatusInternalServerError
 		}
-		item := fromResource.CurrLine()
+		item := transform.Apply(res.Transformers, fromResource.CurrLine())
 		var refURL string
 		if res.KontextBacklinkRootURL != "" {
 			var err error
@@ -308,27 +590,17 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 						Type: "application/x-clarin-fcs-hits+xml",
 						Result: schema.XMLSRBasicDataViewResult{
 							XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
-							Data: strings.Join(
-								collections.SliceMap(
-									item.Text.Tokens(),
-									func(token *concordance.Token, i int) string {
-										if token.Strong {
-											return "<hits:Hit>" + token.Word + "</hits:Hit>"
-										}
-										return token.Word
-									},
-								),
-								" ",
-							),
+							Data:      common.FormatHits(item.Text, common.GluedTokens(item.Text, res.GlueStruct)),
 						},
 					},
 				},
 			},
-			RecordPosition: len(records) + startRecord,
+			RecordPosition: len(records) + fromResource.NumDuplicates() + startRecord,
 		})
 	}
 	if len(records) > 0 {
 		ans.Records = &records
 	}
+	a.attachTimings(&ans, timings)
 	return ans, http.StatusOK
 }
@@ -23,6 +23,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/gin-gonic/gin"
 )
 
@@ -34,6 +36,9 @@ const (
 	QueryTypeFCS            QueryType         = "fcs"
 	RecordXMLEscapingXML    RecordXMLEscaping = "xml"
 	RecordXMLEscapingString RecordXMLEscaping = "string" // TODO for now unsupported
+	ContextUnitToken        ContextUnit       = "token"
+	ContextUnitSentence     ContextUnit       = "sentence"
+	ContextUnitParagraph    ContextUnit       = "paragraph"
 
 	SearchRetrArgVersion            SearchRetrArg = "version"
 	SearchRetrStartRecord           SearchRetrArg = "startRecord"
@@ -46,6 +51,21 @@ const (
 	SearchRetrArgFCSContext         SearchRetrArg = "x-fcs-context"
 	SearchRetrArgFCSDataViews       SearchRetrArg = "x-fcs-dataviews"
 	SearchRetrArgFCSRewritesAllowed SearchRetrArg = "x-fcs-rewrites-allowed"
+	SearchRetrArgFCSFuzzy           SearchRetrArg = "x-fcs-fuzzy"
+	SearchRetrArgFCSContextSize     SearchRetrArg = "x-fcs-context-size"
+	SearchRetrArgFCSContextUnit     SearchRetrArg = "x-fcs-context-unit"
+	SearchRetrArgFCSTimeout         SearchRetrArg = "x-fcs-timeout"
+	SearchRetrArgFCSFacet           SearchRetrArg = "x-fcs-facet"
+	SearchRetrArgFCSFacetLimit      SearchRetrArg = "x-fcs-facet-limit"
+	SearchRetrArgFCSHitMarker       SearchRetrArg = "x-fcs-hit-marker"
+	SearchRetrArgFCSAdvLayers       SearchRetrArg = "x-fcs-adv-layers"
+	SearchRetrArgFCSAttrs           SearchRetrArg = "x-fcs-attrs"
+	SearchRetrArgFCSGroupByResource SearchRetrArg = "x-fcs-group-by-resource"
+	SearchRetrArgFacets             SearchRetrArg = "x-mquery-facets"
+	SearchRetrArgFacetsOnly         SearchRetrArg = "x-mquery-facets-only"
+	SearchRetrArgResourceSummary    SearchRetrArg = "x-mquery-resource-summary"
+	SearchRetrArgMatchKey           SearchRetrArg = "x-mquery-match-key"
+	SearchRetrArgSortKeys           SearchRetrArg = "sortKeys"
 
 	ScanArgVersion           ScanArg = "version"
 	ScanArgOperation         ScanArg = "operation"
@@ -53,13 +73,33 @@ const (
 	ScanArgScanClause        ScanArg = "scanClause"
 	ScanArgMaximumTerms      ScanArg = "maximumTerms"
 	ScanArgResponsePosition  ScanArg = "responsePosition"
+	ScanArgScanFold          ScanArg = "x-mquery-scan-fold"
 
 	ExplainArgVersion                ExplainArg = "version"
 	ExplainArgRecordXMLEscaping      ExplainArg = "recordXMLEscaping"
 	ExplainArgOperation              ExplainArg = "operation"
 	ExplainArgFCSEndpointDescription ExplainArg = "x-fcs-endpoint-description"
+	ExplainArgResourcesOffset        ExplainArg = "x-mquery-resources-offset"
 
 	DefaultQueryType QueryType = QueryTypeCQL
+
+	// DataViewCollocations is an ID of the (opt-in) collocations
+	// data view which can be requested via `x-fcs-dataviews`
+	DataViewCollocations = "colloc"
+
+	// DataViewPosition is an ID of the (opt-in) data view providing
+	// absolute corpus positions of hits (see `x-fcs-dataviews`)
+	DataViewPosition = "position"
+
+	// DataViewHitOffsets is an ID of the (opt-in) data view providing
+	// character offsets of hits within the text of the hits data view
+	// (see `x-fcs-dataviews`)
+	DataViewHitOffsets = "hit-offsets"
+
+	// DataViewWideContext is an ID of the (opt-in) data view providing
+	// hits with the whole sentence as a context, in addition to the
+	// regular hits data view (see `x-fcs-dataviews`)
+	DataViewWideContext = "wide"
 )
 
 type Operation string
@@ -91,6 +131,75 @@ func (qt QueryType) String() string {
 	return string(qt)
 }
 
+// Capability returns an FCS endpoint capability an endpoint
+// must declare to accept the query type.
+func (qt QueryType) Capability() string {
+	switch qt {
+	case QueryTypeCQL:
+		return "http://clarin.eu/fcs/capability/basic-search"
+	case QueryTypeFCS:
+		return "http://clarin.eu/fcs/capability/advanced-search"
+	}
+	return ""
+}
+
+// supportedQueryTypes returns query types supported by at least
+// one of the resources. This determines capabilities declared
+// in the endpoint description.
+func supportedQueryTypes(resources corpus.SrchResources) []QueryType {
+	ans := make([]QueryType, 0, 2)
+	if resources.SupportsBasicSearch() {
+		ans = append(ans, QueryTypeCQL)
+	}
+	if resources.SupportsAdvancedSearch() {
+		ans = append(ans, QueryTypeFCS)
+	}
+	return ans
+}
+
+// splitByQueryType splits corpora into the ones which can be searched
+// using the provided query type and the ones which cannot. Unknown
+// corpora are considered supported so errors are reported the usual way.
+func splitByQueryType(
+	resources corpus.SrchResources,
+	corpora []string,
+	queryType QueryType,
+) (supported, unsupported []string) {
+	supported = make([]string, 0, len(corpora))
+	for _, corpusID := range corpora {
+		rsc, err := resources.GetResource(corpusID)
+		if err == nil &&
+			(queryType == QueryTypeCQL && !rsc.IsBasicSearchSupported() ||
+				queryType == QueryTypeFCS && !rsc.IsAdvancedSearchSupported()) {
+			unsupported = append(unsupported, corpusID)
+			continue
+		}
+		supported = append(supported, corpusID)
+	}
+	return
+}
+
+// resolveDefaultQueryType returns a query type used in case a request
+// does not specify one. If all the searched resources declare the same
+// default query type, it is used. Otherwise, DefaultQueryType applies.
+func resolveDefaultQueryType(resources corpus.SrchResources, corpora []string) QueryType {
+	var ans QueryType
+	for _, corpusID := range corpora {
+		rsc, err := resources.GetResource(corpusID)
+		if err != nil || rsc.DefaultQueryType == "" {
+			return DefaultQueryType
+		}
+		if ans != "" && ans != QueryType(rsc.DefaultQueryType) {
+			return DefaultQueryType
+		}
+		ans = QueryType(rsc.DefaultQueryType)
+	}
+	if ans == "" {
+		return DefaultQueryType
+	}
+	return ans
+}
+
 // ----
 
 type RecordXMLEscaping string
@@ -104,6 +213,30 @@ func (rp RecordXMLEscaping) Validate() error {
 
 // ----
 
+// ContextUnit specifies how KWIC context is delimited. With
+// ContextUnitToken, a fixed number of tokens is used. Other
+// units return the whole enclosing structure (as mapped
+// via resource's StructureMapping).
+type ContextUnit string
+
+func (cu ContextUnit) Validate() error {
+	if cu == ContextUnitToken || cu == ContextUnitSentence ||
+		cu == ContextUnitParagraph {
+		return nil
+	}
+	return fmt.Errorf("unsupported context unit: %s", cu)
+}
+
+func (cu ContextUnit) IsStructural() bool {
+	return cu == ContextUnitSentence || cu == ContextUnitParagraph
+}
+
+func (cu ContextUnit) String() string {
+	return string(cu)
+}
+
+// ----
+
 type SearchRetrArg string
 
 func (sra SearchRetrArg) Validate() error {
@@ -117,7 +250,22 @@ func (sra SearchRetrArg) Validate() error {
 		sra == SearchRetrArgRecordSchema ||
 		sra == SearchRetrArgFCSContext ||
 		sra == SearchRetrArgFCSDataViews ||
-		sra == SearchRetrArgFCSRewritesAllowed {
+		sra == SearchRetrArgFCSRewritesAllowed ||
+		sra == SearchRetrArgFCSFuzzy ||
+		sra == SearchRetrArgFCSContextSize ||
+		sra == SearchRetrArgFCSContextUnit ||
+		sra == SearchRetrArgFCSTimeout ||
+		sra == SearchRetrArgFCSFacet ||
+		sra == SearchRetrArgFCSFacetLimit ||
+		sra == SearchRetrArgFCSHitMarker ||
+		sra == SearchRetrArgFCSAdvLayers ||
+		sra == SearchRetrArgFCSAttrs ||
+		sra == SearchRetrArgFCSGroupByResource ||
+		sra == SearchRetrArgFacets ||
+		sra == SearchRetrArgFacetsOnly ||
+		sra == SearchRetrArgResourceSummary ||
+		sra == SearchRetrArgMatchKey ||
+		sra == SearchRetrArgSortKeys {
 		return nil
 	}
 	return fmt.Errorf("unknown searchRetrieve argument: %s", sra)
@@ -141,7 +289,8 @@ func (sa ScanArg) Validate() error {
 		sa == ScanArgRecordXMLEscaping ||
 		sa == ScanArgScanClause ||
 		sa == ScanArgMaximumTerms ||
-		sa == ScanArgResponsePosition {
+		sa == ScanArgResponsePosition ||
+		sa == ScanArgScanFold {
 		return nil
 	}
 	return fmt.Errorf("unknown scan argument: %s", sa)
@@ -155,7 +304,8 @@ func (arg ExplainArg) Validate() error {
 	if arg == ExplainArgVersion ||
 		arg == ExplainArgRecordXMLEscaping ||
 		arg == ExplainArgOperation ||
-		arg == ExplainArgFCSEndpointDescription {
+		arg == ExplainArgFCSEndpointDescription ||
+		arg == ExplainArgResourcesOffset {
 		return nil
 	}
 	return fmt.Errorf("unknown explain argument: %s", arg)
@@ -181,3 +331,73 @@ func fetchContext(ctx *gin.Context) []string {
 	}
 	return tmp
 }
+
+func fetchDataViews(ctx *gin.Context) []string {
+	tmp := strings.Split(ctx.DefaultQuery(SearchRetrArgFCSDataViews.String(), ""), ",")
+	if len(tmp) == 0 || len(tmp) == 1 && tmp[0] == "" {
+		return []string{}
+	}
+	return tmp
+}
+
+// fetchAdvLayers obtains layers requested via `x-fcs-adv-layers`.
+// Unknown layers are returned separately so they can be reported.
+// Empty `layers` means no restriction.
+func fetchAdvLayers(ctx *gin.Context) (layers []corpus.LayerType, unknown []string) {
+	layers = make([]corpus.LayerType, 0, 5)
+	for _, v := range strings.Split(ctx.Query(SearchRetrArgFCSAdvLayers.String()), ",") {
+		if v == "" {
+			continue
+		}
+		layer := corpus.LayerType(v)
+		if err := layer.Validate(); err != nil {
+			unknown = append(unknown, v)
+
+		} else if !collections.SliceContains(layers, layer) {
+			layers = append(layers, layer)
+		}
+	}
+	return
+}
+
+// fetchAttrs obtains unique positional attribute names
+// requested via the comma-separated `x-fcs-attrs` argument
+func fetchAttrs(ctx *gin.Context) []string {
+	ans := make([]string, 0, 5)
+	for _, v := range strings.Split(ctx.Query(SearchRetrArgFCSAttrs.String()), ",") {
+		if v != "" && !collections.SliceContains(ans, v) {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
+
+// facetArg returns the argument the `facet` has been requested by
+// (in case of both, `x-fcs-facet` is returned)
+func facetArg(ctx *gin.Context, facet string) SearchRetrArg {
+	for _, v := range ctx.QueryArray(SearchRetrArgFCSFacet.String()) {
+		if collections.SliceContains(strings.Split(v, ","), facet) {
+			return SearchRetrArgFCSFacet
+		}
+	}
+	return SearchRetrArgFacets
+}
+
+// fetchFacets obtains requested facets from both the `x-fcs-facet`
+// (can be repeated) and `x-mquery-facets` arguments. Both also accept
+// comma-separated facet names.
+func fetchFacets(ctx *gin.Context) []string {
+	ans := make([]string, 0, 5)
+	values := append(
+		ctx.QueryArray(SearchRetrArgFCSFacet.String()),
+		ctx.QueryArray(SearchRetrArgFacets.String())...,
+	)
+	for _, v := range values {
+		for _, facet := range strings.Split(v, ",") {
+			if facet != "" && !collections.SliceContains(ans, facet) {
+				ans = append(ans, facet)
+			}
+		}
+	}
+	return ans
+}
@@ -0,0 +1,150 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func TestQueryTypeValidate(t *testing.T) {
+	assert.NoError(t, QueryTypeCQL.Validate())
+	assert.NoError(t, QueryTypeFCS.Validate())
+	assert.Error(t, QueryType("lex").Validate())
+	assert.Error(t, QueryType("").Validate())
+}
+
+func TestQueryTypeCapability(t *testing.T) {
+	assert.Equal(t, "http://clarin.eu/fcs/capability/basic-search", QueryTypeCQL.Capability())
+	assert.Equal(t, "http://clarin.eu/fcs/capability/advanced-search", QueryTypeFCS.Capability())
+	assert.Equal(t, "", QueryType("lex").Capability())
+}
+
+func TestSupportedQueryTypesAll(t *testing.T) {
+	rscs := corpus.SrchResources{
+		{ID: "corp1"},
+		{ID: "corp2", SupportsAdvanced: boolPtr(false)},
+	}
+	assert.Equal(t, []QueryType{QueryTypeCQL, QueryTypeFCS}, supportedQueryTypes(rscs))
+}
+
+func TestResolveDefaultQueryType(t *testing.T) {
+	rscs := corpus.SrchResources{
+		{ID: "corp1", DefaultQueryType: "fcs"},
+		{ID: "corp2", DefaultQueryType: "fcs"},
+		{ID: "corp3", DefaultQueryType: "cql"},
+		{ID: "corp4"},
+	}
+	assert.Equal(t, QueryTypeFCS, resolveDefaultQueryType(rscs, []string{"corp1", "corp2"}))
+	assert.Equal(t, QueryTypeCQL, resolveDefaultQueryType(rscs, []string{"corp3"}))
+	assert.Equal(t, DefaultQueryType, resolveDefaultQueryType(rscs, []string{"corp1", "corp3"}))
+	assert.Equal(t, DefaultQueryType, resolveDefaultQueryType(rscs, []string{"corp1", "corp4"}))
+	assert.Equal(t, DefaultQueryType, resolveDefaultQueryType(rscs, []string{}))
+}
+
+func TestSupportedQueryTypesBasicOnly(t *testing.T) {
+	rscs := corpus.SrchResources{
+		{ID: "corp1", SupportsAdvanced: boolPtr(false)},
+		{ID: "corp2", SupportsAdvanced: boolPtr(false)},
+	}
+	assert.Equal(t, []QueryType{QueryTypeCQL}, supportedQueryTypes(rscs))
+}
+
+func TestSupportedQueryTypesAdvancedOnly(t *testing.T) {
+	rscs := corpus.SrchResources{
+		{ID: "corp1", SupportsBasic: boolPtr(false)},
+	}
+	assert.Equal(t, []QueryType{QueryTypeFCS}, supportedQueryTypes(rscs))
+}
+
+func TestSplitByQueryType(t *testing.T) {
+	rscs := corpus.SrchResources{
+		{ID: "corp1"},
+		{ID: "corp2", SupportsAdvanced: boolPtr(false)},
+		{ID: "corp3", SupportsBasic: boolPtr(false)},
+	}
+	supported, unsupported := splitByQueryType(rscs, []string{"corp1", "corp2", "corp3"}, QueryTypeFCS)
+	assert.Equal(t, []string{"corp1", "corp3"}, supported)
+	assert.Equal(t, []string{"corp2"}, unsupported)
+	supported, unsupported = splitByQueryType(rscs, []string{"corp1", "corp2", "corp3"}, QueryTypeCQL)
+	assert.Equal(t, []string{"corp1", "corp2"}, supported)
+	assert.Equal(t, []string{"corp3"}, unsupported)
+}
+
+func TestFetchFacets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet, "/?x-fcs-facet=genre&x-fcs-facet=decade,genre&x-mquery-facets=medium", nil)
+	assert.Equal(t, []string{"genre", "decade", "medium"}, fetchFacets(ctx))
+}
+
+func TestFetchFacetsEmpty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/?x-fcs-facet=", nil)
+	assert.Equal(t, []string{}, fetchFacets(ctx))
+}
+
+func TestFacetArg(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet, "/?x-fcs-facet=genre,decade&x-mquery-facets=medium,genre", nil)
+	assert.Equal(t, SearchRetrArgFCSFacet, facetArg(ctx, "decade"))
+	assert.Equal(t, SearchRetrArgFCSFacet, facetArg(ctx, "genre"))
+	assert.Equal(t, SearchRetrArgFacets, facetArg(ctx, "medium"))
+}
+
+func TestFetchAdvLayers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet, "/?x-fcs-adv-layers=lemma,foo,pos,lemma", nil)
+	layers, unknown := fetchAdvLayers(ctx)
+	assert.Equal(t, []corpus.LayerType{corpus.LayerTypeLemma, corpus.LayerTypePOS}, layers)
+	assert.Equal(t, []string{"foo"}, unknown)
+}
+
+func TestFetchAttrs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet, "/?x-fcs-attrs=word,,lemma,word", nil)
+	assert.Equal(t, []string{"word", "lemma"}, fetchAttrs(ctx))
+}
+
+func TestRestrictLayers(t *testing.T) {
+	layers := []corpus.LayerType{corpus.LayerTypeText, corpus.LayerTypeLemma, corpus.LayerTypePOS}
+	assert.Equal(t, layers, restrictLayers(layers, []corpus.LayerType{}))
+	assert.Equal(
+		t,
+		[]corpus.LayerType{corpus.LayerTypeLemma},
+		restrictLayers(layers, []corpus.LayerType{corpus.LayerTypeLemma, corpus.LayerTypeOrth}),
+	)
+}
@@ -26,14 +26,17 @@ import (
 )
 
 type XMLDiagnostic struct {
-	URI     []string `xml:"diag:uri,omitempty"`
-	Details string   `xml:"diag:details"`
-	Message string   `xml:"diag:message"`
+	URI     []string `xml:"diag:uri,omitempty" json:"uri,omitempty"`
+	Details string   `xml:"diag:details" json:"details"`
+	Message string   `xml:"diag:message" json:"message"`
 }
 
 type XMLDiagnostics struct {
-	XMLNSDiag   string          `xml:"xmlns:diag,attr"`
-	Diagnostics []XMLDiagnostic `xml:"diag:diagnostic"`
+	XMLNSDiag   string          `xml:"xmlns:diag,attr" json:"-"`
+	Diagnostics []XMLDiagnostic `xml:"diag:diagnostic" json:"diagnostics"`
+
+	// lang specifies a language of default messages
+	lang string
 }
 
 // AddDiagnostic add diagnostics output with a custom
@@ -67,11 +70,12 @@ func (d *XMLDiagnostics) AddDfltMsgDiagnostic(
 	typ general.DiagnosticType,
 	ident string,
 ) {
-	d.AddDiagnostic(code, typ, ident, code.AsMessage())
+	d.AddDiagnostic(code, typ, ident, code.AsMessage(d.lang))
 }
 
-func NewXMLDiagnostics() *XMLDiagnostics {
+func NewXMLDiagnostics(lang string) *XMLDiagnostics {
 	return &XMLDiagnostics{
 		XMLNSDiag: "http://docs.oasis-open.org/ns/search-ws/diagnostic",
+		lang:      lang,
 	}
 }
@@ -21,87 +21,92 @@ package schema
 import "encoding/xml"
 
 type XMLExplainResponse struct {
-	XMLName          xml.Name `xml:"sruResponse:explainResponse"`
-	XMLNSSRUResponse string   `xml:"xmlns:sruResponse,attr"`
-	Version          string   `xml:"sruResponse:version"`
+	XMLName          xml.Name `xml:"sruResponse:explainResponse" json:"-"`
+	XMLNSSRUResponse string   `xml:"xmlns:sruResponse,attr" json:"-"`
+	Version          string   `xml:"sruResponse:version" json:"version"`
 
-	ExplainRecord       *XMLExplainRecord              `xml:"sruResponse:record,omitempty"`
-	EchoedRequest       *XMLExplainEchoedRequest       `xml:"sruResponse:echoedExplainRequest,omitempty"`
-	EndpointDescription *XMLExplainEndpointDescription `xml:"sruResponse:extraResponseData>ed:EndpointDescription,omitempty"`
-	Diagnostics         *XMLDiagnostics                `xml:"sruResponse:diagnostics,omitempty"`
+	ExplainRecord       *XMLExplainRecord              `xml:"sruResponse:record,omitempty" json:"explainRecord,omitempty"`
+	EchoedRequest       *XMLExplainEchoedRequest       `xml:"sruResponse:echoedExplainRequest,omitempty" json:"echoedRequest,omitempty"`
+	EndpointDescription *XMLExplainEndpointDescription `xml:"sruResponse:extraResponseData>ed:EndpointDescription,omitempty" json:"endpointDescription,omitempty"`
+	ResourcesPage       *XMLExplainResourcesPage       `xml:"sruResponse:extraResponseData>rp:resourcesPage,omitempty" json:"resourcesPage,omitempty"`
+	Diagnostics         *XMLDiagnostics                `xml:"sruResponse:diagnostics,omitempty" json:"diagnostics,omitempty"`
 }
 
 // --------------------- Explain Record ---------------------
 
 type XMLExplainRecord struct {
-	Schema      string         `xml:"sruResponse:recordSchema"`
-	XMLEscaping string         `xml:"sruResponse:recordXMLEscaping"`
-	Data        XMLExplainData `xml:"sruResponse:recordData>zr:explain"`
+	Schema      string         `xml:"sruResponse:recordSchema" json:"schema"`
+	XMLEscaping string         `xml:"sruResponse:recordXMLEscaping" json:"xmlEscaping"`
+	Data        XMLExplainData `xml:"sruResponse:recordData>zr:explain" json:"data"`
 }
 
 type XMLExplainData struct {
-	XMLNSZR string `xml:"xmlns:zr,attr"`
+	XMLNSZR string `xml:"xmlns:zr,attr" json:"-"`
 
-	ServerInfo   XMLExplainServerInfo   `xml:"zr:serverInfo"`
-	DatabaseInfo XMLExplainDatabaseInfo `xml:"zr:databaseInfo"`
-	IndexInfo    XMLExplainIndexInfo    `xml:"zr:indexInfo"`
-	SchemaInfo   XMLExplainSchemaInfo   `xml:"zr:schemaInfo"`
-	ConfigInfo   XMLExplainConfigInfo   `xml:"zr:configInfo"`
+	ServerInfo   XMLExplainServerInfo   `xml:"zr:serverInfo" json:"serverInfo"`
+	DatabaseInfo XMLExplainDatabaseInfo `xml:"zr:databaseInfo" json:"databaseInfo"`
+	IndexInfo    XMLExplainIndexInfo    `xml:"zr:indexInfo" json:"indexInfo"`
+	SchemaInfo   XMLExplainSchemaInfo   `xml:"zr:schemaInfo" json:"schemaInfo"`
+	ConfigInfo   XMLExplainConfigInfo   `xml:"zr:configInfo" json:"configInfo"`
 }
 
 type XMLExplainServerInfo struct {
-	Protocol  string `xml:"protocol,attr"`
-	Version   string `xml:"version,attr"`
-	Transport string `xml:"transport,attr"`
+	Protocol  string `xml:"protocol,attr" json:"protocol"`
+	Version   string `xml:"version,attr" json:"version"`
+	Transport string `xml:"transport,attr" json:"transport"`
 
-	Host     string `xml:"zr:host"`
-	Port     string `xml:"zr:port"`
-	Database string `xml:"zr:database"`
+	Host     string `xml:"zr:host" json:"host"`
+	Port     string `xml:"zr:port" json:"port"`
+	Database string `xml:"zr:database" json:"database"`
 }
 
 type XMLExplainDatabaseInfo struct {
-	Titles       []XMLMultilingual `xml:"zr:title"`
-	Descriptions []XMLMultilingual `xml:"zr:description"`
-	Authors      []XMLMultilingual `xml:"zr:author"`
+	Titles       []XMLMultilingual `xml:"zr:title" json:"titles"`
+	Descriptions []XMLMultilingual `xml:"zr:description" json:"descriptions"`
+	Authors      []XMLMultilingual `xml:"zr:author" json:"authors"`
+
+	// Extent describes the size of the data (number of tokens)
+	Extent     string `xml:"zr:extent,omitempty" json:"extent,omitempty"`
+	LastUpdate string `xml:"zr:lastUpdate,omitempty" json:"lastUpdate,omitempty"`
 }
 
 type XMLExplainIndexInfo struct {
-	Set   XMLExplainDefinition     `xml:"zr:set"`
-	Index XMLExplainIndexInfoIndex `xml:"zr:index"`
+	Set   XMLExplainDefinition     `xml:"zr:set" json:"set"`
+	Index XMLExplainIndexInfoIndex `xml:"zr:index" json:"index"`
 }
 
 type XMLExplainDefinition struct {
-	Identifier string `xml:"identifier,attr"`
-	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr" json:"identifier"`
+	Name       string `xml:"name,attr" json:"name"`
 
-	Titles []XMLMultilingual `xml:"zr:title"`
+	Titles []XMLMultilingual `xml:"zr:title" json:"titles"`
 }
 
 type XMLExplainIndexInfoIndex struct {
-	Search bool `xml:"search,attr"`
-	Scan   bool `xml:"scan,attr"`
-	Sort   bool `xml:"sort,attr"`
+	Search bool `xml:"search,attr" json:"search"`
+	Scan   bool `xml:"scan,attr" json:"scan"`
+	Sort   bool `xml:"sort,attr" json:"sort"`
 
-	Titles []XMLMultilingual             `xml:"zr:title"`
-	Maps   []XMLExplainIndexInfoIndexMap `xml:"zr:map"`
+	Titles []XMLMultilingual             `xml:"zr:title" json:"titles"`
+	Maps   []XMLExplainIndexInfoIndexMap `xml:"zr:map" json:"maps"`
 }
 
 type XMLExplainIndexInfoIndexMap struct {
-	Primary bool                            `xml:"primary,attr,omitempty"`
-	Name    XMLExplainIndexInfoIndexMapName `xml:"zr:name"`
+	Primary bool                            `xml:"primary,attr,omitempty" json:"primary,omitempty"`
+	Name    XMLExplainIndexInfoIndexMapName `xml:"zr:name" json:"name"`
 }
 
 type XMLExplainIndexInfoIndexMapName struct {
-	Set   string `xml:"set,attr"`
-	Value string `xml:",chardata"`
+	Set   string `xml:"set,attr" json:"set"`
+	Value string `xml:",chardata" json:"value"`
 }
 
 type XMLExplainSchemaInfo struct {
-	Schema XMLExplainDefinition `xml:"zr:schema"`
+	Schemas []XMLExplainDefinition `xml:"zr:schema" json:"schemas"`
 }
 
 type XMLExplainConfigInfo struct {
-	Values []XMLExplainConfig
+	Values []XMLExplainConfig `json:"values"`
 }
 
 func (c *XMLExplainConfigInfo) AddDefault(key string, value any) {
@@ -121,52 +126,79 @@ func (c *XMLExplainConfigInfo) AddSetting(typ string, value any) {
 }
 
 type XMLExplainConfig struct {
-	XMLName xml.Name
-	Type    string `xml:"type,attr"`
-	Value   any    `xml:",chardata"`
+	XMLName xml.Name `json:"-"`
+	Type    string   `xml:"type,attr" json:"type"`
+	Value   any      `xml:",chardata" json:"value"`
 }
 
 // --------------------- Echoed Explain Request ---------------------
 
 type XMLExplainEchoedRequest struct {
-	Version string `xml:"sruResponse:version"`
+	Version string `xml:"sruResponse:version" json:"version"`
 }
 
 // --------------------- Extra Response Data ---------------------
 
 type XMLExplainEndpointDescription struct {
-	XMLNSED string `xml:"xmlns:ed,attr"`
-	Version string `xml:"version,attr"`
+	XMLNSED string `xml:"xmlns:ed,attr" json:"-"`
+	Version string `xml:"version,attr" json:"version"`
 
-	Capabilities       []string                      `xml:"ed:Capabilities>ed:Capability"`
-	SupportedDataViews []XMLExplainSupportedDataView `xml:"ed:SupportedDataViews>ed:SupportedDataView"`
-	SupportedLayers    []XMLExplainSupportedLayer    `xml:"ed:SupportedLayers>ed:SupportedLayer"`
-	Resources          []XMLExplainResource          `xml:"ed:Resources>ed:Resource"`
+	Capabilities       []string                      `xml:"ed:Capabilities>ed:Capability" json:"capabilities"`
+	SupportedDataViews []XMLExplainSupportedDataView `xml:"ed:SupportedDataViews>ed:SupportedDataView" json:"supportedDataViews"`
+	SupportedLayers    []XMLExplainSupportedLayer    `xml:"ed:SupportedLayers>ed:SupportedLayer" json:"supportedLayers"`
+	Resources          []XMLExplainResource          `xml:"ed:Resources>ed:Resource" json:"resources"`
 }
 
 type XMLExplainSupportedDataView struct {
-	ID             string `xml:"id,attr"`
-	DeliveryPolicy string `xml:"delivery-policy,attr"`
-	Value          string `xml:",chardata"`
+	ID             string `xml:"id,attr" json:"id"`
+	DeliveryPolicy string `xml:"delivery-policy,attr" json:"deliveryPolicy"`
+	Value          string `xml:",chardata" json:"value"`
 }
 
 type XMLExplainSupportedLayer struct {
-	ID        string `xml:"id,attr"`
-	Qualifier string `xml:"qualifier,attr"`
-	ResultID  string `xml:"result-id,attr"`
-	Value     string `xml:",chardata"`
+	ID        string `xml:"id,attr" json:"id"`
+	Qualifier string `xml:"qualifier,attr" json:"qualifier"`
+	ResultID  string `xml:"result-id,attr" json:"resultId"`
+	Value     string `xml:",chardata" json:"value"`
 }
 
 type XMLExplainResource struct {
-	PID                string                    `xml:"pid,attr"`
-	Titles             []XMLMultilingual2        `xml:"ed:Title"`
-	Descriptions       []XMLMultilingual2        `xml:"ed:Description"`
-	LandingPage        string                    `xml:"ed:LandingPageURI,omitempty"`
-	Languages          []string                  `xml:"ed:Languages>ed:Language"`
-	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews"`
-	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers"`
+	PID                string                     `xml:"pid,attr" json:"pid"`
+	Titles             []XMLMultilingual2         `xml:"ed:Title" json:"titles"`
+	Descriptions       []XMLMultilingual2         `xml:"ed:Description" json:"descriptions"`
+	LandingPage        string                     `xml:"ed:LandingPageURI,omitempty" json:"landingPage,omitempty"`
+	Languages          []string                   `xml:"ed:Languages>ed:Language" json:"languages"`
+	AvailableDataViews XMLExplainAvailableValues  `xml:"ed:AvailableDataViews" json:"availableDataViews"`
+	AvailableLayers    *XMLExplainAvailableValues `xml:"ed:AvailableLayers,omitempty" json:"availableLayers,omitempty"`
+
+	// Size and LastUpdated are not part of the FCS endpoint description
+	// so they are available only in the JSON output
+	Size        int64  `xml:"-" json:"size,omitempty"`
+	LastUpdated string `xml:"-" json:"lastUpdated,omitempty"`
+}
+
+// XMLExplainResourcesPage describes which part of the resources
+// is listed in the endpoint description. It is attached only in case
+// the number of listed resources is limited by the configuration.
+type XMLExplainResourcesPage struct {
+	XMLNSRP    string `xml:"xmlns:rp,attr" json:"-"`
+	Total      int    `xml:"total,attr" json:"total"`
+	Offset     int    `xml:"offset,attr" json:"offset"`
+	NextOffset int    `xml:"nextOffset,attr,omitempty" json:"nextOffset,omitempty"`
+}
+
+func NewXMLExplainResourcesPage(total, offset, nextOffset int) *XMLExplainResourcesPage {
+	ans := &XMLExplainResourcesPage{
+		XMLNSRP: "http://www.korpus.cz/mquery/resources-page",
+		Total:   total,
+		Offset:  offset,
+	}
+	if nextOffset > 0 {
+		ans.NextOffset = nextOffset
+	}
+	return ans
 }
 
 type XMLExplainAvailableValues struct {
-	Values string `xml:"ref,attr"`
+	Values string `xml:"ref,attr" json:"values"`
 }
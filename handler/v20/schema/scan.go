@@ -21,10 +21,18 @@ package schema
 import "encoding/xml"
 
 type XMLScanResponse struct {
-	XMLName           xml.Name        `xml:"scan:scanResponse"`
-	XMLNSScanResponse string          `xml:"xmlns:scan,attr"`
-	Version           string          `xml:"scan:version"`
-	Diagnostics       *XMLDiagnostics `xml:"scan:diagnostics,omitempty"`
+	XMLName           xml.Name        `xml:"scan:scanResponse" json:"-"`
+	XMLNSScanResponse string          `xml:"xmlns:scan,attr" json:"-"`
+	Version           string          `xml:"scan:version" json:"version"`
+	Terms             []XMLScanTerm   `xml:"scan:terms>scan:term,omitempty" json:"terms,omitempty"`
+	Diagnostics       *XMLDiagnostics `xml:"scan:diagnostics,omitempty" json:"diagnostics,omitempty"`
+}
+
+// XMLScanTerm is a value of a scanned index along with
+// a number of records (e.g. documents) with the value
+type XMLScanTerm struct {
+	Value           string `xml:"scan:value" json:"value"`
+	NumberOfRecords int64  `xml:"scan:numberOfRecords" json:"numberOfRecords"`
 }
 
 func NewXMLScanResponse() XMLScanResponse {
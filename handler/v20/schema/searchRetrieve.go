@@ -18,23 +18,30 @@
 
 package schema
 
-import "encoding/xml"
+import (
+	"encoding/xml"
+
+	"github.com/czcorpus/mquery-sru/rdb"
+)
 
 type XMLSRResponse struct {
-	XMLName          xml.Name `xml:"sruResponse:searchRetrieveResponse"`
-	XMLNSSRUResponse string   `xml:"xmlns:sruResponse,attr"`
-	Version          string   `xml:"sruResponse:version"`
+	XMLName          xml.Name `xml:"sruResponse:searchRetrieveResponse" json:"-"`
+	XMLNSSRUResponse string   `xml:"xmlns:sruResponse,attr" json:"-"`
+	Version          string   `xml:"sruResponse:version" json:"version"`
 
-	NumberOfRecords int `xml:"sruResponse:numberOfRecords"`
+	NumberOfRecords int `xml:"sruResponse:numberOfRecords" json:"numberOfRecords"`
 
 	// Records
 	// note: we need a pointer here to allow the marshaler skip the 'records' parent
 	// in case there are no 'record' children
-	Records              *[]XMLSRRecord      `xml:"sruResponse:records>sruResponse:record,omitempty"`
-	NextRecordPosition   int                 `xml:"sruResponse:nextRecordPosition,omitempty"`
-	EchoedRequest        *XMLSREchoedRequest `xml:"sruResponse:echoedSearchRetrieveRequest,omitempty"`
-	Diagnostics          *XMLDiagnostics     `xml:"sruResponse:diagnostics,omitempty"`
-	ResultCountPrecision string              `xml:"sruResponse:resultCountPrecision"`
+	Records              *[]XMLSRRecord      `xml:"sruResponse:records>sruResponse:record,omitempty" json:"records,omitempty"`
+	NextRecordPosition   int                 `xml:"sruResponse:nextRecordPosition,omitempty" json:"nextRecordPosition,omitempty"`
+	EchoedRequest        *XMLSREchoedRequest `xml:"sruResponse:echoedSearchRetrieveRequest,omitempty" json:"echoedRequest,omitempty"`
+	Diagnostics          *XMLDiagnostics     `xml:"sruResponse:diagnostics,omitempty" json:"diagnostics,omitempty"`
+	ExtraResponseData    *XMLSRDebugData     `xml:"sruResponse:extraResponseData>mq:debug,omitempty" json:"extraResponseData,omitempty"`
+	Facets               *XMLSRFacets        `xml:"sruResponse:extraResponseData>fct:facets,omitempty" json:"facets,omitempty"`
+	ResourceSummary      *XMLSRRscSummary    `xml:"sruResponse:extraResponseData>rs:summary,omitempty" json:"resourceSummary,omitempty"`
+	ResultCountPrecision string              `xml:"sruResponse:resultCountPrecision" json:"resultCountPrecision"`
 }
 
 func NewXMLSRResponse() XMLSRResponse {
@@ -57,63 +64,300 @@ func NewMinimalXMLSRResponse() XMLSRResponse {
 // --------------------- Search Retrieve Record ---------------------
 
 type XMLSRRecord struct {
-	Schema         string        `xml:"sruResponse:recordSchema"`
-	XMLEscaping    string        `xml:"sruResponse:recordXMLEscaping"`
-	Data           XMLSRResource `xml:"sruResponse:recordData>fcs:Resource"`
-	RecordPosition int           `xml:"sruResponse:recordPosition"`
+	Schema      string `xml:"sruResponse:recordSchema" json:"schema"`
+	XMLEscaping string `xml:"sruResponse:recordXMLEscaping" json:"xmlEscaping"`
+
+	// Data contains a record in the FCS resource schema
+	Data *XMLSRResource `xml:"sruResponse:recordData>fcs:Resource,omitempty" json:"data,omitempty"`
+
+	// DCData contains a record in the Dublin Core schema
+	DCData *XMLSRDCRecord `xml:"sruResponse:recordData>oai_dc:dc,omitempty" json:"dcData,omitempty"`
+
+	// RecordIdentifier is an opaque and stable ID of the record
+	// (resolvable via the position endpoint)
+	RecordIdentifier string `xml:"sruResponse:recordIdentifier,omitempty" json:"recordIdentifier,omitempty"`
+	RecordPosition   int    `xml:"sruResponse:recordPosition" json:"recordPosition"`
+
+	// MatchKey is a normalized form of the match (if requested)
+	MatchKey *XMLSRMatchKey `xml:"sruResponse:extraRecordData>mk:matchKey,omitempty" json:"matchKey,omitempty"`
+}
+
+// XMLSRMatchKey is a normalized (folded) form of the match words
+// allowing clients to sort and group records without processing
+// the record data.
+type XMLSRMatchKey struct {
+	XMLNSMK string `xml:"xmlns:mk,attr" json:"-"`
+	Fold    string `xml:"fold,attr" json:"fold"`
+	Value   string `xml:",chardata" json:"value"`
+}
+
+func NewXMLSRMatchKey(fold, value string) *XMLSRMatchKey {
+	return &XMLSRMatchKey{
+		XMLNSMK: "http://www.korpus.cz/mquery/matchkey",
+		Fold:    fold,
+		Value:   value,
+	}
+}
+
+// XMLSRDCRecord is a simplified (Dublin Core) representation
+// of a search result
+type XMLSRDCRecord struct {
+	XMLNSOAIDC  string   `xml:"xmlns:oai_dc,attr" json:"-"`
+	XMLNSDC     string   `xml:"xmlns:dc,attr" json:"-"`
+	Title       string   `xml:"dc:title" json:"title"`
+	Identifier  string   `xml:"dc:identifier" json:"identifier"`
+	Source      string   `xml:"dc:source,omitempty" json:"source,omitempty"`
+	Description string   `xml:"dc:description" json:"description"`
+	Languages   []string `xml:"dc:language" json:"languages"`
 }
 
 type XMLSRResource struct {
-	XMLNSFCS         string                `xml:"xmlns:fcs,attr"`
-	PID              string                `xml:"pid,attr"`
-	ResourceFragment XMLSRResourceFragment `xml:"fcs:ResourceFragment"`
+	XMLNSFCS         string                `xml:"xmlns:fcs,attr" json:"-"`
+	PID              string                `xml:"pid,attr" json:"pid"`
+	ResourceFragment XMLSRResourceFragment `xml:"fcs:ResourceFragment" json:"resourceFragment"`
 }
 
 type XMLSRResourceFragment struct {
-	Ref       string           `xml:"ref,attr,omitempty"`
-	DataViews []*XMLSRDataView `xml:"fcs:DataView"`
+	Ref       string           `xml:"ref,attr,omitempty" json:"ref,omitempty"`
+	DataViews []*XMLSRDataView `xml:"fcs:DataView" json:"dataViews"`
 }
 
 type XMLSRDataView struct {
-	Type   string `xml:"type,attr"`
-	Result any
+	Type   string `xml:"type,attr" json:"type"`
+	Result any    `json:"result"`
 }
 
 type XMLSRBasicDataViewResult struct {
-	XMLName   xml.Name `xml:"hits:Result"`
-	XMLNSHits string   `xml:"xmlns:hits,attr"`
-	Data      string   `xml:",innerxml"`
+	XMLName   xml.Name `xml:"hits:Result" json:"-"`
+	XMLNSHits string   `xml:"xmlns:hits,attr" json:"-"`
+	Data      string   `xml:",innerxml" json:"data"`
+
+	// Columns are provided only in JSON responses
+	// with the `columns` hit marker
+	Columns *XMLSRHitColumns `xml:"-" json:"columns,omitempty"`
+}
+
+// XMLSRHitColumns contains a hit and its contexts
+// as separate values (JSON responses only)
+type XMLSRHitColumns struct {
+	Left  string `json:"left"`
+	Hit   string `json:"hit"`
+	Right string `json:"right"`
 }
 
 type XMLSRAdvancedDataViewResult struct {
-	XMLName  xml.Name          `xml:"adv:Advanced"`
-	Unit     string            `xml:"unit,attr"`
-	XMLNSAdv string            `xml:"xmlns:adv,attr"`
-	Segments []XMLSRAdvSegment `xml:"adv:Segments>adv:Segment"`
-	Layers   []XMLSRAdvLayer   `xml:"adv:Layers>adv:Layer"`
+	XMLName  xml.Name          `xml:"adv:Advanced" json:"-"`
+	Unit     string            `xml:"unit,attr" json:"unit"`
+	XMLNSAdv string            `xml:"xmlns:adv,attr" json:"-"`
+	Segments []XMLSRAdvSegment `xml:"adv:Segments>adv:Segment" json:"segments"`
+	Layers   []XMLSRAdvLayer   `xml:"adv:Layers>adv:Layer" json:"layers"`
 }
 
 type XMLSRAdvSegment struct {
-	ID    string `xml:"id,attr"`
-	Start int    `xml:"start,attr"`
-	End   int    `xml:"end,attr"`
+	ID    string `xml:"id,attr" json:"id"`
+	Start int    `xml:"start,attr" json:"start"`
+	End   int    `xml:"end,attr" json:"end"`
 }
 
 type XMLSRAdvLayer struct {
-	ID     string          `xml:"id,attr"`
-	Values []XMLSRAdvValue `xml:"adv:Span"`
+	ID     string          `xml:"id,attr" json:"id"`
+	Values []XMLSRAdvValue `xml:"adv:Span" json:"values"`
 }
 
 type XMLSRAdvValue struct {
-	Ref       string `xml:"ref,attr"`
-	Highlight string `xml:"highlight,attr,omitempty"`
-	Value     string `xml:",chardata"`
+	Ref       string `xml:"ref,attr" json:"ref"`
+	Highlight string `xml:"highlight,attr,omitempty" json:"highlight,omitempty"`
+	Value     string `xml:",chardata" json:"value"`
+}
+
+type XMLSRCollocDataViewResult struct {
+	XMLName    xml.Name              `xml:"coll:Collocations" json:"-"`
+	XMLNSColl  string                `xml:"xmlns:coll,attr" json:"-"`
+	Attr       string                `xml:"attr,attr" json:"attr"`
+	Window     int                   `xml:"window,attr" json:"window"`
+	Collocates []XMLSRCollocDataItem `xml:"coll:Collocate" json:"collocates"`
+}
+
+type XMLSRCollocDataItem struct {
+	Score float64 `xml:"score,attr" json:"score"`
+	Freq  int64   `xml:"freq,attr" json:"freq"`
+	Value string  `xml:",chardata" json:"value"`
+}
+
+// XMLSRPositionDataViewResult provides an absolute corpus position
+// (of the first token) of a hit so clients can refer to it later
+// (e.g. via the `/position` endpoint).
+type XMLSRPositionDataViewResult struct {
+	XMLName  xml.Name `xml:"pos:Position" json:"-"`
+	XMLNSPos string   `xml:"xmlns:pos,attr" json:"-"`
+	Value    int      `xml:"value,attr" json:"value"`
+}
+
+// XMLSRHitOffsetsDataViewResult provides character offsets
+// of hits within the text of the hits data view (for clients
+// rendering hits from offsets). The offsets are provided separately
+// from the hits data view to keep it valid against its schema.
+type XMLSRHitOffsetsDataViewResult struct {
+	XMLName xml.Name          `xml:"ho:Result" json:"-"`
+	XMLNSHo string            `xml:"xmlns:ho,attr" json:"-"`
+	Hits    []XMLSRHitOffsets `xml:"ho:Hit" json:"hits"`
+}
+
+// XMLSRHitOffsets contains character offsets (1-based, inclusive)
+// of a single hit
+type XMLSRHitOffsets struct {
+	Start int `xml:"start,attr" json:"start"`
+	End   int `xml:"end,attr" json:"end"`
+}
+
+// XMLSRWideContextDataViewResult provides a hit along with
+// a wider (structural) context than the one used by the hits
+// data view. The data are encoded the same way as in the hits
+// data view.
+type XMLSRWideContextDataViewResult struct {
+	XMLName   xml.Name `xml:"wide:Result" json:"-"`
+	XMLNSWide string   `xml:"xmlns:wide,attr" json:"-"`
+	XMLNSHits string   `xml:"xmlns:hits,attr" json:"-"`
+	Unit      string   `xml:"unit,attr" json:"unit"`
+	Data      string   `xml:",innerxml" json:"data"`
+
+	// Columns are provided only in JSON responses
+	// with the `columns` hit marker
+	Columns *XMLSRHitColumns `xml:"-" json:"columns,omitempty"`
+}
+
+// --------------------- Facets ---------------------
+
+// XMLSRFacets contains distribution of matches over values
+// of structural attributes (e.g. genre) for each resource.
+// It is attached to responses only if requested.
+type XMLSRFacets struct {
+	XMLNSFct string       `xml:"xmlns:fct,attr" json:"-"`
+	Facets   []XMLSRFacet `xml:"fct:facet" json:"facets"`
+}
+
+func (f *XMLSRFacets) AddFacet(facet XMLSRFacet) {
+	f.Facets = append(f.Facets, facet)
+}
+
+func NewXMLSRFacets() *XMLSRFacets {
+	return &XMLSRFacets{
+		XMLNSFct: "http://www.korpus.cz/mquery/facets",
+		Facets:   make([]XMLSRFacet, 0, 5),
+	}
+}
+
+// XMLSRFacet is a distribution of matches over values of a facet
+// merged from all the searched resources defining the facet
+type XMLSRFacet struct {
+	Name   string            `xml:"name,attr" json:"name"`
+	Values []XMLSRFacetValue `xml:"fct:value" json:"values"`
+}
+
+type XMLSRFacetValue struct {
+	Freq  int64  `xml:"freq,attr" json:"freq"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// --------------------- Resource summary ---------------------
+
+// XMLSRRscSummary describes how individual resources contributed
+// to the returned page of records. It is attached to responses
+// only if requested.
+type XMLSRRscSummary struct {
+	XMLNSRS   string             `xml:"xmlns:rs,attr" json:"-"`
+	Resources []XMLSRRscPageInfo `xml:"rs:resource" json:"resources"`
+}
+
+func (rs *XMLSRRscSummary) AddResource(info XMLSRRscPageInfo) {
+	rs.Resources = append(rs.Resources, info)
+}
+
+func NewXMLSRRscSummary() *XMLSRRscSummary {
+	return &XMLSRRscSummary{
+		XMLNSRS:   "http://www.korpus.cz/mquery/summary",
+		Resources: make([]XMLSRRscPageInfo, 0, 5),
+	}
+}
+
+// XMLSRRscPageInfo provides number of records returned from a resource
+// specified by PID, whether the resource has more matching records
+// (beyond the page) and its status (ok, outOfRange, timeout, error).
+type XMLSRRscPageInfo struct {
+	PID        string `xml:"pid,attr" json:"pid"`
+	NumRecords int    `xml:"numRecords,attr" json:"numRecords"`
+	ConcSize   int    `xml:"concSize,attr" json:"concSize"`
+	HasMore    bool   `xml:"hasMore,attr" json:"hasMore"`
+	Status     string `xml:"status,attr" json:"status"`
+	Error      string `xml:"error,omitempty" json:"error,omitempty"`
+}
+
+// --------------------- Debugging data ---------------------
+
+// XMLSRDebugData contains information for debugging queries.
+// It is attached to responses only in the debug mode.
+type XMLSRDebugData struct {
+	XMLNSMQ        string              `xml:"xmlns:mq,attr" json:"-"`
+	BackendQueries []XMLSRBackendQuery `xml:"mq:backendQuery" json:"backendQueries"`
+	Timings        *XMLSRTimings       `xml:"mq:timings,omitempty" json:"timings,omitempty"`
+	Jobs           []XMLSRWorkerJob    `xml:"mq:job,omitempty" json:"jobs,omitempty"`
+}
+
+func (dd *XMLSRDebugData) AddBackendQuery(pid, query string) {
+	dd.BackendQueries = append(dd.BackendQueries, XMLSRBackendQuery{PID: pid, Value: query})
+}
+
+func (dd *XMLSRDebugData) AddJob(job XMLSRWorkerJob) {
+	dd.Jobs = append(dd.Jobs, job)
+}
+
+func NewXMLSRDebugData() *XMLSRDebugData {
+	return &XMLSRDebugData{
+		XMLNSMQ:        "http://www.korpus.cz/mquery/debug",
+		BackendQueries: make([]XMLSRBackendQuery, 0, 5),
+	}
+}
+
+// XMLSRBackendQuery is a Manatee CQL query generated
+// from the client's query for a resource specified by PID
+type XMLSRBackendQuery struct {
+	PID   string `xml:"pid,attr" json:"pid"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// XMLSRWorkerJob describes a worker job a search would publish
+// for a resource specified by PID (see common.JobsPreviewKey)
+type XMLSRWorkerJob struct {
+	PID   string            `xml:"pid,attr" json:"pid"`
+	Func  string            `xml:"func,attr" json:"func"`
+	Queue string            `xml:"queue,attr,omitempty" json:"queue,omitempty"`
+	Args  rdb.ConcQueryArgs `xml:"mq:args" json:"args"`
+}
+
+// XMLSRTimings provides durations (in milliseconds) of individual
+// phases of a search. Translation and publishing times are summed
+// over all the resources. Waits for worker results are measured
+// for each resource separately. The time needed to serialize
+// the response is not included.
+type XMLSRTimings struct {
+	Total     float64          `xml:"total,attr" json:"total"`
+	Translate float64          `xml:"translate,attr" json:"translate"`
+	Publish   float64          `xml:"publish,attr" json:"publish"`
+	Merge     float64          `xml:"merge,attr" json:"merge"`
+	Resources []XMLSRRscTiming `xml:"mq:resource" json:"resources"`
+}
+
+// XMLSRRscTiming is a time spent waiting for results
+// of a resource specified by PID
+type XMLSRRscTiming struct {
+	PID  string  `xml:"pid,attr" json:"pid"`
+	Wait float64 `xml:"wait,attr" json:"wait"`
 }
 
 // --------------------- Echoed Search Retrieve Request ---------------------
 
 type XMLSREchoedRequest struct {
-	Version     string `xml:"sruResponse:version"`
-	Query       string `xml:"sruResponse:query"`
-	StartRecord int    `xml:"sruResponse:startRecord"`
+	Version     string `xml:"sruResponse:version" json:"version"`
+	Query       string `xml:"sruResponse:query" json:"query"`
+	StartRecord int    `xml:"sruResponse:startRecord" json:"startRecord"`
 }
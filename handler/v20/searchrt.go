@@ -20,10 +20,14 @@
 package v20
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
@@ -31,7 +35,9 @@ import (
 	"github.com/czcorpus/mquery-sru/backlink"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/czcorpus/mquery-sru/i18n"
 	"github.com/czcorpus/mquery-sru/mango"
 	"github.com/czcorpus/mquery-sru/query"
 	"github.com/czcorpus/mquery-sru/query/compiler"
@@ -39,6 +45,7 @@ import (
 	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/result"
+	"github.com/czcorpus/mquery-sru/transform"
 	"github.com/rs/zerolog/log"
 
 	"github.com/gin-gonic/gin"
@@ -47,6 +54,8 @@ import (
 func (a *FCSSubHandlerV20) translateQuery(
 	corpusName, query string,
 	queryType QueryType,
+	fuzzyDistance int,
+	lang string,
 ) (compiler.AST, *general.FCSError) {
 	var ast compiler.AST
 	var fcsErr *general.FCSError
@@ -54,15 +63,48 @@ func (a *FCSSubHandlerV20) translateQuery(
 	if err != nil {
 		fcsErr = &general.FCSError{
 			Code:    general.DCGeneralSystemError,
-			Ident:   err.Error(),
-			Message: general.DCGeneralSystemError.AsMessage(),
+			Ident:   common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err),
+			Message: general.DCGeneralSystemError.AsMessage(lang),
 		}
 		return nil, fcsErr
 	}
+	if queryType == QueryTypeCQL && !res.IsBasicSearchSupported() ||
+		queryType == QueryTypeFCS && !res.IsAdvancedSearchSupported() {
+		return nil, &general.FCSError{
+			Code:  general.DCUnsupportedParameterValue,
+			Ident: SearchRetrArgQueryType.String(),
+			Message: fmt.Sprintf(
+				"Resource %s does not support the query type %s", res.PID, queryType),
+		}
+	}
+	if fuzzyDistance > 0 && queryType != QueryTypeCQL {
+		return nil, &general.FCSError{
+			Code:    general.DCUnsupportedParameterValue,
+			Ident:   SearchRetrArgFCSFuzzy.String(),
+			Message: "Fuzzy matching is supported only for basic queries",
+		}
+	}
+	if fuzzyDistance > res.FuzzyMaxDistance {
+		return nil, &general.FCSError{
+			Code:  general.DCUnsupportedParameterValue,
+			Ident: SearchRetrArgFCSFuzzy.String(),
+			Message: fmt.Sprintf(
+				"Resource %s does not support fuzzy matching with distance %d",
+				res.PID, fuzzyDistance,
+			),
+		}
+	}
+	query, err = res.ExpandQueryMacros(query, queryType == QueryTypeFCS)
+	if err != nil {
+		return nil, &general.FCSError{
+			Code:    general.DCQuerySyntaxError,
+			Ident:   SearchRetrArgQuery.String(),
+			Message: fmt.Sprintf("Invalid query: %s", err),
+		}
+	}
 	switch queryType {
 	case QueryTypeCQL:
-		var err error
-		ast, err = basic.ParseQuery(
+		bAST, err := basic.ParseQuery(
 			query,
 			res.PosAttrs,
 			res.StructureMapping,
@@ -73,13 +115,16 @@ func (a *FCSSubHandlerV20) translateQuery(
 				Ident:   query,
 				Message: fmt.Sprintf("Invalid query syntax: %s", err),
 			}
+
+		} else {
+			ast = bAST.SetFuzzyDistance(fuzzyDistance)
 		}
 	case QueryTypeFCS:
-		var err error
-		ast, err = fcsql.ParseQuery(
+		fAST, err := fcsql.ParseQuery(
 			query,
 			res.PosAttrs,
 			res.StructureMapping,
+			res.QueryRewriteRules,
 		)
 		if err != nil {
 			fcsErr = &general.FCSError{
@@ -87,121 +132,216 @@ func (a *FCSSubHandlerV20) translateQuery(
 				Ident:   query,
 				Message: fmt.Sprintf("Invalid query syntax: %s", err),
 			}
+
+		} else if !a.corporaConf.AllowUnboundedQueries && fAST.IsUnbounded() {
+			fcsErr = &general.FCSError{
+				Code:    general.DCQueryCannotProcess,
+				Ident:   query,
+				Message: fmt.Sprintf("Cannot process query: %s", fcsql.ErrUnboundedQuery),
+			}
+
+		} else {
+			ast = fAST
 		}
 
 	default:
 		fcsErr = &general.FCSError{
 			Code:    general.DCUnsupportedParameterValue,
 			Ident:   queryType.String(),
-			Message: general.DCUnsupportedParameterValue.AsMessage(),
+			Message: general.DCUnsupportedParameterValue.AsMessage(lang),
 		}
 	}
 	return ast, fcsErr
 }
 
 func (a *FCSSubHandlerV20) getAttrByLayers(
-	commonPosAttrs []corpus.PosAttr,
+	rscConf *corpus.CorpusSetup,
 	layer corpus.LayerType,
 	token concordance.Token,
-) string {
-	for _, posAttr := range commonPosAttrs {
-		if posAttr.Layer == layer {
-			if v, ok := token.Attrs[posAttr.Name]; ok {
-				return v
-			}
+) []string {
+	if layer == corpus.LayerTypeNorm && rscConf.NormalizationAttr != "" {
+		if v, ok := token.Attrs[rscConf.NormalizationAttr]; ok {
+			return rscConf.GetPosAttr(rscConf.NormalizationAttr).SplitValues(v)
 		}
+		return []string{"??"}
+	}
+	// each resource may use its own name for the layer's attribute
+	if posAttr := rscConf.GetLayerDefault(layer); posAttr.Name != "" {
+		if v, ok := token.Attrs[posAttr.Name]; ok {
+			return posAttr.SplitValues(v)
+		}
+	}
+	return []string{"??"}
+}
+
+// getAdvLayerValues provides spans of a layer for the advanced data view.
+// Each value of a multi-value attribute is emitted as a separate span
+// referring to the same segment.
+func (a *FCSSubHandlerV20) getAdvLayerValues(
+	rscConf *corpus.CorpusSetup,
+	layer corpus.LayerType,
+	tokens []*concordance.Token,
+	hitSpans []int,
+) []schema.XMLSRAdvValue {
+	ans := make([]schema.XMLSRAdvValue, 0, len(tokens))
+	for i, token := range tokens {
+		for _, v := range a.getAttrByLayers(rscConf, layer, *token) {
+			ans = append(ans, schema.XMLSRAdvValue{
+				Ref:       fmt.Sprintf("s%d", i),
+				Highlight: general.ReturnIf(hitSpans[i] > -1, fmt.Sprintf("h%d", hitSpans[i]), ""),
+				Value:     v,
+			})
+		}
+	}
+	return ans
+}
+
+// dcRecordTitle returns the resource name translation to be used
+// as a title of Dublin Core records.
+func dcRecordTitle(fullName map[string]string, primaryLang string, acceptLangs []string) string {
+	title, _ := i18n.Resolve(fullName, acceptLangs, primaryLang)
+	return title
+}
+
+// restrictLayers returns only the `layers` contained in `requested`.
+// Empty `requested` means no restriction.
+func restrictLayers(layers []corpus.LayerType, requested []corpus.LayerType) []corpus.LayerType {
+	if len(requested) == 0 {
+		return layers
+	}
+	ans := make([]corpus.LayerType, 0, len(layers))
+	for _, layer := range layers {
+		if collections.SliceContains(requested, layer) {
+			ans = append(ans, layer)
+		}
+	}
+	return ans
+}
+
+// formatMarkedHits renders tokens for the hits data view
+// with hits marked according to the `marker`
+func formatMarkedHits(
+	text concordance.TokenSlice,
+	glued []bool,
+	marker common.HitMarker,
+) (string, *schema.XMLSRHitColumns) {
+	switch marker {
+	case common.HitMarkerBold, common.HitMarkerBrackets:
+		return common.FormatMarkedHits(text, glued, marker), nil
+	case common.HitMarkerColumns:
+		tokens := text.Tokens()
+		cols := common.SplitHitColumns(tokens, glued)
+		return common.FormatPlainText(tokens, glued),
+			&schema.XMLSRHitColumns{Left: cols.Left, Hit: cols.Hit, Right: cols.Right}
+	default:
+		return common.FormatHits(text, glued), nil
+	}
+}
+
+// attachTimings adds timings of the search to the debugging data
+// (which are available only in the debug mode)
+func (a *FCSSubHandlerV20) attachTimings(ans *schema.XMLSRResponse, timings *common.SearchTimings) {
+	if ans.ExtraResponseData == nil {
+		return
+	}
+	timings.Finish()
+	ans.ExtraResponseData.Timings = &schema.XMLSRTimings{
+		Total:     common.DurationMillis(timings.Total),
+		Translate: common.DurationMillis(timings.Translate),
+		Publish:   common.DurationMillis(timings.Publish),
+		Merge:     common.DurationMillis(timings.Merge),
+		Resources: collections.SliceMap(
+			timings.RscWaits,
+			func(item common.RscWait, i int) schema.XMLSRRscTiming {
+				pid := item.Rsc
+				if rscConf, err := a.corporaConf.Resources.GetResource(item.Rsc); err == nil {
+					pid = rscConf.PID
+				}
+				return schema.XMLSRRscTiming{PID: pid, Wait: common.DurationMillis(item.Wait)}
+			},
+		),
 	}
-	return "??"
 }
 
 func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequest) (schema.XMLSRResponse, int) {
+	timings := common.NewSearchTimings()
 	logArgs := make(map[string]interface{})
 	logging.AddLogEvent(ctx, "args", logArgs)
 	ans := schema.NewXMLSRResponse()
+	// validation errors are collected and reported all at once
+	validErrs := common.NewValidationErrors(fcsResponse.General.Lang)
+
 	// check if all parameters are supported
 	for key := range ctx.Request.URL.Query() {
-		if err := SearchRetrArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
-			return ans, general.ConformantStatusBadRequest
+		if err := SearchRetrArg(key).Validate(); err != nil && general.StrictParameters {
+			validErrs.AddWithMsg(
+				general.ConformantStatusBadRequest, general.DCUnsupportedParameter, key, err.Error())
 		}
 	}
 
 	// handle query parameter
 	fcsQuery := ctx.Query(SearchRetrArgQuery.String())
 	if len(fcsQuery) == 0 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCMandatoryParameterNotSupplied, 0, "fcs_query")
-		return ans, general.ConformantStatusBadRequest
+		validErrs.Add(
+			general.ConformantStatusBadRequest, general.DCMandatoryParameterNotSupplied, "fcs_query")
 	}
 	ans.EchoedRequest.Query = fcsQuery
 	logArgs[SearchRetrArgQuery.String()] = fcsQuery
 	// handle start record parameter
 	xStartRecord := ctx.DefaultQuery(SearchRetrStartRecord.String(), "1")
 	startRecord, err := strconv.Atoi(xStartRecord)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchRetrStartRecord.String())
-		return ans, general.ConformantUnprocessableEntity
-	}
-	if startRecord < 1 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchRetrStartRecord.String())
-		return ans, general.ConformantUnprocessableEntity
+	if err != nil || startRecord < 1 {
+		validErrs.Add(
+			general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+			SearchRetrStartRecord.String())
 	}
 	ans.EchoedRequest.StartRecord = startRecord
 	logArgs[SearchRetrStartRecord.String()] = startRecord
 
 	// handle record schema parameter
 	recordSchema := ctx.DefaultQuery(SearchRetrArgRecordSchema.String(), general.RecordSchema)
-	if recordSchema != general.RecordSchema {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnknownSchemaForRetrieval, 0, SearchMaximumRecords.String())
-		return ans, general.ConformantUnprocessableEntity
+	if !collections.SliceContains(a.corporaConf.RecordSchemas, recordSchema) {
+		validErrs.Add(
+			general.ConformantUnprocessableEntity, general.DCUnknownSchemaForRetrieval, recordSchema)
 	}
+	logArgs[SearchRetrArgRecordSchema.String()] = recordSchema
 
 	// handle max records parameter
 	maximumRecords := a.corporaConf.MaximumRecords
 	if xMaximumRecords := ctx.Query(SearchMaximumRecords.String()); len(xMaximumRecords) > 0 {
 		maximumRecords, err = strconv.Atoi(xMaximumRecords)
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCUnsupportedParameterValue, 0, SearchMaximumRecords.String())
-			return ans, general.ConformantUnprocessableEntity
-		}
-	}
-	if maximumRecords < 1 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchMaximumRecords.String())
-		return ans, general.ConformantUnprocessableEntity
+		if err != nil || maximumRecords < 0 {
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchMaximumRecords.String())
 
+		} else if maximumRecords > mango.MaxRecordsInternalLimit {
+			// TODO the error type is not probably very accurate
+			// as the actual result can be very small. But we still
+			// have to limit max. number of records...
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCTooManyMatchingRecords,
+				fmt.Sprintf("%d", mango.MaxRecordsInternalLimit))
+		}
 	}
-	if maximumRecords > mango.MaxRecordsInternalLimit {
-		// TODO the error type is not probably very accurate
-		// as the actual result can be very small. But we still
-		// have to limit max. number of records...
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCTooManyMatchingRecords, 0, fmt.Sprintf("%d", mango.MaxRecordsInternalLimit))
-		return ans, general.ConformantUnprocessableEntity
-	}
+	// aggregators may get less records than requested (see AggregatorLimits)
+	maximumRecords, recordsReduced := a.corporaConf.AggregatorLimits.EffectiveMaxRecords(
+		ctx.Request, maximumRecords)
 	logArgs[SearchMaximumRecords.String()] = maximumRecords
+	// maximumRecords=0 is a way how clients obtain just the total
+	// number of records (with no records returned)
+	countOnly := maximumRecords == 0
 
 	// handle requested sources
 	corporaPids := fetchContext(ctx)
 	corpora := make([]string, 0, len(corporaPids))
+	var unknownResource bool
 	if len(corporaPids) > 0 {
 		for _, pid := range corporaPids {
 			res, err := a.corporaConf.Resources.GetResourceByPID(pid)
 			if err == corpus.ErrResourceNotFound {
-				ans.Records = nil
-				return ans, http.StatusOK
+				unknownResource = true
+				break
 			}
 			corpora = append(corpora, res.ID)
 		}
@@ -210,133 +350,698 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 		corpora = a.corporaConf.Resources.GetCorpora()
 	}
 
-	// get searchable corpora and attrs
-	if len(corpora) == 0 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedContextSet, 0, SearchRetrArgFCSContext.String())
-		return ans, general.ConformantStatusBadRequest
-	}
-	retrieveAttrs, err := a.corporaConf.Resources.GetCommonPosAttrNames(corpora...)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCGeneralSystemError, 0, err.Error())
-		return ans, http.StatusInternalServerError
+	// get searchable corpora
+	if len(corpora) == 0 && !unknownResource {
+		validErrs.Add(
+			general.ConformantStatusBadRequest, general.DCUnsupportedContextSet,
+			SearchRetrArgFCSContext.String())
 	}
-	// add text layer as another attr, otherwise we won't be able to parse it due to Manatee output formatting
-	retrieveAttrs = append(retrieveAttrs, retrieveAttrs[0])
 
 	logArgs["corpus"] = a.serverInfo.Database
 	logArgs["sources"] = corpora
 	logArgs[SearchRetrArgFCSContext.String()] = ctx.Query(SearchRetrArgFCSContext.String())
-	log.Warn().Msg("Data views are not implemented yet!")
 	logArgs[SearchRetrArgFCSDataViews.String()] = ctx.Query(SearchRetrArgFCSDataViews.String())
+	withCollocs := !countOnly && a.corporaConf.CollocationsTopN > 0 &&
+		collections.SliceContains(fetchDataViews(ctx), DataViewCollocations)
+	withPositions := collections.SliceContains(fetchDataViews(ctx), DataViewPosition)
+	withHitOffsets := collections.SliceContains(fetchDataViews(ctx), DataViewHitOffsets)
+	withWideContext := !countOnly && collections.SliceContains(fetchDataViews(ctx), DataViewWideContext)
 
-	queryType := getTypedArg[QueryType](ctx, SearchRetrArgQueryType.String(), DefaultQueryType)
+	facets := fetchFacets(ctx)
+	for _, facet := range facets {
+		isDefined := collections.SliceFindIndex(corpora, func(corpusID string) bool {
+			rscConf, err := a.corporaConf.Resources.GetResource(corpusID)
+			return err == nil && rscConf.GetFacetAttr(facet) != ""
+		}) > -1
+		if !isDefined && !unknownResource {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				facetArg(ctx, facet).String(), fmt.Sprintf("Unknown facet: %s", facet))
+		}
+	}
+	facetsOnly := len(facets) > 0 && ctx.Query(SearchRetrArgFacetsOnly.String()) == "true"
+	logArgs[SearchRetrArgFacets.String()] = facets
+	facetLimit := a.corporaConf.MaximumFacetItems
+	if xFacetLimit := ctx.Query(SearchRetrArgFCSFacetLimit.String()); len(xFacetLimit) > 0 {
+		facetLimit, err = strconv.Atoi(xFacetLimit)
+		if err != nil || facetLimit < 1 || facetLimit > a.corporaConf.MaximumFacetItems {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSFacetLimit.String(),
+				fmt.Sprintf("Facet limit must be between 1 and %d", a.corporaConf.MaximumFacetItems))
+		}
+		logArgs[SearchRetrArgFCSFacetLimit.String()] = facetLimit
+	}
+	withRscSummary := ctx.Query(SearchRetrArgResourceSummary.String()) == "true"
+
+	hitMarker := getTypedArg(ctx, SearchRetrArgFCSHitMarker.String(), common.DefaultHitMarker)
+	if err := hitMarker.Validate(); err != nil {
+		validErrs.AddWithMsg(
+			general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+			SearchRetrArgFCSHitMarker.String(), err.Error())
+	}
+	logArgs[SearchRetrArgFCSHitMarker.String()] = hitMarker
+	if fcsResponse.General.Format != general.ResponseFormatJSON {
+		// XML responses always use the standard HITS encoding
+		hitMarker = common.HitMarkerHits
+	}
+
+	advLayers, unknownAdvLayers := fetchAdvLayers(ctx)
+	logArgs[SearchRetrArgFCSAdvLayers.String()] = ctx.Query(SearchRetrArgFCSAdvLayers.String())
+
+	reqAttrs := fetchAttrs(ctx)
+	if len(reqAttrs) > 0 {
+		logArgs[SearchRetrArgFCSAttrs.String()] = reqAttrs
+		unknownAttrs, err := a.corporaConf.Resources.GetUnknownPosAttrs(reqAttrs, corpora...)
+		if err != nil {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSAttrs.String(), err.Error())
+
+		} else if len(unknownAttrs) > 0 {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSAttrs.String(),
+				fmt.Sprintf("Unknown attributes: %s", strings.Join(unknownAttrs, ", ")))
+		}
+	}
+
+	groupByResource := ctx.Query(SearchRetrArgFCSGroupByResource.String()) == "true"
+	if groupByResource {
+		logArgs[SearchRetrArgFCSGroupByResource.String()] = groupByResource
+	}
+
+	matchKeyFold := common.ScanFold(ctx.Query(SearchRetrArgMatchKey.String()))
+	if matchKeyFold != common.ScanFoldNone {
+		logArgs[SearchRetrArgMatchKey.String()] = matchKeyFold
+		if err := matchKeyFold.Validate(); err != nil {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgMatchKey.String(), err.Error())
+		}
+	}
+
+	reqSortKeys, err := fetchSortKeys(ctx)
+	if err != nil {
+		validErrs.AddWithMsg(
+			general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+			SearchRetrArgSortKeys.String(), err.Error())
+	}
+	if len(reqSortKeys) > 0 {
+		logArgs[SearchRetrArgSortKeys.String()] = ctx.Query(SearchRetrArgSortKeys.String())
+	}
+
+	queryType := getTypedArg(
+		ctx, SearchRetrArgQueryType.String(), resolveDefaultQueryType(a.corporaConf.Resources, corpora))
 	logArgs[SearchRetrArgQueryType.String()] = queryType
+	if err := queryType.Validate(); err != nil {
+		validErrs.AddWithMsg(
+			general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+			SearchRetrArgQueryType.String(), err.Error())
+
+	} else if !collections.SliceContains(supportedQueryTypes(a.corporaConf.Resources), queryType) {
+		validErrs.AddWithMsg(
+			general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+			SearchRetrArgQueryType.String(),
+			fmt.Sprintf("The endpoint does not support the query type %s", queryType))
+	}
+	// with no explicit context, resources not supporting the query type
+	// are just skipped (explicitly requested ones are reported as errors)
+	var skippedRscs []string
+	if len(corporaPids) == 0 && queryType.Validate() == nil {
+		corpora, skippedRscs = splitByQueryType(a.corporaConf.Resources, corpora, queryType)
+	}
+	if queryType == QueryTypeCQL && a.corporaConf.QueryNormalization {
+		fcsQuery = query.NormalizeQuery(fcsQuery)
+	}
+
+	var reqContextSize int
+	if xContextSize := ctx.Query(SearchRetrArgFCSContextSize.String()); len(xContextSize) > 0 {
+		reqContextSize, err = strconv.Atoi(xContextSize)
+		if err != nil || reqContextSize < 1 || reqContextSize > a.corporaConf.MaximumContext {
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSContextSize.String())
+		}
+		logArgs[SearchRetrArgFCSContextSize.String()] = reqContextSize
+	}
+
+	var contextUnit ContextUnit
+	if xContextUnit := ctx.Query(SearchRetrArgFCSContextUnit.String()); len(xContextUnit) > 0 {
+		contextUnit = ContextUnit(xContextUnit)
+		if err := contextUnit.Validate(); err != nil {
+			validErrs.AddWithMsg(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSContextUnit.String(), err.Error())
+		}
+		logArgs[SearchRetrArgFCSContextUnit.String()] = contextUnit
+	}
 
-	ranges := query.CalculatePartialRanges(corpora, startRecord-1, maximumRecords)
+	var fuzzyDistance int
+	if xFuzzy := ctx.Query(SearchRetrArgFCSFuzzy.String()); len(xFuzzy) > 0 {
+		fuzzyDistance, err = strconv.Atoi(xFuzzy)
+		if err != nil || fuzzyDistance < 0 || fuzzyDistance > corpus.MaxFuzzyDistance {
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSFuzzy.String())
+		}
+		logArgs[SearchRetrArgFCSFuzzy.String()] = fuzzyDistance
+	}
+
+	var reqTimeout int
+	if xTimeout := ctx.Query(SearchRetrArgFCSTimeout.String()); len(xTimeout) > 0 {
+		reqTimeout, err = strconv.Atoi(xTimeout)
+		if err != nil || reqTimeout < 1 ||
+			time.Duration(reqTimeout)*time.Second > a.radapter.QueryAnswerTimeout() {
+			validErrs.Add(
+				general.ConformantUnprocessableEntity, general.DCUnsupportedParameterValue,
+				SearchRetrArgFCSTimeout.String())
+		}
+		logArgs[SearchRetrArgFCSTimeout.String()] = reqTimeout
+	}
+
+	if validErrs.HasErrors() {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		for _, fcsErr := range validErrs.Errors {
+			ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
+		}
+		return ans, validErrs.Status
+	}
+	if unknownResource {
+		ans.Records = nil
+		return ans, http.StatusOK
+	}
+
+	// layers are shared by all the resources but the actual attribute
+	// names may differ (see PosAttr.Layer and PosAttr.IsLayerDefault)
+	commonLayers := a.corporaConf.Resources.GetCommonLayers()
+
+	// the client may limit how long it is willing to wait for results
+	// (and so may the server via the search time budget); resources
+	// not answering in time are skipped (with a diagnostic)
+	searchCtx := ctx.Request.Context()
+	if budget := a.corporaConf.SearchTimeBudget(); budget > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = common.WithSearchBudget(searchCtx, budget)
+		defer cancel()
+	}
+	if reqTimeout > 0 {
+		var cancel context.CancelFunc
+		searchCtx, cancel = context.WithTimeout(searchCtx, time.Duration(reqTimeout)*time.Second)
+		defer cancel()
+	}
+	timedOutRscs := make([]string, 0, len(corpora))
+
+	ranges := query.CalculatePartialRanges(
+		corpora, general.ReturnIf(countOnly, 0, startRecord-1), maximumRecords)
 
 	// make searches
 	waits := make([]<-chan result.ConcResult, len(ranges))
+	if a.debugMode {
+		ans.ExtraResponseData = schema.NewXMLSRDebugData()
+	}
+	// in the debug mode, we may just provide the jobs instead of searching
+	jobsPreview := a.debugMode && ctx.GetBool(common.JobsPreviewKey)
+	concArgs := make([]rdb.ConcQueryArgs, len(ranges))
+	workerQueues := make([]string, len(ranges))
+	// sort keys of the FCS-QL `sortBy` clause (same for all the resources)
+	// take precedence over the `sortKeys` argument
+	sortKeys := reqSortKeys
+	sortKeysArg := SearchRetrArgSortKeys.String()
+	var unsupportedSortKeys []string
+	var numSortedRscs int
 	for i, rng := range ranges {
 
-		ast, fcsErr := a.translateQuery(rng.Rsc, fcsQuery, queryType)
+		translStart := time.Now()
+		ast, fcsErr := a.translateQuery(
+			rng.Rsc, fcsQuery, queryType, fuzzyDistance, fcsResponse.General.Lang)
 		if fcsErr != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
 			return ans, general.ConformantUnprocessableEntity
 		}
 
+		if fq, ok := ast.(*fcsql.Query); ok && len(fq.SortKeys()) > 0 {
+			sortKeys = fq.SortKeys()
+			sortKeysArg = "sortBy"
+		}
 		query := ast.Generate()
+		timings.AddTranslate(translStart)
 		if len(ast.Errors()) > 0 {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDiagnostic(
 				general.DCQueryCannotProcess, 0, SearchRetrArgQuery.String(), ast.Errors()[0].Error())
 			return ans, general.ConformantUnprocessableEntity
 		}
 		rscConf, err := a.corporaConf.Resources.GetResource(rng.Rsc)
 		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
 			return ans, general.ConformandGeneralServerError
 		}
-		wait, err := a.radapter.PublishQuery(rdb.Query{
-			Func: "concExample",
-			Args: rdb.ConcQueryArgs{
-				CorpusPath:        a.corporaConf.GetRegistryPath(rng.Rsc),
-				Query:             query,
-				Attrs:             retrieveAttrs,
-				StartLine:         rng.From,
-				MaxItems:          maximumRecords,
-				MaxContext:        a.corporaConf.MaximumContext,
-				ViewContextStruct: rscConf.ViewContextStruct,
-			},
+		contextSize := a.corporaConf.GetDefaultContext(rscConf)
+		contextStruct := rscConf.ViewContextStruct
+		switch {
+		case contextUnit == ContextUnitToken:
+			contextStruct = ""
+		case contextUnit.IsStructural():
+			contextStruct = rscConf.StructureMapping.GetStructure(contextUnit.String())
+			if contextStruct == "" {
+				ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+				ans.Diagnostics.AddDiagnostic(
+					general.DCUnsupportedParameterValue, 0,
+					SearchRetrArgFCSContextUnit.String(),
+					fmt.Sprintf(
+						"Resource %s does not support context unit %s", rscConf.PID, contextUnit))
+				return ans, general.ConformantUnprocessableEntity
+			}
+			// the whole structure is returned, we just keep
+			// a safety limit for extremely long structures
+			contextSize = a.corporaConf.MaximumContext
+		}
+		if reqContextSize > 0 {
+			contextSize = reqContextSize
+		}
+		// add text layer as another attr, otherwise we won't be able
+		// to parse it due to Manatee output formatting
+		retrieveAttrs := rscConf.GetLayerAttrNames(
+			rscConf.RestrictLayersByAttrs(
+				restrictLayers(a.corporaConf.ResourceLayers(rscConf, commonLayers), advLayers),
+				reqAttrs,
+			),
+		)
+		if len(reqAttrs) == 0 || collections.SliceContains(reqAttrs, rscConf.NormalizationAttr) {
+			retrieveAttrs = rscConf.WithNormalizationAttr(retrieveAttrs)
+		}
+		rscAttrs := append(retrieveAttrs, retrieveAttrs[0])
+		concArgs[i] = rdb.ConcQueryArgs{
+			CorpusPath:        a.corporaConf.GetRegistryPath(rng.Rsc),
+			Query:             query,
+			Attrs:             rscAttrs,
+			StartLine:         rng.From,
+			MaxItems:          maximumRecords,
+			MaxContext:        contextSize,
+			ViewContextStruct: contextStruct,
+			GlueStruct:        rscConf.GlueStruct,
+			Encoding:          rscConf.Encoding,
+			MinFormFreq:       rscConf.MinFormFreq,
+		}
+		if len(sortKeys) > 0 {
+			var unsupported []fcsql.SortKey
+			concArgs[i].SortCrit, unsupported = sortCrit(rscConf, sortKeys)
+			for _, key := range unsupported {
+				if !collections.SliceContains(unsupportedSortKeys, key.String()) {
+					unsupportedSortKeys = append(unsupportedSortKeys, key.String())
+				}
+			}
+			if concArgs[i].SortCrit != "" {
+				numSortedRscs++
+			}
+		}
+		if a.debugMode {
+			ans.ExtraResponseData.AddBackendQuery(rscConf.PID, query)
+		}
+		if withWideContext {
+			// resources with no sentence structure just do not provide the data view
+			concArgs[i].WideContextStruct = rscConf.StructureMapping.SentenceStruct
+			concArgs[i].WideMaxContext = a.corporaConf.MaximumContext
+		}
+		if withCollocs {
+			concArgs[i].CollocAttr = retrieveAttrs[0]
+			concArgs[i].CollocWindow = a.corporaConf.CollocationsWindow
+			concArgs[i].CollocMaxItems = a.corporaConf.CollocationsTopN
+		}
+		for _, facet := range facets {
+			if attr := rscConf.GetFacetAttr(facet); attr != "" {
+				concArgs[i].FacetAttrs = append(concArgs[i].FacetAttrs, attr)
+			}
+		}
+		concArgs[i].FacetMaxItems = facetLimit
+		if countOnly || facetsOnly {
+			// records are not needed so the worker can skip retrieving the lines
+			concArgs[i].Output = general.ReturnIf(
+				len(concArgs[i].FacetAttrs) > 0, rdb.ConcOutputFacets, rdb.ConcOutputCount)
+		}
+		workerQueues[i] = rscConf.WorkerQueue
+		if jobsPreview {
+			ans.ExtraResponseData.AddJob(schema.XMLSRWorkerJob{
+				PID:   rscConf.PID,
+				Func:  "concExample",
+				Queue: workerQueues[i],
+				Args:  concArgs[i],
+			})
+			continue
+		}
+		publishStart := time.Now()
+		wait, err := a.prefetch.PublishConcQuery(searchCtx, rdb.Query{
+			Func:  "concExample",
+			Queue: workerQueues[i],
+			Args:  concArgs[i],
 		})
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+		timings.AddPublish(publishStart)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// there was no free slot for the job in time,
+			// the resource will be reported as timed out
+			continue
+
+		} else if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
 			return ans, http.StatusInternalServerError
 		}
 		waits[i] = wait
 	}
-	// using fromResource, we will cycle through available resources' results and their lines
-	fromResource := result.NewRoundRobinLineSel(maximumRecords, ranges.PIDList()...)
-	usedQueries := make(map[string]string) // maps resource ID to Manatee CQL query
-	var totalConcSize int
+	if jobsPreview {
+		return ans, http.StatusOK
+	}
+	results := make(map[string]result.ConcResult)
+	concSizes := make(map[string]int)
+	timings.StartWaiting()
 	for i, wait := range waits {
-		result := <-wait
-		if result.Error == mango.ErrRowsRangeOutOfConc {
-			fromResource.RscSetErrorAt(i, err)
+		res := common.AwaitResult(searchCtx, wait)
+		timings.AddRscWait(ranges[i].Rsc)
+		if res.HasMalformedResultError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
+
+		} else if errors.Is(res.Error, context.DeadlineExceeded) {
+			timedOutRscs = append(timedOutRscs, ranges[i].Rsc)
+
+		} else if res.Error != nil && !res.HasOutOfRangeError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCQueryCannotProcess, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
+		}
+		results[ranges[i].Rsc] = res
+		concSizes[ranges[i].Rsc] = res.ConcSize
+	}
+
+	// lenient clients may prefer the last page to an out of range error
+	var clampedStartRecord int
+	if a.corporaConf.ClampStartRecord && !countOnly {
+		var total int
+		for _, size := range concSizes {
+			total += size
+		}
+		if total > 0 && startRecord-1 >= total {
+			clampedStartRecord = startRecord
+			startRecord = query.LastPageOffset(total, maximumRecords) + 1
+		}
+	}
+
+	// The ranges above have been calculated with the assumption that all
+	// the resources have enough lines. Now we know actual concordance sizes
+	// so we can make sure records are ordered the same way on all the pages
+	// (and re-fetch lines of resources with incorrectly estimated ranges).
+	var exactRanges query.LineRangeList
+	if groupByResource {
+		exactRanges = query.CalculateGroupedRanges(
+			corpora, concSizes, general.ReturnIf(countOnly, 0, startRecord-1), maximumRecords)
+
+	} else {
+		exactRanges = query.CalculateExactRanges(
+			corpora, concSizes, general.ReturnIf(countOnly, 0, startRecord-1), maximumRecords)
+	}
+	refetchWaits := make(map[string]<-chan result.ConcResult)
+	for _, rng := range exactRanges {
+		i := collections.SliceFindIndex(ranges, func(v query.LineRange) bool { return v.Rsc == rng.Rsc })
+		if ranges[i].From == rng.From {
+			continue
+		}
+		if rng.IsEmpty() {
+			// the resource is not reached by the page (grouped results)
+			res := results[rng.Rsc]
+			res.Lines = nil
+			res.WideLines = nil
+			results[rng.Rsc] = res
+			continue
+		}
+		if rng.From >= concSizes[rng.Rsc] {
+			results[rng.Rsc] = result.ConcResult{
+				ConcSize: concSizes[rng.Rsc],
+				Query:    results[rng.Rsc].Query,
+				Collocs:  results[rng.Rsc].Collocs,
+				Facets:   results[rng.Rsc].Facets,
+				Error:    mango.ErrRowsRangeOutOfConc,
+			}
+			continue
+		}
+		args := concArgs[i]
+		args.StartLine = rng.From
+		args.CollocMaxItems = 0 // we already have collocates from the first query
+		args.FacetAttrs = nil   // the same applies for facets
+		publishStart := time.Now()
+		wait, err := a.prefetch.PublishConcQuery(searchCtx, rdb.Query{
+			Func:  "concExample",
+			Queue: workerQueues[i],
+			Args:  args,
+		})
+		timings.AddPublish(publishStart)
+		if errors.Is(err, context.DeadlineExceeded) {
+			refetchWaits[rng.Rsc] = nil
+			continue
+
+		} else if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
+			return ans, http.StatusInternalServerError
+		}
+		refetchWaits[rng.Rsc] = wait
+	}
+	timings.StartWaiting()
+	for rsc, wait := range refetchWaits {
+		res := common.AwaitResult(searchCtx, wait)
+		timings.AddRscWait(rsc)
+		if res.HasMalformedResultError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
+			return ans, http.StatusInternalServerError
 
-		} else if result.Error != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+		} else if errors.Is(res.Error, context.DeadlineExceeded) {
+			timedOutRscs = append(timedOutRscs, rsc)
+			res.ConcSize = concSizes[rsc]
+
+		} else if res.Error != nil && !res.HasOutOfRangeError() {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCQueryCannotProcess, 0, result.Error.Error())
+				general.DCQueryCannotProcess, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, res.Error))
 			return ans, http.StatusInternalServerError
 		}
-		fromResource.SetRscLines(ranges[i].Rsc, result)
-		usedQueries[ranges[i].Rsc] = result.Query
-		totalConcSize += result.ConcSize
+		res.Collocs = results[rsc].Collocs
+		res.Facets = results[rsc].Facets
+		results[rsc] = res
+	}
+
+	timings.StartMerge()
+	// using fromResource, we will cycle through available resources' results and their lines
+	fromResource := result.NewRoundRobinLineSel(maximumRecords, exactRanges.PIDList()...)
+	if a.corporaConf.DeduplicateRecords {
+		fromResource.EnableDeduplication()
+	}
+	if groupByResource {
+		fromResource.EnableGrouping()
+	}
+	usedQueries := make(map[string]string) // maps resource ID to Manatee CQL query
+	var totalConcSize int
+	for i, rng := range exactRanges {
+		res := results[rng.Rsc]
+		if res.Error != nil {
+			fromResource.RscSetErrorAt(i, res.Error)
+		}
+		fromResource.SetRscLines(rng.Rsc, res)
+		usedQueries[rng.Rsc] = res.Query
+		totalConcSize += res.ConcSize
 	}
 
 	ans.NumberOfRecords = totalConcSize
 	if fromResource.AllHasOutOfRangeError() {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCFirstRecordPosOutOfRange, 0, fromResource.GetFirstError().Error())
 		return ans, general.ConformantUnprocessableEntity
 
-	} else if fromResource.HasFatalError() {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
+	} else if fromResource.HasFatalError() && len(timedOutRscs) == 0 {
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCQueryCannotProcess, 0, fromResource.GetFirstError().Error())
+			general.DCQueryCannotProcess, 0,
+			common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, fromResource.GetFirstError()))
 		return ans, general.ConformandGeneralServerError
 	}
+	if len(timedOutRscs) > 0 {
+		// partial result - other resources still provide their lines
+		// (in case all the resources timed out, the result is empty,
+		// but still valid as the diagnostics below explain the reason)
+		ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		for _, rsc := range timedOutRscs {
+			if common.SearchBudgetExhausted(searchCtx) {
+				ans.Diagnostics.AddDiagnostic(
+					0, general.DTGeneralProcessingHint, rsc,
+					fmt.Sprintf(
+						"timed-out-partial: search in resource %s did not finish within the search time budget",
+						rsc))
 
-	// transform results
-	commonLayers := a.corporaConf.Resources.GetCommonLayers()
-	commonPosAttrs, err := a.corporaConf.Resources.GetCommonPosAttrs(corpora...)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCGeneralSystemError, 0, err.Error())
-		return ans, http.StatusInternalServerError
+			} else {
+				ans.Diagnostics.AddDiagnostic(
+					0, general.DTGeneralProcessingHint, rsc,
+					fmt.Sprintf("Search in resource %s did not finish within the requested timeout", rsc))
+			}
+		}
+	}
+	for _, rsc := range skippedRscs {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, rsc,
+			fmt.Sprintf("Resource %s does not support the query type %s and has been skipped", rsc, queryType))
+	}
+	if a.corporaConf.QuerySuggestions && totalConcSize == 0 && len(timedOutRscs) == 0 &&
+		queryType == QueryTypeCQL && fuzzyDistance == 0 {
+		for _, sugg := range a.suggestQueries(searchCtx, fcsQuery, corpora, fcsResponse.General.Lang) {
+			if ans.Diagnostics == nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+			}
+			ans.Diagnostics.AddDiagnostic(
+				0, general.DTGeneralProcessingHint, sugg.query,
+				fmt.Sprintf("query-suggestion: no results found, the query %s provides %d hits",
+					sugg.query, sugg.numHits))
+		}
+	}
+	if recordsReduced {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, SearchMaximumRecords.String(),
+			fmt.Sprintf("Number of returned records has been limited to %d", maximumRecords))
+	}
+	if clampedStartRecord > 0 {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, SearchRetrStartRecord.String(),
+			fmt.Sprintf(
+				"Record position %d is out of range, returning the last page starting at %d",
+				clampedStartRecord, startRecord))
+	}
+	if sortKeysArg == "sortBy" && len(reqSortKeys) > 0 {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, SearchRetrArgSortKeys.String(),
+			"The sortBy clause of the query takes precedence, the sortKeys argument has been ignored")
+	}
+	if len(unsupportedSortKeys) > 0 {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			general.DCSortNotSupported, 0, sortKeysArg,
+			fmt.Sprintf(
+				"Unsupported sort keys have been ignored: %s", strings.Join(unsupportedSortKeys, " ")))
+	}
+	if numSortedRscs > 1 {
+		// records from multiple resources are merged in a round-robin
+		// fashion so they are sorted just within individual resources
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, sortKeysArg,
+			"Records are sorted within individual resources only")
+	}
+	if len(unknownAdvLayers) > 0 {
+		if ans.Diagnostics == nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+		}
+		ans.Diagnostics.AddDiagnostic(
+			0, general.DTGeneralProcessingHint, SearchRetrArgFCSAdvLayers.String(),
+			fmt.Sprintf("Unknown layers ignored: %s", strings.Join(unknownAdvLayers, ", ")))
+	}
+
+	if len(facets) > 0 {
+		ans.Facets = schema.NewXMLSRFacets()
+		for _, facet := range facets {
+			dists := make([][]result.FacetItem, 0, len(exactRanges))
+			for _, rng := range exactRanges {
+				rscConf, err := a.corporaConf.Resources.GetResource(rng.Rsc)
+				if err != nil {
+					ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
+					ans.Diagnostics.AddDfltMsgDiagnostic(
+						general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
+					return ans, http.StatusInternalServerError
+				}
+				if attr := rscConf.GetFacetAttr(facet); attr != "" {
+					dists = append(dists, results[rng.Rsc].Facets[attr])
+				}
+			}
+			if len(dists) == 0 {
+				continue
+			}
+			ans.Facets.AddFacet(schema.XMLSRFacet{
+				Name:   facet,
+				Values: mergeFacetValues(dists, facetLimit),
+			})
+		}
+	}
+	if facetsOnly || countOnly {
+		a.attachTimings(&ans, timings)
+		return ans, http.StatusOK
 	}
 
+	// transform results
+	// (large pages may be written to the client record by record; note that
+	// this still requires all the results to be available as the order of records
+	// depends on concordance sizes of all the resources)
+	var stream *srResponseStream
+	if a.isStreamingApplicable(fcsResponse, maximumRecords) {
+		stream = newSRResponseStream(ctx, fcsResponse.General.XSLT)
+		if err := stream.Begin(ans); err != nil {
+			log.Error().Err(err).Msg("failed to start streaming searchRetrieve response")
+			return ans, http.StatusOK
+		}
+	}
 	records := make([]schema.XMLSRRecord, 0, maximumRecords)
-	for len(records) < maximumRecords && fromResource.Next() {
+	var numRecords int
+	addRecord := func(rec schema.XMLSRRecord) {
+		numRecords++
+		if stream == nil {
+			records = append(records, rec)
+			return
+		}
+		if err := stream.WriteRecord(rec); err != nil {
+			log.Error().Err(err).Msg("failed to write searchRetrieve record")
+		}
+	}
+	// collocates are the same for all the records of a resource
+	// so we attach them just to the first record of each resource
+	collocsAttached := make(map[string]bool)
+	for numRecords < maximumRecords && fromResource.Next() {
 		res, err := a.corporaConf.Resources.GetResource(fromResource.CurrRscName())
 		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics = schema.NewXMLDiagnostics(fcsResponse.General.Lang)
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
+				general.DCGeneralSystemError, 0, common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, err))
+			if stream != nil {
+				// the status has been already sent so the error
+				// is reported via diagnostics only
+				if err := stream.Finish(ans); err != nil {
+					log.Error().Err(err).Msg("failed to finish streaming searchRetrieve response")
+				}
+				return ans, http.StatusOK
+			}
 			return ans, http.StatusInternalServerError
 		}
-		item := fromResource.CurrLine()
+		item := transform.Apply(res.Transformers, fromResource.CurrLine())
 		var refURL string
 		if res.KontextBacklinkRootURL != "" {
 			var err error
@@ -346,11 +1051,106 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 				log.Error().Err(err).Msg("failed to generate ResourceFragment URL")
 			}
 		}
-		segmentPos := 1
-		records = append(records, schema.XMLSRRecord{
-			Schema:      "http://clarin.eu/fcs/resource",
+		var recordID string
+		var hitPosition *schema.XMLSRDataView
+		if pos, err := common.ParseRefPosition(item.Ref); err == nil {
+			recordID = common.EncodeRecordID(res.PID, pos)
+			if withPositions {
+				hitPosition = &schema.XMLSRDataView{
+					Type: "application/x-mquery-position+xml",
+					Result: schema.XMLSRPositionDataViewResult{
+						XMLNSPos: "http://www.korpus.cz/mquery/dataview/position",
+						Value:    pos,
+					},
+				}
+			}
+
+		} else {
+			log.Error().Err(err).Str("resource", res.ID).Msg("failed to get hit position")
+		}
+		var wideContext *schema.XMLSRDataView
+		if wideLine := fromResource.CurrWideLine(); withWideContext && wideLine != nil {
+			wideItem := transform.Apply(res.Transformers, wideLine)
+			wideData, wideColumns := formatMarkedHits(
+				wideItem.Text, common.GluedTokens(wideItem.Text, res.GlueStruct), hitMarker)
+			wideContext = &schema.XMLSRDataView{
+				Type: "application/x-mquery-wide-context+xml",
+				Result: schema.XMLSRWideContextDataViewResult{
+					XMLNSWide: "http://www.korpus.cz/mquery/dataview/wide-context",
+					XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
+					Unit:      ContextUnitSentence.String(),
+					Data:      wideData,
+					Columns:   wideColumns,
+				},
+			}
+		}
+		// character offsets of individual tokens (1-based, inclusive) shared
+		// by the hit offsets and the advanced data views
+		tokens := item.Text.Tokens()
+		// normalization layer is attached only to resources providing it
+		// (with fallback layers, layers may also differ across resources)
+		rscLayers := a.corporaConf.ResourceLayers(res, commonLayers)
+		if res.NormalizationAttr != "" && !collections.SliceContains(rscLayers, corpus.LayerTypeNorm) {
+			rscLayers = append(rscLayers[:len(rscLayers):len(rscLayers)], corpus.LayerTypeNorm)
+		}
+		rscLayers = res.OrderLayers(
+			res.RestrictLayersByAttrs(restrictLayers(rscLayers, advLayers), reqAttrs))
+		var matchKey *schema.XMLSRMatchKey
+		if matchKeyFold != common.ScanFoldNone {
+			matchKey = schema.NewXMLSRMatchKey(string(matchKeyFold), common.MatchKey(tokens, matchKeyFold))
+		}
+		// tokens of the same hit share the same highlight ID
+		hitSpans := common.HitSpanIndices(item.Text)
+		glued := common.GluedTokens(item.Text, res.GlueStruct)
+		segments := make([]schema.XMLSRAdvSegment, len(tokens))
+		for i, offsets := range common.TokenOffsets(tokens, glued) {
+			segments[i] = schema.XMLSRAdvSegment{
+				ID:    fmt.Sprintf("s%d", i),
+				Start: offsets[0],
+				End:   offsets[1],
+			}
+		}
+		var hitOffsets *schema.XMLSRDataView
+		if withHitOffsets {
+			hitOffsets = &schema.XMLSRDataView{
+				Type: "application/x-mquery-hit-offsets+xml",
+				Result: schema.XMLSRHitOffsetsDataViewResult{
+					XMLNSHo: "http://www.korpus.cz/mquery/dataview/hit-offsets",
+					Hits: collections.SliceMap(
+						common.HitOffsets(item.Text, glued),
+						func(item [2]int, i int) schema.XMLSRHitOffsets {
+							return schema.XMLSRHitOffsets{Start: item[0], End: item[1]}
+						},
+					),
+				},
+			}
+		}
+		if recordSchema == general.RecordSchemaDC {
+			title := dcRecordTitle(
+				res.FullName, a.serverInfo.PrimaryLanguage, fcsResponse.General.AcceptLanguages)
+			addRecord(schema.XMLSRRecord{
+				Schema:      general.RecordSchemaDC,
+				XMLEscaping: string(fcsResponse.RecordXMLEscaping),
+				DCData: &schema.XMLSRDCRecord{
+					XMLNSOAIDC:  "http://www.openarchives.org/OAI/2.0/oai_dc/",
+					XMLNSDC:     "http://purl.org/dc/elements/1.1/",
+					Title:       title,
+					Identifier:  res.PID,
+					Source:      refURL,
+					Description: common.FormatPlainText(tokens, glued),
+					Languages:   res.Languages,
+				},
+				RecordIdentifier: recordID,
+				RecordPosition:   numRecords + fromResource.NumDuplicates() + startRecord,
+				MatchKey:         matchKey,
+			})
+			continue
+		}
+		hitsData, hitsColumns := formatMarkedHits(item.Text, glued, hitMarker)
+		addRecord(schema.XMLSRRecord{
+			Schema:      general.RecordSchema,
 			XMLEscaping: string(fcsResponse.RecordXMLEscaping),
-			Data: schema.XMLSRResource{
+			Data: &schema.XMLSRResource{
 				XMLNSFCS: "http://clarin.eu/fcs/resource",
 				PID:      res.PID,
 				ResourceFragment: schema.XMLSRResourceFragment{
@@ -361,18 +1161,8 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 							Type: "application/x-clarin-fcs-hits+xml",
 							Result: schema.XMLSRBasicDataViewResult{
 								XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
-								Data: strings.Join(
-									collections.SliceMap(
-										item.Text.Tokens(),
-										func(token *concordance.Token, i int) string {
-											if token.Strong {
-												return "<hits:Hit>" + token.Word + "</hits:Hit>"
-											}
-											return token.Word
-										},
-									),
-									" ",
-								),
+								Data:      hitsData,
+								Columns:   hitsColumns,
 							},
 						},
 						// advanced data view if requested
@@ -383,33 +1173,13 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 								Result: schema.XMLSRAdvancedDataViewResult{
 									Unit:     "item",
 									XMLNSAdv: "http://clarin.eu/fcs/dataview/advanced",
-									Segments: collections.SliceMap(
-										item.Text.Tokens(),
-										func(token *concordance.Token, i int) schema.XMLSRAdvSegment {
-											segment := schema.XMLSRAdvSegment{
-												ID:    fmt.Sprintf("s%d", i),
-												Start: segmentPos,
-												End:   segmentPos + len(token.Word) - 1,
-											}
-											segmentPos += len(token.Word) + 1 // with space between words
-											return segment
-										},
-									),
+									Segments: segments,
 									Layers: collections.SliceMap(
-										commonLayers,
+										rscLayers,
 										func(layer corpus.LayerType, j int) schema.XMLSRAdvLayer {
 											return schema.XMLSRAdvLayer{
-												ID: layer.GetResultID(),
-												Values: collections.SliceMap(
-													item.Text.Tokens(),
-													func(token *concordance.Token, i int) schema.XMLSRAdvValue {
-														return schema.XMLSRAdvValue{
-															Ref:       fmt.Sprintf("s%d", i),
-															Highlight: general.ReturnIf(token.Strong, fmt.Sprintf("s%d", i), ""),
-															Value:     a.getAttrByLayers(commonPosAttrs, layer, *token),
-														}
-													},
-												),
+												ID:     layer.GetResultID(),
+												Values: a.getAdvLayerValues(res, layer, tokens, hitSpans),
 											}
 										},
 									),
@@ -417,17 +1187,114 @@ func (a *FCSSubHandlerV20) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 							},
 							nil,
 						),
+						// collocations data view if requested
+						general.ReturnIf(
+							withCollocs && !collocsAttached[res.ID],
+							&schema.XMLSRDataView{
+								Type: "application/x-mquery-colloc+xml",
+								Result: schema.XMLSRCollocDataViewResult{
+									XMLNSColl: "http://www.korpus.cz/mquery/dataview/colloc",
+									Attr:      res.GetLayerDefault(corpus.LayerTypeText).Name,
+									Window:    a.corporaConf.CollocationsWindow,
+									Collocates: collections.SliceMap(
+										results[res.ID].Collocs,
+										func(item result.CollocItem, i int) schema.XMLSRCollocDataItem {
+											return schema.XMLSRCollocDataItem{
+												Score: item.Score,
+												Freq:  item.Freq,
+												Value: item.Word,
+											}
+										},
+									),
+								},
+							},
+							nil,
+						),
+						// hit position data view if requested
+						hitPosition,
+						// hit offsets data view if requested
+						hitOffsets,
+						// wide context data view if requested
+						wideContext,
 					},
 				},
 			},
-			RecordPosition: len(records) + startRecord,
+			RecordIdentifier: recordID,
+			RecordPosition:   numRecords + fromResource.NumDuplicates() + startRecord,
+			MatchKey:         matchKey,
 		})
+		collocsAttached[res.ID] = true
 	}
 	if len(records) > 0 {
 		ans.Records = &records
 	}
-	if len(records)+startRecord-1 < ans.NumberOfRecords {
-		ans.NextRecordPosition = len(records) + startRecord
+	// deduplicated records still occupy their positions (see EnableDeduplication)
+	if nextPos := numRecords + fromResource.NumDuplicates() + startRecord; nextPos-1 < ans.NumberOfRecords {
+		ans.NextRecordPosition = nextPos
+	}
+	if withRscSummary {
+		ans.ResourceSummary = schema.NewXMLSRRscSummary()
+		for i, rs := range fromResource.Summary() {
+			rscConf, err := a.corporaConf.Resources.GetResource(rs.Name)
+			if err != nil {
+				log.Error().Err(err).Str("resource", rs.Name).Msg("failed to get resource summary")
+				continue
+			}
+			info := schema.XMLSRRscPageInfo{
+				PID:        rscConf.PID,
+				NumRecords: rs.NumReturned,
+				ConcSize:   rs.ConcSize,
+				HasMore:    rs.HasMore(exactRanges[i].From),
+				Status:     string(rs.Status()),
+			}
+			if rs.Err != nil {
+				info.Error = common.InternalErrorIdent(a.serverInfo.ExposeInternalErrors, rs.Err)
+			}
+			ans.ResourceSummary.AddResource(info)
+		}
+	}
+	a.attachTimings(&ans, timings)
+	if stream != nil {
+		if err := stream.Finish(ans); err != nil {
+			log.Error().Err(err).Msg("failed to finish streaming searchRetrieve response")
+		}
 	}
 	return ans, http.StatusOK
 }
+
+// mergeFacetValues merges distributions of a facet obtained from
+// multiple resources into a single one sorted by frequencies
+// (in descending order) and limited to `limit` values.
+// Please note that the values of each resource are already limited
+// by workers so the merged frequencies of rare values may be lower
+// than the actual ones.
+func mergeFacetValues(dists [][]result.FacetItem, limit int) []schema.XMLSRFacetValue {
+	freqs := make(map[string]int64)
+	for _, dist := range dists {
+		for _, item := range dist {
+			freqs[item.Value] += item.Freq
+		}
+	}
+	ans := make([]schema.XMLSRFacetValue, 0, len(freqs))
+	for value, freq := range freqs {
+		ans = append(ans, schema.XMLSRFacetValue{Freq: freq, Value: value})
+	}
+	sort.Slice(ans, func(i, j int) bool {
+		if ans[i].Freq != ans[j].Freq {
+			return ans[i].Freq > ans[j].Freq
+		}
+		return ans[i].Value < ans[j].Value
+	})
+	if len(ans) > limit {
+		ans = ans[:limit]
+	}
+	return ans
+}
+
+// isStreamingApplicable tells whether searchRetrieve records
+// should be written to the client one by one
+func (a *FCSSubHandlerV20) isStreamingApplicable(fcsRequest *FCSRequest, maximumRecords int) bool {
+	return a.corporaConf.StreamingMinRecords > 0 &&
+		maximumRecords >= a.corporaConf.StreamingMinRecords &&
+		fcsRequest.General.Format == general.ResponseFormatXML
+}
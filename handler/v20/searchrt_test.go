@@ -0,0 +1,53 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDCRecordTitle(t *testing.T) {
+	fullName := map[string]string{
+		"en": "Czech National Corpus",
+		"cs": "Český národní korpus",
+	}
+	assert.Equal(t, "Český národní korpus", dcRecordTitle(fullName, "en", []string{"cs"}))
+	assert.Equal(t, "Czech National Corpus", dcRecordTitle(fullName, "en", []string{"de"}))
+	assert.Equal(t, "Czech National Corpus", dcRecordTitle(fullName, "cs", []string{"en"}))
+}
+
+func TestMergeFacetValues(t *testing.T) {
+	dists := [][]result.FacetItem{
+		{{Value: "fiction", Freq: 10}, {Value: "news", Freq: 3}},
+		{{Value: "news", Freq: 9}, {Value: "poetry", Freq: 2}, {Value: "fiction", Freq: 1}},
+	}
+	assert.Equal(
+		t,
+		[]schema.XMLSRFacetValue{
+			{Value: "news", Freq: 12},
+			{Value: "fiction", Freq: 11},
+		},
+		mergeFacetValues(dists, 2),
+	)
+	assert.Empty(t, mergeFacetValues([][]result.FacetItem{{}}, 2))
+}
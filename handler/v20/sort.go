@@ -0,0 +1,96 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// sortKeyContext is a Manatee sort context covering the whole
+	// match (KWIC) - i.e. from its first to its last token
+	sortKeyContext = "0<0~0>0"
+)
+
+// fetchSortKeys parses the (SRU 1.1) `sortKeys` argument. Keys are
+// separated by spaces, each of them in the form
+// `path[,schema[,ascending[,caseSensitive[,missingValue]]]]`.
+// Only the `path` and `ascending` (`1` - default, `0`) parts are used.
+func fetchSortKeys(ctx *gin.Context) ([]fcsql.SortKey, error) {
+	ans := make([]fcsql.SortKey, 0, 3)
+	for _, item := range strings.Fields(ctx.Query(SearchRetrArgSortKeys.String())) {
+		parts := strings.Split(item, ",")
+		if parts[0] == "" {
+			return ans, fmt.Errorf("missing sort key path in `%s`", item)
+		}
+		key := fcsql.SortKey{Index: parts[0]}
+		if len(parts) > 2 {
+			switch parts[2] {
+			case "", "1":
+			case "0":
+				key.Descending = true
+			default:
+				return ans, fmt.Errorf("invalid sort direction `%s` in `%s`", parts[2], item)
+			}
+		}
+		ans = append(ans, key)
+	}
+	return ans, nil
+}
+
+// sortAttr finds a positional attribute of the resource matching
+// the sort key index. The index can be either a layer (e.g. `lemma`,
+// `fcs.pos`) or an exposed attribute name. An empty string is returned
+// for an unknown index.
+func sortAttr(rsc *corpus.CorpusSetup, index string) string {
+	index = strings.TrimPrefix(index, "fcs.")
+	if index == "word" {
+		index = string(corpus.LayerTypeText)
+	}
+	if layer := corpus.LayerType(index); layer.Validate() == nil {
+		return rsc.GetLayerDefault(layer).Name
+	}
+	if attr := rsc.GetPosAttr(index); attr.IsExposed() {
+		return attr.Name
+	}
+	return ""
+}
+
+// sortCrit translates sort keys to a Manatee sort criterion of the
+// resource. Manatee sorts lines only in the ascending order so descending
+// keys are returned as unsupported along with keys the resource does
+// not know. Such keys are not part of the criterion.
+func sortCrit(rsc *corpus.CorpusSetup, keys []fcsql.SortKey) (crit string, unsupported []fcsql.SortKey) {
+	levels := make([]string, 0, len(keys))
+	for _, key := range keys {
+		attr := sortAttr(rsc, key.Index)
+		if attr == "" || key.Descending {
+			unsupported = append(unsupported, key)
+			continue
+		}
+		levels = append(levels, attr+"/ "+sortKeyContext)
+	}
+	crit = strings.Join(levels, " ")
+	return
+}
@@ -0,0 +1,87 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/parser/fcsql"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchSortKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet, "/?sortKeys=lemma,,1+word,,0+fcs.pos", nil)
+	keys, err := fetchSortKeys(ctx)
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]fcsql.SortKey{{Index: "lemma"}, {Index: "word", Descending: true}, {Index: "fcs.pos"}},
+		keys,
+	)
+}
+
+func TestFetchSortKeysInvalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, v := range []string{",,1", "lemma,,asc"} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodGet, "/?sortKeys="+v, nil)
+		_, err := fetchSortKeys(ctx)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestSortCrit(t *testing.T) {
+	rsc := &corpus.CorpusSetup{
+		PosAttrs: []corpus.PosAttr{
+			{Name: "word", Layer: "text", IsLayerDefault: true},
+			{Name: "lemma", Layer: "lemma", IsLayerDefault: true},
+			{Name: "tag", Layer: "pos", IsLayerDefault: true},
+			{Name: "word_lc", Layer: "text", Exposed: boolPtr(false)},
+		},
+	}
+	crit, unsupported := sortCrit(rsc, []fcsql.SortKey{
+		{Index: "word"},
+		{Index: "fcs.pos"},
+		{Index: "lemma", Descending: true},
+		{Index: "dc.title"},
+		{Index: "word_lc"},
+		{Index: "tag"},
+	})
+	assert.Equal(t, "word/ 0<0~0>0 tag/ 0<0~0>0 tag/ 0<0~0>0", crit)
+	assert.Equal(
+		t,
+		[]string{"lemma/sort.descending", "dc.title", "word_lc"},
+		sortKeysAsStrings(unsupported),
+	)
+}
+
+func sortKeysAsStrings(keys []fcsql.SortKey) []string {
+	ans := make([]string, len(keys))
+	for i, k := range keys {
+		ans[i] = k.String()
+	}
+	return ans
+}
@@ -0,0 +1,124 @@
+// Copyright 2023 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamSplitElement is the last element of the response
+	// preceding the records
+	streamSplitElement = "</sruResponse:numberOfRecords>"
+)
+
+// srResponseStream writes a searchRetrieve XML response incrementally
+// so large pages of records do not have to be buffered as a whole.
+// Elements preceding and following the records are produced by
+// the standard marshaling of schema.XMLSRResponse (with no records)
+// to keep the output the same as in the buffered mode.
+type srResponseStream struct {
+	ctx        *gin.Context
+	xslt       string
+	numRecords int
+	err        error
+}
+
+func (s *srResponseStream) encodeWithoutRecords(ans schema.XMLSRResponse) (string, int, error) {
+	ans.Records = nil
+	data, err := xml.MarshalIndent(ans, "", "  ")
+	if err != nil {
+		return "", 0, err
+	}
+	doc := string(data)
+	idx := strings.Index(doc, streamSplitElement)
+	if idx < 0 {
+		return "", 0, fmt.Errorf("failed to find records position in searchRetrieve response")
+	}
+	return doc, idx + len(streamSplitElement), nil
+}
+
+func (s *srResponseStream) write(data []byte) {
+	if s.err != nil {
+		return
+	}
+	_, s.err = s.ctx.Writer.Write(data)
+	if s.err == nil {
+		s.ctx.Writer.Flush()
+	}
+}
+
+// Begin writes response headers and the part of the response
+// preceding the records.
+func (s *srResponseStream) Begin(ans schema.XMLSRResponse) error {
+	doc, split, err := s.encodeWithoutRecords(ans)
+	if err != nil {
+		return err
+	}
+	s.ctx.Writer.Header().Set("Content-Type", general.ResponseFormatXML.ContentType())
+	s.ctx.Writer.WriteHeader(http.StatusOK)
+	s.write([]byte(xml.Header + general.GetXSLTHeader(s.xslt) + doc[:split]))
+	return s.err
+}
+
+// WriteRecord encodes and sends a single record
+func (s *srResponseStream) WriteRecord(rec schema.XMLSRRecord) error {
+	var buff bytes.Buffer
+	if s.numRecords == 0 {
+		buff.WriteString("\n  <sruResponse:records>")
+	}
+	buff.WriteString("\n")
+	enc := xml.NewEncoder(&buff)
+	enc.Indent("    ", "  ")
+	err := enc.EncodeElement(rec, xml.StartElement{Name: xml.Name{Local: "sruResponse:record"}})
+	if err != nil {
+		return err
+	}
+	s.numRecords++
+	s.write(buff.Bytes())
+	return s.err
+}
+
+// Finish writes the rest of the response. The `ans` is expected
+// to be the same response as the one passed to Begin, possibly
+// with additional data (e.g. diagnostics, next record position).
+func (s *srResponseStream) Finish(ans schema.XMLSRResponse) error {
+	doc, split, err := s.encodeWithoutRecords(ans)
+	if err != nil {
+		return err
+	}
+	if s.numRecords > 0 {
+		s.write([]byte("\n  </sruResponse:records>"))
+	}
+	s.write([]byte(doc[split:]))
+	return s.err
+}
+
+func newSRResponseStream(ctx *gin.Context, xslt string) *srResponseStream {
+	return &srResponseStream{ctx: ctx, xslt: xslt}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 Martin Zimandl <martin.zimandl@gmail.com>
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestingSRResponse(numRecords int) schema.XMLSRResponse {
+	ans := schema.NewXMLSRResponse()
+	ans.NumberOfRecords = 100
+	records := make([]schema.XMLSRRecord, numRecords)
+	for i := range records {
+		records[i] = schema.XMLSRRecord{
+			Schema:      general.RecordSchema,
+			XMLEscaping: string(RecordXMLEscapingXML),
+			Data: &schema.XMLSRResource{
+				XMLNSFCS: "http://clarin.eu/fcs/resource",
+				PID:      "corp1-pid",
+			},
+			RecordPosition: i + 1,
+		}
+	}
+	if numRecords > 0 {
+		ans.Records = &records
+	}
+	ans.NextRecordPosition = numRecords + 1
+	return ans
+}
+
+func streamTestingSRResponse(t *testing.T, ans schema.XMLSRResponse) string {
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(rec)
+	stream := newSRResponseStream(ctx, "")
+	assert.NoError(t, stream.Begin(ans))
+	if ans.Records != nil {
+		for _, r := range *ans.Records {
+			assert.NoError(t, stream.WriteRecord(r))
+		}
+	}
+	assert.NoError(t, stream.Finish(ans))
+	return rec.Body.String()
+}
+
+func TestStreamedResponseEqualsBuffered(t *testing.T) {
+	a := &FCSSubHandlerV20{}
+	ans := createTestingSRResponse(3)
+	buffered, err := a.encodeResponse(general.ResponseFormatXML, "", ans)
+	assert.NoError(t, err)
+	assert.Equal(t, string(buffered), streamTestingSRResponse(t, ans))
+}
+
+func TestStreamedResponseWithoutRecords(t *testing.T) {
+	a := &FCSSubHandlerV20{}
+	ans := createTestingSRResponse(0)
+	buffered, err := a.encodeResponse(general.ResponseFormatXML, "", ans)
+	assert.NoError(t, err)
+	assert.Equal(t, string(buffered), streamTestingSRResponse(t, ans))
+}
@@ -0,0 +1,105 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"context"
+
+	"github.com/czcorpus/mquery-sru/handler/common"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/rs/zerolog/log"
+)
+
+// querySuggestion is an alternative basic query along
+// with its total number of hits in the searched resources
+type querySuggestion struct {
+	query   string
+	numHits int
+}
+
+// suggestQueries tests alternative basic queries (see common.SuggestionCandidates)
+// for a query with no results. Only concordance sizes are calculated and only
+// the alternatives with some hits are returned. Resources not able to process
+// an alternative (e.g. a resource without the lemma layer) are skipped.
+// As each tested resource means a worker job, each alternative is tested in
+// a limited number of resources (see corpus.CorporaSetup.QuerySuggestionsMaxJobs)
+// so the numbers of hits may be incomplete.
+func (a *FCSSubHandlerV20) suggestQueries(
+	ctx context.Context,
+	fcsQuery string,
+	corpora []string,
+	lang string,
+) []querySuggestion {
+	candidates := common.SuggestionCandidates(fcsQuery)
+	if len(candidates) == 0 {
+		return []querySuggestion{}
+	}
+	maxJobs := max(1, a.corporaConf.QuerySuggestionsMaxJobs/len(candidates))
+	waits := make([][]<-chan result.ConcResult, len(candidates))
+	for i, candidate := range candidates {
+		for _, rsc := range corpora {
+			if len(waits[i]) == maxJobs {
+				break
+			}
+			ast, fcsErr := a.translateQuery(rsc, candidate, QueryTypeCQL, 0, lang)
+			if fcsErr != nil {
+				continue
+			}
+			query := ast.Generate()
+			if len(ast.Errors()) > 0 {
+				continue
+			}
+			rscConf, err := a.corporaConf.Resources.GetResource(rsc)
+			if err != nil {
+				continue
+			}
+			wait, err := a.radapter.PublishQuery(ctx, rdb.Query{
+				Func:  "concExample",
+				Queue: rscConf.WorkerQueue,
+				Args: rdb.ConcQueryArgs{
+					CorpusPath:  a.corporaConf.GetRegistryPath(rsc),
+					Query:       query,
+					Attrs:       rscConf.GetLayerAttrNames(nil),
+					Encoding:    rscConf.Encoding,
+					MinFormFreq: rscConf.MinFormFreq,
+					Output:      rdb.ConcOutputCount,
+				},
+			})
+			if err != nil {
+				log.Warn().Err(err).Str("resource", rsc).Msg("failed to publish a query suggestion search")
+				continue
+			}
+			waits[i] = append(waits[i], wait)
+		}
+	}
+	ans := make([]querySuggestion, 0, len(candidates))
+	for i, candidate := range candidates {
+		var numHits int
+		for _, wait := range waits[i] {
+			if res := common.AwaitResult(ctx, wait); res.Error == nil {
+				numHits += res.ConcSize
+			}
+		}
+		if numHits > 0 {
+			ans = append(ans, querySuggestion{query: candidate, numHits: numHits})
+		}
+	}
+	return ans
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestingValidationHandler() *FCSSubHandlerV20 {
+	return &FCSSubHandlerV20{
+		serverInfo: &cnf.ServerInfo{},
+		corporaConf: &corpus.CorporaSetup{
+			MaximumRecords: 50,
+			MaximumContext: 20,
+			RecordSchemas:  []string{general.RecordSchema},
+			Resources:      corpus.SrchResources{{ID: "corp1", PID: "corp1-pid"}},
+		},
+	}
+}
+
+func TestSearchRetrieveReportsAllValidationErrors(t *testing.T) {
+	general.SetStrictHTTPStatus(true)
+	defer general.SetStrictHTTPStatus(false)
+	a := createTestingValidationHandler()
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet,
+		"/?operation=searchRetrieve&startRecord=0&maximumRecords=foo&x-fcs-context-size=100&foo=bar"+
+			"&recordSchema=info:srw/schema/1/dc-v1.1",
+		nil,
+	)
+	ans, status := a.searchRetrieve(
+		ctx, &FCSRequest{General: &general.FCSGeneralRequest{Lang: "en"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.NotNil(t, ans.Diagnostics)
+	idents := make([]string, len(ans.Diagnostics.Diagnostics))
+	for i, diag := range ans.Diagnostics.Diagnostics {
+		idents[i] = diag.Details
+	}
+	assert.ElementsMatch(
+		t,
+		[]string{
+			"foo", "fcs_query", "startRecord", "maximumRecords", "x-fcs-context-size",
+			general.RecordSchemaDC,
+		},
+		idents,
+	)
+}
+
+func TestSearchRetrieveIgnoresUnknownParamsIfNotStrict(t *testing.T) {
+	general.SetStrictHTTPStatus(true)
+	general.SetStrictParameters(false)
+	defer func() {
+		general.SetStrictHTTPStatus(false)
+		general.SetStrictParameters(true)
+	}()
+	a := createTestingValidationHandler()
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		http.MethodGet,
+		"/?operation=searchRetrieve&utm_source=foo&maximumRecords=bar",
+		nil,
+	)
+	ans, status := a.searchRetrieve(
+		ctx, &FCSRequest{General: &general.FCSGeneralRequest{Lang: "en"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.NotNil(t, ans.Diagnostics)
+	idents := make([]string, len(ans.Diagnostics.Diagnostics))
+	for i, diag := range ans.Diagnostics.Diagnostics {
+		idents[i] = diag.Details
+	}
+	// invalid values of known parameters are still reported
+	assert.ElementsMatch(t, []string{"fcs_query", "maximumRecords"}, idents)
+}
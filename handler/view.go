@@ -21,6 +21,8 @@ package handler
 import (
 	"path"
 
+	"github.com/czcorpus/mquery-sru/general"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -32,6 +34,7 @@ type ViewHandler struct {
 func (handler *ViewHandler) Handle(ctx *gin.Context) {
 	handler.fcsHandler.handleWithXSLT(
 		ctx,
+		general.ResponseFormatXML,
 		map[string]string{
 			"explain":        path.Join(handler.assetsURLPath, "ui/assets/xslt/explain.xslt"),
 			"searchRetrieve": path.Join(handler.assetsURLPath, "ui/assets/xslt/searchRetrieve.xslt"),
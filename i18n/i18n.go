@@ -0,0 +1,126 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultLanguage is the language each multilingual
+	// configuration value and message must provide
+	DefaultLanguage = "en"
+)
+
+type langPreference struct {
+	lang    string
+	quality float64
+}
+
+// ParseAcceptLanguage parses a value of the HTTP `Accept-Language`
+// header and returns contained languages (without region subtags)
+// sorted by their quality values. Invalid entries are ignored.
+func ParseAcceptLanguage(header string) []string {
+	prefs := make([]langPreference, 0, 5)
+	for _, item := range strings.Split(header, ",") {
+		parts := strings.Split(strings.TrimSpace(item), ";")
+		tag := strings.ToLower(strings.TrimSpace(parts[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		lang, _, _ := strings.Cut(tag, "-")
+		quality := 1.0
+		for _, param := range parts[1:] {
+			k, v, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && k == "q" {
+				q, err := strconv.ParseFloat(v, 64)
+				if err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			prefs = append(prefs, langPreference{lang: lang, quality: quality})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool {
+		return prefs[i].quality > prefs[j].quality
+	})
+	ans := make([]string, len(prefs))
+	for i, v := range prefs {
+		ans[i] = v.lang
+	}
+	return ans
+}
+
+// Languages returns languages available in `translations`
+// in the order they should be preferred: accepted languages (in order
+// of preference), `primaryLang`, DefaultLanguage and finally the remaining
+// languages sorted alphabetically (to keep the output stable).
+func Languages(translations map[string]string, acceptLangs []string, primaryLang string) []string {
+	ans := make([]string, 0, len(translations))
+	used := make(map[string]bool)
+	candidates := make([]string, 0, len(acceptLangs)+2)
+	candidates = append(candidates, acceptLangs...)
+	candidates = append(candidates, primaryLang, DefaultLanguage)
+	for _, lang := range candidates {
+		if _, ok := translations[lang]; ok && !used[lang] {
+			ans = append(ans, lang)
+			used[lang] = true
+		}
+	}
+	rest := make([]string, 0, len(translations))
+	for lang := range translations {
+		if !used[lang] {
+			rest = append(rest, lang)
+		}
+	}
+	sort.Strings(rest)
+	return append(ans, rest...)
+}
+
+// Resolve returns the most suitable translation and its language
+// based on the resolution order described in Languages.
+// In case there are no translations at all, empty strings are returned.
+func Resolve(translations map[string]string, acceptLangs []string, primaryLang string) (value string, lang string) {
+	langs := Languages(translations, acceptLangs, primaryLang)
+	if len(langs) == 0 {
+		return "", ""
+	}
+	return translations[langs[0]], langs[0]
+}
+
+// Map maps `translations` to a slice ordered by the resolution
+// order described in Languages. The `mapFn` is informed whether
+// the item is the resolved one (i.e. the first one).
+func Map[T any](
+	translations map[string]string,
+	acceptLangs []string,
+	primaryLang string,
+	mapFn func(lang, value string, resolved bool) T,
+) []T {
+	langs := Languages(translations, acceptLangs, primaryLang)
+	ans := make([]T, len(langs))
+	for i, lang := range langs {
+		ans[i] = mapFn(lang, translations[lang], i == 0)
+	}
+	return ans
+}
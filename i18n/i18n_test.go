@@ -0,0 +1,98 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package i18n
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveAcceptedTranslation(t *testing.T) {
+	value, lang := Resolve(
+		map[string]string{"en": "Corpus", "cs": "Korpus"}, []string{"cs", "en"}, "en")
+	assert.Equal(t, "cs", lang)
+	assert.Equal(t, "Korpus", value)
+}
+
+func TestResolveFallbackToPrimary(t *testing.T) {
+	value, lang := Resolve(
+		map[string]string{"en": "Corpus", "cs": "Korpus"}, []string{"de"}, "cs")
+	assert.Equal(t, "cs", lang)
+	assert.Equal(t, "Korpus", value)
+}
+
+func TestResolveFallbackToDefault(t *testing.T) {
+	value, lang := Resolve(
+		map[string]string{"en": "Corpus", "sk": "Korpus"}, []string{"de"}, "cs")
+	assert.Equal(t, "en", lang)
+	assert.Equal(t, "Corpus", value)
+}
+
+func TestResolveFallbackToAny(t *testing.T) {
+	value, lang := Resolve(
+		map[string]string{"sk": "Korpus SK", "cs": "Korpus CS"}, []string{"fr"}, "de")
+	assert.Equal(t, "cs", lang)
+	assert.Equal(t, "Korpus CS", value)
+}
+
+func TestResolveEmpty(t *testing.T) {
+	value, lang := Resolve(map[string]string{}, []string{"en"}, "cs")
+	assert.Equal(t, "", lang)
+	assert.Equal(t, "", value)
+}
+
+func TestResolveNoAcceptedLanguages(t *testing.T) {
+	value, lang := Resolve(map[string]string{"en": "Corpus", "cs": "Korpus"}, nil, "")
+	assert.Equal(t, "en", lang)
+	assert.Equal(t, "Corpus", value)
+}
+
+func TestLanguagesOrder(t *testing.T) {
+	langs := Languages(
+		map[string]string{"sk": "-", "en": "-", "cs": "-", "de": "-", "pl": "-"},
+		[]string{"pl", "fr", "cs"},
+		"cs",
+	)
+	assert.Equal(t, []string{"pl", "cs", "en", "de", "sk"}, langs)
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	assert.Equal(
+		t,
+		[]string{"cs", "en", "de"},
+		ParseAcceptLanguage("de;q=0.5, cs-CZ, en;q=0.8, *;q=0.1, fr;q=0"),
+	)
+	assert.Equal(t, []string{}, ParseAcceptLanguage(""))
+}
+
+func TestMapMarksResolved(t *testing.T) {
+	items := Map(
+		map[string]string{"en": "Corpus", "cs": "Korpus"},
+		[]string{"cs"},
+		"en",
+		func(lang, value string, resolved bool) string {
+			if resolved {
+				return "*" + lang
+			}
+			return lang
+		},
+	)
+	assert.Equal(t, []string{"*cs", "en"}, items)
+}
@@ -20,12 +20,138 @@
 #include "corp/corpus.hh"
 #include "concord/concord.hh"
 #include "concord/concget.hh"
+#include "concord/colloc.hh"
 #include "query/cqpeval.hh"
 #include "mango.h"
 #include <cmath>
+#include <chrono>
+#include <thread>
+#include <sstream>
+#include <vector>
+#include <numeric>
+#include <algorithm>
 
 using namespace std;
 
+const int cancelCheckIntervalMs = 50;
+
+const char* canceledMsg = "operation canceled";
+
+const char* outOfBoundsMsg = "position is out of corpus bounds";
+
+const char* noAttrsMsg = "no positional attributes specified";
+
+/**
+ * A self-closing structure inserted between two adjacent KWIC segments
+ * highlighted as different hits (see HitBoundaryStruct in mango.go)
+ */
+const char* hitBoundaryTag = "<mqhit/>";
+
+/**
+ * @brief Tells whether a class of a KWIC segment marks matched tokens
+ */
+bool is_hit_class(const std::string& cls) {
+    return cls.find("coll") != std::string::npos;
+}
+
+/**
+ * @brief Wait for a concordance (calculated by Manatee in a background thread)
+ * while checking the `canceled` flag.
+ *
+ * Please note that Manatee does not provide a way to interrupt query evaluation.
+ * So once canceled, we only stop waiting for the result and the evaluation
+ * itself may still keep Manatee's calculation thread (and the worker which must
+ * release the concordance) busy until it finishes.
+ *
+ * @param conc
+ * @param canceled
+ * @return true if the concordance is complete, false if the operation has been canceled
+ */
+bool wait_for_conc(Concordance* conc, const volatile int* canceled) {
+    while (!conc->finished()) {
+        if (*canceled) {
+            return false;
+        }
+        std::this_thread::sleep_for(std::chrono::milliseconds(cancelCheckIntervalMs));
+    }
+    conc->sync();
+    return true;
+}
+
+
+/**
+ * @brief Read at most `limit` lines from `kl` and encode each of them
+ * as "[refs][refsSplitter][tokens...]". In case there are less lines
+ * available, the remaining items are filled with empty strings.
+ *
+ * @param kl
+ * @param limit
+ * @param refsSplitter
+ * @param canceled
+ * @return char** an array of exactly `limit` strings
+ */
+char** kwic_lines_to_strings(
+    KWICLines* kl, PosInt limit, const char* refsSplitter, const volatile int* canceled) {
+
+    char** lines = (char**)malloc(limit * sizeof(char*));
+    int i = 0;
+    while (!*canceled && kl->nextline()) {
+        auto lft = kl->get_left();
+        auto kwc = kl->get_kwic();
+        auto rgt = kl->get_right();
+        std::ostringstream buffer;
+
+        buffer << kl->get_refs() << refsSplitter;
+
+        for (size_t i = 0; i < lft.size(); ++i) {
+            if (i > 0) {
+                buffer << " ";
+            }
+            buffer << lft.at(i);
+        }
+        // KWIC segments come as pairs (text, class); adjacent hits would be
+        // indistinguishable in the output so we separate them explicitly
+        std::string prevHitClass;
+        for (size_t i = 0; i < kwc.size(); ++i) {
+            if (i > 0) {
+                buffer << " ";
+            }
+            if (i % 2 == 0 && i + 1 < kwc.size()) {
+                const std::string& cls = kwc.at(i + 1);
+                if (is_hit_class(cls)) {
+                    if (!prevHitClass.empty() && prevHitClass != cls) {
+                        buffer << hitBoundaryTag << " ";
+                    }
+                    prevHitClass = cls;
+
+                } else {
+                    prevHitClass.clear();
+                }
+            }
+            buffer << kwc.at(i);
+        }
+        for (size_t i = 0; i < rgt.size(); ++i) {
+            if (i > 0) {
+                buffer << " ";
+            }
+            buffer << rgt.at(i);
+        }
+        lines[i] = strdup(buffer.str().c_str());
+        i++;
+        if (i == limit) {
+            break;
+        }
+    }
+    // We've allocated memory for `limit` rows,
+    // but it's possible that there is less rows
+    // available so here we fill the remaining items
+    // with empty strings.
+    for (int i2 = i; i2 < limit; i2++) {
+        lines[i2] = strdup("");
+    }
+    return lines;
+}
+
 
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
@@ -46,14 +172,29 @@ KWICRowsRetval conc_examples(
     PosInt fromLine,
     PosInt limit,
     PosInt maxContext,
-    const char* viewContextStruct) {
+    const char* viewContextStruct,
+    const char* wideContextStruct,
+    PosInt wideMaxContext,
+    const char* sortCrit,
+    const volatile int* canceled) {
 
     string cPath(corpusPath);
     try {
         Corpus* corp = new Corpus(cPath);
         Concordance* conc = new Concordance(
             corp, corp->filter_query(eval_cqpquery(query, corp)));
-        conc->sync();
+        if (!wait_for_conc(conc, canceled)) {
+            delete conc;
+            delete corp;
+            KWICRowsRetval ans {
+                nullptr,
+                0,
+                0,
+                strdup(canceledMsg),
+                2
+            };
+            return ans;
+        }
         if (conc->size() == 0 && fromLine == 0) {
             KWICRowsRetval ans {
                 nullptr,
@@ -63,27 +204,50 @@ KWICRowsRetval conc_examples(
             };
             return ans;
         }
+        if (limit == 0) { // only the concordance size has been requested
+            PosInt concSize = conc->size();
+            delete conc;
+            delete corp;
+            KWICRowsRetval ans {
+                nullptr,
+                0,
+                concSize,
+                nullptr
+            };
+            return ans;
+        }
         if (conc->size() < fromLine) {
+            // we still provide the concordance size so the caller
+            // is able to recalculate the requested range
+            PosInt concSize = conc->size();
+            delete conc;
+            delete corp;
             const char* msg = "line range out of result size";
             char* dynamicStr = static_cast<char*>(malloc(strlen(msg) + 1));
             strcpy(dynamicStr, msg);
             KWICRowsRetval ans {
                 nullptr,
                 0,
-                0,
+                concSize,
                 dynamicStr,
                 1
             };
             return ans;
         }
-        conc->shuffle();
+        if (strlen(sortCrit) > 0) {
+            conc->sort(sortCrit);
+
+        } else {
+            conc->shuffle();
+        }
         PosInt concSize = conc->size();
         std::string cppContextStruct(viewContextStruct);
         std::string halfLeft = "-" + std::to_string(int(std::floor(maxContext / 2.0)));
         std::string halfRight = std::to_string(int(std::ceil(maxContext / 2.0)));
+        PosInt toLine = fromLine + limit;
         KWICLines* kl = new KWICLines(
             corp,
-            conc->RS(true, fromLine, fromLine+limit),
+            conc->RS(true, fromLine, toLine),
             cppContextStruct.empty() ? halfLeft.c_str() : ("-1:"+cppContextStruct).c_str(),
             cppContextStruct.empty() ? halfRight.c_str() : ("1:"+cppContextStruct).c_str(),
             attrs,
@@ -96,53 +260,392 @@ KWICRowsRetval conc_examples(
         if (conc->size() < limit) {
             limit = conc->size();
         }
-        char** lines = (char**)malloc(limit * sizeof(char*));
+        char** lines = kwic_lines_to_strings(kl, limit, refsSplitter, canceled);
+        delete kl;
+        char** wideLines = nullptr;
+        std::string cppWideContextStruct(wideContextStruct);
+        if (!cppWideContextStruct.empty() && !*canceled) {
+            KWICLines* wkl = new KWICLines(
+                corp,
+                conc->RS(true, fromLine, toLine),
+                ("-1:"+cppWideContextStruct).c_str(),
+                ("1:"+cppWideContextStruct).c_str(),
+                attrs,
+                attrs,
+                structs,
+                refs,
+                wideMaxContext,
+                false
+            );
+            wideLines = kwic_lines_to_strings(wkl, limit, refsSplitter, canceled);
+            delete wkl;
+        }
+        delete conc;
+        delete corp;
+        if (*canceled) {
+            conc_examples_free(lines, limit);
+            if (wideLines != nullptr) {
+                conc_examples_free(wideLines, limit);
+            }
+            KWICRowsRetval ans {
+                nullptr,
+                0,
+                0,
+                strdup(canceledMsg),
+                2
+            };
+            return ans;
+        }
+        KWICRowsRetval ans {
+            lines,
+            limit,
+            concSize,
+            nullptr,
+            0,
+            wideLines
+        };
+        return ans;
+
+    } catch (std::exception &e) {
+        KWICRowsRetval ans {
+            nullptr,
+            0,
+            0,
+            strdup(e.what()),
+            0
+        };
+        return ans;
+    }
+}
+
+void conc_examples_free(KWICRowsV value, int numItems) {
+    char** tValue = (char**)value;
+    for (int i = 0; i < numItems; i++) {
+        free(tValue[i]);
+    }
+    free(tValue);
+}
+
+CollocsRetval collocations(
+    const char* corpusPath,
+    const char* query,
+    const char* attr,
+    char measure,
+    int fromw,
+    int tow,
+    PosInt minFreq,
+    int maxItems,
+    const volatile int* canceled) {
+
+    string cPath(corpusPath);
+    try {
+        Corpus* corp = new Corpus(cPath);
+        Concordance* conc = new Concordance(
+            corp, corp->filter_query(eval_cqpquery(query, corp)));
+        if (!wait_for_conc(conc, canceled)) {
+            delete conc;
+            delete corp;
+            CollocsRetval ans {
+                nullptr,
+                0,
+                strdup(canceledMsg),
+                2
+            };
+            return ans;
+        }
+        CollocItems* colls = new CollocItems(
+            conc, string(attr), measure, minFreq, minFreq, fromw, tow, maxItems);
+        CollVal* items = (CollVal*)malloc(maxItems * sizeof(CollVal));
         int i = 0;
-        while (kl->nextline()) {
-            auto lft = kl->get_left();
-            auto kwc = kl->get_kwic();
-            auto rgt = kl->get_right();
-            std::ostringstream buffer;
+        while (!colls->eos() && i < maxItems) {
+            items[i] = CollVal {
+                strdup(colls->get_item()),
+                colls->get_bgr(measure),
+                colls->get_freq()
+            };
+            colls->next();
+            i++;
+        }
+        delete colls;
+        delete conc;
+        delete corp;
+        CollocsRetval ans {
+            items,
+            i,
+            nullptr,
+            0
+        };
+        return ans;
+
+    } catch (std::exception &e) {
+        CollocsRetval ans {
+            nullptr,
+            0,
+            strdup(e.what()),
+            0
+        };
+        return ans;
+    }
+}
+
+void collocations_free(CollocsV value, int numItems) {
+    CollVal* tValue = (CollVal*)value;
+    for (int i = 0; i < numItems; i++) {
+        free((void*)tValue[i].word);
+    }
+    free(tValue);
+}
 
-            buffer << kl->get_refs() << refsSplitter;
+FreqsRetval freq_dist(
+    const char* corpusPath,
+    const char* query,
+    const char* fcrit,
+    PosInt flimit,
+    int maxItems,
+    const volatile int* canceled) {
 
-            for (size_t i = 0; i < lft.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
-                }
-                buffer << lft.at(i);
+    string cPath(corpusPath);
+    try {
+        Corpus* corp = new Corpus(cPath);
+        Concordance* conc = new Concordance(
+            corp, corp->filter_query(eval_cqpquery(query, corp)));
+        if (!wait_for_conc(conc, canceled)) {
+            delete conc;
+            delete corp;
+            FreqsRetval ans {
+                nullptr,
+                nullptr,
+                0,
+                strdup(canceledMsg),
+                2
+            };
+            return ans;
+        }
+        std::vector<std::string> words;
+        std::vector<NumOfPos> freqs;
+        std::vector<NumOfPos> norms;
+        corp->freq_dist(conc->RS(), fcrit, flimit, words, freqs, norms);
+
+        std::vector<size_t> order(words.size());
+        std::iota(order.begin(), order.end(), 0);
+        std::stable_sort(order.begin(), order.end(), [&freqs](size_t i1, size_t i2) {
+            return freqs[i1] > freqs[i2];
+        });
+        int size = std::min(maxItems, int(words.size()));
+        char** ansWords = (char**)malloc(size * sizeof(char*));
+        PosInt* ansFreqs = (PosInt*)malloc(size * sizeof(PosInt));
+        for (int i = 0; i < size; i++) {
+            ansWords[i] = strdup(words[order[i]].c_str());
+            ansFreqs[i] = freqs[order[i]];
+        }
+        delete conc;
+        delete corp;
+        FreqsRetval ans {
+            ansWords,
+            ansFreqs,
+            size,
+            nullptr,
+            0
+        };
+        return ans;
+
+    } catch (std::exception &e) {
+        FreqsRetval ans {
+            nullptr,
+            nullptr,
+            0,
+            strdup(e.what()),
+            0
+        };
+        return ans;
+    }
+}
+
+void freq_dist_free(FreqWordsV words, FreqsV freqs, int numItems) {
+    char** tWords = (char**)words;
+    for (int i = 0; i < numItems; i++) {
+        free(tWords[i]);
+    }
+    free(tWords);
+    free(freqs);
+}
+
+FreqsRetval struct_attr_values(
+    const char* corpusPath,
+    const char* structName,
+    const char* attrName,
+    const char* fromValue,
+    int maxItems,
+    const volatile int* canceled) {
+
+    string cPath(corpusPath);
+    Corpus* corp = nullptr;
+    try {
+        corp = new Corpus(cPath);
+        PosAttr* attr;
+        try {
+            attr = corp->get_struct(structName)->get_attr(attrName);
+
+        } catch (std::exception &e) {
+            delete corp;
+            FreqsRetval ans {
+                nullptr,
+                nullptr,
+                0,
+                strdup(e.what()),
+                1
+            };
+            return ans;
+        }
+        string from(fromValue);
+        std::vector<std::string> words;
+        std::vector<NumOfPos> freqs;
+        for (int id = 0; id < attr->id_range(); id++) {
+            if (*canceled) {
+                delete corp;
+                FreqsRetval ans {
+                    nullptr,
+                    nullptr,
+                    0,
+                    strdup(canceledMsg),
+                    2
+                };
+                return ans;
             }
-            for (size_t i = 0; i < kwc.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
-                }
-                buffer << kwc.at(i);
+            string value(attr->id2str(id));
+            if (value >= from) {
+                words.push_back(value);
+                freqs.push_back(attr->freq(id));
             }
-            for (size_t i = 0; i < rgt.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
-                }
-                buffer << rgt.at(i);
+        }
+
+        std::vector<size_t> order(words.size());
+        std::iota(order.begin(), order.end(), 0);
+        std::sort(order.begin(), order.end(), [&words](size_t i1, size_t i2) {
+            return words[i1] < words[i2];
+        });
+        int size = std::min(maxItems, int(words.size()));
+        char** ansWords = (char**)malloc(size * sizeof(char*));
+        PosInt* ansFreqs = (PosInt*)malloc(size * sizeof(PosInt));
+        for (int i = 0; i < size; i++) {
+            ansWords[i] = strdup(words[order[i]].c_str());
+            ansFreqs[i] = freqs[order[i]];
+        }
+        delete corp;
+        FreqsRetval ans {
+            ansWords,
+            ansFreqs,
+            size,
+            nullptr,
+            0
+        };
+        return ans;
+
+    } catch (std::exception &e) {
+        delete corp;
+        FreqsRetval ans {
+            nullptr,
+            nullptr,
+            0,
+            strdup(e.what()),
+            0
+        };
+        return ans;
+    }
+}
+
+KWICRowsRetval position_context(
+    const char* corpusPath,
+    const char* attrs,
+    const char* structName,
+    PosInt position,
+    PosInt maxContext,
+    const char* refsSplitter) {
+
+    string cPath(corpusPath);
+    try {
+        Corpus* corp = new Corpus(cPath);
+        std::string cppStructName(structName);
+        PosInt hitBeg;
+        PosInt hitEnd; // exclusive
+        if (cppStructName.empty()) {
+            if (position < 0 || position >= corp->size()) {
+                delete corp;
+                KWICRowsRetval ans {
+                    nullptr,
+                    0,
+                    0,
+                    strdup(outOfBoundsMsg),
+                    1
+                };
+                return ans;
             }
-            lines[i] = strdup(buffer.str().c_str());
-            i++;
-            if (i == limit) {
-                break;
+            hitBeg = position;
+            hitEnd = position + 1;
+
+        } else {
+            Structure* strct = corp->get_struct(cppStructName);
+            if (position < 0 || position >= strct->size()) {
+                delete corp;
+                KWICRowsRetval ans {
+                    nullptr,
+                    0,
+                    0,
+                    strdup(outOfBoundsMsg),
+                    1
+                };
+                return ans;
             }
+            hitBeg = strct->rng->beg_at(position);
+            hitEnd = strct->rng->end_at(position);
         }
-        // We've allocated memory for `limit` rows,
-        // but it's possible that there is less rows
-        // available so here we fill the remaining items
-        // with empty strings.
-        for (int i2 = i; i2 < limit; i2++) {
-            lines[i2] = strdup("");
+        if (hitEnd - hitBeg > maxContext) {
+            hitEnd = hitBeg + maxContext;
         }
-        delete conc;
+        PosInt lft = hitBeg - PosInt(std::floor(maxContext / 2.0));
+        if (lft < 0) {
+            lft = 0;
+        }
+        PosInt rgt = hitEnd + PosInt(std::ceil(maxContext / 2.0));
+        if (rgt > corp->size()) {
+            rgt = corp->size();
+        }
+
+        std::vector<PosAttr*> posAttrs;
+        std::istringstream attrsStream(attrs);
+        std::string attr;
+        while (std::getline(attrsStream, attr, ',')) {
+            posAttrs.push_back(corp->get_attr(attr));
+        }
+        if (posAttrs.empty()) {
+            delete corp;
+            KWICRowsRetval ans {
+                nullptr,
+                0,
+                0,
+                strdup(noAttrsMsg),
+                3
+            };
+            return ans;
+        }
+
+        std::ostringstream buffer;
+        buffer << "#" << hitBeg << refsSplitter;
+        for (PosInt pos = lft; pos < rgt; pos++) {
+            buffer << " " << posAttrs[0]->pos2str(pos) << " ";
+            buffer << (pos >= hitBeg && pos < hitEnd ? "{kwic}" : "{}") << " ";
+            for (size_t i = 1; i < posAttrs.size(); i++) {
+                buffer << "/" << posAttrs[i]->pos2str(pos);
+            }
+            buffer << " attr";
+        }
+        char** lines = (char**)malloc(sizeof(char*));
+        lines[0] = strdup(buffer.str().c_str());
         delete corp;
         KWICRowsRetval ans {
             lines,
-            limit,
-            concSize,
+            1,
+            1,
             nullptr,
             0
         };
@@ -160,10 +663,22 @@ KWICRowsRetval conc_examples(
     }
 }
 
-void conc_examples_free(KWICRowsV value, int numItems) {
-    char** tValue = (char**)value;
-    for (int i = 0; i < numItems; i++) {
-        free(tValue[i]);
+CorpSizeRetval get_corpus_size(const char* corpusPath) {
+    string cPath(corpusPath);
+    try {
+        Corpus* corp = new Corpus(cPath);
+        CorpSizeRetval ans {
+            corp->size(),
+            nullptr
+        };
+        delete corp;
+        return ans;
+
+    } catch (std::exception &e) {
+        CorpSizeRetval ans {
+            0,
+            strdup(e.what())
+        };
+        return ans;
     }
-    free(tValue);
 }
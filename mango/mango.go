@@ -24,9 +24,11 @@ package mango
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"unsafe"
 
 	"github.com/czcorpus/cnc-gokit/collections"
@@ -35,35 +37,164 @@ import (
 
 const (
 	MaxRecordsInternalLimit = 1000
+
+	// MaxCollocItemsInternalLimit limits number of collocates
+	// returned by `GetCollocations`
+	MaxCollocItemsInternalLimit = 100
+
+	// MaxFreqItemsInternalLimit limits number of items
+	// returned by `GetFreqDist`
+	MaxFreqItemsInternalLimit = 100
+
+	// MaxFormFreqItemsInternalLimit limits number of items
+	// returned by `GetFormFreqs`
+	MaxFormFreqItemsInternalLimit = 100000
+
+	// MaxStructAttrValuesInternalLimit limits number of items
+	// returned by `GetStructAttrValues`
+	MaxStructAttrValuesInternalLimit = 1000
+
+	// HitBoundaryStruct is a name of a self-closing structure separating
+	// two adjacent hits within a concordance line (as without it, the hits
+	// would look like a single one)
+	HitBoundaryStruct = "mqhit"
 )
 
 var (
 	ErrRowsRangeOutOfConc = errors.New("rows range is out of concordance size")
+	ErrOperationCanceled  = errors.New("operation canceled")
+	ErrPositionOutOfRange = errors.New("position is out of corpus bounds")
+	ErrStructAttrNotFound = errors.New("structural attribute not found")
+	ErrNoPosAttrs         = errors.New("no positional attributes specified")
 )
 
 // ---
 
+// cancelFlag is a C-allocated flag passed to Manatee wrapper functions
+// which check it periodically and stop once it is set.
+type cancelFlag struct {
+	value *C.int
+	wg    sync.WaitGroup
+	done  chan struct{}
+}
+
+// watch sets the flag once the `ctx` is done. The `release` method
+// must be called once the flag is no longer needed.
+func (cf *cancelFlag) watch(ctx context.Context) {
+	cf.wg.Add(1)
+	go func() {
+		defer cf.wg.Done()
+		select {
+		case <-ctx.Done():
+			*cf.value = 1
+		case <-cf.done:
+		}
+	}()
+}
+
+func (cf *cancelFlag) release() {
+	close(cf.done)
+	cf.wg.Wait()
+	C.free(unsafe.Pointer(cf.value))
+}
+
+func newCancelFlag(ctx context.Context) *cancelFlag {
+	ans := &cancelFlag{
+		value: (*C.int)(C.malloc(C.sizeof_int)),
+		done:  make(chan struct{}),
+	}
+	*ans.value = 0
+	ans.watch(ctx)
+	return ans
+}
+
+// ---
+
 type GoConcSize struct {
 	Value      int64
 	CorpusSize int64
 }
 
 type GoConcordance struct {
-	Lines    []string
-	ConcSize int
+	Lines []string
+
+	// WideLines contain the same matches as Lines but with the whole
+	// surrounding structure as a context. The slice is filled only
+	// if a wide context structure is requested and its items are
+	// aligned with Lines.
+	WideLines []string
+	ConcSize  int
 }
 
+// CollMeasure is a Manatee code of an association measure
+// used to score collocates
+type CollMeasure byte
+
+const (
+	CollMeasureLogDice       CollMeasure = 'd'
+	CollMeasureTScore        CollMeasure = 't'
+	CollMeasureMI            CollMeasure = 'm'
+	CollMeasureLogLikelihood CollMeasure = 'l'
+)
+
+var collMeasureNames = map[string]CollMeasure{
+	"logDice":       CollMeasureLogDice,
+	"tScore":        CollMeasureTScore,
+	"mi":            CollMeasureMI,
+	"logLikelihood": CollMeasureLogLikelihood,
+}
+
+// ParseCollMeasure converts a measure name (`logDice`, `tScore`, `mi`,
+// `logLikelihood`) into a CollMeasure. Empty name means logDice.
+func ParseCollMeasure(name string) (CollMeasure, error) {
+	if name == "" {
+		return CollMeasureLogDice, nil
+	}
+	ans, ok := collMeasureNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown association measure: %s", name)
+	}
+	return ans, nil
+}
+
+type GoCollItem struct {
+	Word  string
+	Score float64
+	Freq  int64
+}
+
+type GoFreqItem struct {
+	Value string
+	Freq  int64
+}
+
+// GetConcordance obtains concordance lines for the `query`.
+// Once the `ctx` is done, the calculation is stopped as soon as possible
+// and ErrOperationCanceled is returned. Please note that Manatee cannot
+// interrupt the query evaluation itself so the function only stops
+// waiting for its result (see wait_for_conc in mango.cc).
+// If `wideContextStruct` is non-empty, each line is also returned
+// with the whole structure surrounding the match (limited to
+// `wideMaxContext` tokens) - see GoConcordance.WideLines.
+// If `sortCrit` (a Manatee sort criterion) is non-empty, lines are
+// sorted by it. Otherwise, they are returned in a random order.
 func GetConcordance(
+	ctx context.Context,
 	corpusPath, query string,
 	attrs []string,
 	structs []string,
 	refs []string,
 	fromLine, maxItems, maxContext int,
 	viewContextStruct string,
+	wideContextStruct string,
+	wideMaxContext int,
+	sortCrit string,
 ) (GoConcordance, error) {
 	if !collections.SliceContains(refs, "#") {
 		refs = append([]string{"#"}, refs...)
 	}
+	canceled := newCancelFlag(ctx)
+	defer canceled.release()
 	ans := C.conc_examples(
 		C.CString(corpusPath),
 		C.CString(query),
@@ -74,7 +205,11 @@ func GetConcordance(
 		C.longlong(fromLine),
 		C.longlong(maxItems),
 		C.longlong(maxContext),
-		C.CString(viewContextStruct))
+		C.CString(viewContextStruct),
+		C.CString(wideContextStruct),
+		C.longlong(wideMaxContext),
+		C.CString(sortCrit),
+		canceled.value)
 	var ret GoConcordance
 	ret.Lines = make([]string, 0, maxItems)
 	ret.ConcSize = int(ans.concSize)
@@ -83,20 +218,238 @@ func GetConcordance(
 		defer C.free(unsafe.Pointer(ans.err))
 		if ans.errorCode == 1 {
 			return ret, ErrRowsRangeOutOfConc
+
+		} else if ans.errorCode == 2 {
+			return ret, ErrOperationCanceled
 		}
 		return ret, err
 
 	} else {
 		defer C.conc_examples_free(ans.value, C.int(ans.size))
+		if ans.wideValue != nil {
+			defer C.conc_examples_free(ans.wideValue, C.int(ans.size))
+			ret.WideLines = make([]string, 0, maxItems)
+		}
 	}
 	tmp := (*[MaxRecordsInternalLimit]*C.char)(unsafe.Pointer(ans.value))
+	wideTmp := (*[MaxRecordsInternalLimit]*C.char)(unsafe.Pointer(ans.wideValue))
 	for i := 0; i < int(ans.size); i++ {
 		str := C.GoString(tmp[i])
 		// we must test str len as our c++ wrapper may return it
 		// e.g. in case our offset is higher than actual num of lines
 		if len(str) > 0 {
 			ret.Lines = append(ret.Lines, str)
+			if ans.wideValue != nil {
+				ret.WideLines = append(ret.WideLines, C.GoString(wideTmp[i]))
+			}
 		}
 	}
 	return ret, nil
 }
+
+// GetCollocations calculates at most `maxItems` collocates (sorted by
+// the `measure`) of the matches of `query` within the [fromw, tow] window
+// using the `attr` positional attribute. Cancellation via `ctx` works
+// the same way as in GetConcordance.
+func GetCollocations(
+	ctx context.Context,
+	corpusPath, query, attr string,
+	measure CollMeasure,
+	fromw, tow, minFreq, maxItems int,
+) ([]GoCollItem, error) {
+	if maxItems > MaxCollocItemsInternalLimit {
+		return []GoCollItem{}, fmt.Errorf(
+			"number of collocates must be at most %d", MaxCollocItemsInternalLimit)
+	}
+	canceled := newCancelFlag(ctx)
+	defer canceled.release()
+	ans := C.collocations(
+		C.CString(corpusPath),
+		C.CString(query),
+		C.CString(attr),
+		C.char(measure),
+		C.int(fromw),
+		C.int(tow),
+		C.longlong(minFreq),
+		C.int(maxItems),
+		canceled.value)
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		if ans.errorCode == 2 {
+			return []GoCollItem{}, ErrOperationCanceled
+		}
+		return []GoCollItem{}, err
+	}
+	defer C.collocations_free(ans.value, C.int(ans.size))
+	ret := make([]GoCollItem, 0, int(ans.size))
+	tmp := (*[MaxCollocItemsInternalLimit]C.CollVal)(unsafe.Pointer(ans.value))
+	for i := 0; i < int(ans.size); i++ {
+		ret = append(ret, GoCollItem{
+			Word:  C.GoString(tmp[i].word),
+			Score: float64(tmp[i].score),
+			Freq:  int64(tmp[i].freq),
+		})
+	}
+	return ret, nil
+}
+
+// GetFreqDist calculates frequency distribution of the matches of `query`
+// based on the `fcrit` criterion (e.g. `doc.genre 0`). At most `maxItems`
+// items with the highest frequencies are returned. Cancellation via `ctx`
+// works the same way as in GetConcordance.
+func GetFreqDist(
+	ctx context.Context,
+	corpusPath, query, fcrit string,
+	flimit, maxItems int,
+) ([]GoFreqItem, error) {
+	if maxItems > MaxFreqItemsInternalLimit {
+		return []GoFreqItem{}, fmt.Errorf(
+			"number of frequency items must be at most %d", MaxFreqItemsInternalLimit)
+	}
+	return freqDist(ctx, corpusPath, query, fcrit, flimit, maxItems)
+}
+
+// GetFormFreqs returns frequencies of values of the positional attribute
+// `attr` of the first tokens of the matches of `query`. Only the values
+// with frequency at least `flimit` are returned (and at most
+// MaxFormFreqItemsInternalLimit of them).
+func GetFormFreqs(
+	ctx context.Context,
+	corpusPath, query, attr string,
+	flimit int,
+) ([]GoFreqItem, error) {
+	return freqDist(ctx, corpusPath, query, attr+" 0", flimit, MaxFormFreqItemsInternalLimit)
+}
+
+func freqDist(
+	ctx context.Context,
+	corpusPath, query, fcrit string,
+	flimit, maxItems int,
+) ([]GoFreqItem, error) {
+	canceled := newCancelFlag(ctx)
+	defer canceled.release()
+	ans := C.freq_dist(
+		C.CString(corpusPath),
+		C.CString(query),
+		C.CString(fcrit),
+		C.longlong(flimit),
+		C.int(maxItems),
+		canceled.value)
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		if ans.errorCode == 2 {
+			return []GoFreqItem{}, ErrOperationCanceled
+		}
+		return []GoFreqItem{}, err
+	}
+	defer C.freq_dist_free(ans.words, ans.freqs, C.int(ans.size))
+	ret := make([]GoFreqItem, 0, int(ans.size))
+	words := (*[MaxFormFreqItemsInternalLimit]*C.char)(unsafe.Pointer(ans.words))
+	freqs := (*[MaxFormFreqItemsInternalLimit]C.longlong)(unsafe.Pointer(ans.freqs))
+	for i := 0; i < int(ans.size); i++ {
+		ret = append(ret, GoFreqItem{
+			Value: C.GoString(words[i]),
+			Freq:  int64(freqs[i]),
+		})
+	}
+	return ret, nil
+}
+
+// GetStructAttrValues returns values of the structural attribute
+// `structName`.`attrName` along with numbers of structures having
+// the values (e.g. numbers of documents of individual genres).
+// Values are sorted alphabetically starting with the first value
+// equal or greater than `fromValue`. In case the structure or
+// the attribute does not exist, ErrStructAttrNotFound is returned.
+func GetStructAttrValues(
+	ctx context.Context,
+	corpusPath, structName, attrName, fromValue string,
+	maxItems int,
+) ([]GoFreqItem, error) {
+	if maxItems > MaxStructAttrValuesInternalLimit {
+		return []GoFreqItem{}, fmt.Errorf(
+			"number of structural attribute values must be at most %d", MaxStructAttrValuesInternalLimit)
+	}
+	canceled := newCancelFlag(ctx)
+	defer canceled.release()
+	ans := C.struct_attr_values(
+		C.CString(corpusPath),
+		C.CString(structName),
+		C.CString(attrName),
+		C.CString(fromValue),
+		C.int(maxItems),
+		canceled.value)
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		if ans.errorCode == 1 {
+			return []GoFreqItem{}, ErrStructAttrNotFound
+		} else if ans.errorCode == 2 {
+			return []GoFreqItem{}, ErrOperationCanceled
+		}
+		return []GoFreqItem{}, err
+	}
+	defer C.freq_dist_free(ans.words, ans.freqs, C.int(ans.size))
+	ret := make([]GoFreqItem, 0, int(ans.size))
+	words := (*[MaxStructAttrValuesInternalLimit]*C.char)(unsafe.Pointer(ans.words))
+	freqs := (*[MaxStructAttrValuesInternalLimit]C.longlong)(unsafe.Pointer(ans.freqs))
+	for i := 0; i < int(ans.size); i++ {
+		ret = append(ret, GoFreqItem{
+			Value: C.GoString(words[i]),
+			Freq:  int64(freqs[i]),
+		})
+	}
+	return ret, nil
+}
+
+// GetPositionContext returns a single KWIC line with a token at the corpus
+// `position` as the hit. In case `structName` is not empty, the `position`
+// is understood as a number of the structure (e.g. a sentence) and the whole
+// structure (limited to `maxContext` tokens) is the hit.
+// In case the position is out of corpus bounds, ErrPositionOutOfRange
+// is returned. At least one attribute (the first one is used as the word)
+// is required, otherwise ErrNoPosAttrs is returned.
+func GetPositionContext(
+	corpusPath string,
+	attrs []string,
+	structName string,
+	position, maxContext int,
+) (GoConcordance, error) {
+	ans := C.position_context(
+		C.CString(corpusPath),
+		C.CString(strings.Join(attrs, ",")),
+		C.CString(structName),
+		C.longlong(position),
+		C.longlong(maxContext),
+		C.CString(concordance.RefsEndMark))
+	var ret GoConcordance
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		if ans.errorCode == 1 {
+			return ret, ErrPositionOutOfRange
+
+		} else if ans.errorCode == 3 {
+			return ret, ErrNoPosAttrs
+		}
+		return ret, err
+	}
+	defer C.conc_examples_free(ans.value, C.int(ans.size))
+	tmp := (*[1]*C.char)(unsafe.Pointer(ans.value))
+	ret.Lines = []string{C.GoString(tmp[0])}
+	ret.ConcSize = int(ans.concSize)
+	return ret, nil
+}
+
+// GetCorpusSize returns a size (number of tokens) of a corpus
+func GetCorpusSize(corpusPath string) (int64, error) {
+	ans := C.get_corpus_size(C.CString(corpusPath))
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return 0, err
+	}
+	return int64(ans.value), nil
+}
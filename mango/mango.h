@@ -26,6 +26,12 @@ typedef void* KWICRowsV;
 
 typedef long long int PosInt;
 
+typedef void* CollocsV;
+
+typedef void* FreqWordsV;
+
+typedef void* FreqsV;
+
 typedef struct ConcRetval {
     ConcV value;
     const char * err;
@@ -37,8 +43,35 @@ typedef struct KWICRowsRetval {
     PosInt concSize;
     const char * err;
     int errorCode;
+    KWICRowsV wideValue;
 } KWICRowsRetval;
 
+typedef struct CollVal {
+    const char * word;
+    double score;
+    PosInt freq;
+} CollVal;
+
+typedef struct CollocsRetval {
+    CollocsV value;
+    int size;
+    const char * err;
+    int errorCode;
+} CollocsRetval;
+
+typedef struct CorpSizeRetval {
+    PosInt value;
+    const char * err;
+} CorpSizeRetval;
+
+typedef struct FreqsRetval {
+    FreqWordsV words;
+    FreqsV freqs;
+    int size;
+    const char * err;
+    int errorCode;
+} FreqsRetval;
+
 
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
@@ -52,6 +85,13 @@ typedef struct KWICRowsRetval {
  * @param query
  * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
  * @param limit
+ * @param wideContextStruct if non-empty, an additional set of lines (`wideValue`)
+ * with the whole structure surrounding each match is returned, aligned with `value`
+ * @param wideMaxContext a maximum context size applied to the `wideValue` lines
+ * @param sortCrit a Manatee sort criterion (e.g. `lemma/ 0<0~0>0`); if empty,
+ * lines are returned in a random order
+ * @param canceled a flag checked periodically during the calculation; once set to
+ * a non-zero value, the function stops as soon as possible and returns error code 2
  * @return KWICRowsRetval
  */
 KWICRowsRetval conc_examples(
@@ -64,7 +104,11 @@ KWICRowsRetval conc_examples(
     PosInt fromLine,
     PosInt limit,
     PosInt maxContext,
-    const char* viewContextStruct);
+    const char* viewContextStruct,
+    const char* wideContextStruct,
+    PosInt wideMaxContext,
+    const char* sortCrit,
+    const volatile int* canceled);
 /**
  * @brief This function frees all the allocated memory
  * for a concordance example. It is intended to be called
@@ -75,6 +119,133 @@ KWICRowsRetval conc_examples(
  */
 void conc_examples_free(KWICRowsV value, int numItems);
 
+/**
+ * @brief For a concordance defined by `query`, calculate at most `maxItems`
+ * collocates of the match within the window [fromw, tow] using the positional
+ * attribute `attr`. Collocates are sorted by the score of the `measure`.
+ *
+ * @param corpusPath
+ * @param query
+ * @param attr
+ * @param measure Manatee code of an association measure (e.g. 'd' for logDice,
+ * 't' for T-score, 'm' for MI, 'l' for log-likelihood)
+ * @param fromw left edge of the window (typically negative)
+ * @param tow right edge of the window
+ * @param minFreq minimum frequency of a collocate within the concordance
+ * @param maxItems
+ * @param canceled a flag checked periodically during the calculation; once set to
+ * a non-zero value, the function stops as soon as possible and returns error code 2
+ * @return CollocsRetval
+ */
+CollocsRetval collocations(
+    const char* corpusPath,
+    const char* query,
+    const char* attr,
+    char measure,
+    int fromw,
+    int tow,
+    PosInt minFreq,
+    int maxItems,
+    const volatile int* canceled);
+
+/**
+ * @brief This function frees all the allocated memory
+ * for collocations. It is intended to be called
+ * from Go.
+ *
+ * @param value
+ * @param numItems
+ */
+void collocations_free(CollocsV value, int numItems);
+
+/**
+ * @brief For a concordance defined by `query`, calculate frequency distribution
+ * based on the criterion `fcrit` (e.g. `doc.genre 0`). At most `maxItems` items
+ * with the highest frequencies are returned (sorted by frequency).
+ *
+ * @param corpusPath
+ * @param query
+ * @param fcrit
+ * @param flimit minimum frequency of an item
+ * @param maxItems
+ * @param canceled a flag checked periodically during the calculation; once set to
+ * a non-zero value, the function stops as soon as possible and returns error code 2
+ * @return FreqsRetval
+ */
+FreqsRetval freq_dist(
+    const char* corpusPath,
+    const char* query,
+    const char* fcrit,
+    PosInt flimit,
+    int maxItems,
+    const volatile int* canceled);
+
+/**
+ * @brief This function frees all the allocated memory
+ * for a frequency distribution. It is intended to be called
+ * from Go.
+ *
+ * @param words
+ * @param freqs
+ * @param numItems
+ */
+void freq_dist_free(FreqWordsV words, FreqsV freqs, int numItems);
+
+/**
+ * @brief List values of a structural attribute (e.g. `doc.genre`) along with
+ * numbers of structures having the values. Values are sorted alphabetically
+ * and the list starts with the first value equal or greater than `fromValue`.
+ *
+ * @param corpusPath
+ * @param structName
+ * @param attrName
+ * @param fromValue
+ * @param maxItems
+ * @param canceled a flag checked periodically during the calculation; once set to
+ * a non-zero value, the function stops as soon as possible and returns error code 2
+ * @return FreqsRetval with error code 1 in case the structure or the attribute
+ * does not exist
+ */
+FreqsRetval struct_attr_values(
+    const char* corpusPath,
+    const char* structName,
+    const char* attrName,
+    const char* fromValue,
+    int maxItems,
+    const volatile int* canceled);
+
+/**
+ * @brief Return a single KWIC line for a token specified by its corpus position
+ * or for a structure specified by its number. The line has the same format as
+ * the ones returned by `conc_examples`.
+ *
+ * @param corpusPath
+ * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
+ * @param structName if empty, `position` is a corpus position of a token; otherwise,
+ * `position` is a number of the structure `structName` (e.g. a sentence)
+ * @param position
+ * @param maxContext max. number of tokens surrounding the hit (the hit itself
+ * is also limited to this number of tokens)
+ * @param refsSplitter
+ * @return KWICRowsRetval with error code 1 in case the position (structure number)
+ * is out of corpus bounds and with error code 3 in case `attrs` is empty
+ */
+KWICRowsRetval position_context(
+    const char* corpusPath,
+    const char* attrs,
+    const char* structName,
+    PosInt position,
+    PosInt maxContext,
+    const char* refsSplitter);
+
+/**
+ * @brief Return a size (number of tokens) of a corpus
+ *
+ * @param corpusPath
+ * @return CorpSizeRetval
+ */
+CorpSizeRetval get_corpus_size(const char* corpusPath);
+
 
 #ifdef __cplusplus
 }
@@ -19,17 +19,30 @@
 package monitoring
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/czcorpus/cnc-gokit/datetime"
 	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/gin-gonic/gin"
 )
 
+// jobsCounter provides information about jobs
+// published to workers (see rdb.Adapter)
+type jobsCounter interface {
+	InFlightJobs() int
+	MaxConcurrentJobs() int
+	QueueDepth() (int, error)
+	NumWorkers() (int, error)
+	RecentJobs(window time.Duration) (int, time.Duration)
+}
+
 type Actions struct {
 	logger   *WorkerJobLogger
 	location *time.Location
+	jobs     jobsCounter
 }
 
 func (a *Actions) WorkersLoad(ctx *gin.Context) {
@@ -69,13 +82,75 @@ func (a *Actions) WorkersLoadTotal(ctx *gin.Context) {
 
 }
 
+// InFlightJobs shows number of jobs published to workers
+// and still waiting for their results along with the limit
+func (a *Actions) InFlightJobs(ctx *gin.Context) {
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		map[string]any{
+			"inFlightJobs": a.jobs.InFlightJobs(),
+			"limit":        a.jobs.MaxConcurrentJobs(),
+		},
+	)
+}
+
+// WorkersSuggestion provides a recommended number of workers based
+// on recent throughput and the number of jobs waiting in queues.
+// The period of recent jobs can be specified via the `ago` argument
+// (default is 5 minutes, max. is rdb.MaxJobStatsWindow).
+func (a *Actions) WorkersSuggestion(ctx *gin.Context) {
+	window := dfltScalingWindow
+	if ctx.Query("ago") != "" {
+		var err error
+		window, err = datetime.ParseDuration(ctx.Query("ago"))
+		if err != nil {
+			uniresp.RespondWithErrorJSON(ctx, err, http.StatusUnprocessableEntity)
+			return
+		}
+		if window <= 0 || window > rdb.MaxJobStatsWindow {
+			uniresp.RespondWithErrorJSON(
+				ctx,
+				fmt.Errorf("the `ago` value must be positive and max. %s", rdb.MaxJobStatsWindow),
+				http.StatusUnprocessableEntity,
+			)
+			return
+		}
+	}
+	queueDepth, err := a.jobs.QueueDepth()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	numWorkers, err := a.jobs.NumWorkers()
+	if err != nil {
+		uniresp.RespondWithErrorJSON(ctx, err, http.StatusInternalServerError)
+		return
+	}
+	numJobs, avgDuration := a.jobs.RecentJobs(window)
+	jobsPerSec := float64(numJobs) / window.Seconds()
+	uniresp.WriteJSONResponse(
+		ctx.Writer,
+		WorkersSuggestion{
+			SuggestedWorkers:   suggestWorkers(jobsPerSec, avgDuration, queueDepth),
+			CurrentWorkers:     numWorkers,
+			QueueDepth:         queueDepth,
+			InFlightJobs:       a.jobs.InFlightJobs(),
+			JobsPerSec:         jobsPerSec,
+			AvgJobDurationSecs: avgDuration.Seconds(),
+			WindowSecs:         window.Seconds(),
+		},
+	)
+}
+
 func NewActions(
 	logger *WorkerJobLogger,
 	location *time.Location,
+	jobs jobsCounter,
 ) *Actions {
 	ans := &Actions{
 		logger:   logger,
 		location: location,
+		jobs:     jobs,
 	}
 	return ans
 }
@@ -0,0 +1,58 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// dfltScalingWindow is a period of recent jobs used
+	// to calculate the suggested number of workers
+	dfltScalingWindow = 5 * time.Minute
+
+	// backlogDrainTime is a time in which the suggested number
+	// of workers should process the jobs waiting in queues
+	backlogDrainTime = time.Minute
+)
+
+// WorkersSuggestion is a recommended number of workers along with
+// the data it is based on. It is intended for external autoscalers
+// (e.g. Kubernetes HPA via a custom metrics adapter).
+type WorkersSuggestion struct {
+	SuggestedWorkers   int     `json:"suggestedWorkers"`
+	CurrentWorkers     int     `json:"currentWorkers"`
+	QueueDepth         int     `json:"queueDepth"`
+	InFlightJobs       int     `json:"inFlightJobs"`
+	JobsPerSec         float64 `json:"jobsPerSec"`
+	AvgJobDurationSecs float64 `json:"avgJobDurationSecs"`
+	WindowSecs         float64 `json:"windowSecs"`
+}
+
+// suggestWorkers calculates a number of workers needed to handle
+// the observed traffic (jobs arriving at `jobsPerSec` and taking
+// `avgDuration` each - i.e. Little's law) and to process the jobs
+// waiting in queues within backlogDrainTime. As each worker processes
+// a single job at a time, at least one worker is always suggested.
+func suggestWorkers(jobsPerSec float64, avgDuration time.Duration, queueDepth int) int {
+	load := jobsPerSec * avgDuration.Seconds()
+	backlog := float64(queueDepth) * avgDuration.Seconds() / backlogDrainTime.Seconds()
+	return max(1, int(math.Ceil(load+backlog)))
+}
@@ -0,0 +1,35 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestWorkers(t *testing.T) {
+	// no traffic
+	assert.Equal(t, 1, suggestWorkers(0, 0, 0))
+	// 2 jobs/s taking 1.5s each => 3 workers busy
+	assert.Equal(t, 3, suggestWorkers(2, 1500*time.Millisecond, 0))
+	// 2 jobs/s at 2s (4 workers) plus 120 queued jobs drained within a minute (4 workers)
+	assert.Equal(t, 8, suggestWorkers(2, 2*time.Second, 120))
+}
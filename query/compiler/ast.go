@@ -1,9 +1,51 @@
 package compiler
 
+import "unicode/utf8"
+
 type AST interface {
 	Generate() string
 	AddError(err error)
 	Errors() []error
 	TranslateWithinCtx(v string) string
 	TranslatePosAttr(qualifier, name string) string
+
+	// RewriteAttrValue applies configured rewrite rules to an attribute
+	// (specified by `qualifier` and `name`) and its `value`. If no rule
+	// matches, false is returned.
+	RewriteAttrValue(qualifier, name, value string) (string, string, bool)
+}
+
+// TreeProvider is implemented by parsed queries able to export
+// their structure (e.g. for query builders)
+type TreeProvider interface {
+	Tree() *Node
+}
+
+// Node is a JSON serializable view of a part of a parsed query
+type Node struct {
+	Type     string  `json:"type"`
+	Value    string  `json:"value,omitempty"`
+	Span     *Span   `json:"span,omitempty"`
+	Children []*Node `json:"children,omitempty"`
+}
+
+// Span specifies a position of a part of a query. Parsers record
+// spans as byte offsets while exported nodes use character offsets
+// (see CharSpan). The End is exclusive.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// CharSpan converts a span with byte offsets within the `src` query
+// to a span with character offsets.
+func CharSpan(src string, byteSpan Span) *Span {
+	if byteSpan.Start < 0 || byteSpan.End > len(src) || byteSpan.Start > byteSpan.End {
+		return nil
+	}
+	start := utf8.RuneCountInString(src[:byteSpan.Start])
+	return &Span{
+		Start: start,
+		End:   start + utf8.RuneCountInString(src[byteSpan.Start:byteSpan.End]),
+	}
 }
@@ -0,0 +1,105 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var macroNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func isMacroNameChar(c byte, first bool) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || !first && c >= '0' && c <= '9'
+}
+
+// IsValidMacroName tests whether the name can be used as a query macro
+// (i.e. it contains only ASCII letters, digits and underscores and it
+// does not start with a digit)
+func IsValidMacroName(name string) bool {
+	return macroNameRegexp.MatchString(name)
+}
+
+// ExpandMacros replaces macros (`$NAME`) in a query by their definitions.
+// Macros may use other macros. Quoted strings are not searched for macros
+// (e.g. `"foo$"` is kept as is). The `singleQuotes` argument specifies
+// whether also `'` delimits quoted strings (as in advanced queries).
+// In basic queries, `'` is just an ordinary character (e.g. `rock'n'roll`).
+// A `$` not followed by a name of a defined macro is kept as is (so e.g.
+// `$100` can be searched). Recursive macros are reported as errors.
+func ExpandMacros(q string, macros map[string]string, singleQuotes bool) (string, error) {
+	if len(macros) == 0 || !strings.Contains(q, "$") {
+		return q, nil
+	}
+	return expandMacros(q, macros, singleQuotes, []string{})
+}
+
+func expandMacros(
+	q string,
+	macros map[string]string,
+	singleQuotes bool,
+	stack []string,
+) (string, error) {
+	var ans strings.Builder
+	var quote byte
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+		switch {
+		case quote != 0:
+			ans.WriteByte(c)
+			if c == '\\' && i+1 < len(q) {
+				i++
+				ans.WriteByte(q[i])
+
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || singleQuotes && c == '\'':
+			quote = c
+			ans.WriteByte(c)
+		case c == '$' && i+1 < len(q) && isMacroNameChar(q[i+1], true):
+			j := i + 1
+			for j < len(q) && isMacroNameChar(q[j], false) {
+				j++
+			}
+			name := q[i+1 : j]
+			def, ok := macros[name]
+			if !ok {
+				ans.WriteString(q[i:j])
+				i = j - 1
+				continue
+			}
+			for _, v := range stack {
+				if v == name {
+					return "", fmt.Errorf("recursive macro $%s", name)
+				}
+			}
+			expanded, err := expandMacros(def, macros, singleQuotes, append(stack, name))
+			if err != nil {
+				return "", err
+			}
+			ans.WriteString(expanded)
+			i = j - 1
+		default:
+			ans.WriteByte(c)
+		}
+	}
+	return ans.String(), nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandMacros(t *testing.T) {
+	macros := map[string]string{
+		"NOUN":   `[pos="N.*"]`,
+		"ADJ":    `[pos="A.*"]`,
+		"ADJ_NP": `$ADJ $NOUN`,
+	}
+	ans, err := ExpandMacros(`[word="big"] $NOUN`, macros, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `[word="big"] [pos="N.*"]`, ans)
+	ans, err = ExpandMacros(`$ADJ_NP`, macros, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `[pos="A.*"] [pos="N.*"]`, ans)
+}
+
+func TestExpandMacrosKeepsQuotedAndLiteral(t *testing.T) {
+	macros := map[string]string{"NOUN": `[pos="N.*"]`}
+	ans, err := ExpandMacros(`[word="$NOUN"] [word='a\'$NOUN'] $ 5$`, macros, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `[word="$NOUN"] [word='a\'$NOUN'] $ 5$`, ans)
+	ans, err = ExpandMacros(`$NOUN`, nil, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `$NOUN`, ans)
+}
+
+func TestExpandMacrosKeepsUndefined(t *testing.T) {
+	macros := map[string]string{"NOUN": `[pos="N.*"]`}
+	ans, err := ExpandMacros(`$NOUNS cost $USD $NOUN`, macros, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `$NOUNS cost $USD [pos="N.*"]`, ans)
+}
+
+func TestExpandMacrosSingleQuoteInBasicQuery(t *testing.T) {
+	macros := map[string]string{"NOUN": `[pos="N.*"]`}
+	ans, err := ExpandMacros(`rock'n'roll $NOUN it's`, macros, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `rock'n'roll [pos="N.*"] it's`, ans)
+	ans, err = ExpandMacros(`"it's $NOUN"`, macros, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `"it's $NOUN"`, ans)
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	macros := map[string]string{
+		"A": `$B`,
+		"B": `[word="x"] $A`,
+		"C": `$D`,
+	}
+	_, err := ExpandMacros(`$A`, macros, true)
+	assert.EqualError(t, err, "recursive macro $A")
+	ans, err := ExpandMacros(`$C`, macros, true)
+	assert.NoError(t, err)
+	assert.Equal(t, `$D`, ans)
+}
+
+func TestIsValidMacroName(t *testing.T) {
+	assert.True(t, IsValidMacroName("NOUN_2"))
+	assert.False(t, IsValidMacroName("2NOUN"))
+	assert.False(t, IsValidMacroName("NO-UN"))
+	assert.False(t, IsValidMacroName(""))
+}
@@ -0,0 +1,66 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"strings"
+	"unicode"
+)
+
+// typographicQuotes contains double quotation marks clients
+// often use instead of the ASCII one. Single quotes, primes and
+// guillemets are not included as they are often part of the searched
+// text (e.g. apostrophes).
+var typographicQuotes = map[rune]bool{
+	'“': true, // left double quotation mark
+	'”': true, // right double quotation mark
+	'„': true, // double low-9 quotation mark
+	'‟': true, // double high-reversed-9 quotation mark
+}
+
+func isTermBoundary(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '='
+}
+
+// replaceQuotes replaces typographic double quotes delimiting terms
+// (i.e. the ones placed at the beginning or at the end of a term)
+// by ASCII ones. Quotes inside terms are kept as they are part
+// of the searched text.
+func replaceQuotes(q string) string {
+	runes := []rune(q)
+	for i, r := range runes {
+		if !typographicQuotes[r] {
+			continue
+		}
+		if i == 0 || isTermBoundary(runes[i-1]) ||
+			i == len(runes)-1 || isTermBoundary(runes[i+1]) {
+			runes[i] = '"'
+		}
+	}
+	return string(runes)
+}
+
+// NormalizeQuery fixes common problems of queries copy-pasted
+// from text editors and web pages - it replaces all the Unicode
+// spaces (e.g. NBSP) with a single ASCII space, trims the query
+// and replaces typographic double quotes delimiting terms with ASCII ones.
+func NormalizeQuery(q string) string {
+	q = strings.Join(strings.FieldsFunc(q, unicode.IsSpace), " ")
+	return replaceQuotes(q)
+}
@@ -0,0 +1,37 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, `"grumpy cat" AND dog`, NormalizeQuery(" „grumpy  cat“ AND\tdog \n"))
+	assert.Equal(t, `‘cat’`, NormalizeQuery("‘cat’"))
+	assert.Equal(t, `don’t`, NormalizeQuery("don’t"))
+	assert.Equal(t, `«chat»`, NormalizeQuery("«chat»"))
+	assert.Equal(t, `("cat" OR dog)`, NormalizeQuery("(“cat” OR dog)"))
+	assert.Equal(t, `word="cat"`, NormalizeQuery("word=„cat“"))
+	assert.Equal(t, `a„b`, NormalizeQuery("a„b"))
+	assert.Equal(t, `cat dog`, NormalizeQuery("cat\u00a0dog"))
+	assert.Equal(t, `cat`, NormalizeQuery(`cat`))
+}
@@ -25,13 +25,27 @@ import (
 	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 )
 
+// layerPrefixRegexp matches the `layer:value` shorthand
+// (e.g. `lemma:dog`) allowing users to search a specific layer.
+// The shorthand applies only to unquoted terms so e.g. `"10:30"`
+// can be searched as is.
+var layerPrefixRegexp = regexp.MustCompile(`^([A-Za-z]+):(.+)$`)
+
 type Query struct {
 	binaryOperatorQuery *binaryOperatorQuery
 	structureMapping    corpus.StructureMapping
 	posAttrs            []corpus.PosAttr
 	errors              []error
+
+	// fuzzyDistance specifies max. edit distance of matched words.
+	// Zero means exact matching.
+	fuzzyDistance int
+
+	// src is the original query (used to export node positions)
+	src string
 }
 
 func (q *Query) getDefaultAttrsExp(word string, negated bool) string {
@@ -63,6 +77,34 @@ func (q *Query) getDefaultAttrsExp(word string, negated bool) string {
 	return "[" + ans.String() + "]"
 }
 
+// getWordExp generates a token expression for an unquoted word which
+// is either matched against the basic search attributes or, in case
+// of the `layer:value` shorthand, against the layer's attribute.
+func (q *Query) getWordExp(w *word, negated bool) string {
+	if m := layerPrefixRegexp.FindStringSubmatch(w.value); m != nil {
+		return q.getLayerAttrExp(corpus.LayerType(strings.ToLower(m[1])), &word{value: m[2]}, negated)
+	}
+	return q.getDefaultAttrsExp(w.Generate(q), negated)
+}
+
+func (q *Query) getLayerAttrExp(layer corpus.LayerType, w *word, negated bool) string {
+	if err := layer.Validate(); err != nil {
+		q.AddError(fmt.Errorf("unknown layer prefix `%s:` (use e.g. `lemma:value`)", layer))
+		return "??"
+	}
+	for _, p := range q.posAttrs {
+		if p.Layer == layer && p.IsLayerDefault {
+			op := "="
+			if negated {
+				op = "!="
+			}
+			return fmt.Sprintf(`[%s%s"%s"]`, p.Name, op, w.Generate(q))
+		}
+	}
+	q.AddError(fmt.Errorf("layer %s is not supported by the resource", layer))
+	return "??"
+}
+
 func (q *Query) SetStructureMapping(m corpus.StructureMapping) *Query {
 	q.structureMapping = m
 	return q
@@ -73,6 +115,13 @@ func (q *Query) SetPosAttrs(attrs []corpus.PosAttr) *Query {
 	return q
 }
 
+// SetFuzzyDistance enables approximate matching of words
+// within the provided edit (Levenshtein) distance
+func (q *Query) SetFuzzyDistance(dist int) *Query {
+	q.fuzzyDistance = dist
+	return q
+}
+
 func (q *Query) TranslateWithinCtx(v string) string {
 	switch v {
 	case "sentence", "s":
@@ -94,7 +143,7 @@ func (q *Query) TranslateWithinCtx(v string) string {
 func (q *Query) TranslatePosAttr(qualifier, name string) string {
 	if qualifier != "" {
 		for _, p := range q.posAttrs {
-			if p.Name == qualifier && string(p.Layer) == name {
+			if p.Name == qualifier && string(p.Layer) == name && p.IsExposed() {
 				return p.Name
 			}
 		}
@@ -110,6 +159,12 @@ func (q *Query) TranslatePosAttr(qualifier, name string) string {
 	return ""
 }
 
+// RewriteAttrValue is not applicable for basic queries as they
+// do not contain any attributes.
+func (q *Query) RewriteAttrValue(qualifier, name, value string) (string, string, bool) {
+	return "", "", false
+}
+
 func (q *Query) AddError(err error) {
 	q.errors = append(q.errors, err)
 }
@@ -132,6 +187,7 @@ type binaryOperatorQueryRest struct {
 type binaryOperatorQuery struct {
 	nonRecursiveQuery *nonRecursiveQuery
 	rest              []*binaryOperatorQueryRest
+	span              compiler.Span
 }
 
 func (boq *binaryOperatorQuery) AddRest(op string, nrq *nonRecursiveQuery) {
@@ -186,6 +242,7 @@ type nonRecursiveQuery struct {
 	parenthesisExpr *parenthesisExpr
 	term            *term
 	termNegation    bool
+	span            compiler.Span
 }
 
 func (nrq *nonRecursiveQuery) Generate(ast *Query) string {
@@ -235,6 +292,7 @@ func (t *term) Generate(ast *Query, negated bool) string {
 
 type quotedText struct {
 	words []*word
+	span  compiler.Span
 }
 
 func (qt *quotedText) Generate(ast *Query, negated bool) string {
@@ -256,17 +314,30 @@ type text struct {
 }
 
 func (t *text) Generate(ast *Query, negated bool) string {
-	return ast.getDefaultAttrsExp(t.word.Generate(ast), negated)
+	return ast.getWordExp(t.word, negated)
 }
 
 // ------
 
 type word struct {
 	value string
+	span  compiler.Span
 }
 
 func (w *word) Generate(ast *Query) string {
-	tmp := w.value
+	if ast.fuzzyDistance > 0 {
+		ans, err := fuzzyRegexp(w.value, ast.fuzzyDistance)
+		if err != nil {
+			ast.AddError(err)
+			return "??"
+		}
+		return ans
+	}
+	return escapeWord(w.value)
+}
+
+func escapeWord(value string) string {
+	tmp := value
 	cqlEscapeChar := []string{"\"", "\\"}
 	for _, v := range cqlEscapeChar {
 		tmp = strings.ReplaceAll(tmp, v, "\\"+v)
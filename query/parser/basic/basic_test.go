@@ -20,8 +20,12 @@ package basic
 
 import (
 	"fmt"
+	"regexp"
 	"testing"
 
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +49,124 @@ func TestBasicParser(t *testing.T) {
 
 	}
 }
+
+func TestFuzzyWordMatching(t *testing.T) {
+	ans, err := Parse("test_fuzzy", []byte(`cat`))
+	assert.NoError(t, err)
+	q := ans.(*Query).
+		SetPosAttrs([]corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}}).
+		SetFuzzyDistance(1)
+	assert.Equal(
+		t,
+		`[word="(cat|.cat|at|.at|c.at|ct|c.t|ca.t|ca|ca.|cat.)"]`,
+		q.Generate(),
+	)
+	assert.Empty(t, q.Errors())
+}
+
+func TestFuzzyVariantsMatchWithinDistance(t *testing.T) {
+	rx, err := fuzzyRegexp("house", 2)
+	assert.NoError(t, err)
+	re := regexp.MustCompile("^" + rx + "$")
+	for _, w := range []string{"house", "hous", "hose", "mouse", "houses", "hause", "hus", "hoouse", "ouse", "mouses"} {
+		assert.True(t, re.MatchString(w), w)
+	}
+	for _, w := range []string{"hovel", "hs", "housesss", "mice"} {
+		assert.False(t, re.MatchString(w), w)
+	}
+}
+
+func TestFuzzyTooLongWord(t *testing.T) {
+	_, err := fuzzyRegexp("antidisestablishmentarianism", 2)
+	assert.Error(t, err)
+}
+
+func TestTokenBasedQueryIsRejected(t *testing.T) {
+	for _, q := range []string{
+		`[]`,
+		`[ ]`,
+		`[]{3}`,
+		`[word="a"] [] [word="b"]`,
+		`dog [] cat`,
+		`dog []`,
+		`[] "black cat"`,
+		`dog AND [word="cat"]`,
+	} {
+		_, err := ParseQuery(q, []corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}}, corpus.StructureMapping{})
+		assert.ErrorContains(t, err, "queryType=fcs", q)
+	}
+}
+
+func TestLayerPrefixShorthand(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+		{Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+		{Name: "upos", Layer: corpus.LayerTypePOS, IsLayerDefault: true},
+	}
+	q, err := ParseQuery(`lemma:dog AND pos:NOUN`, posAttrs, corpus.StructureMapping{SentenceStruct: "s"})
+	assert.NoError(t, err)
+	cql := q.Generate()
+	assert.Empty(t, q.Errors())
+	assert.Contains(t, cql, `[lemma="dog"]`)
+	assert.Contains(t, cql, `[upos="NOUN"]`)
+
+	q, err = ParseQuery(`NOT Lemma:dog`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	assert.Equal(t, `[lemma!="dog"]`, q.Generate())
+	assert.Empty(t, q.Errors())
+}
+
+func TestLayerPrefixIgnoredInQuotes(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+		{Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+	}
+	q, err := ParseQuery(`"lemma:dog"`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	assert.Contains(t, q.Generate(), `[word="lemma:dog"]`)
+	assert.Empty(t, q.Errors())
+
+	q, err = ParseQuery(`"at 10:30"`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	phrase := q.Tree().Children[0]
+	assert.Equal(t, "phrase", phrase.Type)
+	assert.Equal(t, "word", phrase.Children[1].Type)
+	assert.Equal(t, "10:30", phrase.Children[1].Value)
+}
+
+func TestLayerPrefixShorthandErrors(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+	}
+	q, err := ParseQuery(`foo:dog`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	q.Generate()
+	assert.ErrorContains(t, q.Errors()[0], "unknown layer prefix")
+
+	q, err = ParseQuery(`lemma:dog`, posAttrs, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	q.Generate()
+	assert.ErrorContains(t, q.Errors()[0], "not supported")
+}
+
+func TestQueryTree(t *testing.T) {
+	q, err := ParseQuery(`"grumpy cat" AND NOT lemma:dog`, nil, corpus.StructureMapping{})
+	assert.NoError(t, err)
+	and := q.Tree().Children[0]
+	assert.Equal(t, "and", and.Type)
+	assert.Len(t, and.Children, 2)
+
+	phrase := and.Children[0]
+	assert.Equal(t, "phrase", phrase.Type)
+	assert.Equal(t, &compiler.Span{Start: 0, End: 12}, phrase.Span)
+	assert.Equal(t, "cat", phrase.Children[1].Value)
+	assert.Equal(t, &compiler.Span{Start: 8, End: 11}, phrase.Children[1].Span)
+
+	not := and.Children[1]
+	assert.Equal(t, "not", not.Type)
+	layer := not.Children[0]
+	assert.Equal(t, "layer", layer.Type)
+	assert.Equal(t, "lemma", layer.Value)
+	assert.Equal(t, "dog", layer.Children[0].Value)
+	assert.Equal(t, &compiler.Span{Start: 27, End: 30}, layer.Children[0].Span)
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package basic
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxFuzzyVariants limits number of variants a fuzzy word
+	// can be expanded to (longer words and/or larger distances
+	// produce very large regular expressions)
+	MaxFuzzyVariants = 1000
+
+	fuzzyAnyChar = "."
+)
+
+// fuzzyVariants generates all the patterns matching words within
+// the provided edit (Levenshtein) distance of the `value`.
+// Each pattern is a list of items where each item is either
+// an (escaped) character or a placeholder for any character.
+func fuzzyVariants(value string, dist int) ([][]string, error) {
+	orig := make([]string, 0, len(value))
+	for _, r := range value {
+		orig = append(orig, escapeWord(string(r)))
+	}
+	ans := [][]string{orig}
+	used := map[string]bool{strings.Join(orig, ""): true}
+	add := func(v []string) bool {
+		key := strings.Join(v, "")
+		if key == "" || used[key] {
+			return true
+		}
+		used[key] = true
+		ans = append(ans, v)
+		return len(ans) <= MaxFuzzyVariants
+	}
+	level := ans
+	for d := 0; d < dist; d++ {
+		numPrev := len(ans)
+		for _, pattern := range level {
+			for i := 0; i <= len(pattern); i++ {
+				// insertion
+				v := make([]string, 0, len(pattern)+1)
+				v = append(append(append(v, pattern[:i]...), fuzzyAnyChar), pattern[i:]...)
+				ok := add(v)
+				if i < len(pattern) {
+					// deletion
+					v = make([]string, 0, len(pattern)-1)
+					v = append(append(v, pattern[:i]...), pattern[i+1:]...)
+					ok = ok && add(v)
+					// substitution
+					if pattern[i] != fuzzyAnyChar {
+						v = make([]string, 0, len(pattern))
+						v = append(append(append(v, pattern[:i]...), fuzzyAnyChar), pattern[i+1:]...)
+						ok = ok && add(v)
+					}
+				}
+				if !ok {
+					return nil, fmt.Errorf(
+						"word '%s' is too long for fuzzy matching with distance %d", value, dist)
+				}
+			}
+		}
+		level = ans[numPrev:]
+	}
+	return ans, nil
+}
+
+// fuzzyRegexp generates a regular expression matching words
+// within the provided edit distance of the `value`.
+func fuzzyRegexp(value string, dist int) (string, error) {
+	variants, err := fuzzyVariants(value, dist)
+	if err != nil {
+		return "", err
+	}
+	items := make([]string, len(variants))
+	for i, v := range variants {
+		items[i] = strings.Join(v, "")
+	}
+	return "(" + strings.Join(items, "|") + ")", nil
+}
@@ -20,6 +20,7 @@ package basic
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
 )
@@ -33,12 +34,18 @@ func ParseQuery(
 ) (*Query, error) {
 	ans, err := Parse("query", []byte(q)) // Debug(true))
 	if err != nil {
+		if strings.ContainsAny(q, "[]") {
+			// probably a token based query (e.g. `[word="a"] [] [word="b"]`)
+			return nil, fmt.Errorf(
+				"token based queries are supported only by the advanced search (queryType=fcs): %w", err)
+		}
 		return nil, err
 	}
 	tAns, ok := ans.(*Query)
 	if !ok {
 		return nil, fmt.Errorf("invalid AST type produced by parser")
 	}
+	tAns.src = q
 	tAns.
 		SetStructureMapping(smapping).
 		SetPosAttrs(posAttrs)
@@ -0,0 +1,113 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package basic
+
+import (
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/query/compiler"
+)
+
+// Tree exports the structure of the parsed query with positions
+// (in characters) of its parts.
+func (q *Query) Tree() *compiler.Node {
+	return &compiler.Node{
+		Type:     "query",
+		Span:     &compiler.Span{Start: 0, End: len([]rune(q.src))},
+		Children: []*compiler.Node{q.binaryOperatorQuery.tree(q.src)},
+	}
+}
+
+func (boq *binaryOperatorQuery) tree(src string) *compiler.Node {
+	if len(boq.rest) == 0 {
+		return boq.nonRecursiveQuery.tree(src)
+	}
+	// note: just like in Generate, the first operator applies to all the operands
+	ans := &compiler.Node{
+		Type:     strings.ToLower(boq.operatorAt(0)),
+		Span:     compiler.CharSpan(src, boq.span),
+		Children: []*compiler.Node{boq.nonRecursiveQuery.tree(src)},
+	}
+	for _, v := range boq.rest {
+		ans.Children = append(ans.Children, v.nonRecursiveQuery.tree(src))
+	}
+	return ans
+}
+
+func (nrq *nonRecursiveQuery) tree(src string) *compiler.Node {
+	if nrq.parenthesisExpr != nil {
+		return &compiler.Node{
+			Type:     "group",
+			Span:     compiler.CharSpan(src, nrq.span),
+			Children: []*compiler.Node{nrq.parenthesisExpr.binaryOperatorQuery.tree(src)},
+		}
+	}
+	if nrq.termNegation {
+		return &compiler.Node{
+			Type:     "not",
+			Span:     compiler.CharSpan(src, nrq.span),
+			Children: []*compiler.Node{nrq.term.tree(src)},
+		}
+	}
+	return nrq.term.tree(src)
+}
+
+func (t *term) tree(src string) *compiler.Node {
+	if t.quotedText != nil {
+		ans := &compiler.Node{
+			Type: "phrase",
+			Span: compiler.CharSpan(src, t.quotedText.span),
+		}
+		for _, w := range t.quotedText.words {
+			ans.Children = append(ans.Children, w.tree(src))
+		}
+		return ans
+	}
+	return t.text.tree(src)
+}
+
+// tree returns a node of the unquoted word. In case of the `layer:value`
+// shorthand, the word is wrapped in a node of the layer.
+func (t *text) tree(src string) *compiler.Node {
+	w := t.word
+	if m := layerPrefixRegexp.FindStringSubmatch(w.value); m != nil {
+		valueStart := w.span.Start + len(m[1]) + 1
+		return &compiler.Node{
+			Type:  "layer",
+			Value: strings.ToLower(m[1]),
+			Span:  compiler.CharSpan(src, w.span),
+			Children: []*compiler.Node{
+				{
+					Type:  "word",
+					Value: m[2],
+					Span:  compiler.CharSpan(src, compiler.Span{Start: valueStart, End: w.span.End}),
+				},
+			},
+		}
+	}
+	return w.tree(src)
+}
+
+func (w *word) tree(src string) *compiler.Node {
+	return &compiler.Node{
+		Type:  "word",
+		Value: w.value,
+		Span:  compiler.CharSpan(src, w.span),
+	}
+}
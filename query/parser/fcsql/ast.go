@@ -19,10 +19,12 @@
 package fcsql
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query"
 	"github.com/czcorpus/mquery-sru/query/compiler"
 
 	"github.com/rs/zerolog/log"
@@ -32,10 +34,17 @@ const (
 	mainQueryOpNone mainQueryOp = iota
 	mainQueryOpSequence
 	mainQueryOpOr
+	mainQueryOpProx
 
 	basicExpressionTypeGroup beType = iota
 	basicExpressionTypeNot
 	basicExpressionTypeAttrOpRegexp
+
+	proxUnitWord = "word"
+
+	// MaxProxDistance is the max. supported distance (in tokens)
+	// of proximity search operands
+	MaxProxDistance = 50
 )
 
 type mainQueryOp int
@@ -47,9 +56,14 @@ type beType int
 type Query struct {
 	mainQuery        *mainQuery
 	within           *withinPart
+	sortKeys         []SortKey
 	structureMapping corpus.StructureMapping
 	posAttrs         []corpus.PosAttr
+	rewriteRules     []corpus.QueryRewriteRule
 	errors           []error
+
+	// src is the original query (used to export node positions)
+	src string
 }
 
 func (q *Query) SetStructureMapping(m corpus.StructureMapping) *Query {
@@ -62,6 +76,11 @@ func (q *Query) SetPosAttrs(attrs []corpus.PosAttr) *Query {
 	return q
 }
 
+func (q *Query) SetRewriteRules(rules []corpus.QueryRewriteRule) *Query {
+	q.rewriteRules = rules
+	return q
+}
+
 func (q *Query) TranslateWithinCtx(v string) string {
 	switch v {
 	case "sentence", "s":
@@ -86,7 +105,7 @@ func (q *Query) TranslateWithinCtx(v string) string {
 func (q *Query) TranslatePosAttr(qualifier, name string) string {
 	if qualifier != "" {
 		for _, p := range q.posAttrs {
-			if p.Name == qualifier && (string(p.Layer) == name || p.Layer == "text" && name == "word") {
+			if p.Name == qualifier && (string(p.Layer) == name || p.Layer == "text" && name == "word") && p.IsExposed() {
 				return p.Name
 			}
 		}
@@ -102,6 +121,17 @@ func (q *Query) TranslatePosAttr(qualifier, name string) string {
 	return ""
 }
 
+// RewriteAttrValue finds a rewrite rule matching provided attribute
+// and value and returns a resource specific attribute and value.
+func (q *Query) RewriteAttrValue(qualifier, name, value string) (string, string, bool) {
+	for _, rule := range q.rewriteRules {
+		if rule.Matches(qualifier, name, value) {
+			return rule.TargetAttr, rule.TargetValue, true
+		}
+	}
+	return "", "", false
+}
+
 func (q *Query) AddError(err error) {
 	q.errors = append(q.errors, err)
 }
@@ -110,6 +140,27 @@ func (q *Query) Errors() []error {
 	return q.errors
 }
 
+// MatchesAnyToken tells whether the query has no restriction
+// on tokens (e.g. `[]`, `[]{3}`, `[] | "dog"`) and would match
+// each position of a corpus.
+func (q *Query) MatchesAnyToken() bool {
+	return q.mainQuery.matchesAnyToken()
+}
+
+// IsUnbounded tells whether the query (heuristically) matches
+// (almost) any token, e.g. `[word=".*"]` or `"a|"`. Unlike with
+// MatchesAnyToken, such queries are syntactically restricted
+// so it is up to the caller whether to accept them.
+func (q *Query) IsUnbounded() bool {
+	return q.mainQuery.isUnbounded()
+}
+
+// SortKeys returns keys of the CQL-like `sortBy` clause
+// (if present in the query)
+func (q *Query) SortKeys() []SortKey {
+	return q.sortKeys
+}
+
 func (q *Query) Generate() string {
 	q.errors = make([]error, 0, 20)
 	if q.within != nil {
@@ -127,6 +178,22 @@ func (q *Query) Generate() string {
 type quantifiedQuery struct {
 	basicQuery *basicQuery
 	quantifier string
+	span       compiler.Span
+}
+
+func (qq *quantifiedQuery) matchesAnyToken() bool {
+	return qq.basicQuery.matchesAnyToken()
+}
+
+func (qq *quantifiedQuery) isUnbounded() bool {
+	return qq.basicQuery.isUnbounded()
+}
+
+// isSingleToken tells whether the query always matches
+// a single token (i.e. a segment or an implicit query
+// with no quantifier)
+func (qq *quantifiedQuery) isSingleToken() bool {
+	return qq.quantifier == "" && qq.basicQuery.GetInnerQuery() == nil
 }
 
 func (qq *quantifiedQuery) Generate(ast compiler.AST) string {
@@ -142,6 +209,45 @@ type mainQuery struct {
 	quantifiedQuery *quantifiedQuery
 	mainQuery       *mainQuery
 	operator        mainQueryOp
+	prox            *proxSpec
+	span            compiler.Span
+}
+
+// matchesAnyToken tells whether the query matches any token.
+// A sequence (or a proximity search) requires all of its items
+// to be unrestricted while for an alternative, one unrestricted
+// item is enough.
+func (mq *mainQuery) matchesAnyToken() bool {
+	switch mq.operator {
+	case mainQueryOpNone:
+		return mq.quantifiedQuery.matchesAnyToken()
+	case mainQueryOpSequence, mainQueryOpProx:
+		return mq.quantifiedQuery.matchesAnyToken() && mq.mainQuery.matchesAnyToken()
+	case mainQueryOpOr:
+		return mq.quantifiedQuery.matchesAnyToken() || mq.mainQuery.matchesAnyToken()
+	default:
+		return false
+	}
+}
+
+// isUnbounded works like matchesAnyToken but it also takes
+// trivially unbounded regular expressions into account
+func (mq *mainQuery) isUnbounded() bool {
+	switch mq.operator {
+	case mainQueryOpNone:
+		return mq.quantifiedQuery.isUnbounded()
+	case mainQueryOpSequence, mainQueryOpProx:
+		return mq.quantifiedQuery.isUnbounded() && mq.mainQuery.isUnbounded()
+	case mainQueryOpOr:
+		return mq.quantifiedQuery.isUnbounded() || mq.mainQuery.isUnbounded()
+	default:
+		return false
+	}
+}
+
+// isSingleToken tells whether the query always matches a single token
+func (mq *mainQuery) isSingleToken() bool {
+	return mq.operator == mainQueryOpNone && mq.quantifiedQuery.isSingleToken()
 }
 
 func (mq *mainQuery) Generate(ast compiler.AST) string {
@@ -154,6 +260,17 @@ func (mq *mainQuery) Generate(ast compiler.AST) string {
 	case mainQueryOpOr:
 		return fmt.Sprintf(
 			"%s | %s", mq.quantifiedQuery.Generate(ast), mq.mainQuery.Generate(ast))
+	case mainQueryOpProx:
+		right := mq.mainQuery.Generate(ast)
+		if mq.mainQuery.operator != mainQueryOpNone {
+			right = fmt.Sprintf("(%s)", right)
+		}
+		return mq.prox.Generate(
+			ast,
+			mq.quantifiedQuery.Generate(ast),
+			right,
+			mq.quantifiedQuery.isSingleToken() && mq.mainQuery.isSingleToken(),
+		)
 	default:
 		return "??"
 	}
@@ -161,12 +278,154 @@ func (mq *mainQuery) Generate(ast compiler.AST) string {
 
 // -------
 
+type proxModifier struct {
+	name     string
+	operator string
+	value    string
+	distance int
+}
+
+// proxSpec describes a proximity search (`A prox/distance<=3/ordered B`).
+// For the `word` unit (default), the operands are translated into Manatee's
+// `meet` operator with a respective window (the first operand is the hit).
+// As `meet` works with single positions, both operands must be single
+// tokens. For structural units (sentence, paragraph,...), the operands must
+// occur within the same structure.
+type proxSpec struct {
+	unit        string
+	distanceOp  string
+	distance    int
+	hasDistance bool
+	ordered     bool
+}
+
+func (ps *proxSpec) AttachUntypedModifier(v any) error {
+	mod, ok := v.(*proxModifier)
+	if !ok {
+		return fmt.Errorf("invalid value for proximity modifier: %v", v)
+	}
+	switch mod.name {
+	case "distance":
+		ps.distanceOp = mod.operator
+		ps.distance = mod.distance
+		ps.hasDistance = true
+	case "unit":
+		ps.unit = mod.value
+	case "ordered":
+		ps.ordered = true
+	case "unordered":
+		ps.ordered = false
+	default:
+		return fmt.Errorf("unknown proximity modifier: %s", mod.name)
+	}
+	return nil
+}
+
+// window returns min. and max. distance (in tokens) of the second
+// operand from the first one (the first operand following the second
+// one is not covered here) of a word-based proximity search
+func (ps *proxSpec) window(ast compiler.AST) (int, int, bool) {
+	if !ps.hasDistance {
+		ast.AddError(errors.New("proximity search by words requires a distance"))
+		return 0, 0, false
+	}
+	var lo, hi int
+	switch ps.distanceOp {
+	case "<=":
+		lo, hi = 1, ps.distance
+	case "<":
+		lo, hi = 1, ps.distance-1
+	case "=":
+		lo, hi = ps.distance, ps.distance
+	}
+	if hi < 1 || ps.distance > MaxProxDistance {
+		ast.AddError(fmt.Errorf(
+			"unsupported proximity distance %s%d (max. supported distance is %d)",
+			ps.distanceOp, ps.distance, MaxProxDistance))
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// isSameStructDistance tests whether the distance (if any) means
+// "within the same structure" which is the only supported distance
+// for structural units.
+func (ps *proxSpec) isSameStructDistance() bool {
+	if !ps.hasDistance {
+		return true
+	}
+	if ps.distanceOp == "<" {
+		return ps.distance == 1
+	}
+	return ps.distance == 0
+}
+
+// Generate creates CQL for the proximity search of the `left` and `right`
+// operands. The `singleTokens` argument tells whether both the operands
+// are single tokens (which is required for the `word` unit).
+func (ps *proxSpec) Generate(ast compiler.AST, left, right string, singleTokens bool) string {
+	if ps.unit == proxUnitWord {
+		lo, hi, ok := ps.window(ast)
+		if !ok {
+			return "??"
+		}
+		if !singleTokens {
+			ast.AddError(errors.New("proximity search by words supports only single token operands"))
+			return "??"
+		}
+		if ps.ordered {
+			return fmt.Sprintf("(meet %s %s %d %d)", left, right, lo, hi)
+		}
+		return fmt.Sprintf(
+			"(union (meet %s %s %d %d) (meet %s %s %d %d))",
+			left, right, -hi, -lo, left, right, lo, hi,
+		)
+	}
+
+	if !ps.isSameStructDistance() {
+		ast.AddError(fmt.Errorf(
+			"unsupported proximity distance %s%d for unit %s (only the same structure is supported)",
+			ps.distanceOp, ps.distance, ps.unit))
+		return "??"
+	}
+	structure := ast.TranslateWithinCtx(ps.unit)
+	if structure == "" || structure == "??" {
+		ast.AddError(fmt.Errorf("no structure defined for proximity unit %s", ps.unit))
+		return "??"
+	}
+	if ps.ordered {
+		return fmt.Sprintf("(%s []* %s within <%s />)", left, right, structure)
+	}
+	return fmt.Sprintf(
+		"((%s []* %s within <%s />) | (%s []* %s within <%s />))",
+		left, right, structure, right, left, structure,
+	)
+}
+
+func newProxSpec() *proxSpec {
+	return &proxSpec{unit: proxUnitWord}
+}
+
+// -------
+
 type basicExpression struct {
 	attribute     *attribute
 	operator      string
 	expression    *expression
 	flaggedRegexp *flaggedRegexp
 	exprType      beType
+	span          compiler.Span
+}
+
+func (be *basicExpression) isUnbounded() bool {
+	switch be.exprType {
+	case basicExpressionTypeGroup:
+		return be.expression.isUnbounded()
+	case basicExpressionTypeAttrOpRegexp:
+		return be.operator == "=" && be.flaggedRegexp.isUnbounded()
+	default:
+		return false
+	}
 }
 
 func (be *basicExpression) Generate(ast compiler.AST) string {
@@ -176,6 +435,14 @@ func (be *basicExpression) Generate(ast compiler.AST) string {
 	case basicExpressionTypeNot:
 		return fmt.Sprintf("!%s", be.expression.Generate(ast))
 	case basicExpressionTypeAttrOpRegexp:
+		// rewrite rules apply only to literal values without flags
+		qs := be.flaggedRegexp.regexp.quotedString
+		if len(be.flaggedRegexp.flags) == 0 && qs.regexp == "" {
+			attr, value, ok := ast.RewriteAttrValue(be.attribute.name, be.attribute.value, qs.value)
+			if ok {
+				return fmt.Sprintf(`%s%s"%s"`, attr, be.operator, value)
+			}
+		}
 		return fmt.Sprintf(
 			"%s%s%s", be.attribute.Generate(ast), be.operator, be.flaggedRegexp.Generate(ast))
 	default:
@@ -202,6 +469,28 @@ func (e *expression) AddTailItem(operator string, value *basicExpression) {
 	)
 }
 
+// isUnbounded tells whether any of the `|` separated parts
+// of the expression (conjunctions as `&` has a higher precedence)
+// consists of unbounded expressions only
+func (e *expression) isUnbounded() bool {
+	if e == nil {
+		return false
+	}
+	conjUnbounded := e.basicExpression.isUnbounded()
+	for _, te := range e.tailValues {
+		if te.operator == "|" {
+			if conjUnbounded {
+				return true
+			}
+			conjUnbounded = te.value.isUnbounded()
+
+		} else {
+			conjUnbounded = conjUnbounded && te.value.isUnbounded()
+		}
+	}
+	return conjUnbounded
+}
+
 func (e *expression) Generate(ast compiler.AST) string {
 	if e == nil {
 		return ""
@@ -219,6 +508,7 @@ func (e *expression) Generate(ast compiler.AST) string {
 type attribute struct {
 	name  string
 	value string
+	span  compiler.Span
 }
 
 func (a *attribute) Generate(ast compiler.AST) string {
@@ -244,6 +534,15 @@ func (r *regexp) Generate(ast compiler.AST) string {
 type flaggedRegexp struct {
 	regexp *regexp
 	flags  []string
+	span   compiler.Span
+}
+
+func (fr *flaggedRegexp) isUnbounded() bool {
+	qs := fr.regexp.quotedString
+	if qs.regexp != "" {
+		return query.IsUnboundedRegexp(qs.regexp)
+	}
+	return query.IsUnboundedRegexp(qs.value)
 }
 
 func (fr *flaggedRegexp) Generate(ast compiler.AST) string {
@@ -276,6 +575,7 @@ func (fr *flaggedRegexp) AttachUntypedFlag(v any) error {
 
 type withinPart struct {
 	value string
+	span  compiler.Span
 }
 
 func (wp *withinPart) Generate(ast compiler.AST) string {
@@ -284,6 +584,23 @@ func (wp *withinPart) Generate(ast compiler.AST) string {
 
 // ----
 
+// SortKey is a single key of the `sortBy` clause
+// (e.g. `sortBy word/sort.descending`)
+type SortKey struct {
+	Index      string
+	Descending bool
+	span       compiler.Span
+}
+
+func (sk SortKey) String() string {
+	if sk.Descending {
+		return sk.Index + "/sort.descending"
+	}
+	return sk.Index
+}
+
+// ----
+
 type implicitQuery struct {
 	flaggedRegexp *flaggedRegexp
 }
@@ -298,6 +615,16 @@ type segmentQuery struct {
 	expression *expression
 }
 
+// IsEmpty tells whether the segment is the `[]` wildcard
+// matching any token
+func (wp *segmentQuery) IsEmpty() bool {
+	return wp.expression == nil
+}
+
+func (wp *segmentQuery) isUnbounded() bool {
+	return wp.IsEmpty() || wp.expression.isUnbounded()
+}
+
 func (wp *segmentQuery) Generate(ast compiler.AST) string {
 	return fmt.Sprintf("[%s]", wp.expression.Generate(ast))
 }
@@ -306,6 +633,7 @@ func (wp *segmentQuery) Generate(ast compiler.AST) string {
 
 type basicQuery struct {
 	value any
+	span  compiler.Span
 }
 
 func (sq *basicQuery) Generate(ast compiler.AST) string {
@@ -321,6 +649,29 @@ func (sq *basicQuery) Generate(ast compiler.AST) string {
 	return "??"
 }
 
+func (sq *basicQuery) isUnbounded() bool {
+	if sq.GetInnerQuery() != nil {
+		return sq.GetInnerQuery().isUnbounded()
+
+	} else if sq.GetImplicitQuery() != nil {
+		return sq.GetImplicitQuery().flaggedRegexp.isUnbounded()
+
+	} else if sq.GetSegmentQuery() != nil {
+		return sq.GetSegmentQuery().isUnbounded()
+	}
+	return false
+}
+
+func (sq *basicQuery) matchesAnyToken() bool {
+	if sq.GetInnerQuery() != nil {
+		return sq.GetInnerQuery().matchesAnyToken()
+
+	} else if sq.GetSegmentQuery() != nil {
+		return sq.GetSegmentQuery().IsEmpty()
+	}
+	return false
+}
+
 func (sq *basicQuery) GetInnerQuery() *mainQuery {
 	v, ok := sq.value.(*mainQuery)
 	if !ok {
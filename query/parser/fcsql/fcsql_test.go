@@ -22,6 +22,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,3 +53,231 @@ func TestFCSQLParser(t *testing.T) {
 
 	}
 }
+
+func TestQueryRewriteRules(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+		{ID: "id2", Name: "tag", Layer: "pos", IsLayerDefault: true},
+	}
+	rules := []corpus.QueryRewriteRule{
+		{Attr: "pos", Value: "NOUN", TargetAttr: "tag", TargetValue: "N.*"},
+		{Attr: "x:pos", Value: "ADJ", TargetAttr: "tag", TargetValue: "A.*"},
+	}
+	testCases := map[string]string{
+		`[pos = "NOUN"]`:                `[tag="N.*"]`,
+		`[pos != "NOUN"]`:               `[tag!="N.*"]`,
+		`[pos = "VERB"]`:                `[tag="VERB"]`,
+		`[x:pos = "ADJ"]`:               `[tag="A.*"]`,
+		`[pos = "ADJ"]`:                 `[tag="ADJ"]`,
+		`[word = "dog" & pos = "NOUN"]`: `[word="dog" & tag="N.*"]`,
+	}
+	for q, expected := range testCases {
+		ast, err := ParseQuery(q, posAttrs, corpus.StructureMapping{}, rules)
+		assert.NoError(t, err)
+		if ast != nil {
+			assert.Equal(t, expected, ast.Generate(), q)
+		}
+	}
+}
+
+func TestProxOperator(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+	}
+	smapping := corpus.StructureMapping{SentenceStruct: "s"}
+	testCases := map[string]string{
+		`[word="a"] prox/distance<=3/ordered [word="b"]`: `(meet [word="a"] [word="b"] 1 3)`,
+		`[word="a"] prox/distance=2/ordered [word="b"]`:  `(meet [word="a"] [word="b"] 2 2)`,
+		`[word="a"] prox/distance<2/ordered [word="b"]`:  `(meet [word="a"] [word="b"] 1 1)`,
+		`[word="a"] prox/distance<=3 [word="b"]`:         `(union (meet [word="a"] [word="b"] -3 -1) (meet [word="a"] [word="b"] 1 3))`,
+		`"a" prox/distance=2 "b"`:                        `(union (meet "a" "b" -2 -2) (meet "a" "b" 2 2))`,
+		`[word="a"] prox/unit=s/ordered [word="b"]`:      `([word="a"] []* [word="b"] within <s />)`,
+		`[word="a"] prox/unit=sentence [word="b"]`:       `(([word="a"] []* [word="b"] within <s />) | ([word="b"] []* [word="a"] within <s />))`,
+	}
+	for q, expected := range testCases {
+		ast, err := ParseQuery(q, posAttrs, smapping, []corpus.QueryRewriteRule{})
+		assert.NoError(t, err)
+		if ast != nil {
+			assert.Equal(t, expected, ast.Generate(), q)
+			assert.Empty(t, ast.Errors(), q)
+		}
+	}
+}
+
+func TestProxOperatorUnsupportedDistance(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+	}
+	smapping := corpus.StructureMapping{SentenceStruct: "s"}
+	queries := []string{
+		`[word="a"] prox [word="b"]`,
+		`[word="a"] prox/distance<=0 [word="b"]`,
+		`[word="a"] prox/distance<1 [word="b"]`,
+		`[word="a"] prox/distance<=100 [word="b"]`,
+		`[word="a"] prox/unit=s/distance<=2 [word="b"]`,
+		`[word="a"] prox/unit=p [word="b"]`,
+		`[word="a"] prox/distance<=3/ordered [word="b"] [word="c"]`,
+		`[word="a"]{2} prox/distance<=3 [word="b"]`,
+		`([word="a"] [word="b"]) prox/distance<=3 [word="c"]`,
+	}
+	for _, q := range queries {
+		ast, err := ParseQuery(q, posAttrs, smapping, []corpus.QueryRewriteRule{})
+		assert.NoError(t, err)
+		if ast != nil {
+			ast.Generate()
+			assert.NotEmpty(t, ast.Errors(), q)
+		}
+	}
+}
+
+func TestAnyTokenSegments(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+	}
+	testCases := map[string]string{
+		`[word="a"] [] [word="b"]`: `[word="a"] [] [word="b"]`,
+		`[ ] "dog"`:                `[] "dog"`,
+		`"dog" []{2,3} "cat"`:      `"dog" []{2,3} "cat"`,
+		`([]) "dog"`:               `([]) "dog"`,
+	}
+	for q, expected := range testCases {
+		ast, err := ParseQuery(q, posAttrs, corpus.StructureMapping{}, nil)
+		assert.NoError(t, err, q)
+		if ast != nil {
+			assert.Equal(t, expected, ast.Generate(), q)
+			assert.Empty(t, ast.Errors(), q)
+		}
+	}
+}
+
+func TestAnyTokenOnlyQueryIsRejected(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+	}
+	for _, q := range []string{`[]`, `[ ]`, `[]{3}`, `[] []`, `[] | "dog"`, `([])`, `[] within s`} {
+		_, err := ParseQuery(q, posAttrs, corpus.StructureMapping{}, nil)
+		assert.ErrorIs(t, err, ErrAnyTokenQuery, q)
+	}
+}
+
+func TestQueryTree(t *testing.T) {
+	q, err := ParseQuery(`"křen" [pos="NOUN" & lemma!="x"] within s`, nil, corpus.StructureMapping{}, nil)
+	assert.NoError(t, err)
+	tree := q.Tree()
+	assert.Equal(t, "query", tree.Type)
+	assert.Len(t, tree.Children, 2)
+
+	seq := tree.Children[0]
+	assert.Equal(t, "sequence", seq.Type)
+	assert.Len(t, seq.Children, 2)
+
+	implicit := seq.Children[0]
+	assert.Equal(t, "implicit", implicit.Type)
+	assert.Equal(t, 0, implicit.Span.Start)
+	assert.Equal(t, 6, implicit.Span.End) // positions are in characters
+	assert.Equal(t, "křen", implicit.Children[0].Value)
+
+	segment := seq.Children[1]
+	assert.Equal(t, "segment", segment.Type)
+	assert.Equal(t, 7, segment.Span.Start)
+	assert.Len(t, segment.Children, 3)
+	assert.Equal(t, "constraint", segment.Children[0].Type)
+	assert.Equal(t, "=", segment.Children[0].Value)
+	assert.Equal(t, "pos", segment.Children[0].Children[0].Value)
+	assert.Equal(t, &compiler.Span{Start: 8, End: 11}, segment.Children[0].Children[0].Span)
+	assert.Equal(t, "NOUN", segment.Children[0].Children[1].Value)
+	assert.Equal(t, "&", segment.Children[1].Value)
+	assert.Equal(t, "!=", segment.Children[2].Value)
+
+	within := tree.Children[1]
+	assert.Equal(t, "within", within.Type)
+	assert.Equal(t, "s", within.Value)
+}
+
+func TestQueryTreeFlattensAlternatives(t *testing.T) {
+	q, err := ParseQuery(`"a" | "b" | "c"`, nil, corpus.StructureMapping{}, nil)
+	assert.NoError(t, err)
+	or := q.Tree().Children[0]
+	assert.Equal(t, "or", or.Type)
+	assert.Len(t, or.Children, 3)
+}
+
+func TestSortBySingleKey(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{ID: "id1", Name: "word", Layer: "text", IsLayerDefault: true},
+	}
+	q, err := ParseQuery(`[word="dog"] sortBy lemma`, posAttrs, corpus.StructureMapping{}, nil)
+	assert.NoError(t, err)
+	if q != nil {
+		assert.Equal(t, []string{"lemma"}, sortKeysAsStrings(q.SortKeys()))
+		assert.Equal(t, `[word="dog"]`, q.Generate())
+		assert.Empty(t, q.Errors())
+	}
+}
+
+func TestSortByMultipleKeys(t *testing.T) {
+	q, err := ParseQuery(
+		`"dog" within s sortBy word/sort.descending fcs.pos dc.title/sort.ascending`,
+		nil, corpus.StructureMapping{SentenceStruct: "s"}, nil)
+	assert.NoError(t, err)
+	if q != nil {
+		assert.Equal(
+			t,
+			[]string{"word/sort.descending", "fcs.pos", "dc.title"},
+			sortKeysAsStrings(q.SortKeys()),
+		)
+		assert.Equal(t, `"dog" within <s />`, q.Generate())
+		sortBy := q.Tree().Children[2]
+		assert.Equal(t, "sortBy", sortBy.Type)
+		assert.Len(t, sortBy.Children, 3)
+	}
+}
+
+func TestSortByWithoutKeysIsRejected(t *testing.T) {
+	_, err := ParseQuery(`"dog" sortBy`, nil, corpus.StructureMapping{}, nil)
+	assert.Error(t, err)
+}
+
+func sortKeysAsStrings(keys []SortKey) []string {
+	ans := make([]string, len(keys))
+	for i, k := range keys {
+		ans[i] = k.String()
+	}
+	return ans
+}
+
+func TestUnboundedQueries(t *testing.T) {
+	for _, q := range []string{
+		`[word=".*"]`,
+		`".*"`,
+		`[word=".+" & lemma=".*"]`,
+		`[word="dog" | lemma=".*"]`,
+		`[(word=".*")]`,
+		`[word="dog|"]`,
+		`".*" ".*" within s`,
+		`"dog" | [lemma=".*"]`,
+	} {
+		ast, err := ParseQuery(q, nil, corpus.StructureMapping{}, nil)
+		assert.NoError(t, err, q)
+		if ast != nil {
+			assert.True(t, ast.IsUnbounded(), q)
+		}
+	}
+}
+
+func TestBoundedQueries(t *testing.T) {
+	for _, q := range []string{
+		`[word="dog.*"]`,
+		`"dog" [word=".*"]`,
+		`[word=".*" & lemma="dog"]`,
+		`[word!=".*"]`,
+		`[!word=".*"]`,
+		`"dog|cat"`,
+	} {
+		ast, err := ParseQuery(q, nil, corpus.StructureMapping{}, nil)
+		assert.NoError(t, err, q)
+		if ast != nil {
+			assert.False(t, ast.IsUnbounded(), q)
+		}
+	}
+}
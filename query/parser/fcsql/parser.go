@@ -19,17 +19,30 @@
 package fcsql
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/czcorpus/mquery-sru/corpus"
 )
 
+// ErrAnyTokenQuery is returned for queries with no restriction
+// on tokens (e.g. a bare `[]`) as they would match whole corpora
+var ErrAnyTokenQuery = errors.New(
+	"query must contain at least one restricted token (a bare `[]` matches any token)")
+
+// ErrUnboundedQuery is returned by callers rejecting queries
+// matching (almost) any token via a regular expression
+// (see Query.IsUnbounded)
+var ErrUnboundedQuery = errors.New(
+	"query must contain at least one token restricted by a bounded pattern (e.g. `[word=\".*\"]` matches any token)")
+
 // ParseQuery parses FCS-QL and returns an abstract syntax
 // tree which can be used to generate CQL.
 func ParseQuery(
 	q string,
 	posAttrs []corpus.PosAttr,
 	smapping corpus.StructureMapping,
+	rewriteRules []corpus.QueryRewriteRule,
 ) (*Query, error) {
 	ans, err := Parse("query", []byte(q)) // Debug(true))
 	if err != nil {
@@ -39,8 +52,13 @@ func ParseQuery(
 	if !ok {
 		return nil, fmt.Errorf("invalid AST type produced by parser")
 	}
+	tAns.src = q
+	if tAns.MatchesAnyToken() {
+		return nil, ErrAnyTokenQuery
+	}
 	tAns.
 		SetStructureMapping(smapping).
-		SetPosAttrs(posAttrs)
+		SetPosAttrs(posAttrs).
+		SetRewriteRules(rewriteRules)
 	return tAns, nil
 }
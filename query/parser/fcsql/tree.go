@@ -0,0 +1,169 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package fcsql
+
+import (
+	"github.com/czcorpus/mquery-sru/query/compiler"
+)
+
+// Tree exports the structure of the parsed query with positions
+// (in characters) of its parts. Sequences, alternatives and proximity
+// searches are flattened so each of them is represented by a single
+// node with all its operands as children.
+func (q *Query) Tree() *compiler.Node {
+	ans := &compiler.Node{
+		Type: "query",
+		Span: &compiler.Span{Start: 0, End: len([]rune(q.src))},
+	}
+	ans.Children = append(ans.Children, q.mainQuery.tree(q.src))
+	if q.within != nil {
+		ans.Children = append(ans.Children, &compiler.Node{
+			Type:  "within",
+			Value: q.within.value,
+			Span:  compiler.CharSpan(q.src, q.within.span),
+		})
+	}
+	if len(q.sortKeys) > 0 {
+		sortBy := &compiler.Node{Type: "sortBy"}
+		for _, key := range q.sortKeys {
+			sortBy.Children = append(sortBy.Children, &compiler.Node{
+				Type:  "sortKey",
+				Value: key.String(),
+				Span:  compiler.CharSpan(q.src, key.span),
+			})
+		}
+		ans.Children = append(ans.Children, sortBy)
+	}
+	return ans
+}
+
+func (mq *mainQuery) tree(src string) *compiler.Node {
+	var typ string
+	switch mq.operator {
+	case mainQueryOpNone:
+		return mq.quantifiedQuery.tree(src)
+	case mainQueryOpSequence:
+		typ = "sequence"
+	case mainQueryOpOr:
+		typ = "or"
+	case mainQueryOpProx:
+		typ = "prox"
+	}
+	ans := &compiler.Node{Type: typ, Span: compiler.CharSpan(src, mq.span)}
+	curr := mq
+	for {
+		ans.Children = append(ans.Children, curr.quantifiedQuery.tree(src))
+		// proximity searches have their own modifiers so they are not flattened
+		if curr.mainQuery.operator != mq.operator || mq.operator == mainQueryOpProx {
+			ans.Children = append(ans.Children, curr.mainQuery.tree(src))
+			break
+		}
+		curr = curr.mainQuery
+	}
+	return ans
+}
+
+func (qq *quantifiedQuery) tree(src string) *compiler.Node {
+	if qq.quantifier == "" {
+		return qq.basicQuery.tree(src)
+	}
+	return &compiler.Node{
+		Type:     "quantified",
+		Value:    qq.quantifier,
+		Span:     compiler.CharSpan(src, qq.span),
+		Children: []*compiler.Node{qq.basicQuery.tree(src)},
+	}
+}
+
+func (sq *basicQuery) tree(src string) *compiler.Node {
+	ans := &compiler.Node{Span: compiler.CharSpan(src, sq.span)}
+	if inner := sq.GetInnerQuery(); inner != nil {
+		ans.Type = "group"
+		ans.Children = []*compiler.Node{inner.tree(src)}
+
+	} else if implicit := sq.GetImplicitQuery(); implicit != nil {
+		ans.Type = "implicit"
+		ans.Children = []*compiler.Node{implicit.flaggedRegexp.tree(src)}
+
+	} else if segment := sq.GetSegmentQuery(); segment != nil {
+		ans.Type = "segment"
+		if !segment.IsEmpty() {
+			ans.Children = segment.expression.tree(src)
+		}
+	}
+	return ans
+}
+
+// tree returns nodes of the expression's operands separated
+// by nodes of the boolean operators (`&`, `|`)
+func (e *expression) tree(src string) []*compiler.Node {
+	ans := []*compiler.Node{e.basicExpression.tree(src)}
+	for _, item := range e.tailValues {
+		ans = append(
+			ans,
+			&compiler.Node{Type: "operator", Value: item.operator},
+			item.value.tree(src),
+		)
+	}
+	return ans
+}
+
+func (be *basicExpression) tree(src string) *compiler.Node {
+	ans := &compiler.Node{Span: compiler.CharSpan(src, be.span)}
+	switch be.exprType {
+	case basicExpressionTypeGroup:
+		ans.Type = "group"
+		ans.Children = be.expression.tree(src)
+	case basicExpressionTypeNot:
+		ans.Type = "not"
+		ans.Children = be.expression.tree(src)
+	case basicExpressionTypeAttrOpRegexp:
+		ans.Type = "constraint"
+		ans.Value = be.operator
+		attrName := be.attribute.value
+		if be.attribute.name != "" {
+			attrName = be.attribute.name + ":" + be.attribute.value
+		}
+		ans.Children = []*compiler.Node{
+			{
+				Type:  "attribute",
+				Value: attrName,
+				Span:  compiler.CharSpan(src, be.attribute.span),
+			},
+			be.flaggedRegexp.tree(src),
+		}
+	}
+	return ans
+}
+
+func (fr *flaggedRegexp) tree(src string) *compiler.Node {
+	value := fr.regexp.quotedString.value
+	if fr.regexp.quotedString.regexp != "" {
+		value = fr.regexp.quotedString.regexp
+	}
+	ans := &compiler.Node{
+		Type:  "regexp",
+		Value: value,
+		Span:  compiler.CharSpan(src, fr.span),
+	}
+	for _, flag := range fr.flags {
+		ans.Children = append(ans.Children, &compiler.Node{Type: "flag", Value: flag})
+	}
+	return ans
+}
@@ -24,6 +24,11 @@ type LineRange struct {
 	To   int
 }
 
+// IsEmpty tells whether the range requires no lines at all
+func (lr LineRange) IsEmpty() bool {
+	return lr.To <= lr.From
+}
+
 type LineRangeList []LineRange
 
 func (lrlist LineRangeList) Resources() []string {
@@ -75,3 +80,114 @@ func CalculatePartialRanges(rscList []string, offset, limit int) LineRangeList {
 	}
 	return ans2
 }
+
+// CalculateExactRanges calculates ranges for individual resources
+// in case we already know concordance sizes of all the resources
+// (`concSizes` maps resource IDs to their sizes).
+//
+// The function defines a stable total ordering of records across
+// all the resources: records are taken in rounds where the k-th round
+// contains the k-th line of each resource (in the `rscList` order)
+// still having enough lines. This means that unlike `CalculatePartialRanges`,
+// the ranges are correct even if some resources run out of lines
+// before `offset` is reached and thus paging through the result
+// produces no duplicates or gaps.
+//
+// Like in `CalculatePartialRanges`, the returned list is rotated
+// so the iteration always starts from the correct resource.
+func CalculateExactRanges(rscList []string, concSizes map[string]int, offset, limit int) LineRangeList {
+	numRsc := len(rscList)
+	ans := make([]LineRange, numRsc)
+	// first we find the round `round` the offset falls into and the
+	// position `posInRound` within the round (counted among resources
+	// which still have lines in the round)
+	var round, posInRound int
+	remaining := offset
+	for {
+		numActive := 0
+		nextLimit := -1
+		for _, rsc := range rscList {
+			size := concSizes[rsc]
+			if size > round {
+				numActive++
+				if nextLimit == -1 || size < nextLimit {
+					nextLimit = size
+				}
+			}
+		}
+		if numActive == 0 { // offset is beyond all the available lines
+			break
+		}
+		blockSize := (nextLimit - round) * numActive
+		if remaining >= blockSize {
+			remaining -= blockSize
+			round = nextLimit
+			continue
+		}
+		round += remaining / numActive
+		posInRound = remaining % numActive
+		break
+	}
+
+	firstIdx := -1
+	var activeIdx int
+	for i, rsc := range rscList {
+		size := concSizes[rsc]
+		from := min(size, round)
+		if size > round {
+			if activeIdx < posInRound {
+				from++
+
+			} else if firstIdx == -1 {
+				firstIdx = i
+			}
+			activeIdx++
+		}
+		ans[i] = LineRange{Rsc: rsc, From: from, To: from + limit}
+	}
+	if firstIdx == -1 {
+		firstIdx = 0
+	}
+	ans2 := make([]LineRange, 0, numRsc)
+	for i := 0; i < numRsc; i++ {
+		ans2 = append(ans2, ans[(i+firstIdx)%numRsc])
+	}
+	return ans2
+}
+
+// CalculateGroupedRanges calculates ranges for individual resources
+// in case the result is created by concatenating whole results of
+// the resources (in the order of `rscList`) instead of the round robin
+// selection. Unlike the other functions here, the order of resources
+// is never changed.
+//
+// Resources entirely before the offset get a range starting at the end
+// of their concordance (i.e. they are out of range). Resources entirely
+// after the page get an empty range starting at zero (see LineRange.IsEmpty)
+// as there is no need to fetch their lines.
+func CalculateGroupedRanges(rscList []string, concSizes map[string]int, offset, limit int) LineRangeList {
+	ans := make([]LineRange, len(rscList))
+	var start int
+	for i, rsc := range rscList {
+		size := concSizes[rsc]
+		if start >= offset+limit {
+			ans[i] = LineRange{Rsc: rsc}
+
+		} else {
+			from := min(max(offset-start, 0), size)
+			ans[i] = LineRange{Rsc: rsc, From: from, To: from + limit}
+		}
+		start += size
+	}
+	return ans
+}
+
+// LastPageOffset returns an offset of the last page of a result
+// with `total` lines provided that pages of `limit` lines start
+// at offset zero.
+func LastPageOffset(total, limit int) int {
+	if total <= 0 || limit <= 0 {
+		return 0
+	}
+	return (total - 1) / limit * limit
+}
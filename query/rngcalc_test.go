@@ -42,3 +42,48 @@ func TestSingleResource(t *testing.T) {
 	assert.Equal(t, 38, ans[0].From)
 	assert.Equal(t, 48, ans[0].To)
 }
+
+func TestExactRangesSameAsPartialForEnoughLines(t *testing.T) {
+	sizes := map[string]int{"c1": 100, "c2": 100, "c3": 100}
+	ans := CalculateExactRanges([]string{"c1", "c2", "c3"}, sizes, 38, 10)
+	assert.Equal(t, CalculatePartialRanges([]string{"c1", "c2", "c3"}, 38, 10), ans)
+}
+
+func TestExactRangesWithExhaustedResource(t *testing.T) {
+	// order: c1-0 c2-0 c3-0 c1-1 c2-1 c3-1 c2-2 c3-2 c2-3 c3-3 c2-4 ...
+	sizes := map[string]int{"c1": 2, "c2": 10, "c3": 10}
+	ans := CalculateExactRanges([]string{"c1", "c2", "c3"}, sizes, 9, 5)
+	assert.Equal(t, "c3", ans[0].Rsc)
+	assert.Equal(t, 3, ans[0].From)
+	assert.Equal(t, "c1", ans[1].Rsc)
+	assert.Equal(t, 2, ans[1].From)
+	assert.Equal(t, "c2", ans[2].Rsc)
+	assert.Equal(t, 4, ans[2].From)
+	assert.Equal(t, 9, ans[2].To)
+}
+
+func TestGroupedRangesKeepOrder(t *testing.T) {
+	sizes := map[string]int{"c1": 4, "c2": 10, "c3": 10}
+	ans := CalculateGroupedRanges([]string{"c1", "c2", "c3"}, sizes, 2, 5)
+	assert.Equal(t, []string{"c1", "c2", "c3"}, ans.PIDList())
+	assert.Equal(t, 2, ans[0].From)
+	assert.Equal(t, 0, ans[1].From)
+	assert.Equal(t, 5, ans[1].To)
+	assert.True(t, ans[2].IsEmpty()) // not reached by the page
+	assert.Equal(t, 0, ans[2].From)
+}
+
+func TestGroupedRangesSkipConsumedResource(t *testing.T) {
+	sizes := map[string]int{"c1": 4, "c2": 10, "c3": 10}
+	ans := CalculateGroupedRanges([]string{"c1", "c2", "c3"}, sizes, 12, 5)
+	assert.Equal(t, 4, ans[0].From)
+	assert.Equal(t, 8, ans[1].From)
+	assert.Equal(t, 0, ans[2].From)
+}
+
+func TestLastPageOffset(t *testing.T) {
+	assert.Equal(t, 20, LastPageOffset(25, 10))
+	assert.Equal(t, 10, LastPageOffset(20, 10))
+	assert.Equal(t, 0, LastPageOffset(5, 10))
+	assert.Equal(t, 0, LastPageOffset(0, 10))
+}
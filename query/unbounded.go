@@ -0,0 +1,105 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// anyCharsPattern matches regexps like `.*`, `.+` or `.*.+`
+	anyCharsPattern = regexp.MustCompile(`^(\.[*+])+$`)
+
+	inlineFlagsPattern = regexp.MustCompile(`^\(\?[a-zA-Z]+\)`)
+)
+
+// IsUnboundedRegexp tells whether a regular expression used
+// as a value of a token attribute trivially matches (almost) any
+// value. This is a heuristic detecting patterns like `.*`, `.+`,
+// `(.*)` or alternatives with such or an empty item (e.g. `a|.*`
+// or `a|`). Less obvious cases (e.g. `[^x]*`) are not detected.
+func IsUnboundedRegexp(pattern string) bool {
+	pattern = inlineFlagsPattern.ReplaceAllString(pattern, "")
+	for _, alt := range splitTopLevelAlternatives(pattern) {
+		if alt == "" || anyCharsPattern.MatchString(alt) {
+			return true
+		}
+		if inner, ok := stripEnclosingGroup(alt); ok && IsUnboundedRegexp(inner) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTopLevelAlternatives splits a regexp by `|` operators
+// not nested in groups, character classes or escaped.
+func splitTopLevelAlternatives(pattern string) []string {
+	ans := make([]string, 0, 3)
+	var depth int
+	var inClass bool
+	var curr strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			curr.WriteByte(c)
+			i++
+			c = pattern[i]
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			ans = append(ans, curr.String())
+			curr.Reset()
+			continue
+		}
+		curr.WriteByte(c)
+	}
+	return append(ans, curr.String())
+}
+
+// stripEnclosingGroup removes parentheses enclosing the whole
+// `pattern` (e.g. `(a|b)` => `a|b`, `(?:a)` => `a`). For other
+// patterns, false is returned.
+func stripEnclosingGroup(pattern string) (string, bool) {
+	if len(pattern) < 2 || pattern[0] != '(' || pattern[len(pattern)-1] != ')' {
+		return "", false
+	}
+	var depth int
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 && i < len(pattern)-1 {
+				return "", false // e.g. (a)(b)
+			}
+		}
+	}
+	return strings.TrimPrefix(pattern[1:len(pattern)-1], "?:"), true
+}
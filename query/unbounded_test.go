@@ -0,0 +1,43 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnboundedRegexp(t *testing.T) {
+	for _, p := range []string{
+		``, `.*`, `.+`, `.*.*`, `(.*)`, `(?:.+)`, `(?i).*`,
+		`dog|.*`, `.*|dog`, `dog|`, `|dog`, `dog||cat`, `((.*))`, `(dog|.*)`,
+	} {
+		assert.True(t, IsUnboundedRegexp(p), p)
+	}
+}
+
+func TestIsBoundedRegexp(t *testing.T) {
+	for _, p := range []string{
+		`dog`, `dog.*`, `.*dog`, `do.`, `.`, `.?`, `[.*]`, `\.*`, `dog|cat`,
+		`(dog|cat)s`, `(.*)(x)`, `[|]`, `a\|`,
+	} {
+		assert.False(t, IsUnboundedRegexp(p), p)
+	}
+}
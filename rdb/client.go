@@ -21,10 +21,13 @@ package rdb
 import (
 	"bytes"
 	"context"
+	"crypto/sha1"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/czcorpus/mquery-sru/result"
@@ -38,10 +41,16 @@ const (
 	MsgNewQuery                = "newQuery"
 	MsgNewResult               = "newResult"
 	DefaultQueueKey            = "mqueryQueue"
+	DefaultQueueName           = "default"
 	DefaultResultChannelPrefix = "mqueryResults"
 	DefaultQueryChannel        = "mqueryQueries"
 	DefaultResultExpiration    = 10 * time.Minute
 	DefaultQueryAnswerTimeout  = 60 * time.Second
+
+	// chunkedResultMarker starts a value describing a result split
+	// into multiple chunks. As GOB data never start with a zero byte,
+	// the marker cannot be confused with a regular result.
+	chunkedResultMarker = "\x00chunked:"
 )
 
 var (
@@ -49,11 +58,37 @@ var (
 )
 
 type Query struct {
-	Channel string        `json:"channel"`
-	Func    string        `json:"func"`
-	Args    ConcQueryArgs `json:"args"`
+	Channel string `json:"channel"`
+	Func    string `json:"func"`
+
+	// Queue is a name of a worker queue the query is published to.
+	// Empty value means the default queue.
+	Queue string        `json:"queue"`
+	Args  ConcQueryArgs `json:"args"`
+
+	// IdempotencyKey identifies jobs which can be safely processed
+	// just once in case they are published repeatedly (e.g. on retry).
+	// Empty value disables the deduplication.
+	IdempotencyKey string `json:"idempotencyKey"`
 }
 
+// ConcOutput specifies which parts of a concordance result
+// are requested from a worker by the `concExample` function
+type ConcOutput string
+
+const (
+	// ConcOutputFull requests concordance lines along with
+	// all the requested aggregates
+	ConcOutputFull ConcOutput = ""
+
+	// ConcOutputCount requests just the concordance size
+	ConcOutputCount ConcOutput = "count"
+
+	// ConcOutputFacets requests the concordance size and facets
+	// (see ConcQueryArgs.FacetAttrs)
+	ConcOutputFacets ConcOutput = "facets"
+)
+
 type ConcQueryArgs struct {
 	CorpusPath        string   `json:"corpusPath"`
 	Query             string   `json:"query"`
@@ -62,6 +97,100 @@ type ConcQueryArgs struct {
 	StartLine         int      `json:"startLine"`
 	MaxContext        int      `json:"maxContext"`
 	ViewContextStruct string   `json:"viewContextStruct"`
+
+	// GlueStruct is a self-closing structure marking tokens not
+	// separated by a space. If set, it is included in the returned lines.
+	GlueStruct string `json:"glueStruct"`
+
+	// Encoding is a character encoding of the corpus. Queries are
+	// converted to the encoding and results are converted back to UTF-8.
+	// Empty value means UTF-8.
+	Encoding string `json:"encoding"`
+
+	// CollocAttr is a positional attribute used to calculate
+	// collocates of the match
+	CollocAttr string `json:"collocAttr"`
+
+	// CollocWindow specifies the number of tokens to the left
+	// and to the right of the match used to search for collocates
+	CollocWindow int `json:"collocWindow"`
+
+	// CollocMaxItems specifies the number of collocates to be
+	// returned. Zero value means no collocates will be calculated.
+	CollocMaxItems int `json:"collocMaxItems"`
+
+	// CollocMeasure is a name of an association measure used
+	// to score collocates (see mango.ParseCollMeasure). Empty
+	// value means logDice.
+	CollocMeasure string `json:"collocMeasure"`
+
+	// CollocMinFreq is a min. frequency of a collocate within
+	// the window. Zero value means a worker's default.
+	CollocMinFreq int `json:"collocMinFreq"`
+
+	// FacetAttrs contains structural attributes (e.g. `doc.genre`)
+	// for which frequency distribution of the matches is calculated
+	FacetAttrs []string `json:"facetAttrs"`
+
+	// FacetMaxItems specifies max. number of values of each facet
+	FacetMaxItems int `json:"facetMaxItems"`
+
+	// Position is a corpus position (or a structure number in case
+	// PositionStruct is set) used by the `positionContext` function
+	Position int `json:"position"`
+
+	// PositionStruct is an optional structure the Position refers to
+	PositionStruct string `json:"positionStruct"`
+
+	// FormsAttr is a positional attribute (typically `word`) used
+	// by the `lemmaForms` function to obtain forms of the matching
+	// tokens (up to MaxItems forms with the highest frequencies)
+	FormsAttr string `json:"formsAttr"`
+
+	// MinFormFreq enables filtering of concordance lines whose match
+	// form (the first matching token, Attrs[0]) occurs less than
+	// MinFormFreq times. Zero value disables the filter.
+	MinFormFreq int `json:"minFormFreq"`
+
+	// ScanAttr is a structural attribute (e.g. `doc.genre`) whose values
+	// are listed by the `structAttrValues` function (up to MaxItems values
+	// in alphabetical order, starting with ScanFrom)
+	ScanAttr string `json:"scanAttr"`
+
+	// ScanFrom is the first value (or a value preceding the first one)
+	// listed by the `structAttrValues` function
+	ScanFrom string `json:"scanFrom"`
+
+	// WideContextStruct is an optional structure (e.g. `p`) used
+	// as a context of an additional set of lines returned along with
+	// the regular ones (see result.ConcResult.WideLines)
+	WideContextStruct string `json:"wideContextStruct"`
+
+	// WideMaxContext is a maximum number of tokens of the wide context
+	WideMaxContext int `json:"wideMaxContext"`
+
+	// SortCrit is a Manatee sort criterion (e.g. `lemma/ 0<0~0>0`)
+	// the concordance lines are sorted by. Empty value means
+	// the lines are returned in a random order.
+	SortCrit string `json:"sortCrit"`
+
+	// Output specifies the requested parts of the `concExample` result.
+	// In case lines are not needed, the worker neither retrieves nor
+	// parses them (and collocations are not calculated either).
+	Output ConcOutput `json:"output"`
+}
+
+// ArgsKey returns a key identifying the query by its function,
+// queue and arguments. It is suitable as an idempotency key.
+func (q Query) ArgsKey() string {
+	q.Channel = ""
+	q.IdempotencyKey = ""
+	data, err := json.Marshal(q)
+	if err != nil {
+		// this should not happen as the query contains only basic types
+		panic(fmt.Sprintf("failed to create query key: %s", err))
+	}
+	return fmt.Sprintf("%x", sha1.Sum(data))
 }
 
 func (q Query) ToJSON() (string, error) {
@@ -72,6 +201,16 @@ func (q Query) ToJSON() (string, error) {
 	return string(ans), nil
 }
 
+// QueueKey returns a Redis key of a named worker queue.
+// For backward compatibility, the default queue uses
+// the original (non-suffixed) key.
+func QueueKey(name string) string {
+	if name == "" || name == DefaultQueueName {
+		return DefaultQueueKey
+	}
+	return DefaultQueueKey + ":" + name
+}
+
 func DecodeQuery(q string) (Query, error) {
 	var ans Query
 	var buff bytes.Buffer
@@ -112,6 +251,10 @@ type Adapter struct {
 	channelQuery        string
 	channelResultPrefix string
 	queryAnswerTimeout  time.Duration
+	jobLimiter          *jobLimiter
+	jobStats            *jobStats
+	jobDedup            *jobDeduplicator
+	resultChunkSize     int
 }
 
 func (a *Adapter) TestConnection(totalTimeout time.Duration, timeoutPerTry time.Duration) error {
@@ -139,6 +282,55 @@ func (a *Adapter) TestConnection(totalTimeout time.Duration, timeoutPerTry time.
 	}
 }
 
+// NumWorkers returns number of workers subscribed
+// to the query channel
+func (a *Adapter) NumWorkers() (int, error) {
+	cmd := a.redis.PubSubNumSub(a.ctx, a.channelQuery)
+	if cmd.Err() != nil {
+		return 0, fmt.Errorf("failed to determine number of workers: %w", cmd.Err())
+	}
+	return int(cmd.Val()[a.channelQuery]), nil
+}
+
+// QueryAnswerTimeout returns max. time a query publisher
+// waits for a result
+func (a *Adapter) QueryAnswerTimeout() time.Duration {
+	return a.queryAnswerTimeout
+}
+
+// InFlightJobs returns number of published jobs
+// still waiting for their results
+func (a *Adapter) InFlightJobs() int {
+	return a.jobLimiter.inFlight()
+}
+
+// MaxConcurrentJobs returns max. number of jobs
+// which can be published at the same time
+func (a *Adapter) MaxConcurrentJobs() int {
+	return a.jobLimiter.limit()
+}
+
+// QueueDepth returns total number of jobs waiting
+// in the configured worker queues
+func (a *Adapter) QueueDepth() (int, error) {
+	var ans int
+	for _, q := range a.conf.WorkerQueues {
+		cmd := a.redis.LLen(a.ctx, QueueKey(q))
+		if cmd.Err() != nil {
+			return 0, fmt.Errorf("failed to determine queue depth: %w", cmd.Err())
+		}
+		ans += int(cmd.Val())
+	}
+	return ans, nil
+}
+
+// RecentJobs returns number of jobs answered by workers within
+// the `window` (up to now, max. MaxJobStatsWindow) and their average
+// processing time (without time spent in a queue)
+func (a *Adapter) RecentJobs(window time.Duration) (int, time.Duration) {
+	return a.jobStats.summary(time.Now(), window)
+}
+
 // SomeoneListens tests if there is a listener for a channel
 // specified in the provided `query`. If false, then there
 // is nobody interested in the query anymore.
@@ -158,11 +350,36 @@ func (a *Adapter) SomeoneListens(query Query) (bool, error) {
 // that the publishing itself failed and the client won't obtain
 // any information about the calculation (in which case it relies
 // on timeout)
-func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
+// Once the `ctx` is done (e.g. the HTTP request has been canceled),
+// the method stops listening for the result which is also a signal
+// for the worker to abort the calculation.
+// In case the max. number of concurrent jobs is reached, the method
+// waits for a free slot (or for the `ctx` to be done).
+// Queries with an IdempotencyKey matching a job published shortly
+// before and still being processed are not published again. Instead,
+// the result of the existing job is shared. As such a job may be shared
+// by unrelated requests, it does not depend on the `ctx` of any of its
+// publishers (the `ctx` applies just to waiting for the result) and it
+// is canceled only once all the publishers stop waiting.
+func (a *Adapter) PublishQuery(ctx context.Context, query Query) (<-chan result.ConcResult, error) {
+	if query.IdempotencyKey != "" {
+		return a.jobDedup.publish(
+			ctx,
+			query.IdempotencyKey,
+			func(jobCtx context.Context) (<-chan result.ConcResult, error) {
+				return a.publishQuery(jobCtx, query)
+			},
+		)
+	}
+	return a.publishQuery(ctx, query)
+}
+
+func (a *Adapter) publishQuery(ctx context.Context, query Query) (<-chan result.ConcResult, error) {
 	query.Channel = fmt.Sprintf("%s:%s", a.channelResultPrefix, uuid.New().String())
 	log.Debug().
 		Str("channel", query.Channel).
 		Str("func", query.Func).
+		Str("queue", query.Queue).
 		Any("args", query.Args).
 		Msg("publishing query")
 
@@ -173,19 +390,29 @@ func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
 		return nil, fmt.Errorf("failed to publish query: %w", err)
 	}
 
+	if err := a.jobLimiter.acquire(ctx); err != nil {
+		return nil, fmt.Errorf("failed to publish query: %w", err)
+	}
+	// the timeout starts once the job has a free slot
+	// (acquiring the slot is limited by `ctx`)
 	ctx2, cancel := context.WithTimeout(a.ctx, a.queryAnswerTimeout)
 	defer cancel()
 	sub := a.redis.Subscribe(ctx2, query.Channel)
-	if err := a.redis.LPush(ctx2, DefaultQueueKey, msg.String()).Err(); err != nil {
+	if err := a.redis.LPush(ctx2, QueueKey(query.Queue), msg.String()).Err(); err != nil {
+		sub.Close()
+		a.jobLimiter.release()
 		return nil, err
 	}
-	ansChan := make(chan result.ConcResult)
+	// the channel is buffered so we never block in case
+	// the receiver is not interested in the result anymore
+	ansChan := make(chan result.ConcResult, 1)
 
 	// now we wait for response and send result via `ans`
 	go func() {
 		defer func() {
 			sub.Close()
 			close(ansChan)
+			a.jobLimiter.release()
 		}()
 
 		ctx3, cancel := context.WithTimeout(a.ctx, a.queryAnswerTimeout)
@@ -199,17 +426,23 @@ func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
 					Str("channel", query.Channel).
 					Bool("closedChannel", !ok).
 					Msg("received result")
-				cmd := a.redis.Get(ctx3, item.Payload)
-				if cmd.Err() != nil {
-					ans.Error = cmd.Err()
+				data, err := a.loadResult(ctx3, item.Payload)
+				if err != nil {
+					ans.Error = err
 
 				} else {
-					var buf bytes.Buffer
-					buf.WriteString(cmd.Val())
-					dec := gob.NewDecoder(&buf)
-					err := dec.Decode(&ans)
+					var err error
+					ans, err = decodeResult(data)
 					if err != nil {
-						ans.Error = err
+						// details stay in the log, clients obtain just the job ID
+						log.Error().
+							Err(err).
+							Str("channel", query.Channel).
+							Str("func", query.Func).
+							Msg("failed to deserialize worker result")
+						ans = result.ConcResult{
+							Error: &result.MalformedResultError{JobID: query.Channel},
+						}
 					}
 					log.Debug().
 						Str("channel", query.Channel).
@@ -217,11 +450,19 @@ func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
 						Str("query", ans.Query).
 						Msg("decoded result")
 				}
+				if ans.ProcTime > 0 {
+					a.jobStats.add(time.Now(), ans.ProcTime)
+				}
 				ansChan <- ans
 				return
 			case <-ctx3.Done():
 				ans.Error = fmt.Errorf("waiting for worker response timeout")
 				ansChan <- ans
+				return
+			case <-ctx.Done():
+				ans.Error = fmt.Errorf("waiting for worker response canceled: %w", ctx.Err())
+				ansChan <- ans
+				return
 			case <-a.ctx.Done():
 				log.Warn().Msg("publishing query interrupted due to cancellation")
 				return
@@ -232,28 +473,112 @@ func (a *Adapter) PublishQuery(query Query) (<-chan result.ConcResult, error) {
 	return ansChan, a.redis.Publish(ctx2, a.channelQuery, MsgNewQuery).Err()
 }
 
-// DequeueQuery looks for a query queued for processing.
-// In case nothing is found, ErrorEmptyQueue is returned
-// as an error.
-func (a *Adapter) DequeueQuery() (Query, error) {
-	cmd := a.redis.RPop(a.ctx, DefaultQueueKey)
-
-	if cmd.Val() == "" {
-		return Query{}, ErrorEmptyQueue
+// loadResult obtains raw data of a result stored under `key`.
+// In case the result has been split into chunks, the chunks
+// are loaded and joined.
+func (a *Adapter) loadResult(ctx context.Context, key string) (string, error) {
+	data, err := a.redis.Get(ctx, key).Result()
+	if err != nil {
+		return "", err
 	}
-	if cmd.Err() != nil {
-		return Query{}, fmt.Errorf("failed to dequeue query: %w", cmd.Err())
+	numChunks, isChunked, err := parseChunkedHeader(data)
+	if err != nil || !isChunked {
+		return data, err
 	}
-	q, err := DecodeQuery(cmd.Val())
+	keys := make([]string, numChunks)
+	for i := range keys {
+		keys[i] = chunkKey(key, i)
+	}
+	chunks, err := a.redis.MGet(ctx, keys...).Result()
 	if err != nil {
-		return Query{}, fmt.Errorf("failed to deserialize query: %w", err)
+		return "", fmt.Errorf("failed to load result chunks: %w", err)
 	}
-	return q, nil
+	var ans strings.Builder
+	for i, chunk := range chunks {
+		v, ok := chunk.(string)
+		if !ok {
+			return "", fmt.Errorf("failed to load result chunks: missing chunk %d of %s", i, key)
+		}
+		ans.WriteString(v)
+	}
+	return ans.String(), nil
+}
+
+// chunkKey returns a Redis key of idx-th chunk of a result
+func chunkKey(key string, idx int) string {
+	return fmt.Sprintf("%s:chunk:%d", key, idx)
+}
+
+// splitResult splits result data into chunks of max. `chunkSize` bytes
+func splitResult(data string, chunkSize int) []string {
+	ans := make([]string, 0, len(data)/chunkSize+1)
+	for len(data) > chunkSize {
+		ans = append(ans, data[:chunkSize])
+		data = data[chunkSize:]
+	}
+	return append(ans, data)
+}
+
+func chunkedHeader(numChunks int) string {
+	return chunkedResultMarker + strconv.Itoa(numChunks)
+}
+
+// parseChunkedHeader tests whether the value is a header of a chunked
+// result and if so, it returns number of respective chunks.
+func parseChunkedHeader(value string) (int, bool, error) {
+	if !strings.HasPrefix(value, chunkedResultMarker) {
+		return 0, false, nil
+	}
+	numChunks, err := strconv.Atoi(value[len(chunkedResultMarker):])
+	if err != nil || numChunks < 1 {
+		return 0, true, fmt.Errorf("invalid chunked result header")
+	}
+	return numChunks, true, nil
+}
+
+// decodeResult deserializes a result published by a worker.
+// Malformed data (e.g. produced by an incompatible worker version)
+// are reported as an error and never cause panic.
+func decodeResult(data string) (ans result.ConcResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ans = result.ConcResult{}
+			err = fmt.Errorf("failed to decode result: %v", r)
+		}
+	}()
+	var buf bytes.Buffer
+	buf.WriteString(data)
+	dec := gob.NewDecoder(&buf)
+	err = dec.Decode(&ans)
+	return
+}
+
+// DequeueQuery looks for a query queued for processing
+// in the provided worker queues (in the order of the queues).
+// In case nothing is found, ErrorEmptyQueue is returned
+// as an error.
+func (a *Adapter) DequeueQuery(queues []string) (Query, error) {
+	for _, queue := range queues {
+		cmd := a.redis.RPop(a.ctx, QueueKey(queue))
+		if cmd.Err() == redis.Nil {
+			continue
+
+		} else if cmd.Err() != nil {
+			return Query{}, fmt.Errorf("failed to dequeue query: %w", cmd.Err())
+		}
+		q, err := DecodeQuery(cmd.Val())
+		if err != nil {
+			return Query{}, fmt.Errorf("failed to deserialize query: %w", err)
+		}
+		return q, nil
+	}
+	return Query{}, ErrorEmptyQueue
 }
 
 // PublishResult sends notification via Redis PUBSUB mechanism
 // and also stores the result so a notified listener can retrieve
-// it.
+// it. Results larger than the configured chunk size are stored
+// in multiple chunks.
 func (a *Adapter) PublishResult(channelName string, value *result.ConcResult) error {
 	log.Debug().
 		Str("channel", channelName).
@@ -271,7 +596,27 @@ func (a *Adapter) PublishResult(channelName string, value *result.ConcResult) er
 	if err != nil {
 		return fmt.Errorf("failed to serialize (GOB) result: %w", err)
 	}
-	a.redis.Set(a.ctx, channelName, msg.String(), DefaultResultExpiration)
+	if msg.Len() <= a.resultChunkSize {
+		a.redis.Set(a.ctx, channelName, msg.String(), DefaultResultExpiration)
+
+	} else {
+		chunks := splitResult(msg.String(), a.resultChunkSize)
+		_, err := a.redis.TxPipelined(a.ctx, func(pipe redis.Pipeliner) error {
+			for i, chunk := range chunks {
+				pipe.Set(a.ctx, chunkKey(channelName, i), chunk, DefaultResultExpiration)
+			}
+			pipe.Set(a.ctx, channelName, chunkedHeader(len(chunks)), DefaultResultExpiration)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to store chunked result: %w", err)
+		}
+		log.Debug().
+			Str("channel", channelName).
+			Int("size", msg.Len()).
+			Int("numChunks", len(chunks)).
+			Msg("stored result in chunks")
+	}
 	return a.redis.Publish(a.ctx, channelName, channelName).Err()
 }
 
@@ -282,8 +627,9 @@ func (a *Adapter) Subscribe() <-chan *redis.Message {
 }
 
 // NewAdapter is a recommended factory function
-// for creating new `Adapter` instances
-func NewAdapter(ctx context.Context, conf *Conf) *Adapter {
+// for creating new `Adapter` instances. The `maxConcurrentJobs`
+// limits number of published jobs waiting for their results.
+func NewAdapter(ctx context.Context, conf *Conf, maxConcurrentJobs int) *Adapter {
 	chRes := conf.ChannelResultPrefix
 	chQuery := conf.ChannelQuery
 	if chRes == "" {
@@ -305,6 +651,10 @@ func NewAdapter(ctx context.Context, conf *Conf) *Adapter {
 			Float64("value", queryAnswerTimeout.Seconds()).
 			Msg("queryAnswerTimeoutSecs not specified for Redis adapter, using default")
 	}
+	resultChunkSize := conf.ResultChunkSize
+	if resultChunkSize <= 0 {
+		resultChunkSize = dfltResultChunkSize
+	}
 	ans := &Adapter{
 		conf: conf,
 		redis: redis.NewClient(&redis.Options{
@@ -316,6 +666,10 @@ func NewAdapter(ctx context.Context, conf *Conf) *Adapter {
 		channelQuery:        chQuery,
 		channelResultPrefix: chRes,
 		queryAnswerTimeout:  queryAnswerTimeout,
+		jobLimiter:          newJobLimiter(maxConcurrentJobs),
+		jobStats:            newJobStats(),
+		jobDedup:            newJobDeduplicator(ctx, idempotencyWindow),
+		resultChunkSize:     resultChunkSize,
 	}
 	return ans
 }
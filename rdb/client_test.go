@@ -0,0 +1,87 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeResult(t *testing.T, res result.ConcResult) string {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	assert.NoError(t, enc.Encode(res))
+	return buf.String()
+}
+
+func TestDecodeResult(t *testing.T) {
+	ans, err := decodeResult(encodeResult(t, result.ConcResult{ConcSize: 42, Query: "[word=\"x\"]"}))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, ans.ConcSize)
+	assert.Equal(t, "[word=\"x\"]", ans.Query)
+}
+
+func TestDecodeCorruptResult(t *testing.T) {
+	data := encodeResult(t, result.ConcResult{ConcSize: 42, Query: "[word=\"x\"]"})
+	for _, corrupt := range []string{"", "foo", data[:len(data)/2], data[len(data)/2:]} {
+		ans, err := decodeResult(corrupt)
+		assert.Error(t, err)
+		assert.Equal(t, 0, ans.ConcSize)
+	}
+}
+
+func TestMalformedResultErrorIsSanitized(t *testing.T) {
+	res := result.ConcResult{Error: &result.MalformedResultError{JobID: "res:1234"}}
+	assert.True(t, res.HasMalformedResultError())
+	assert.Equal(t, "failed to process worker result (job res:1234)", res.Error.Error())
+	assert.False(t, res.HasOutOfRangeError())
+}
+
+func TestSplitResult(t *testing.T) {
+	assert.Equal(t, []string{"abc"}, splitResult("abc", 3))
+	assert.Equal(t, []string{"abc", "de"}, splitResult("abcde", 3))
+	assert.Equal(t, []string{""}, splitResult("", 3))
+}
+
+func TestChunkedResultReassembly(t *testing.T) {
+	data := encodeResult(t, result.ConcResult{ConcSize: 42, Query: "[word=\"x\"]"})
+	chunks := splitResult(data, 5)
+	assert.Greater(t, len(chunks), 1)
+	numChunks, isChunked, err := parseChunkedHeader(chunkedHeader(len(chunks)))
+	assert.NoError(t, err)
+	assert.True(t, isChunked)
+	assert.Equal(t, len(chunks), numChunks)
+	ans, err := decodeResult(strings.Join(chunks, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, ans.ConcSize)
+}
+
+func TestRegularResultIsNotChunkedHeader(t *testing.T) {
+	_, isChunked, err := parseChunkedHeader(encodeResult(t, result.ConcResult{ConcSize: 42}))
+	assert.NoError(t, err)
+	assert.False(t, isChunked)
+	_, isChunked, err = parseChunkedHeader(chunkedResultMarker + "foo")
+	assert.Error(t, err)
+	assert.True(t, isChunked)
+}
@@ -19,7 +19,9 @@
 package rdb
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 )
@@ -29,6 +31,8 @@ const (
 	dfltChannelQuery           = "mquerysru"
 	dfltChannelResultPrefix    = "res"
 	dfltQueryAnswerTimeoutSecs = 30
+	dfltResultChunkSize        = 1024 * 1024
+	minResultChunkSize         = 1024
 )
 
 type Conf struct {
@@ -39,6 +43,17 @@ type Conf struct {
 	ChannelQuery           string `json:"channelQuery"`
 	ChannelResultPrefix    string `json:"channelResultPrefix"`
 	QueryAnswerTimeoutSecs int    `json:"queryAnswerTimeoutSecs"`
+
+	// WorkerQueues is a list of queues a worker takes queries from.
+	// This allows for dedicating workers to specific (e.g. large)
+	// resources. Resources are assigned to queues via their
+	// `workerQueue` setting.
+	WorkerQueues []string `json:"workerQueues"`
+
+	// ResultChunkSize is a max. size (in bytes) of a worker result
+	// stored as a single Redis value. Larger results are split into
+	// chunks of this size to prevent huge Redis values.
+	ResultChunkSize int `json:"resultChunkSize"`
 }
 
 func (conf *Conf) ServerInfo() string {
@@ -46,8 +61,9 @@ func (conf *Conf) ServerInfo() string {
 }
 
 func (conf *Conf) Validate() error {
+	errs := make([]error, 0, 3)
 	if conf.Host == "" {
-		return fmt.Errorf("redis.host is missing")
+		errs = append(errs, fmt.Errorf("redis.host is missing"))
 	}
 	if conf.Port == 0 {
 		conf.Port = dfltPort
@@ -56,10 +72,10 @@ func (conf *Conf) Validate() error {
 			Msg("redis.port not specified, using default")
 
 	} else if conf.Port < 1 || conf.Port > 65535 {
-		return fmt.Errorf("redis.port is invalid (use 1-65535)")
+		errs = append(errs, fmt.Errorf("redis.port is invalid (use 1-65535)"))
 	}
 	if conf.DB < 1 || conf.DB > 16 {
-		return fmt.Errorf("redis.db is invalid (use 1-16)")
+		errs = append(errs, fmt.Errorf("redis.db is invalid (use 1-16)"))
 	}
 	if conf.ChannelQuery == "" {
 		conf.ChannelQuery = dfltChannelQuery
@@ -79,5 +95,41 @@ func (conf *Conf) Validate() error {
 			Int("value", conf.QueryAnswerTimeoutSecs).
 			Msg("redis.queryAnswerTimeoutSecs not specified, using default")
 	}
-	return nil
+	if len(conf.WorkerQueues) == 0 {
+		conf.WorkerQueues = []string{DefaultQueueName}
+		log.Warn().
+			Strs("value", conf.WorkerQueues).
+			Msg("redis.workerQueues not specified, using default")
+	}
+	for _, q := range conf.WorkerQueues {
+		if q == "" {
+			errs = append(errs, fmt.Errorf("redis.workerQueues must not contain empty names"))
+			break
+		}
+	}
+	if conf.ResultChunkSize == 0 {
+		conf.ResultChunkSize = dfltResultChunkSize
+		log.Warn().
+			Int("value", conf.ResultChunkSize).
+			Msg("redis.resultChunkSize not specified, using default")
+
+	} else if conf.ResultChunkSize < minResultChunkSize {
+		errs = append(errs, fmt.Errorf("redis.resultChunkSize must be at least %d", minResultChunkSize))
+	}
+	return errors.Join(errs...)
+}
+
+// ParseWorkerQueues parses a comma-separated list of worker queue
+// names (e.g. as provided via an env. variable). Names are trimmed
+// and empty names are rejected.
+func ParseWorkerQueues(v string) ([]string, error) {
+	items := strings.Split(v, ",")
+	ans := make([]string, len(items))
+	for i, item := range items {
+		ans[i] = strings.TrimSpace(item)
+		if ans[i] == "" {
+			return nil, fmt.Errorf("invalid worker queue list %q: empty queue name", v)
+		}
+	}
+	return ans, nil
 }
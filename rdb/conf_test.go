@@ -0,0 +1,47 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWorkerQueues(t *testing.T) {
+	queues, err := ParseWorkerQueues(" fast, slow ,default")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fast", "slow", "default"}, queues)
+}
+
+func TestParseWorkerQueuesEmptyName(t *testing.T) {
+	for _, v := range []string{"fast,,slow", "fast, ", " "} {
+		_, err := ParseWorkerQueues(v)
+		assert.Error(t, err, v)
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	conf := &Conf{Port: 100000, WorkerQueues: []string{"fast", ""}}
+	err := conf.Validate()
+	assert.ErrorContains(t, err, "redis.host")
+	assert.ErrorContains(t, err, "redis.port")
+	assert.ErrorContains(t, err, "redis.db")
+	assert.ErrorContains(t, err, "redis.workerQueues")
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+)
+
+const (
+	// idempotencyWindow specifies how long after publishing
+	// a job can be shared by identical (same key) publications
+	idempotencyWindow = 30 * time.Second
+)
+
+type sharedJob struct {
+	created time.Time
+	done    chan struct{}
+	res     result.ConcResult
+	hasRes  bool
+
+	// cancel cancels the job context (see jobDeduplicator.publish)
+	cancel context.CancelFunc
+
+	// numWaiting is a number of publishers still waiting
+	// for the job result (guarded by jobDeduplicator.mu)
+	numWaiting int
+}
+
+// jobDeduplicator makes sure that jobs with the same idempotency key
+// published repeatedly (e.g. on retry after a transient error or by
+// concurrent identical requests) within a short time window are
+// processed just once. All the publishers then obtain the same result.
+type jobDeduplicator struct {
+	// ctx is a parent context of all the shared jobs so the jobs
+	// do not depend on a context of any of their publishers
+	ctx    context.Context
+	jobs   map[string]*sharedJob
+	window time.Duration
+	mu     sync.Mutex
+}
+
+func (jd *jobDeduplicator) remove(key string, job *sharedJob) {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	if jd.jobs[key] == job {
+		delete(jd.jobs, key)
+	}
+}
+
+// leave unsubscribes a publisher from the job. Once nobody waits for
+// the job result, the job is canceled (which also signals the worker
+// to abort the calculation).
+func (jd *jobDeduplicator) leave(key string, job *sharedJob) {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	job.numWaiting--
+	if job.numWaiting == 0 {
+		if jd.jobs[key] == job {
+			delete(jd.jobs, key)
+		}
+		job.cancel()
+	}
+}
+
+// subscribe returns a channel providing the job result once available.
+// In case the `ctx` is done sooner, the channel provides a result with
+// the respective error. In case the job ends without a result, the
+// channel is closed without sending anything.
+// The method must be called with jd.mu locked.
+func (jd *jobDeduplicator) subscribe(
+	ctx context.Context,
+	key string,
+	job *sharedJob,
+) <-chan result.ConcResult {
+	job.numWaiting++
+	ans := make(chan result.ConcResult, 1)
+	go func() {
+		defer close(ans)
+		select {
+		case <-job.done:
+			if job.hasRes {
+				ans <- job.res
+			}
+		case <-ctx.Done():
+			jd.leave(key, job)
+			ans <- result.ConcResult{
+				Error: fmt.Errorf("waiting for worker response canceled: %w", ctx.Err()),
+			}
+		}
+	}()
+	return ans
+}
+
+// publish calls `publishFn` unless there is an in-flight job with
+// the same key. In such case, the result of the existing job is shared.
+// The `publishFn` obtains a job context which is independent of the `ctx`
+// of the publisher. The `ctx` applies only to waiting for the result.
+// The job is canceled once all its publishers stop waiting.
+func (jd *jobDeduplicator) publish(
+	ctx context.Context,
+	key string,
+	publishFn func(jobCtx context.Context) (<-chan result.ConcResult, error),
+) (<-chan result.ConcResult, error) {
+	jd.mu.Lock()
+	job, ok := jd.jobs[key]
+	if ok && time.Since(job.created) < jd.window {
+		ans := jd.subscribe(ctx, key, job)
+		jd.mu.Unlock()
+		return ans, nil
+	}
+	jobCtx, cancel := context.WithCancel(jd.ctx)
+	job = &sharedJob{created: time.Now(), done: make(chan struct{}), cancel: cancel}
+	jd.jobs[key] = job
+	ans := jd.subscribe(ctx, key, job)
+	jd.mu.Unlock()
+
+	wait, err := publishFn(jobCtx)
+	if err != nil {
+		jd.remove(key, job)
+		job.res = result.ConcResult{Error: fmt.Errorf("failed to publish shared job: %w", err)}
+		job.hasRes = true
+		close(job.done)
+		cancel()
+		return nil, err
+	}
+	go func() {
+		job.res, job.hasRes = <-wait
+		jd.remove(key, job)
+		close(job.done)
+		cancel()
+	}()
+	return ans, nil
+}
+
+// numInFlight returns number of jobs which can be currently shared
+func (jd *jobDeduplicator) numInFlight() int {
+	jd.mu.Lock()
+	defer jd.mu.Unlock()
+	return len(jd.jobs)
+}
+
+func newJobDeduplicator(ctx context.Context, window time.Duration) *jobDeduplicator {
+	return &jobDeduplicator{
+		ctx:    ctx,
+		jobs:   make(map[string]*sharedJob),
+		window: window,
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeWorker simulates a worker answering after a short delay
+// and counts number of executed jobs
+type fakeWorker struct {
+	numExecuted atomic.Int64
+	numCanceled atomic.Int64
+}
+
+func (fw *fakeWorker) publish(jobCtx context.Context) (<-chan result.ConcResult, error) {
+	fw.numExecuted.Add(1)
+	ans := make(chan result.ConcResult, 1)
+	go func() {
+		defer close(ans)
+		select {
+		case <-time.After(20 * time.Millisecond):
+			ans <- result.ConcResult{ConcSize: 42}
+		case <-jobCtx.Done():
+			fw.numCanceled.Add(1)
+		}
+	}()
+	return ans, nil
+}
+
+func TestJobDeduplicatorDuplicatePublish(t *testing.T) {
+	dedup := newJobDeduplicator(context.Background(), time.Minute)
+	var worker fakeWorker
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait, err := dedup.publish(context.Background(), "job1", worker.publish)
+			assert.NoError(t, err)
+			res, ok := <-wait
+			assert.True(t, ok)
+			assert.Equal(t, 42, res.ConcSize)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(1), worker.numExecuted.Load())
+	assert.Equal(t, 0, dedup.numInFlight())
+}
+
+func TestJobDeduplicatorDifferentKeys(t *testing.T) {
+	dedup := newJobDeduplicator(context.Background(), time.Minute)
+	var worker fakeWorker
+	wait1, err := dedup.publish(context.Background(), "job1", worker.publish)
+	assert.NoError(t, err)
+	wait2, err := dedup.publish(context.Background(), "job2", worker.publish)
+	assert.NoError(t, err)
+	<-wait1
+	<-wait2
+	assert.Equal(t, int64(2), worker.numExecuted.Load())
+}
+
+func TestJobDeduplicatorFinishedJobNotShared(t *testing.T) {
+	dedup := newJobDeduplicator(context.Background(), time.Minute)
+	var worker fakeWorker
+	wait, err := dedup.publish(context.Background(), "job1", worker.publish)
+	assert.NoError(t, err)
+	<-wait
+	wait, err = dedup.publish(context.Background(), "job1", worker.publish)
+	assert.NoError(t, err)
+	<-wait
+	assert.Equal(t, int64(2), worker.numExecuted.Load())
+}
+
+func TestJobDeduplicatorPublishError(t *testing.T) {
+	dedup := newJobDeduplicator(context.Background(), time.Minute)
+	_, err := dedup.publish(context.Background(), "job1", func(context.Context) (<-chan result.ConcResult, error) {
+		return nil, errors.New("connection reset")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, dedup.numInFlight())
+	var worker fakeWorker
+	wait, err := dedup.publish(context.Background(), "job1", worker.publish)
+	assert.NoError(t, err)
+	res := <-wait
+	assert.Equal(t, 42, res.ConcSize)
+}
+
+func TestJobDeduplicatorFirstPublisherGivesUp(t *testing.T) {
+	dedup := newJobDeduplicator(context.Background(), time.Minute)
+	var worker fakeWorker
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	wait1, err := dedup.publish(ctx1, "job1", worker.publish)
+	assert.NoError(t, err)
+	wait2, err := dedup.publish(context.Background(), "job1", worker.publish)
+	assert.NoError(t, err)
+	cancel1()
+	res1 := <-wait1
+	assert.ErrorIs(t, res1.Error, context.Canceled)
+	res2 := <-wait2
+	assert.NoError(t, res2.Error)
+	assert.Equal(t, 42, res2.ConcSize)
+	assert.Equal(t, int64(1), worker.numExecuted.Load())
+	assert.Equal(t, int64(0), worker.numCanceled.Load())
+}
+
+func TestJobDeduplicatorAllPublishersGiveUp(t *testing.T) {
+	dedup := newJobDeduplicator(context.Background(), time.Minute)
+	var worker fakeWorker
+	ctx, cancel := context.WithCancel(context.Background())
+	wait1, err := dedup.publish(ctx, "job1", worker.publish)
+	assert.NoError(t, err)
+	wait2, err := dedup.publish(ctx, "job1", worker.publish)
+	assert.NoError(t, err)
+	cancel()
+	<-wait1
+	<-wait2
+	assert.Eventually(
+		t,
+		func() bool { return worker.numCanceled.Load() == 1 },
+		time.Second,
+		5*time.Millisecond,
+	)
+	assert.Equal(t, 0, dedup.numInFlight())
+}
+
+func TestQueryArgsKey(t *testing.T) {
+	q1 := Query{Func: "concExample", Args: ConcQueryArgs{Query: "[word=\"x\"]"}}
+	q2 := q1
+	q2.Channel = "res:1234"
+	assert.Equal(t, q1.ArgsKey(), q2.ArgsKey())
+	q2.Args.StartLine = 10
+	assert.NotEqual(t, q1.ArgsKey(), q2.ArgsKey())
+}
+
+func TestQueryArgsKeyOutput(t *testing.T) {
+	q1 := Query{Func: "concExample", Args: ConcQueryArgs{Query: "[word=\"x\"]"}}
+	q2 := q1
+	q2.Args.Output = ConcOutputCount
+	assert.NotEqual(t, q1.ArgsKey(), q2.ArgsKey())
+}
@@ -0,0 +1,58 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+)
+
+// jobLimiter is a semaphore limiting number of jobs published
+// to workers and still waiting for their results. Once the limit
+// is reached, publishers wait until some of the running jobs finish.
+type jobLimiter struct {
+	slots chan struct{}
+}
+
+// acquire waits for a free job slot. In case the `ctx` is done
+// before a slot is available, the context error is returned.
+func (jl *jobLimiter) acquire(ctx context.Context) error {
+	select {
+	case jl.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (jl *jobLimiter) release() {
+	<-jl.slots
+}
+
+// inFlight returns number of currently acquired slots
+func (jl *jobLimiter) inFlight() int {
+	return len(jl.slots)
+}
+
+func (jl *jobLimiter) limit() int {
+	return cap(jl.slots)
+}
+
+func newJobLimiter(maxJobs int) *jobLimiter {
+	return &jobLimiter{slots: make(chan struct{}, maxJobs)}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobLimiterBurst(t *testing.T) {
+	limiter := newJobLimiter(4)
+	var running, maxRunning atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, limiter.acquire(context.Background()))
+			defer limiter.release()
+			curr := running.Add(1)
+			for {
+				prev := maxRunning.Load()
+				if curr <= prev || maxRunning.CompareAndSwap(prev, curr) {
+					break
+				}
+			}
+			assert.LessOrEqual(t, limiter.inFlight(), limiter.limit())
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(4), maxRunning.Load())
+	assert.Equal(t, 0, limiter.inFlight())
+}
+
+func TestJobLimiterAcquireCanceled(t *testing.T) {
+	limiter := newJobLimiter(1)
+	assert.NoError(t, limiter.acquire(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, limiter.acquire(ctx), context.DeadlineExceeded)
+	limiter.release()
+	assert.NoError(t, limiter.acquire(context.Background()))
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// MaxJobStatsWindow is the longest period job statistics
+	// can be summarized for
+	MaxJobStatsWindow = time.Hour
+)
+
+// jobStatsBucket aggregates jobs finished within a single second
+type jobStatsBucket struct {
+	second int64
+	num    int
+	total  time.Duration
+}
+
+// jobStats keeps processing times of recently finished jobs
+// (as measured by workers, i.e. without time spent in a queue)
+// aggregated in per-second buckets covering MaxJobStatsWindow.
+// So the memory used does not depend on the traffic.
+type jobStats struct {
+	mu      sync.Mutex
+	buckets []jobStatsBucket
+}
+
+func (js *jobStats) add(finished time.Time, duration time.Duration) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	sec := finished.Unix()
+	bucket := &js.buckets[sec%int64(len(js.buckets))]
+	if bucket.second != sec {
+		*bucket = jobStatsBucket{second: sec}
+	}
+	bucket.num++
+	bucket.total += duration
+}
+
+// summary returns number of jobs finished within the `window`
+// before `now` and their average processing time. The window
+// is limited to MaxJobStatsWindow.
+func (js *jobStats) summary(now time.Time, window time.Duration) (int, time.Duration) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	window = min(window, MaxJobStatsWindow)
+	var num int
+	var total time.Duration
+	to := now.Unix()
+	from := now.Add(-window).Unix()
+	for _, bucket := range js.buckets {
+		if bucket.second > from && bucket.second <= to {
+			num += bucket.num
+			total += bucket.total
+		}
+	}
+	if num == 0 {
+		return 0, 0
+	}
+	return num, total / time.Duration(num)
+}
+
+func newJobStats() *jobStats {
+	return &jobStats{
+		buckets: make([]jobStatsBucket, int(MaxJobStatsWindow/time.Second)),
+	}
+}
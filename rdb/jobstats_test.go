@@ -0,0 +1,70 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStatsSummary(t *testing.T) {
+	stats := newJobStats()
+	now := time.Now()
+	stats.add(now.Add(-10*time.Minute), 10*time.Second)
+	stats.add(now.Add(-2*time.Minute), 2*time.Second)
+	stats.add(now.Add(-time.Minute), 4*time.Second)
+	num, avg := stats.summary(now, 5*time.Minute)
+	assert.Equal(t, 2, num)
+	assert.Equal(t, 3*time.Second, avg)
+
+	num, avg = stats.summary(now, 30*time.Second)
+	assert.Equal(t, 0, num)
+	assert.Equal(t, time.Duration(0), avg)
+}
+
+func TestJobStatsSameSecond(t *testing.T) {
+	stats := newJobStats()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		stats.add(now, time.Duration(i+1)*time.Second)
+	}
+	num, avg := stats.summary(now, time.Minute)
+	assert.Equal(t, 5, num)
+	assert.Equal(t, 3*time.Second, avg)
+}
+
+func TestJobStatsExpiredBucketReused(t *testing.T) {
+	stats := newJobStats()
+	now := time.Now()
+	stats.add(now.Add(-MaxJobStatsWindow), 10*time.Second)
+	stats.add(now, 2*time.Second)
+	num, avg := stats.summary(now, MaxJobStatsWindow)
+	assert.Equal(t, 1, num)
+	assert.Equal(t, 2*time.Second, avg)
+}
+
+func TestJobStatsWindowLimit(t *testing.T) {
+	stats := newJobStats()
+	now := time.Now()
+	stats.add(now.Add(-30*time.Minute), 2*time.Second)
+	num, _ := stats.summary(now, 24*time.Hour)
+	assert.Equal(t, 1, num)
+}
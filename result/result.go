@@ -19,7 +19,13 @@
 package result
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
 )
 
 const (
@@ -31,13 +37,108 @@ const (
 	ResultTypeError        = "Error"
 )
 
+// CollocItem is a single collocate of a concordance match
+type CollocItem struct {
+	Word  string  `json:"word"`
+	Score float64 `json:"score"`
+	Freq  int64   `json:"freq"`
+}
+
+// FacetItem is a single value of a structural attribute
+// along with the number of matches within the value
+type FacetItem struct {
+	Value string `json:"value"`
+	Freq  int64  `json:"freq"`
+}
+
+// MalformedResultError is reported in case a worker result cannot
+// be deserialized. To prevent leaking of internal details to clients,
+// the error message contains just a job ID which can be used to find
+// the original error in the server log.
+type MalformedResultError struct {
+	JobID string
+}
+
+func (err *MalformedResultError) Error() string {
+	return fmt.Sprintf("failed to process worker result (job %s)", err.JobID)
+}
+
 type ConcResult struct {
 	Lines    []concordance.Line `json:"lines"`
 	ConcSize int                `json:"concSize"`
 	Query    string             `json:"query"`
-	Error    error              `json:"error"`
+
+	// WideLines contain the same matches as Lines (i.e. the slices
+	// are aligned) with the whole structure specified by
+	// ConcQueryArgs.WideContextStruct as a context
+	WideLines []concordance.Line `json:"wideLines,omitempty"`
+
+	// Collocs contains collocates of the match
+	// (filled in only if requested via ConcQueryArgs.CollocMaxItems)
+	Collocs []CollocItem `json:"collocs,omitempty"`
+
+	// Facets contains frequency distributions of the matches
+	// for structural attributes (e.g. `doc.genre`) specified
+	// in ConcQueryArgs.FacetAttrs
+	Facets map[string][]FacetItem `json:"facets,omitempty"`
+
+	// Forms contains word forms (along with their frequencies)
+	// of the tokens matching the query (filled in only by
+	// the `lemmaForms` function)
+	Forms []FacetItem `json:"forms,omitempty"`
+
+	// CorpusSize is a number of tokens of a corpus
+	// (filled in only by the `corpusSize` function)
+	CorpusSize int64 `json:"corpusSize,omitempty"`
+
+	// ProcTime is a time the worker spent processing the job
+	// (i.e. without the time the job waited in a queue)
+	ProcTime time.Duration `json:"procTime,omitempty"`
+
+	Error error `json:"error"`
 }
 
 func (res *ConcResult) NumLines() int {
 	return len(res.Lines)
 }
+
+// IsOutOfRangeError tells whether the `err` means that
+// the requested lines are out of the concordance range.
+// Please note that we cannot compare the errors directly
+// as results (incl. errors) are transmitted from workers
+// (wrapped by rdb.TransmittedError) and thus deserialized
+// to a different type. So we only search for the original
+// error message.
+func IsOutOfRangeError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), mango.ErrRowsRangeOutOfConc.Error())
+}
+
+// HasOutOfRangeError tells whether the result failed because
+// the requested lines are out of the concordance range
+// (see IsOutOfRangeError).
+func (res *ConcResult) HasOutOfRangeError() bool {
+	return IsOutOfRangeError(res.Error)
+}
+
+// HasPositionOutOfRangeError tells whether the result failed
+// because the requested corpus position (or structure number)
+// is out of corpus bounds. As the error is typically transmitted
+// from a worker (and wrapped by rdb.TransmittedError), we only
+// search for the original error message.
+func (res *ConcResult) HasPositionOutOfRangeError() bool {
+	return res.Error != nil && strings.Contains(res.Error.Error(), mango.ErrPositionOutOfRange.Error())
+}
+
+// HasMalformedResultError tells whether the result could not be
+// decoded (see MalformedResultError).
+func (res *ConcResult) HasMalformedResultError() bool {
+	var mErr *MalformedResultError
+	return errors.As(res.Error, &mErr)
+}
+
+// HasStructAttrNotFoundError tells whether the result failed because
+// of a non-existing structural attribute (see HasPositionOutOfRangeError
+// for the way the error is detected).
+func (res *ConcResult) HasStructAttrNotFoundError() bool {
+	return res.Error != nil && strings.Contains(res.Error.Error(), mango.ErrStructAttrNotFound.Error())
+}
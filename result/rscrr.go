@@ -19,18 +19,70 @@
 package result
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/czcorpus/mquery-common/concordance"
-	"github.com/czcorpus/mquery-sru/mango"
 )
 
+const (
+	RscStatusOK         RscStatus = "ok"
+	RscStatusOutOfRange RscStatus = "outOfRange"
+	RscStatusTimeout    RscStatus = "timeout"
+	RscStatusError      RscStatus = "error"
+)
+
+// RscStatus describes how a resource contributed to a result page
+type RscStatus string
+
 type item struct {
 	Name     string
 	CurrLine int
 	Err      error
 	Lines    ConcResult
 	Started  bool
+
+	numReturned int
+	numConsumed int
+}
+
+// RscSummary describes contribution of a single resource
+// (corpus) to the lines returned during an iteration.
+type RscSummary struct {
+	Name string
+
+	// NumReturned is a number of lines returned from the resource
+	NumReturned int
+
+	// NumConsumed is a number of lines taken from the resource
+	// including possible duplicates skipped due to deduplication
+	NumConsumed int
+
+	ConcSize int
+	Err      error
+}
+
+// HasMore tells whether the resource has more lines than those
+// consumed, provided that its lines started at `startLine`.
+func (rs RscSummary) HasMore(startLine int) bool {
+	return rs.Err == nil && startLine+rs.NumConsumed < rs.ConcSize
+}
+
+// Status provides a simplified description of the resource
+// state (mostly based on a possible error).
+func (rs RscSummary) Status() RscStatus {
+	switch {
+	case rs.Err == nil:
+		return RscStatusOK
+	case IsOutOfRangeError(rs.Err):
+		return RscStatusOutOfRange
+	case errors.Is(rs.Err, context.DeadlineExceeded):
+		return RscStatusTimeout
+	default:
+		return RscStatusError
+	}
 }
 
 // RoundRobinLineSel allows for fetching data from
@@ -43,6 +95,47 @@ type RoundRobinLineSel struct {
 	currIdx           int
 	maxLines          int
 	nextOutputLineIdx int
+
+	// seenLines is used for deduplication of lines (nil = disabled)
+	seenLines     map[string]struct{}
+	numDuplicates int
+
+	// grouped means that a resource is exhausted before
+	// we move to the next one (see EnableGrouping)
+	grouped bool
+}
+
+// EnableGrouping makes the iteration return all the lines
+// of a resource before moving to the next one (in the order
+// of resources passed to NewRoundRobinLineSel) instead of
+// taking the lines in the "round robin" style.
+// The method must be called before the iteration starts.
+func (r *RoundRobinLineSel) EnableGrouping() {
+	if r.iterationStarted() {
+		panic("cannot enable grouping of an already iterating RoundRobinLineSel")
+	}
+	r.grouped = true
+}
+
+// EnableDeduplication makes the iteration skip lines with
+// the same content as some of the already returned lines
+// (e.g. in case the same document is present in multiple
+// corpora). Skipped lines still occupy their slots within `maxLines`
+// so pages of a paginated result stay aligned with the ones obtained
+// without deduplication (i.e. a page may contain less than `maxLines`
+// lines and record positions must take NumDuplicates into account).
+// The method must be called before the iteration starts.
+func (r *RoundRobinLineSel) EnableDeduplication() {
+	if r.iterationStarted() {
+		panic("cannot enable deduplication of an already iterating RoundRobinLineSel")
+	}
+	r.seenLines = make(map[string]struct{})
+}
+
+// NumDuplicates returns number of lines skipped so far
+// due to deduplication.
+func (r *RoundRobinLineSel) NumDuplicates() int {
+	return r.numDuplicates
 }
 
 func (r *RoundRobinLineSel) DescribeCurr() string {
@@ -67,6 +160,20 @@ func (r *RoundRobinLineSel) CurrLine() *concordance.Line {
 	return nil
 }
 
+// CurrWideLine returns the current line (see CurrLine) with a wide
+// context (see ConcResult.WideLines). In case the resource provides
+// no wide lines, nil is returned.
+func (r *RoundRobinLineSel) CurrWideLine() *concordance.Line {
+	if r.CurrLine() == nil {
+		return nil
+	}
+	lineNum := r.items[r.currIdx].CurrLine
+	if lineNum < len(r.items[r.currIdx].Lines.WideLines) {
+		return &r.items[r.currIdx].Lines.WideLines[lineNum]
+	}
+	return nil
+}
+
 // CurrRscName returns the currently set resource (corpus)
 // during iteration.
 func (r *RoundRobinLineSel) CurrRscName() string {
@@ -127,7 +234,7 @@ func (r *RoundRobinLineSel) HasFatalError() bool {
 func (r *RoundRobinLineSel) AllHasOutOfRangeError() bool {
 	var numMatch int
 	for _, v := range r.items {
-		if v.Err != nil && v.Err.Error() == mango.ErrRowsRangeOutOfConc.Error() {
+		if IsOutOfRangeError(v.Err) {
 			numMatch++
 		}
 	}
@@ -159,6 +266,44 @@ func (r *RoundRobinLineSel) IsEmpty() bool {
 // Also, once called for the first time, no new result sets
 // can be added (this causes the call to panic)
 func (r *RoundRobinLineSel) Next() bool {
+	for r.next() {
+		line := r.CurrLine()
+		if line == nil {
+			return true
+		}
+		r.items[r.currIdx].numConsumed++
+		if r.seenLines != nil {
+			key := lineContentKey(line)
+			if _, ok := r.seenLines[key]; ok {
+				r.numDuplicates++
+				continue
+			}
+			r.seenLines[key] = struct{}{}
+		}
+		r.items[r.currIdx].numReturned++
+		return true
+	}
+	return false
+}
+
+// Summary returns per-resource summary of the lines
+// returned so far. The order of items matches the order
+// of resources passed to NewRoundRobinLineSel.
+func (r *RoundRobinLineSel) Summary() []RscSummary {
+	ans := make([]RscSummary, len(r.items))
+	for i, v := range r.items {
+		ans[i] = RscSummary{
+			Name:        v.Name,
+			NumReturned: v.numReturned,
+			NumConsumed: v.numConsumed,
+			ConcSize:    v.Lines.ConcSize,
+			Err:         v.Err,
+		}
+	}
+	return ans
+}
+
+func (r *RoundRobinLineSel) next() bool {
 	if r.nextOutputLineIdx >= r.maxLines {
 		r.nextOutputLineIdx++
 		return false
@@ -166,6 +311,9 @@ func (r *RoundRobinLineSel) Next() bool {
 	if len(r.items) == 0 || r.IsEmpty() {
 		return false
 	}
+	if r.grouped {
+		return r.nextGrouped()
+	}
 
 	if !r.items[r.currIdx].Started {
 		r.nextOutputLineIdx++
@@ -196,6 +344,44 @@ func (r *RoundRobinLineSel) Next() bool {
 	return false
 }
 
+// nextGrouped is a variant of next() for the grouped mode
+// where we stay with the current resource until it runs
+// out of lines.
+func (r *RoundRobinLineSel) nextGrouped() bool {
+	for {
+		curr := &r.items[r.currIdx]
+		if !curr.Started {
+			curr.Started = true
+
+		} else {
+			curr.CurrLine++
+		}
+		if curr.CurrLine < len(curr.Lines.Lines) {
+			r.nextOutputLineIdx++
+			return true
+		}
+		if r.currIdx == len(r.items)-1 {
+			return false
+		}
+		r.currIdx++
+	}
+}
+
+// lineContentKey creates a key identifying line content. As
+// line refs are specific to individual corpora, only words
+// and KWIC flags are considered.
+func lineContentKey(line *concordance.Line) string {
+	var key strings.Builder
+	for _, token := range line.Text.Tokens() {
+		if token.Strong {
+			key.WriteString("\x01")
+		}
+		key.WriteString(token.Word)
+		key.WriteString("\x00")
+	}
+	return key.String()
+}
+
 // NewRoundRobinLineSel creates a new instance of NewRoundRobinLineSel
 // with correctly initialized attributes.
 func NewRoundRobinLineSel(maxLines int, items ...string) *RoundRobinLineSel {
@@ -19,9 +19,12 @@
 package result
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -273,3 +276,260 @@ func TestSingleResourceWithNoLines(t *testing.T) {
 	r := createSingleResourceEmptyResult()
 	assert.False(t, r.Next())
 }
+
+// TestPagingThroughResourcesOfDiffSizes pages through a multi-resource
+// result (with ranges calculated by query.CalculateExactRanges) and
+// makes sure there are no duplicate or missing records.
+func TestPagingThroughResourcesOfDiffSizes(t *testing.T) {
+	rscList := []string{"corp1", "corp2", "corp3"}
+	concSizes := map[string]int{"corp1": 5, "corp2": 17, "corp3": 2}
+	allLines := make(map[string][]concordance.Line)
+	expected := make([]string, 0, 24)
+	for _, rsc := range rscList {
+		for i := 0; i < concSizes[rsc]; i++ {
+			allLines[rsc] = append(
+				allLines[rsc],
+				concordance.Line{
+					Text: concordance.TokenSlice{
+						&concordance.Token{Word: fmt.Sprintf("%s-%d", rsc, i)}},
+				},
+			)
+		}
+	}
+	for round := 0; round < 17; round++ {
+		for _, rsc := range rscList {
+			if round < concSizes[rsc] {
+				expected = append(expected, fmt.Sprintf("%s-%d", rsc, round))
+			}
+		}
+	}
+
+	for _, pageSize := range []int{1, 3, 4, 7, 10} {
+		fetched := make([]string, 0, len(expected))
+		for offset := 0; offset < len(expected); {
+			ranges := query.CalculateExactRanges(rscList, concSizes, offset, pageSize)
+			r := NewRoundRobinLineSel(pageSize, ranges.PIDList()...)
+			for _, rng := range ranges {
+				lines := allLines[rng.Rsc][min(rng.From, concSizes[rng.Rsc]):min(rng.To, concSizes[rng.Rsc])]
+				r.SetRscLines(rng.Rsc, ConcResult{Lines: lines})
+			}
+			var numFetched int
+			for r.Next() {
+				fetched = append(fetched, firstWord(r.CurrLine()))
+				numFetched++
+			}
+			assert.Greater(t, numFetched, 0)
+			if numFetched == 0 {
+				break
+			}
+			offset += numFetched
+		}
+		assert.Equal(t, expected, fetched, "page size %d", pageSize)
+	}
+}
+
+func TestDeduplicationSkipsSameContent(t *testing.T) {
+	r := NewRoundRobinLineSel(3, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}, Ref: "#10"},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo2"}}, Ref: "#20"},
+	}})
+	r.SetRscLines("corp2", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}, Ref: "#117"},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "bar2"}}, Ref: "#130"},
+	}})
+	r.EnableDeduplication()
+	fetched := make([]string, 0, 3)
+	for r.Next() {
+		fetched = append(fetched, firstWord(r.CurrLine()))
+	}
+	// the skipped duplicate occupies one of the three slots
+	assert.Equal(t, []string{"foo1", "foo2"}, fetched)
+	assert.Equal(t, 1, r.NumDuplicates())
+}
+
+// TestPagingWithDeduplication makes sure deduplicated pages are aligned
+// with pages obtained without deduplication (even if resources provide
+// more lines than needed for the page) so no record is returned twice
+// and no record is lost.
+func TestPagingWithDeduplication(t *testing.T) {
+	rscList := []string{"corp1", "corp2"}
+	words := map[string][]string{
+		"corp1": {"a", "b", "c", "d", "e"},
+		"corp2": {"a", "x", "y", "b", "z"},
+	}
+	concSizes := map[string]int{"corp1": 5, "corp2": 5}
+	pageSize := 3
+	fetched := make([]string, 0, 10)
+	for offset := 0; offset < 10; offset += pageSize {
+		ranges := query.CalculateExactRanges(rscList, concSizes, offset, pageSize)
+		r := NewRoundRobinLineSel(pageSize, ranges.PIDList()...)
+		r.EnableDeduplication()
+		for _, rng := range ranges {
+			// like workers, provide up to pageSize lines from the range start
+			lines := make([]concordance.Line, 0, pageSize)
+			for _, w := range words[rng.Rsc][min(rng.From, 5):min(rng.From+pageSize, 5)] {
+				lines = append(lines, concordance.Line{
+					Text: concordance.TokenSlice{&concordance.Token{Word: w}}})
+			}
+			r.SetRscLines(rng.Rsc, ConcResult{ConcSize: concSizes[rng.Rsc], Lines: lines})
+		}
+		for r.Next() {
+			fetched = append(fetched, firstWord(r.CurrLine()))
+		}
+	}
+	// without deduplication, pages are [a a b] [x c y] [d b e] [z]; duplicates
+	// within a page are skipped ("a"), the ones spread over pages are not ("b")
+	assert.Equal(t, []string{"a", "b", "x", "c", "y", "d", "b", "e", "z"}, fetched)
+}
+
+func TestDeduplicationDistinguishesKWIC(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{
+			&concordance.Token{Word: "foo", Strong: true}, &concordance.Token{Word: "bar"}}},
+	}})
+	r.SetRscLines("corp2", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{
+			&concordance.Token{Word: "foo"}, &concordance.Token{Word: "bar", Strong: true}}},
+	}})
+	r.EnableDeduplication()
+	var numFetched int
+	for r.Next() {
+		numFetched++
+	}
+	assert.Equal(t, 2, numFetched)
+	assert.Equal(t, 0, r.NumDuplicates())
+}
+
+func TestDeduplicationDisabledByDefault(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}},
+	}})
+	r.SetRscLines("corp2", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}},
+	}})
+	var numFetched int
+	for r.Next() {
+		numFetched++
+	}
+	assert.Equal(t, 2, numFetched)
+}
+
+func TestSummaryCountsLinesPerResource(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2", "corp3")
+	r.SetRscLines("corp1", ConcResult{ConcSize: 10, Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo2"}}},
+	}})
+	r.SetRscLines("corp2", ConcResult{ConcSize: 1, Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "bar1"}}},
+	}})
+	r.RscSetErrorAt(2, mango.ErrRowsRangeOutOfConc)
+	for r.Next() {
+	}
+	summary := r.Summary()
+	assert.Equal(t, 3, len(summary))
+	assert.Equal(t, "corp1", summary[0].Name)
+	assert.Equal(t, 2, summary[0].NumReturned)
+	assert.True(t, summary[0].HasMore(0))
+	assert.False(t, summary[0].HasMore(8))
+	assert.Equal(t, RscStatusOK, summary[0].Status())
+	assert.Equal(t, 1, summary[1].NumReturned)
+	assert.False(t, summary[1].HasMore(0))
+	assert.Equal(t, 0, summary[2].NumReturned)
+	assert.Equal(t, RscStatusOutOfRange, summary[2].Status())
+}
+
+func TestSummaryWithDeduplication(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcResult{ConcSize: 2, Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo2"}}},
+	}})
+	r.SetRscLines("corp2", ConcResult{ConcSize: 2, Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "bar2"}}},
+	}})
+	r.EnableDeduplication()
+	for r.Next() {
+	}
+	summary := r.Summary()
+	assert.Equal(t, 2, summary[0].NumReturned)
+	assert.Equal(t, 1, summary[1].NumReturned)
+	assert.Equal(t, 2, summary[1].NumConsumed)
+	assert.False(t, summary[1].HasMore(0))
+}
+
+func TestCurrWideLineFollowsCurrLine(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcResult{
+		Lines: []concordance.Line{
+			{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}},
+			{Text: concordance.TokenSlice{&concordance.Token{Word: "foo2"}}},
+		},
+		WideLines: []concordance.Line{
+			{Text: concordance.TokenSlice{&concordance.Token{Word: "wide1"}}},
+			{Text: concordance.TokenSlice{&concordance.Token{Word: "wide2"}}},
+		},
+	})
+	r.SetRscLines("corp2", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "bar1"}}},
+	}})
+	assert.True(t, r.Next())
+	assert.Equal(t, "wide1", firstWord(r.CurrWideLine()))
+	assert.True(t, r.Next())
+	assert.Equal(t, "bar1", firstWord(r.CurrLine()))
+	assert.Nil(t, r.CurrWideLine())
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo2", firstWord(r.CurrLine()))
+	assert.Equal(t, "wide2", firstWord(r.CurrWideLine()))
+	assert.False(t, r.Next())
+	assert.Nil(t, r.CurrWideLine())
+}
+
+func TestGroupingExhaustsResourceFirst(t *testing.T) {
+	r := createResourceWithSomeEmpty()
+	r.EnableGrouping()
+	fetched := make([]string, 0, 6)
+	for r.Next() {
+		fetched = append(fetched, firstWord(r.CurrLine()))
+	}
+	assert.Equal(t, []string{"bar1", "bar2", "bar3", "baz1", "baz2", "baz3"}, fetched)
+}
+
+func TestGroupingRespectsMaxLines(t *testing.T) {
+	r := NewRoundRobinLineSel(3, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo1"}}, Ref: "#10"},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "foo2"}}, Ref: "#20"},
+	}})
+	r.SetRscLines("corp2", ConcResult{Lines: []concordance.Line{
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "bar1"}}, Ref: "#117"},
+		{Text: concordance.TokenSlice{&concordance.Token{Word: "bar2"}}, Ref: "#130"},
+	}})
+	r.EnableGrouping()
+	fetched := make([]string, 0, 3)
+	for r.Next() {
+		fetched = append(fetched, firstWord(r.CurrLine()))
+	}
+	assert.Equal(t, []string{"foo1", "foo2", "bar1"}, fetched)
+	summ := r.Summary()
+	assert.Equal(t, 2, summ[0].NumReturned)
+	assert.Equal(t, 1, summ[1].NumReturned)
+}
+
+func TestSummaryStatusOfTransmittedOutOfRangeError(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2")
+	transmitted := fmt.Errorf("TransmittedError(*errors.errorString: %s)", mango.ErrRowsRangeOutOfConc)
+	r.RscSetErrorAt(0, transmitted)
+	r.RscSetErrorAt(1, transmitted)
+	assert.True(t, r.AllHasOutOfRangeError())
+	for r.Next() {
+	}
+	summary := r.Summary()
+	assert.Equal(t, RscStatusOutOfRange, summary[0].Status())
+	res := ConcResult{Error: transmitted}
+	assert.True(t, res.HasOutOfRangeError())
+}
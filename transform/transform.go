@@ -0,0 +1,144 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package transform
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/czcorpus/mquery-common/concordance"
+)
+
+const (
+	TransformerStripMarkup      = "strip-markup"
+	TransformerMergeHyphenation = "merge-hyphenation"
+)
+
+var markupRegexp = regexp.MustCompile(`<[^<>]*>`)
+
+// Transformer creates a transformed version of a concordance line
+// for resources with specific needs (e.g. corpora with internal markup
+// in tokens). The original line must not be modified as it may be
+// shared (e.g. cached).
+type Transformer func(line concordance.Line) concordance.Line
+
+var registry = map[string]Transformer{
+	TransformerStripMarkup:      stripMarkup,
+	TransformerMergeHyphenation: mergeHyphenation,
+}
+
+// Exists tests whether there is a transformer with the provided name
+func Exists(name string) bool {
+	_, ok := registry[name]
+	return ok
+}
+
+// Names returns sorted names of all the available transformers
+func Names() []string {
+	ans := make([]string, 0, len(registry))
+	for k := range registry {
+		ans = append(ans, k)
+	}
+	sort.Strings(ans)
+	return ans
+}
+
+// Apply applies transformers with the provided names (in the order
+// of the names) to a line. In case there are no names, the original
+// line is returned. Unknown names are ignored (names are expected
+// to be validated when loading configuration).
+func Apply(names []string, line *concordance.Line) *concordance.Line {
+	if len(names) == 0 {
+		return line
+	}
+	ans := *line
+	for _, name := range names {
+		if fn, ok := registry[name]; ok {
+			ans = fn(ans)
+		}
+	}
+	return &ans
+}
+
+// stripMarkup removes XML-like tags from words and attribute values
+// of tokens. Tokens consisting only of markup are removed unless
+// they are part of a hit.
+func stripMarkup(line concordance.Line) concordance.Line {
+	text := make(concordance.TokenSlice, 0, len(line.Text))
+	for _, elm := range line.Text {
+		token, ok := elm.(*concordance.Token)
+		if !ok {
+			text = append(text, elm)
+			continue
+		}
+		word := strings.TrimSpace(markupRegexp.ReplaceAllString(token.Word, ""))
+		if word == "" && token.Word != "" && !token.Strong {
+			continue
+		}
+		newToken := *token
+		newToken.Word = word
+		if len(token.Attrs) > 0 {
+			newToken.Attrs = make(map[string]string, len(token.Attrs))
+			for k, v := range token.Attrs {
+				newToken.Attrs[k] = markupRegexp.ReplaceAllString(v, "")
+			}
+		}
+		text = append(text, &newToken)
+	}
+	line.Text = text
+	return line
+}
+
+// mergeHyphenation joins words split by hyphenation (e.g. `exam-` `ple`)
+// into a single token. Attributes of the first part are preserved.
+// Structures between the parts are kept (after the merged token).
+func mergeHyphenation(line concordance.Line) concordance.Line {
+	text := make(concordance.TokenSlice, 0, len(line.Text))
+	skip := make(map[int]bool)
+	for i, elm := range line.Text {
+		if skip[i] {
+			continue
+		}
+		token, ok := elm.(*concordance.Token)
+		if !ok || len(token.Word) < 2 || !strings.HasSuffix(token.Word, "-") {
+			text = append(text, elm)
+			continue
+		}
+		next := -1
+		for j := i + 1; j < len(line.Text); j++ {
+			if _, ok := line.Text[j].(*concordance.Token); ok {
+				next = j
+				break
+			}
+		}
+		if next < 0 {
+			text = append(text, elm)
+			continue
+		}
+		nextToken := line.Text[next].(*concordance.Token)
+		newToken := *token
+		newToken.Word = strings.TrimSuffix(token.Word, "-") + nextToken.Word
+		newToken.Strong = token.Strong || nextToken.Strong
+		text = append(text, &newToken)
+		skip[next] = true
+	}
+	line.Text = text
+	return line
+}
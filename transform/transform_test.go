@@ -0,0 +1,83 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/stretchr/testify/assert"
+)
+
+func words(line *concordance.Line) []string {
+	ans := make([]string, 0, len(line.Text))
+	for _, token := range line.Text.Tokens() {
+		ans = append(ans, token.Word)
+	}
+	return ans
+}
+
+func TestApplyNoTransformers(t *testing.T) {
+	line := &concordance.Line{Text: concordance.TokenSlice{&concordance.Token{Word: "<b>foo</b>"}}}
+	assert.Same(t, line, Apply(nil, line))
+}
+
+func TestStripMarkup(t *testing.T) {
+	line := &concordance.Line{Text: concordance.TokenSlice{
+		&concordance.Token{Word: "<b>foo</b>", Attrs: map[string]string{"lemma": "<i>foo</i>"}},
+		&concordance.Token{Word: "<lb/>"},
+		&concordance.Token{Word: "bar", Strong: true},
+	}}
+	ans := Apply([]string{TransformerStripMarkup}, line)
+	assert.Equal(t, []string{"foo", "bar"}, words(ans))
+	assert.Equal(t, "foo", ans.Text.Tokens()[0].Attrs["lemma"])
+	assert.True(t, ans.Text.Tokens()[1].Strong)
+	// the original line must stay untouched
+	assert.Equal(t, []string{"<b>foo</b>", "<lb/>", "bar"}, words(line))
+	assert.Equal(t, "<i>foo</i>", line.Text.Tokens()[0].Attrs["lemma"])
+}
+
+func TestMergeHyphenation(t *testing.T) {
+	line := &concordance.Line{Text: concordance.TokenSlice{
+		&concordance.Token{Word: "an"},
+		&concordance.Token{Word: "exam-"},
+		&concordance.Token{Word: "ple", Strong: true},
+		&concordance.Token{Word: "-"},
+		&concordance.Token{Word: "end-"},
+	}}
+	ans := Apply([]string{TransformerMergeHyphenation}, line)
+	assert.Equal(t, []string{"an", "example", "-", "end-"}, words(ans))
+	assert.True(t, ans.Text.Tokens()[1].Strong)
+	assert.Equal(t, []string{"an", "exam-", "ple", "-", "end-"}, words(line))
+}
+
+func TestApplyMultiple(t *testing.T) {
+	line := &concordance.Line{Text: concordance.TokenSlice{
+		&concordance.Token{Word: "<i>exam-</i>"},
+		&concordance.Token{Word: "ple"},
+	}}
+	ans := Apply([]string{TransformerStripMarkup, TransformerMergeHyphenation}, line)
+	assert.Equal(t, []string{"example"}, words(ans))
+}
+
+func TestExists(t *testing.T) {
+	assert.True(t, Exists(TransformerStripMarkup))
+	assert.False(t, Exists("foo"))
+	assert.Equal(t, []string{TransformerMergeHyphenation, TransformerStripMarkup}, Names())
+}
@@ -19,10 +19,44 @@
 package worker
 
 import (
+	"fmt"
 	"strings"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	lineTooLongPlaceholder = "---- ERROR (line too long) ----"
 )
 
 func extractAttrFromTTCrit(crit string) string {
 	tmp := strings.Split(crit, " ")
 	return tmp[0]
 }
+
+// parseLines parses raw concordance lines. Lines longer than
+// `maxLength` bytes are not parsed at all. Instead, they are replaced
+// by a placeholder line with ErrMsg set (the same way the LineParser
+// handles unparseable lines). Zero `maxLength` means no limit.
+func parseLines(parser *concordance.LineParser, lines []string, maxLength int) []concordance.Line {
+	if maxLength == 0 {
+		return parser.Parse(lines)
+	}
+	ans := make([]concordance.Line, len(lines))
+	for i, line := range lines {
+		if len(line) > maxLength {
+			log.Warn().
+				Int("length", len(line)).
+				Int("maxLength", maxLength).
+				Msg("concordance line too long, replacing with a placeholder")
+			ans[i] = concordance.Line{
+				Text:   concordance.TokenSlice{&concordance.Token{Word: lineTooLongPlaceholder}},
+				ErrMsg: fmt.Sprintf("raw concordance line too long (%d bytes, max. %d)", len(line), maxLength),
+			}
+			continue
+		}
+		ans[i] = parser.Parse([]string{line})[0]
+	}
+	return ans
+}
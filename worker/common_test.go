@@ -0,0 +1,61 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinesTooLong(t *testing.T) {
+	parser := concordance.NewLineParser([]string{"word", "lemma"})
+	short := "#1 " + concordance.RefsEndMark + " dogs {} /dog attr"
+	long := "#2 " + concordance.RefsEndMark + " " + strings.Repeat("dogs {} /dog attr ", 10)
+	lines := parseLines(parser, []string{short, long}, 50)
+	assert.Len(t, lines, 2)
+	assert.Empty(t, lines[0].ErrMsg)
+	assert.Equal(t, "#1", lines[0].Ref)
+	assert.Contains(t, lines[1].ErrMsg, "too long")
+	assert.Equal(t, lineTooLongPlaceholder, lines[1].Text.Tokens()[0].Word)
+}
+
+func TestParseLinesNoLimit(t *testing.T) {
+	parser := concordance.NewLineParser([]string{"word", "lemma"})
+	long := "#2 " + concordance.RefsEndMark + " " + strings.Repeat("dogs {} /dog attr ", 10)
+	lines := parseLines(parser, []string{long}, 0)
+	assert.Empty(t, lines[0].ErrMsg)
+	assert.Len(t, lines[0].Text.Tokens(), 10)
+}
+
+func TestDecodeSortedValues(t *testing.T) {
+	codec, err := newTextCodec("iso-8859-2")
+	assert.NoError(t, err)
+	// "ł" (0xB3) precedes "ß" (0xDF) in ISO-8859-2 but not in UTF-8
+	values := []mango.GoFreqItem{{Value: "a", Freq: 1}, {Value: "\xb3", Freq: 2}, {Value: "\xdf", Freq: 3}}
+	assert.Equal(
+		t,
+		[]result.FacetItem{{Value: "a", Freq: 1}, {Value: "ß", Freq: 3}, {Value: "ł", Freq: 2}},
+		decodeSortedValues(codec, values),
+	)
+}
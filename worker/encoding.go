@@ -0,0 +1,74 @@
+// Copyright 2023 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2023 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/general"
+
+	"golang.org/x/text/encoding"
+)
+
+// textCodec converts texts between UTF-8 (used by the service)
+// and an encoding of a corpus (e.g. legacy latin2 corpora).
+type textCodec struct {
+	enc encoding.Encoding
+}
+
+// toCorpus converts a UTF-8 text (typically a query) to the corpus encoding
+func (c textCodec) toCorpus(s string) (string, error) {
+	if c.enc == nil {
+		return s, nil
+	}
+	ans, err := c.enc.NewEncoder().String(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode text for the corpus: %w", err)
+	}
+	return ans, nil
+}
+
+// fromCorpus converts a text produced by Manatee to UTF-8. Invalid
+// byte sequences are replaced so the text can be safely serialized
+// (e.g. to XML).
+func (c textCodec) fromCorpus(s string) string {
+	if c.enc != nil {
+		ans, err := c.enc.NewDecoder().String(s)
+		if err == nil {
+			return ans
+		}
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+func (c textCodec) linesFromCorpus(lines []string) []string {
+	for i, line := range lines {
+		lines[i] = c.fromCorpus(line)
+	}
+	return lines
+}
+
+func newTextCodec(encName string) (textCodec, error) {
+	enc, err := general.GetEncoding(encName)
+	if err != nil {
+		return textCodec{}, err
+	}
+	return textCodec{enc: enc}, nil
+}
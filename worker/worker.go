@@ -22,9 +22,12 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/mango"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/result"
@@ -36,6 +39,17 @@ import (
 const (
 	DefaultTickerInterval = 2 * time.Second
 	MaxFreqResultItems    = 100
+	MinCollocFreq         = 3
+
+	// ListenerCheckInterval specifies how often a worker checks
+	// whether someone still waits for the result of a running job
+	ListenerCheckInterval = 1 * time.Second
+
+	// MaxRareFormsScanBatches limits number of concordance batches
+	// (of mango.MaxRecordsInternalLimit lines) read by the minFormFreq
+	// filter. As each batch means a new evaluation of the query,
+	// the filter gives up on lines located further in the concordance.
+	MaxRareFormsScanBatches = 10
 )
 
 type jobLogger interface {
@@ -44,17 +58,27 @@ type jobLogger interface {
 
 type Worker struct {
 	ID         string
+	queues     []string
 	messages   <-chan *redis.Message
 	radapter   *rdb.Adapter
 	ctx        context.Context
 	ticker     *time.Ticker
 	jobLogger  jobLogger
 	currJobLog *result.JobLog
+
+	// registryDir is a directory all the corpora
+	// opened by the worker must be located in
+	registryDir string
+
+	// maxRawLineLength is a max. length of a raw concordance
+	// line to be parsed (see corpus.CorporaSetup.MaxRawLineLength)
+	maxRawLineLength int
 }
 
 func (w *Worker) publishResult(res *result.ConcResult, channel string) error {
 	w.currJobLog.End = time.Now()
 	w.currJobLog.Err = res.Error
+	res.ProcTime = w.currJobLog.End.Sub(w.currJobLog.Begin)
 	w.jobLogger.Log(*w.currJobLog)
 	w.currJobLog = nil
 	return w.radapter.PublishResult(channel, res)
@@ -62,7 +86,7 @@ func (w *Worker) publishResult(res *result.ConcResult, channel string) error {
 
 func (w *Worker) tryNextQuery() error {
 	time.Sleep(time.Duration(rand.Intn(40)) * time.Millisecond)
-	query, err := w.radapter.DequeueQuery()
+	query, err := w.radapter.DequeueQuery(w.queues)
 	if err == rdb.ErrorEmptyQueue {
 		return nil
 
@@ -93,13 +117,80 @@ func (w *Worker) tryNextQuery() error {
 		Func:     query.Func,
 		Begin:    time.Now(),
 	}
-	ans := w.ConcResult(query.Args)
+	// there is no point in calculating the result once the handler stops
+	// waiting for it
+	jobCtx, cancel := context.WithTimeout(w.ctx, w.radapter.QueryAnswerTimeout())
+	defer cancel()
+	go w.cancelIfAbandoned(jobCtx, cancel, query)
+	var ans *result.ConcResult
+	if err := w.validateCorpusPath(query.Args); err != nil {
+		log.Error().
+			Err(err).
+			Str("func", query.Func).
+			Str("channel", query.Channel).
+			Msg("worker rejected a query")
+		ans = &result.ConcResult{Error: err}
+		if err := w.publishResult(ans, query.Channel); err != nil {
+			return fmt.Errorf("failed to publish result: %w", err)
+		}
+		return nil
+	}
+	switch query.Func {
+	case "positionContext":
+		ans = w.PositionContext(query.Args)
+	case "lemmaForms":
+		ans = w.LemmaForms(jobCtx, query.Args)
+	case "corpusSize":
+		ans = w.CorpusSize(query.Args)
+	case "collocations":
+		ans = w.Collocations(jobCtx, query.Args)
+	case "structAttrValues":
+		ans = w.StructAttrValues(jobCtx, query.Args)
+	default:
+		ans = w.ConcResult(jobCtx, query.Args)
+	}
 	if err := w.publishResult(ans, query.Channel); err != nil {
 		return fmt.Errorf("failed to publish result: %w", err)
 	}
 	return nil
 }
 
+// validateCorpusPath tests whether the corpus the query refers to
+// is located within the worker's registry directory. As the path
+// is created by the server from a resource ID, this is the last line
+// of defense against IDs escaping the directory (e.g. `../../etc/passwd`).
+func (w *Worker) validateCorpusPath(args rdb.ConcQueryArgs) error {
+	return corpus.ValidateRegistryPath(w.registryDir, args.CorpusPath)
+}
+
+// cancelIfAbandoned periodically checks whether someone still
+// listens for the query result and if not, it cancels the job
+// (e.g. in case the original HTTP request has been canceled).
+func (w *Worker) cancelIfAbandoned(ctx context.Context, cancel context.CancelFunc, query rdb.Query) {
+	ticker := time.NewTicker(ListenerCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			isActive, err := w.radapter.SomeoneListens(query)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to check query listeners")
+				continue
+			}
+			if !isActive {
+				log.Warn().
+					Str("func", query.Func).
+					Str("channel", query.Channel).
+					Msg("nobody waits for the query result anymore, canceling")
+				cancel()
+				return
+			}
+		}
+	}
+}
+
 func (w *Worker) Listen() {
 	for {
 		select {
@@ -125,7 +216,7 @@ func (w *Worker) Listen() {
 	}
 }
 
-func (w *Worker) ConcResult(args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+func (w *Worker) ConcResult(ctx context.Context, args rdb.ConcQueryArgs) (ans *result.ConcResult) {
 	ans = &result.ConcResult{Query: args.Query}
 	defer func() {
 		if r := recover(); r != nil {
@@ -135,45 +226,521 @@ func (w *Worker) ConcResult(args rdb.ConcQueryArgs) (ans *result.ConcResult) {
 			}
 		}
 	}()
+	codec, err := newTextCodec(args.Encoding)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	corpQuery, err := codec.toCorpus(args.Query)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	if args.Output != rdb.ConcOutputFull {
+		// no lines are needed so we ask Manatee just for the concordance size
+		args.StartLine = 0
+		args.MaxItems = 0
+		args.WideContextStruct = ""
+	}
 	concEx, err := mango.GetConcordance(
+		ctx,
 		args.CorpusPath,
-		args.Query,
+		corpQuery,
 		args.Attrs,
-		[]string{},
+		glueStructs(args),
 		[]string{},
 		args.StartLine,
 		args.MaxItems,
 		args.MaxContext,
 		args.ViewContextStruct,
+		args.WideContextStruct,
+		args.WideMaxContext,
+		args.SortCrit,
 	)
 	log.Debug().
 		Str("query", args.Query).
+		Str("output", string(args.Output)).
 		Int("concSize", concEx.ConcSize).
 		Err(err).
 		Msg("obtained concordance result")
+	// we need the size even in case of an out of range error
+	// so the handler can recalculate ranges of individual resources
+	ans.ConcSize = concEx.ConcSize
+	// collocations and facets do not depend on the requested range of lines
+	// so they are provided even for an out of range request (the handler may
+	// re-fetch just the lines once it knows sizes of all the concordances)
+	var rangeErr error
+	if err == mango.ErrRowsRangeOutOfConc {
+		rangeErr = err
+
+	} else if err != nil {
+		ans.Error = err
+		return
+	}
+	if args.Output == rdb.ConcOutputFull && rangeErr == nil {
+		parser := concordance.NewLineParser(args.Attrs)
+		ans.Lines = parseLines(parser, codec.linesFromCorpus(concEx.Lines), w.maxRawLineLength)
+		if args.WideContextStruct != "" {
+			ans.WideLines = parseLines(parser, codec.linesFromCorpus(concEx.WideLines), w.maxRawLineLength)
+		}
+	}
+	if args.MinFormFreq > 0 && rangeErr == nil {
+		err := w.filterRareForms(ctx, args, corpQuery, codec, ans)
+		if err == mango.ErrRowsRangeOutOfConc {
+			rangeErr = err
+
+		} else if err != nil {
+			ans.Error = err
+			return
+		}
+	}
+
+	switch args.Output {
+	case rdb.ConcOutputCount:
+		return
+	case rdb.ConcOutputFacets:
+		ans.Error = w.facets(ctx, args, corpQuery, codec, ans)
+		return
+	}
+
+	if args.CollocMaxItems > 0 {
+		ans.Collocs, err = w.collocations(ctx, args, corpQuery, codec)
+		if err != nil {
+			ans.Error = err
+			return
+		}
+	}
+	ans.Error = w.facets(ctx, args, corpQuery, codec, ans)
+	if ans.Error == nil {
+		ans.Error = rangeErr
+	}
+	return
+}
+
+// facets calculates frequency distributions of the query matches
+// for all the args.FacetAttrs and stores them in `ans`
+func (w *Worker) facets(
+	ctx context.Context,
+	args rdb.ConcQueryArgs,
+	corpQuery string,
+	codec textCodec,
+	ans *result.ConcResult,
+) error {
+	if len(args.FacetAttrs) == 0 {
+		return nil
+	}
+	ans.Facets = make(map[string][]result.FacetItem)
+	for _, attr := range args.FacetAttrs {
+		freqs, err := mango.GetFreqDist(
+			ctx,
+			args.CorpusPath,
+			corpQuery,
+			attr+" 0",
+			1,
+			args.FacetMaxItems,
+		)
+		if err != nil {
+			return err
+		}
+		ans.Facets[attr] = make([]result.FacetItem, len(freqs))
+		for i, item := range freqs {
+			ans.Facets[attr][i] = result.FacetItem{
+				Value: codec.fromCorpus(item.Value),
+				Freq:  item.Freq,
+			}
+		}
+	}
+	return nil
+}
+
+// glueStructs returns structures to be included in concordance lines
+// so the original spacing of tokens can be reconstructed
+func glueStructs(args rdb.ConcQueryArgs) []string {
+	if args.GlueStruct == "" {
+		return []string{}
+	}
+	return []string{args.GlueStruct}
+}
+
+// collocations calculates collocates of the query matches
+// as specified by the Colloc* arguments
+func (w *Worker) collocations(
+	ctx context.Context,
+	args rdb.ConcQueryArgs,
+	corpQuery string,
+	codec textCodec,
+) ([]result.CollocItem, error) {
+	measure, err := mango.ParseCollMeasure(args.CollocMeasure)
+	if err != nil {
+		return nil, err
+	}
+	minFreq := args.CollocMinFreq
+	if minFreq == 0 {
+		minFreq = MinCollocFreq
+	}
+	colls, err := mango.GetCollocations(
+		ctx,
+		args.CorpusPath,
+		corpQuery,
+		args.CollocAttr,
+		measure,
+		-args.CollocWindow,
+		args.CollocWindow,
+		minFreq,
+		args.CollocMaxItems,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ans := make([]result.CollocItem, len(colls))
+	for i, item := range colls {
+		ans[i] = result.CollocItem{
+			Word:  codec.fromCorpus(item.Word),
+			Score: item.Score,
+			Freq:  item.Freq,
+		}
+	}
+	return ans, nil
+}
+
+// Collocations returns just collocates (see rdb.ConcQueryArgs.Colloc*)
+// of the query matches without any concordance lines.
+func (w *Worker) Collocations(ctx context.Context, args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+	ans = &result.ConcResult{Query: args.Query}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.ConcResult{
+				Error:   fmt.Errorf("%v", r),
+				Collocs: make([]result.CollocItem, 0),
+			}
+		}
+	}()
+	codec, err := newTextCodec(args.Encoding)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	corpQuery, err := codec.toCorpus(args.Query)
 	if err != nil {
 		ans.Error = err
 		return
 	}
+	ans.Collocs, err = w.collocations(ctx, args, corpQuery, codec)
+	if err != nil {
+		ans.Error = err
+	}
+	return
+}
+
+// filterRareForms replaces concordance lines in `ans` with the lines
+// whose match form (the first matching token) occurs at least
+// args.MinFormFreq times. Both the returned concordance size and the
+// args.StartLine refer to the filtered concordance. As Manatee cannot
+// filter the concordance this way, the lines preceding the requested
+// range must be read (and filtered) too (see MaxRareFormsScanBatches).
+func (w *Worker) filterRareForms(
+	ctx context.Context,
+	args rdb.ConcQueryArgs,
+	corpQuery string,
+	codec textCodec,
+	ans *result.ConcResult,
+) error {
+	freqs, err := mango.GetFormFreqs(ctx, args.CorpusPath, corpQuery, args.Attrs[0], args.MinFormFreq)
+	if err != nil {
+		return err
+	}
+	if len(freqs) == mango.MaxFormFreqItemsInternalLimit {
+		log.Warn().
+			Str("query", args.Query).
+			Msg("too many distinct match forms, minFormFreq filter not applied")
+		return nil
+	}
+	allowed := make(map[string]bool)
+	var filteredSize int
+	for _, item := range freqs {
+		allowed[codec.fromCorpus(item.Value)] = true
+		filteredSize += int(item.Freq)
+	}
+	if filteredSize == ans.ConcSize {
+		return nil // nothing to filter
+	}
+	ans.ConcSize = filteredSize
+	if args.MaxItems == 0 {
+		return nil // only the concordance size has been requested
+	}
+	if args.StartLine >= filteredSize {
+		ans.Lines = []concordance.Line{}
+		ans.WideLines = nil
+		return mango.ErrRowsRangeOutOfConc
+	}
+	return w.collectFrequentFormLines(
+		func(fromLine int) (mango.GoConcordance, error) {
+			return mango.GetConcordance(
+				ctx,
+				args.CorpusPath,
+				corpQuery,
+				args.Attrs,
+				glueStructs(args),
+				[]string{},
+				fromLine,
+				mango.MaxRecordsInternalLimit,
+				args.MaxContext,
+				args.ViewContextStruct,
+				args.WideContextStruct,
+				args.WideMaxContext,
+				args.SortCrit,
+			)
+		},
+		allowed,
+		args,
+		codec,
+		ans,
+	)
+}
+
+// concBatchLoader loads max. mango.MaxRecordsInternalLimit
+// concordance lines starting at `fromLine`
+type concBatchLoader func(fromLine int) (mango.GoConcordance, error)
+
+// collectFrequentFormLines reads concordance batches using `load`
+// and fills `ans` with the requested range of lines whose match
+// form is `allowed`. Max. MaxRareFormsScanBatches batches are read.
+func (w *Worker) collectFrequentFormLines(
+	load concBatchLoader,
+	allowed map[string]bool,
+	args rdb.ConcQueryArgs,
+	codec textCodec,
+	ans *result.ConcResult,
+) error {
+	ans.Lines = make([]concordance.Line, 0, args.MaxItems)
+	ans.WideLines = nil
+	if args.WideContextStruct != "" {
+		ans.WideLines = make([]concordance.Line, 0, args.MaxItems)
+	}
 	parser := concordance.NewLineParser(args.Attrs)
-	ans.Lines = parser.Parse(concEx.Lines)
+	var numSkipped int
+	for batch := 0; len(ans.Lines) < args.MaxItems; batch++ {
+		if batch == MaxRareFormsScanBatches {
+			log.Warn().
+				Str("query", args.Query).
+				Int("scannedLines", batch*mango.MaxRecordsInternalLimit).
+				Int("foundLines", len(ans.Lines)).
+				Msg("minFormFreq filter reached the scan limit, returning incomplete lines")
+			break
+		}
+		concEx, err := load(batch * mango.MaxRecordsInternalLimit)
+		if err == mango.ErrRowsRangeOutOfConc {
+			break
+
+		} else if err != nil {
+			return err
+		}
+		var wideLines []concordance.Line
+		if args.WideContextStruct != "" {
+			wideLines = parseLines(parser, codec.linesFromCorpus(concEx.WideLines), w.maxRawLineLength)
+		}
+		for i, line := range parseLines(parser, codec.linesFromCorpus(concEx.Lines), w.maxRawLineLength) {
+			if !allowed[matchForm(line)] {
+				continue
+			}
+			if numSkipped < args.StartLine {
+				numSkipped++
+				continue
+			}
+			ans.Lines = append(ans.Lines, line)
+			if i < len(wideLines) {
+				ans.WideLines = append(ans.WideLines, wideLines[i])
+			}
+			if len(ans.Lines) == args.MaxItems {
+				break
+			}
+		}
+		if len(concEx.Lines) < mango.MaxRecordsInternalLimit {
+			break
+		}
+	}
+	return nil
+}
+
+// matchForm returns the word of the first matching token of a line
+func matchForm(line concordance.Line) string {
+	for _, token := range line.Text.Tokens() {
+		if token.Strong {
+			return token.Word
+		}
+	}
+	return ""
+}
+
+// PositionContext returns a KWIC line for a corpus position
+// or a structure number (see rdb.ConcQueryArgs.PositionStruct)
+func (w *Worker) PositionContext(args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+	ans = &result.ConcResult{}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.ConcResult{
+				Error: fmt.Errorf("%v", r),
+				Lines: make([]concordance.Line, 0),
+			}
+		}
+	}()
+	codec, err := newTextCodec(args.Encoding)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	concEx, err := mango.GetPositionContext(
+		args.CorpusPath,
+		args.Attrs,
+		args.PositionStruct,
+		args.Position,
+		args.MaxContext,
+	)
+	if err != nil {
+		ans.Error = err
+		return
+	}
 	ans.ConcSize = concEx.ConcSize
+	parser := concordance.NewLineParser(args.Attrs)
+	ans.Lines = parseLines(parser, codec.linesFromCorpus(concEx.Lines), w.maxRawLineLength)
+	return
+}
+
+// LemmaForms returns forms (see rdb.ConcQueryArgs.FormsAttr)
+// of the tokens matching the query along with their frequencies.
+// The query is expected to search for a lemma.
+func (w *Worker) LemmaForms(ctx context.Context, args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+	ans = &result.ConcResult{Query: args.Query}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.ConcResult{
+				Error: fmt.Errorf("%v", r),
+				Forms: make([]result.FacetItem, 0),
+			}
+		}
+	}()
+	codec, err := newTextCodec(args.Encoding)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	corpQuery, err := codec.toCorpus(args.Query)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	freqs, err := mango.GetFreqDist(
+		ctx,
+		args.CorpusPath,
+		corpQuery,
+		args.FormsAttr+" 0",
+		1,
+		args.MaxItems,
+	)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	ans.Forms = make([]result.FacetItem, len(freqs))
+	for i, item := range freqs {
+		ans.Forms[i] = result.FacetItem{
+			Value: codec.fromCorpus(item.Value),
+			Freq:  item.Freq,
+		}
+	}
+	return
+}
+
+// StructAttrValues returns values of a structural attribute
+// (see rdb.ConcQueryArgs.ScanAttr) along with numbers of structures
+// having the values. The values are stored in `Facets` under the
+// attribute name.
+func (w *Worker) StructAttrValues(ctx context.Context, args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+	ans = &result.ConcResult{}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.ConcResult{Error: fmt.Errorf("%v", r)}
+		}
+	}()
+	codec, err := newTextCodec(args.Encoding)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	structName, attrName, ok := strings.Cut(args.ScanAttr, ".")
+	if !ok {
+		ans.Error = fmt.Errorf("invalid structural attribute %s", args.ScanAttr)
+		return
+	}
+	fromValue, err := codec.toCorpus(args.ScanFrom)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	values, err := mango.GetStructAttrValues(
+		ctx,
+		args.CorpusPath,
+		structName,
+		attrName,
+		fromValue,
+		args.MaxItems,
+	)
+	if err != nil {
+		ans.Error = err
+		return
+	}
+	ans.Facets = map[string][]result.FacetItem{args.ScanAttr: decodeSortedValues(codec, values)}
+	return
+}
+
+// decodeSortedValues converts alphabetically sorted values obtained
+// from Manatee to UTF-8. As the corpus encoding may sort the values
+// differently, the decoded values are sorted again.
+func decodeSortedValues(codec textCodec, values []mango.GoFreqItem) []result.FacetItem {
+	items := make([]result.FacetItem, len(values))
+	for i, item := range values {
+		items[i] = result.FacetItem{
+			Value: codec.fromCorpus(item.Value),
+			Freq:  item.Freq,
+		}
+	}
+	if codec.enc != nil {
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Value < items[j].Value })
+	}
+	return items
+}
+
+// CorpusSize returns a size (number of tokens) of a corpus
+func (w *Worker) CorpusSize(args rdb.ConcQueryArgs) (ans *result.ConcResult) {
+	ans = &result.ConcResult{}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.ConcResult{Error: fmt.Errorf("%v", r)}
+		}
+	}()
+	ans.CorpusSize, ans.Error = mango.GetCorpusSize(args.CorpusPath)
 	return
 }
 
 func NewWorker(
 	ctx context.Context,
 	workerID string,
+	queues []string,
 	radapter *rdb.Adapter,
 	messages <-chan *redis.Message,
 	jobLogger jobLogger,
+	registryDir string,
+	maxRawLineLength int,
 ) *Worker {
 	return &Worker{
-		ID:        workerID,
-		radapter:  radapter,
-		messages:  messages,
-		ctx:       ctx,
-		ticker:    time.NewTicker(DefaultTickerInterval),
-		jobLogger: jobLogger,
+		ID:               workerID,
+		queues:           queues,
+		radapter:         radapter,
+		messages:         messages,
+		ctx:              ctx,
+		ticker:           time.NewTicker(DefaultTickerInterval),
+		jobLogger:        jobLogger,
+		registryDir:      registryDir,
+		maxRawLineLength: maxRawLineLength,
 	}
 }
@@ -0,0 +1,86 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package worker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/czcorpus/mquery-common/concordance"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+func createRawLine(ref int, word string) string {
+	return fmt.Sprintf("#%d %s %s {coll} /%s attr", ref, concordance.RefsEndMark, word, word)
+}
+
+func TestCollectFrequentFormLines(t *testing.T) {
+	words := []string{"cat", "dog", "dog", "cat", "dog", "dog"}
+	var numLoads int
+	load := func(fromLine int) (mango.GoConcordance, error) {
+		numLoads++
+		var ans mango.GoConcordance
+		for i, w := range words {
+			ans.Lines = append(ans.Lines, createRawLine(i, w))
+		}
+		return ans, nil
+	}
+	w := &Worker{}
+	ans := &result.ConcResult{}
+	args := rdb.ConcQueryArgs{Attrs: []string{"word", "lemma"}, StartLine: 1, MaxItems: 2}
+	err := w.collectFrequentFormLines(load, map[string]bool{"dog": true}, args, textCodec{}, ans)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, numLoads)
+	assert.Len(t, ans.Lines, 2)
+	assert.Equal(t, "#2", ans.Lines[0].Ref)
+	assert.Equal(t, "#4", ans.Lines[1].Ref)
+}
+
+func TestCollectFrequentFormLinesScanLimit(t *testing.T) {
+	var numLoads int
+	load := func(fromLine int) (mango.GoConcordance, error) {
+		numLoads++
+		var ans mango.GoConcordance
+		for i := 0; i < mango.MaxRecordsInternalLimit; i++ {
+			ans.Lines = append(ans.Lines, createRawLine(fromLine+i, "cat"))
+		}
+		return ans, nil
+	}
+	w := &Worker{}
+	ans := &result.ConcResult{}
+	args := rdb.ConcQueryArgs{Attrs: []string{"word", "lemma"}, MaxItems: 10}
+	err := w.collectFrequentFormLines(load, map[string]bool{"dog": true}, args, textCodec{}, ans)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxRareFormsScanBatches, numLoads)
+	assert.Empty(t, ans.Lines)
+}
+
+func TestValidateCorpusPath(t *testing.T) {
+	conf := &corpus.CorporaSetup{RegistryDir: "/var/lib/manatee/registry"}
+	w := &Worker{registryDir: conf.RegistryDir}
+	assert.NoError(t, w.validateCorpusPath(rdb.ConcQueryArgs{CorpusPath: conf.GetRegistryPath("syn2020")}))
+	for _, rsc := range []string{"../syn2020", "../../etc/passwd", "..", "."} {
+		err := w.validateCorpusPath(rdb.ConcQueryArgs{CorpusPath: conf.GetRegistryPath(rsc)})
+		assert.Error(t, err, rsc)
+	}
+}